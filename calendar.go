@@ -0,0 +1,336 @@
+package smtpmock
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CalendarAddress is the calendar user address of event organizer. Name is the
+// common name (CN parameter), it's equal to empty string for case when not specified
+type CalendarAddress struct {
+	Email string
+	Name  string
+}
+
+// CalendarAttendee is the event attendee with its participation parameters
+type CalendarAttendee struct {
+	Email    string
+	Name     string
+	Role     string
+	PartStat string
+	RSVP     bool
+}
+
+// CalendarRecurrenceRule is the parsed event RRULE. Interval is equal to 1 for case when
+// it's not specified, Count and Until are zero values for case when not specified. Parts
+// includes all rule parts as is, keyed by upper case part name
+type CalendarRecurrenceRule struct {
+	Frequency string
+	Interval  int
+	Count     int
+	Until     time.Time
+	ByDay     []string
+	Parts     map[string]string
+}
+
+// CalendarEvent is the VEVENT component of iCalendar object. Method is the METHOD of
+// enclosing calendar object or method parameter of text/calendar part. AllDay is true for
+// case when event start is date value. End is calculated from DURATION for case when
+// event has no DTEND. Error is the first error of event time zones resolution, for
+// example unknown TZID, time of such event is interpreted in UTC
+type CalendarEvent struct {
+	Method         string
+	UID            string
+	Sequence       int
+	Summary        string
+	Description    string
+	Location       string
+	Status         string
+	Organizer      CalendarAddress
+	Attendees      []CalendarAttendee
+	Start          time.Time
+	End            time.Time
+	AllDay         bool
+	RecurrenceRule *CalendarRecurrenceRule
+	Error          error
+}
+
+// iCalendar content line
+type calendarProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parses VEVENT components of iCalendar object. Properties of nested components
+// (for example VALARM) are skipped. Returns error for case when iCalendar object
+// is malformed
+func parseCalendarEvents(data, method string) ([]CalendarEvent, error) {
+	var components []string
+	var events []CalendarEvent
+	var durations []time.Duration
+
+	for _, line := range unfoldCalendarLines(data) {
+		property, err := parseCalendarProperty(line)
+		if err != nil {
+			return nil, err
+		}
+
+		currentComponent := emptyString
+		if len(components) > 0 {
+			currentComponent = components[len(components)-1]
+		}
+
+		switch {
+		case property.name == "BEGIN":
+			components = append(components, strings.ToUpper(property.value))
+			if strings.ToUpper(property.value) == calendarEventComponent {
+				events, durations = append(events, CalendarEvent{}), append(durations, 0)
+			}
+		case property.name == "END":
+			if currentComponent != strings.ToUpper(property.value) {
+				return nil, fmt.Errorf("%s: %s", malformedCalendarMsg, line)
+			}
+
+			components = components[:len(components)-1]
+		case currentComponent == calendarObjectComponent && property.name == "METHOD":
+			method = strings.ToUpper(property.value)
+		case currentComponent == calendarEventComponent:
+			duration, err := events[len(events)-1].setProperty(property)
+			if err != nil {
+				return nil, err
+			}
+
+			if property.name == "DURATION" {
+				durations[len(durations)-1] = duration
+			}
+		}
+	}
+
+	if len(components) > 0 {
+		return nil, fmt.Errorf("%s: %s is not terminated", malformedCalendarMsg, components[len(components)-1])
+	}
+
+	for index := range events {
+		events[index].Method = method
+		if events[index].End.IsZero() && durations[index] != 0 {
+			events[index].End = events[index].Start.Add(durations[index])
+		}
+	}
+
+	return events, nil
+}
+
+// Sets event field by the given property. Returns event duration for case when
+// property is DURATION. Unknown properties are skipped
+func (event *CalendarEvent) setProperty(property calendarProperty) (duration time.Duration, err error) {
+	switch property.name {
+	case "UID":
+		event.UID = unescapeCalendarText(property.value)
+	case "SEQUENCE":
+		event.Sequence, err = strconv.Atoi(property.value)
+	case "SUMMARY":
+		event.Summary = unescapeCalendarText(property.value)
+	case "DESCRIPTION":
+		event.Description = unescapeCalendarText(property.value)
+	case "LOCATION":
+		event.Location = unescapeCalendarText(property.value)
+	case "STATUS":
+		event.Status = strings.ToUpper(property.value)
+	case "ORGANIZER":
+		event.Organizer = CalendarAddress{Email: calendarAddressEmail(property.value), Name: property.params["CN"]}
+	case "ATTENDEE":
+		event.Attendees = append(event.Attendees, CalendarAttendee{
+			Email:    calendarAddressEmail(property.value),
+			Name:     property.params["CN"],
+			Role:     strings.ToUpper(property.params["ROLE"]),
+			PartStat: strings.ToUpper(property.params["PARTSTAT"]),
+			RSVP:     strings.EqualFold(property.params["RSVP"], "TRUE"),
+		})
+	case "DTSTART":
+		event.Start, event.AllDay, err = parseCalendarDateTime(property.value, event.location(property.params["TZID"]))
+	case "DTEND":
+		event.End, _, err = parseCalendarDateTime(property.value, event.location(property.params["TZID"]))
+	case "DURATION":
+		duration, err = parseCalendarDuration(property.value)
+	case "RRULE":
+		event.RecurrenceRule, err = parseCalendarRecurrenceRule(property.value)
+	}
+
+	return duration, err
+}
+
+// Returns location by TZID parameter. Keeps the first time zone error as event error,
+// UTC is used for case when time zone identifier is unknown
+func (event *CalendarEvent) location(tzid string) *time.Location {
+	location, err := calendarLocation(tzid)
+	if err != nil && event.Error == nil {
+		event.Error = err
+	}
+
+	return location
+}
+
+// Splits iCalendar data into unfolded content lines. Empty lines are skipped
+func unfoldCalendarLines(data string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n") {
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		if line != emptyString {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// Parses iCalendar content line. Property and parameter names are converted to upper
+// case, quoted parameter values are unquoted. Returns error for case when line is malformed
+func parseCalendarProperty(line string) (calendarProperty, error) {
+	var segments []string
+	quoted, segmentStart := false, 0
+
+	for index, char := range line {
+		switch {
+		case char == '"':
+			quoted = !quoted
+		case char == ';' && !quoted:
+			segments, segmentStart = append(segments, line[segmentStart:index]), index+1
+		case char == ':' && !quoted:
+			segments = append(segments, line[segmentStart:index])
+			property := calendarProperty{name: strings.ToUpper(segments[0]), params: map[string]string{}, value: line[index+1:]}
+
+			for _, param := range segments[1:] {
+				paramName, paramValue, found := cutString(param, "=")
+				if !found {
+					return calendarProperty{}, fmt.Errorf("%s: %s", malformedCalendarMsg, line)
+				}
+
+				property.params[strings.ToUpper(paramName)] = strings.Trim(paramValue, `"`)
+			}
+
+			if property.name == emptyString {
+				return calendarProperty{}, fmt.Errorf("%s: %s", malformedCalendarMsg, line)
+			}
+
+			return property, nil
+		}
+	}
+
+	return calendarProperty{}, fmt.Errorf("%s: %s", malformedCalendarMsg, line)
+}
+
+// Unescapes iCalendar TEXT value
+func unescapeCalendarText(value string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(value)
+}
+
+// Returns e-mail address from calendar user address URI
+func calendarAddressEmail(value string) string {
+	if len(value) >= len(calendarMailtoScheme) && strings.EqualFold(value[:len(calendarMailtoScheme)], calendarMailtoScheme) {
+		return value[len(calendarMailtoScheme):]
+	}
+
+	return value
+}
+
+// Returns location by TZID parameter. Returns UTC for case when time zone identifier is
+// empty. Returns UTC and error for case when time zone identifier is unknown
+func calendarLocation(tzid string) (*time.Location, error) {
+	if tzid == emptyString {
+		return time.UTC, nil
+	}
+
+	location, err := time.LoadLocation(tzid)
+	if err != nil {
+		return time.UTC, fmt.Errorf("%s: %s", unknownCalendarTimeZoneMsg, tzid)
+	}
+
+	return location, nil
+}
+
+// Parses iCalendar DATE or DATE-TIME value. Local date-time is interpreted in the given
+// location. Returns true for case when value is date
+func parseCalendarDateTime(value string, location *time.Location) (time.Time, bool, error) {
+	var parsedTime time.Time
+	var err error
+
+	switch {
+	case len(value) == len(calendarDateLayout):
+		parsedTime, err = time.ParseInLocation(calendarDateLayout, value, location)
+		return parsedTime, true, err
+	case strings.HasSuffix(value, "Z"):
+		parsedTime, err = time.Parse(calendarUTCDateTimeLayout, value)
+	default:
+		parsedTime, err = time.ParseInLocation(calendarDateTimeLayout, value, location)
+	}
+
+	return parsedTime, false, err
+}
+
+// Parses iCalendar DURATION value. Returns error for case when value is malformed
+func parseCalendarDuration(value string) (time.Duration, error) {
+	match := regexp.MustCompile(calendarDurationRegexPattern).FindStringSubmatch(strings.ToUpper(value))
+	if match == nil || strings.HasSuffix(match[0], "P") || strings.HasSuffix(match[0], "T") {
+		return 0, fmt.Errorf("%s: %s", malformedCalendarMsg, value)
+	}
+
+	var duration time.Duration
+	for index, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		amount, _ := strconv.Atoi(match[index+2])
+		duration += time.Duration(amount) * unit
+	}
+
+	if match[1] == "-" {
+		return -duration, nil
+	}
+
+	return duration, nil
+}
+
+// Parses iCalendar RECUR value. Returns error for case when rule has no frequency
+// or rule parts are malformed
+func parseCalendarRecurrenceRule(value string) (*CalendarRecurrenceRule, error) {
+	rule := &CalendarRecurrenceRule{Interval: 1, Parts: map[string]string{}}
+
+	for _, rulePart := range strings.Split(value, ";") {
+		name, partValue, found := cutString(rulePart, "=")
+		if !found {
+			return nil, fmt.Errorf("%s: %s", malformedCalendarMsg, value)
+		}
+
+		var err error
+		name = strings.ToUpper(name)
+		rule.Parts[name] = partValue
+
+		switch name {
+		case "FREQ":
+			rule.Frequency = strings.ToUpper(partValue)
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(partValue)
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(partValue)
+		case "UNTIL":
+			rule.Until, _, err = parseCalendarDateTime(partValue, time.UTC)
+		case "BYDAY":
+			rule.ByDay = strings.Split(strings.ToUpper(partValue), ",")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rule.Frequency == emptyString {
+		return nil, fmt.Errorf("%s: %s", malformedCalendarMsg, value)
+	}
+
+	return rule, nil
+}
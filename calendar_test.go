@@ -0,0 +1,373 @@
+package smtpmock
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // time zones of test calendar events don't depend on system time zone database
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns iCalendar meeting invitation with recurring event and cancelled all-day event
+func calendarInvitation() string {
+	return strings.Join(
+		[]string{
+			"BEGIN:VCALENDAR",
+			"PRODID:-//Example//Scheduler//EN",
+			"VERSION:2.0",
+			"METHOD:REQUEST",
+			"BEGIN:VEVENT",
+			"UID:event-1@example.com",
+			"SEQUENCE:2",
+			"SUMMARY:Weekly sync\\, planning",
+			"DESCRIPTION:Agenda:\\n1. Status",
+			"LOCATION:Room 1",
+			"STATUS:confirmed",
+			`ORGANIZER;CN="Organizer, Inc":MAILTO:organizer@example.com`,
+			"ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE;CN=Attendee One:ma",
+			" ilto:attendee1@example.com",
+			"ATTENDEE;ROLE=OPT-PARTICIPANT;PARTSTAT=accepted:mailto:attendee2@example.com",
+			"DTSTART;TZID=Europe/Berlin:20240102T100000",
+			"DURATION:PT1H30M",
+			"RRULE:FREQ=WEEKLY;INTERVAL=2;COUNT=10;BYDAY=MO,WE",
+			"BEGIN:VALARM",
+			"ACTION:DISPLAY",
+			"DESCRIPTION:Reminder",
+			"END:VALARM",
+			"END:VEVENT",
+			"BEGIN:VEVENT",
+			"UID:event-2@example.com",
+			"DTSTART;VALUE=DATE:20240105",
+			"DTEND;VALUE=DATE:20240106",
+			"RRULE:FREQ=DAILY;UNTIL=20240110T000000Z",
+			"END:VEVENT",
+			"END:VCALENDAR",
+			"",
+		},
+		"\r\n",
+	)
+}
+
+func TestParseCalendarEvents(t *testing.T) {
+	t.Run("returns parsed events", func(t *testing.T) {
+		location, _ := time.LoadLocation("Europe/Berlin")
+		events, err := parseCalendarEvents(calendarInvitation(), emptyString)
+		start, end := events[0].Start, events[0].End
+		events[0].Start, events[0].End = time.Time{}, time.Time{}
+
+		assert.NoError(t, err)
+		assert.True(t, time.Date(2024, 1, 2, 10, 0, 0, 0, location).Equal(start))
+		assert.Equal(t, "Europe/Berlin", start.Location().String())
+		assert.True(t, time.Date(2024, 1, 2, 11, 30, 0, 0, location).Equal(end))
+		assert.Equal(
+			t,
+			[]CalendarEvent{
+				{
+					Method:      "REQUEST",
+					UID:         "event-1@example.com",
+					Sequence:    2,
+					Summary:     "Weekly sync, planning",
+					Description: "Agenda:\n1. Status",
+					Location:    "Room 1",
+					Status:      "CONFIRMED",
+					Organizer:   CalendarAddress{Email: "organizer@example.com", Name: "Organizer, Inc"},
+					Attendees: []CalendarAttendee{
+						{Email: "attendee1@example.com", Name: "Attendee One", Role: "REQ-PARTICIPANT", PartStat: "NEEDS-ACTION", RSVP: true},
+						{Email: "attendee2@example.com", Role: "OPT-PARTICIPANT", PartStat: "ACCEPTED"},
+					},
+					RecurrenceRule: &CalendarRecurrenceRule{
+						Frequency: "WEEKLY",
+						Interval:  2,
+						Count:     10,
+						ByDay:     []string{"MO", "WE"},
+						Parts:     map[string]string{"FREQ": "WEEKLY", "INTERVAL": "2", "COUNT": "10", "BYDAY": "MO,WE"},
+					},
+				},
+				{
+					Method: "REQUEST",
+					UID:    "event-2@example.com",
+					Start:  time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+					End:    time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC),
+					AllDay: true,
+					RecurrenceRule: &CalendarRecurrenceRule{
+						Frequency: "DAILY",
+						Interval:  1,
+						Until:     time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC),
+						Parts:     map[string]string{"FREQ": "DAILY", "UNTIL": "20240110T000000Z"},
+					},
+				},
+			},
+			events,
+		)
+	})
+
+	t.Run("uses the given method for case when calendar has no METHOD property", func(t *testing.T) {
+		events, err := parseCalendarEvents("BEGIN:VEVENT\nUID:1\nEND:VEVENT\n", "CANCEL")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []CalendarEvent{{Method: "CANCEL", UID: "1"}}, events)
+	})
+
+	t.Run("when calendar has no events", func(t *testing.T) {
+		events, err := parseCalendarEvents("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n", emptyString)
+
+		assert.Nil(t, events)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when content line is malformed", func(t *testing.T) {
+		events, err := parseCalendarEvents("BEGIN:VCALENDAR\r\nmalformed\r\nEND:VCALENDAR\r\n", emptyString)
+
+		assert.Nil(t, events)
+		assert.EqualError(t, err, malformedCalendarMsg+": malformed")
+	})
+
+	t.Run("when component end doesn't match component begin", func(t *testing.T) {
+		events, err := parseCalendarEvents("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VCALENDAR\r\n", emptyString)
+
+		assert.Nil(t, events)
+		assert.EqualError(t, err, malformedCalendarMsg+": END:VCALENDAR")
+	})
+
+	t.Run("when component is not terminated", func(t *testing.T) {
+		events, err := parseCalendarEvents("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n", emptyString)
+
+		assert.Nil(t, events)
+		assert.EqualError(t, err, malformedCalendarMsg+": VEVENT is not terminated")
+	})
+
+	t.Run("when event property is malformed", func(t *testing.T) {
+		events, err := parseCalendarEvents("BEGIN:VEVENT\r\nSEQUENCE:a\r\nEND:VEVENT\r\n", emptyString)
+
+		assert.Nil(t, events)
+		assert.Error(t, err)
+	})
+}
+
+func TestCalendarEventSetProperty(t *testing.T) {
+	t.Run("returns duration for DURATION property", func(t *testing.T) {
+		event := new(CalendarEvent)
+		duration, err := event.setProperty(calendarProperty{name: "DURATION", value: "P1D"})
+
+		assert.Equal(t, 24*time.Hour, duration)
+		assert.NoError(t, err)
+	})
+
+	t.Run("sets end by DTEND property", func(t *testing.T) {
+		event := new(CalendarEvent)
+		duration, err := event.setProperty(calendarProperty{name: "DTEND", value: "20240102T100000Z"})
+
+		assert.Equal(t, time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC), event.End)
+		assert.Zero(t, duration)
+		assert.NoError(t, err)
+	})
+
+	t.Run("keeps the first time zone error, interprets time in UTC", func(t *testing.T) {
+		event := new(CalendarEvent)
+		_, startErr := event.setProperty(calendarProperty{name: "DTSTART", params: map[string]string{"TZID": "W. Europe Standard Time"}, value: "20240102T100000"})
+		_, endErr := event.setProperty(calendarProperty{name: "DTEND", params: map[string]string{"TZID": "Other Standard Time"}, value: "20240102T110000"})
+
+		assert.NoError(t, startErr)
+		assert.NoError(t, endErr)
+		assert.Equal(t, time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC), event.Start)
+		assert.Equal(t, time.Date(2024, 1, 2, 11, 0, 0, 0, time.UTC), event.End)
+		assert.EqualError(t, event.Error, unknownCalendarTimeZoneMsg+": W. Europe Standard Time")
+	})
+
+	t.Run("skips unknown property", func(t *testing.T) {
+		event := new(CalendarEvent)
+		duration, err := event.setProperty(calendarProperty{name: "X-UNKNOWN", value: "value"})
+
+		assert.Equal(t, new(CalendarEvent), event)
+		assert.Zero(t, duration)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when property value is malformed", func(t *testing.T) {
+		for _, name := range []string{"DTSTART", "DTEND", "DURATION", "RRULE"} {
+			_, err := new(CalendarEvent).setProperty(calendarProperty{name: name, value: "value"})
+
+			assert.Error(t, err)
+		}
+	})
+}
+
+func TestUnfoldCalendarLines(t *testing.T) {
+	t.Run("returns unfolded not empty lines", func(t *testing.T) {
+		assert.Equal(t, []string{"A:bc", "D:e\tf"}, unfoldCalendarLines("A:b\r\n c\r\n\r\nD:e\n \tf\n"))
+	})
+}
+
+func TestParseCalendarProperty(t *testing.T) {
+	t.Run("returns parsed property", func(t *testing.T) {
+		property, err := parseCalendarProperty(`attendee;cn="Name; Inc: Ltd";rsvp=TRUE:mailto:a@example.com`)
+
+		assert.Equal(
+			t,
+			calendarProperty{name: "ATTENDEE", params: map[string]string{"CN": "Name; Inc: Ltd", "RSVP": "TRUE"}, value: "mailto:a@example.com"},
+			property,
+		)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when value separator not found", func(t *testing.T) {
+		property, err := parseCalendarProperty(`NAME;PARAM="a:b"`)
+
+		assert.Equal(t, calendarProperty{}, property)
+		assert.EqualError(t, err, malformedCalendarMsg+`: NAME;PARAM="a:b"`)
+	})
+
+	t.Run("when parameter is malformed", func(t *testing.T) {
+		property, err := parseCalendarProperty("NAME;PARAM:value")
+
+		assert.Equal(t, calendarProperty{}, property)
+		assert.EqualError(t, err, malformedCalendarMsg+": NAME;PARAM:value")
+	})
+
+	t.Run("when property name is empty", func(t *testing.T) {
+		property, err := parseCalendarProperty(":value")
+
+		assert.Equal(t, calendarProperty{}, property)
+		assert.EqualError(t, err, malformedCalendarMsg+": :value")
+	})
+}
+
+func TestUnescapeCalendarText(t *testing.T) {
+	t.Run("returns unescaped text", func(t *testing.T) {
+		assert.Equal(t, "a\\n;b,c\nd\ne", unescapeCalendarText(`a\\n\;b\,c\nd\Ne`))
+	})
+}
+
+func TestCalendarAddressEmail(t *testing.T) {
+	t.Run("returns e-mail address from mailto URI", func(t *testing.T) {
+		assert.Equal(t, "user@example.com", calendarAddressEmail("MailTo:user@example.com"))
+	})
+
+	t.Run("returns address as is for case when it's not mailto URI", func(t *testing.T) {
+		assert.Equal(t, "urn:uuid:1", calendarAddressEmail("urn:uuid:1"))
+	})
+}
+
+func TestCalendarLocation(t *testing.T) {
+	t.Run("returns location by time zone identifier", func(t *testing.T) {
+		location, err := calendarLocation("Europe/Berlin")
+
+		assert.Equal(t, "Europe/Berlin", location.String())
+		assert.NoError(t, err)
+	})
+
+	t.Run("returns UTC for case when time zone identifier is empty", func(t *testing.T) {
+		location, err := calendarLocation(emptyString)
+
+		assert.Equal(t, time.UTC, location)
+		assert.NoError(t, err)
+	})
+
+	t.Run("returns UTC and error for case when time zone identifier is unknown", func(t *testing.T) {
+		location, err := calendarLocation("Unknown Standard Time")
+
+		assert.Equal(t, time.UTC, location)
+		assert.EqualError(t, err, unknownCalendarTimeZoneMsg+": Unknown Standard Time")
+	})
+}
+
+func TestParseCalendarDateTime(t *testing.T) {
+	location := time.FixedZone("test", 3600)
+
+	t.Run("when date value", func(t *testing.T) {
+		parsedTime, allDay, err := parseCalendarDateTime("20240102", location)
+
+		assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, location), parsedTime)
+		assert.True(t, allDay)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when UTC date-time value", func(t *testing.T) {
+		parsedTime, allDay, err := parseCalendarDateTime("20240102T030405Z", location)
+
+		assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), parsedTime)
+		assert.False(t, allDay)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when local date-time value", func(t *testing.T) {
+		parsedTime, allDay, err := parseCalendarDateTime("20240102T030405", location)
+
+		assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, location), parsedTime)
+		assert.False(t, allDay)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when value is malformed", func(t *testing.T) {
+		_, _, err := parseCalendarDateTime("2024-01-02", location)
+
+		assert.Error(t, err)
+	})
+}
+
+func TestParseCalendarDuration(t *testing.T) {
+	t.Run("returns parsed duration", func(t *testing.T) {
+		for value, expectedDuration := range map[string]time.Duration{
+			"P2W":         14 * 24 * time.Hour,
+			"+P1DT2H3M4S": 26*time.Hour + 3*time.Minute + 4*time.Second,
+			"-PT15M":      -15 * time.Minute,
+			"pt1h":        time.Hour,
+		} {
+			duration, err := parseCalendarDuration(value)
+
+			assert.Equal(t, expectedDuration, duration)
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("when value is malformed", func(t *testing.T) {
+		for _, value := range []string{"P", "PT", "P1DT", "1H", "PT1H1D"} {
+			duration, err := parseCalendarDuration(value)
+
+			assert.Zero(t, duration)
+			assert.EqualError(t, err, malformedCalendarMsg+": "+value)
+		}
+	})
+}
+
+func TestParseCalendarRecurrenceRule(t *testing.T) {
+	t.Run("returns parsed rule", func(t *testing.T) {
+		rule, err := parseCalendarRecurrenceRule("freq=monthly;bymonthday=1,15;byday=mo")
+
+		assert.Equal(
+			t,
+			&CalendarRecurrenceRule{
+				Frequency: "MONTHLY",
+				Interval:  1,
+				ByDay:     []string{"MO"},
+				Parts:     map[string]string{"FREQ": "monthly", "BYMONTHDAY": "1,15", "BYDAY": "mo"},
+			},
+			rule,
+		)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when rule part is malformed", func(t *testing.T) {
+		rule, err := parseCalendarRecurrenceRule("FREQ=DAILY;COUNT")
+
+		assert.Nil(t, rule)
+		assert.EqualError(t, err, malformedCalendarMsg+": FREQ=DAILY;COUNT")
+	})
+
+	t.Run("when rule part value is malformed", func(t *testing.T) {
+		for _, value := range []string{"FREQ=DAILY;INTERVAL=a", "FREQ=DAILY;COUNT=a", "FREQ=DAILY;UNTIL=a"} {
+			rule, err := parseCalendarRecurrenceRule(value)
+
+			assert.Nil(t, rule)
+			assert.Error(t, err)
+		}
+	})
+
+	t.Run("when rule has no frequency", func(t *testing.T) {
+		rule, err := parseCalendarRecurrenceRule("COUNT=1")
+
+		assert.Nil(t, rule)
+		assert.EqualError(t, err, malformedCalendarMsg+": COUNT=1")
+	})
+}
@@ -0,0 +1,253 @@
+package smtpmock
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Charset decoder converts data in some charset to UTF-8 string
+type charsetDecoder func([]byte) string
+
+// Supported charsets decoders, keyed by lower case charset name or alias
+var charsetDecoders = map[string]charsetDecoder{
+	"utf-8":        decodeUTF8,
+	"utf8":         decodeUTF8,
+	"us-ascii":     decodeUTF8,
+	"ascii":        decodeUTF8,
+	"iso-8859-1":   decodeLatin1,
+	"iso8859-1":    decodeLatin1,
+	"latin1":       decodeLatin1,
+	"iso-8859-15":  decodeISO885915,
+	"iso8859-15":   decodeISO885915,
+	"latin-9":      decodeISO885915,
+	"windows-1252": decodeWindows1252,
+	"cp1252":       decodeWindows1252,
+	"iso-2022-jp":  decodeISO2022JP,
+	"shift_jis":    decodeShiftJIS,
+	"shift-jis":    decodeShiftJIS,
+	"sjis":         decodeShiftJIS,
+	"euc-jp":       decodeEUCJP,
+}
+
+// ISO-2022-JP escape sequences (without leading ESC) and related modes
+var iso2022JPEscapeSequences = map[string]int{
+	"(B": iso2022JPModeASCII,
+	"(J": iso2022JPModeRoman,
+	"(I": iso2022JPModeKatakana,
+	"$@": iso2022JPModeJIS0208,
+	"$B": iso2022JPModeJIS0208,
+}
+
+// Lazy loaded JIS X 0208 table
+var (
+	jis0208Table     []rune
+	jis0208TableOnce sync.Once
+)
+
+// RFC 2047 encoded-words decoder with supported charsets
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// Converts data in the given charset to UTF-8 string. Data without charset is treated
+// as UTF-8. Returns error for case when charset is not supported
+func decodeCharset(charset string, data []byte) (string, error) {
+	if charset == emptyString {
+		return decodeUTF8(data), nil
+	}
+
+	decoder, ok := charsetDecoders[strings.ToLower(strings.TrimSpace(charset))]
+	if !ok {
+		return emptyString, fmt.Errorf("%s: %s", unsupportedCharsetMsg, charset)
+	}
+
+	return decoder(data), nil
+}
+
+// Charset reader for mime.WordDecoder. Returns reader with UTF-8 context
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := decodeCharset(charset, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.NewReader(text), nil
+}
+
+// Decodes RFC 2047 encoded-words in header value. Returns error for case when
+// encoded-word charset is not supported
+func decodeHeaderValue(value string) (string, error) {
+	return wordDecoder.DecodeHeader(value)
+}
+
+// Returns UTF-8 string, replaces invalid sequences with U+FFFD
+func decodeUTF8(data []byte) string {
+	return string(bytes.ToValidUTF8(data, []byte(string(utf8.RuneError))))
+}
+
+// Decodes ISO-8859-1 data
+func decodeLatin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for index, character := range data {
+		runes[index] = rune(character)
+	}
+
+	return string(runes)
+}
+
+// Decodes data with single byte charset table for upper half
+func decodeSingleByte(data []byte, table *[128]rune) string {
+	runes := make([]rune, len(data))
+	for index, character := range data {
+		runes[index] = rune(character)
+		if character >= 0x80 {
+			runes[index] = table[character-0x80]
+		}
+	}
+
+	return string(runes)
+}
+
+// Decodes ISO-8859-15 data
+func decodeISO885915(data []byte) string {
+	return decodeSingleByte(data, &iso885915Table)
+}
+
+// Decodes Windows-1252 data
+func decodeWindows1252(data []byte) string {
+	return decodeSingleByte(data, &windows1252Table)
+}
+
+// Returns JIS X 0208 character by row and cell numbers (1-94).
+// Returns U+FFFD for case when character not found
+func jis0208Rune(row, cell int) rune {
+	jis0208TableOnce.Do(func() { jis0208Table = []rune(jis0208TableData) })
+
+	if row < 1 || row > 94 || cell < 1 || cell > 94 {
+		return utf8.RuneError
+	}
+
+	return jis0208Table[(row-1)*94+cell-1]
+}
+
+// Returns JIS X 0201 half-width katakana character by its code (0x21-0x5F)
+func halfwidthKatakanaRune(code byte) rune {
+	return rune(0xFF61) + rune(code-0x21)
+}
+
+// Decodes ISO-2022-JP (RFC 1468) data
+func decodeISO2022JP(data []byte) string {
+	var runes []rune
+	mode := iso2022JPModeASCII
+
+	for index := 0; index < len(data); index++ {
+		character := data[index]
+
+		if character == 0x1B && index+2 < len(data) {
+			if sequenceMode, ok := iso2022JPEscapeSequences[string(data[index+1:index+3])]; ok {
+				mode, index = sequenceMode, index+2
+				continue
+			}
+		}
+
+		switch {
+		case character >= 0x80:
+			runes = append(runes, utf8.RuneError)
+		case mode == iso2022JPModeJIS0208 && character != '\r' && character != '\n':
+			if index+1 >= len(data) {
+				runes = append(runes, utf8.RuneError)
+				continue
+			}
+			runes = append(runes, jis0208Rune(int(character)-0x20, int(data[index+1])-0x20))
+			index++
+		case mode == iso2022JPModeKatakana && character >= 0x21 && character <= 0x5F:
+			runes = append(runes, halfwidthKatakanaRune(character))
+		case mode == iso2022JPModeRoman && character == 0x5C:
+			runes = append(runes, '¥')
+		case mode == iso2022JPModeRoman && character == 0x7E:
+			runes = append(runes, '‾')
+		default:
+			runes = append(runes, rune(character))
+		}
+	}
+
+	return string(runes)
+}
+
+// Decodes Shift_JIS data
+func decodeShiftJIS(data []byte) string {
+	var runes []rune
+
+	for index := 0; index < len(data); index++ {
+		lead := data[index]
+
+		switch {
+		case lead < 0x80:
+			runes = append(runes, rune(lead))
+		case lead >= 0xA1 && lead <= 0xDF:
+			runes = append(runes, halfwidthKatakanaRune(lead-0x80))
+		case ((lead >= 0x81 && lead <= 0x9F) || (lead >= 0xE0 && lead <= 0xEF)) && index+1 < len(data):
+			index++
+			runes = append(runes, shiftJISRune(lead, data[index]))
+		default:
+			runes = append(runes, utf8.RuneError)
+		}
+	}
+
+	return string(runes)
+}
+
+// Converts Shift_JIS double byte sequence to JIS X 0208 character
+func shiftJISRune(lead, trail byte) rune {
+	offset := int(lead) - 0x81
+	if lead >= 0xE0 {
+		offset = int(lead) - 0xC1
+	}
+
+	switch {
+	case trail >= 0x40 && trail <= 0x7E:
+		return jis0208Rune(offset*2+1, int(trail)-0x3F)
+	case trail >= 0x80 && trail <= 0x9E:
+		return jis0208Rune(offset*2+1, int(trail)-0x40)
+	case trail >= 0x9F && trail <= 0xFC:
+		return jis0208Rune(offset*2+2, int(trail)-0x9E)
+	default:
+		return utf8.RuneError
+	}
+}
+
+// Decodes EUC-JP data. JIS X 0212 characters are not supported and replaced with U+FFFD
+func decodeEUCJP(data []byte) string {
+	var runes []rune
+
+	for index := 0; index < len(data); index++ {
+		character := data[index]
+
+		switch {
+		case character < 0x80:
+			runes = append(runes, rune(character))
+		case character == 0x8E && index+1 < len(data):
+			index++
+			runes = append(runes, halfwidthKatakanaRune(data[index]-0x80))
+		case character == 0x8F && index+2 < len(data):
+			index += 2
+			runes = append(runes, utf8.RuneError)
+		case character >= 0xA1 && index+1 < len(data):
+			index++
+			runes = append(runes, jis0208Rune(int(character)-0xA0, int(data[index])-0xA0))
+		default:
+			runes = append(runes, utf8.RuneError)
+		}
+	}
+
+	return string(runes)
+}
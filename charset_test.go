@@ -0,0 +1,170 @@
+package smtpmock
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Reader which always fails
+type failedReader struct{}
+
+func (failedReader) Read([]byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func TestDecodeCharset(t *testing.T) {
+	t.Run("when charset is empty", func(t *testing.T) {
+		text, err := decodeCharset(emptyString, []byte("café"))
+
+		assert.Equal(t, "café", text)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when charset is supported", func(t *testing.T) {
+		text, err := decodeCharset(" ISO-8859-1 ", []byte("caf\xe9"))
+
+		assert.Equal(t, "café", text)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when charset is not supported", func(t *testing.T) {
+		text, err := decodeCharset("koi8-u", []byte("text"))
+
+		assert.Empty(t, text)
+		assert.EqualError(t, err, unsupportedCharsetMsg+": koi8-u")
+	})
+}
+
+func TestCharsetReader(t *testing.T) {
+	t.Run("returns reader with UTF-8 context", func(t *testing.T) {
+		reader, err := charsetReader("windows-1252", strings.NewReader("\x80"))
+		data, _ := ioutil.ReadAll(reader)
+
+		assert.Equal(t, "€", string(data))
+		assert.NoError(t, err)
+	})
+
+	t.Run("when charset is not supported", func(t *testing.T) {
+		reader, err := charsetReader("koi8-u", strings.NewReader("text"))
+
+		assert.Nil(t, reader)
+		assert.Error(t, err)
+	})
+
+	t.Run("when input read error", func(t *testing.T) {
+		reader, err := charsetReader("utf-8", failedReader{})
+
+		assert.Nil(t, reader)
+		assert.Error(t, err)
+	})
+}
+
+func TestDecodeHeaderValue(t *testing.T) {
+	t.Run("decodes encoded-words with supported charsets", func(t *testing.T) {
+		value, err := decodeHeaderValue("=?ISO-2022-JP?B?GyRCN29MPiVGJTklSBsoQg==?= =?windows-1252?Q?=80=75=72=6F?= =?UTF-8?B?8J+RiyE=?=")
+
+		assert.Equal(t, "件名テスト€uro👋!", value)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when encoded-word charset is not supported", func(t *testing.T) {
+		_, err := decodeHeaderValue("=?koi8-u?Q?text?=")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestDecodeUTF8(t *testing.T) {
+	t.Run("replaces invalid sequences", func(t *testing.T) {
+		assert.Equal(t, "a�b", decodeUTF8([]byte("a\xffb")))
+	})
+}
+
+func TestDecodeLatin1(t *testing.T) {
+	t.Run("decodes ISO-8859-1 data", func(t *testing.T) {
+		assert.Equal(t, "café ©", decodeLatin1([]byte("caf\xe9 \xa9")))
+	})
+}
+
+func TestDecodeISO885915(t *testing.T) {
+	t.Run("decodes ISO-8859-15 data", func(t *testing.T) {
+		assert.Equal(t, "a€Š", decodeISO885915([]byte("a\xa4\xa6")))
+	})
+}
+
+func TestDecodeWindows1252(t *testing.T) {
+	t.Run("decodes Windows-1252 data", func(t *testing.T) {
+		assert.Equal(t, "€‚ƒ café", decodeWindows1252([]byte("\x80\x82\x83\x20\x63\x61\x66\xe9")))
+	})
+}
+
+func TestJIS0208Rune(t *testing.T) {
+	t.Run("returns character by row and cell", func(t *testing.T) {
+		assert.Equal(t, '、', jis0208Rune(1, 2))
+		assert.Equal(t, '亜', jis0208Rune(16, 1))
+	})
+
+	t.Run("returns U+FFFD for unmapped character", func(t *testing.T) {
+		assert.Equal(t, utf8.RuneError, jis0208Rune(2, 15))
+	})
+
+	t.Run("returns U+FFFD for out of range character", func(t *testing.T) {
+		assert.Equal(t, utf8.RuneError, jis0208Rune(0, 1))
+		assert.Equal(t, utf8.RuneError, jis0208Rune(95, 1))
+		assert.Equal(t, utf8.RuneError, jis0208Rune(1, 0))
+		assert.Equal(t, utf8.RuneError, jis0208Rune(1, 95))
+	})
+}
+
+func TestDecodeISO2022JP(t *testing.T) {
+	t.Run("decodes ASCII and JIS X 0208 data", func(t *testing.T) {
+		data := "\x48\x69\x20\x1b\x24\x42\x24\x33\x24\x73\x24\x4b\x24\x41\x24\x4f\x1b\x28\x42\x0d\x0a\x1b\x24\x42\x40\x24\x33\x26\x1b\x28\x42"
+
+		assert.Equal(t, "Hi こんにちは\r\n世界", decodeISO2022JP([]byte(data)))
+	})
+
+	t.Run("decodes half-width katakana and JIS X 0201 Roman data", func(t *testing.T) {
+		assert.Equal(t, "ｱｲｳ¥‾a", decodeISO2022JP([]byte("\x1b(I123\x1b(J\x5c\x7ea")))
+	})
+
+	t.Run("replaces 8-bit and truncated characters", func(t *testing.T) {
+		assert.Equal(t, "��", decodeISO2022JP([]byte("\xa4\x1b$B$")))
+	})
+
+	t.Run("keeps unknown escape sequences", func(t *testing.T) {
+		assert.Equal(t, "\x1b(Z", decodeISO2022JP([]byte("\x1b(Z")))
+	})
+}
+
+func TestDecodeShiftJIS(t *testing.T) {
+	t.Run("decodes Shift_JIS data", func(t *testing.T) {
+		data := "\x82\xb1\x82\xf1\x82\xc9\x82\xbf\x82\xcd\x81\x41\x90\xa2\x8a\x45\x81\x49\xb1\xb2\xb3"
+
+		assert.Equal(t, "こんにちは、世界！ｱｲｳ", decodeShiftJIS([]byte(data)))
+	})
+
+	t.Run("decodes all trail byte ranges", func(t *testing.T) {
+		assert.Equal(t, "a漢字表熙堯", decodeShiftJIS([]byte("a\x8a\xbf\x8e\x9a\x95\x5c\xea\xa4\xea\x9f")))
+	})
+
+	t.Run("replaces invalid and truncated sequences", func(t *testing.T) {
+		assert.Equal(t, "���", decodeShiftJIS([]byte("\x81\x20\xf0\x82")))
+	})
+}
+
+func TestDecodeEUCJP(t *testing.T) {
+	t.Run("decodes EUC-JP data", func(t *testing.T) {
+		data := "\xa4\xb3\xa4\xf3\xa4\xcb\xa4\xc1\xa4\xcf\xa1\xa2\xc0\xa4\xb3\xa6\xa1\xaa\x8e\xb1\x8e\xb2\x8e\xb3"
+
+		assert.Equal(t, "こんにちは、世界！ｱｲｳ", decodeEUCJP([]byte(data)))
+	})
+
+	t.Run("replaces JIS X 0212, invalid and truncated sequences", func(t *testing.T) {
+		assert.Equal(t, "�a��", decodeEUCJP([]byte("\x8f\xb0\xa1a\x80\xa4")))
+	})
+}
@@ -4,18 +4,21 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	smtpmock "github.com/mocktools/go-smtp-mock/v2"
 	version "github.com/mocktools/go-smtp-mock/v2/cmd/version"
 )
 
 const (
-	responseDelayFlagInfo = " response delay in seconds. It runs immediately (equals to 0 seconds) by default"
+	responseDelayFlagInfo = " response delay in seconds or duration, e.g. 2 or 250ms. It runs immediately (equals to 0 seconds) by default"
 )
 
 var signals, logFatalf = make(chan os.Signal, 1), log.Fatalf
@@ -44,7 +47,11 @@ func run(args []string, options ...flag.ErrorHandling) error {
 		return nil
 	}
 
-	server := smtpmock.New(*configAttr)
+	server, err := smtpmock.Build(*configAttr)
+	if err != nil {
+		return err
+	}
+
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
 
 	if err := server.Start(); err != nil {
@@ -61,6 +68,53 @@ func toSlice(str string) []string {
 	return strings.Split(str, ",")
 }
 
+// Response delay flag value. Integer value is number of seconds, otherwise value is parsed
+// as duration, e.g. 250ms
+type delayValue time.Duration
+
+// Parses and sets flag value
+func (delay *delayValue) Set(value string) error {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		*delay = delayValue(time.Duration(seconds) * time.Second)
+		return nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	*delay = delayValue(duration)
+	return err
+}
+
+// Returns flag value as duration string
+func (delay *delayValue) String() string {
+	return time.Duration(*delay).String()
+}
+
+// Defines response delay flag with the given name and usage. Returns pointer to flag value
+func durationFlag(flags *flag.FlagSet, name, usage string) *time.Duration {
+	delay := new(time.Duration)
+	flags.Var((*delayValue)(delay), name, usage)
+	return delay
+}
+
+// Reads file context by path. Returns empty string for case when path is empty
+func readFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	return string(data), err
+}
+
+// Loads scenario by path. Returns nil scenario for case when path is empty
+func loadScenario(path string) (*smtpmock.Scenario, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	return smtpmock.LoadScenario(path)
+}
+
 // Prints to stdout current smtpmock version data
 func printVersionData(writer io.Writer) {
 	for _, item := range [3]string{
@@ -72,7 +126,8 @@ func printVersionData(writer io.Writer) {
 	}
 }
 
-// Creates pointer to ConfigurationAttr based on passed command line arguments
+// Creates pointer to ConfigurationAttr based on passed command line arguments. Returns error
+// for case when arguments can't be parsed
 func attrFromCommandLine(args []string, options ...flag.ErrorHandling) (bool, *smtpmock.ConfigurationAttr, error) {
 	failureScenario := flag.ExitOnError
 	if len(options) > 0 {
@@ -90,18 +145,37 @@ func attrFromCommandLine(args []string, options ...flag.ErrorHandling) (bool, *s
 		failFast                      = flags.Bool("failFast", false, "Enables fail fast scenario. Disabled by default")
 		multipleRcptto                = flags.Bool("multipleRcptto", false, "Enables multiple RCPT TO receiving scenario. Disabled by default")
 		multipleMessageReceiving      = flags.Bool("multipleMessageReceiving", false, "Enables multiple message receiving scenario. Disabled by default")
+		prependReceivedHeader         = flags.Bool("prependReceivedHeader", false, "Enables prepending Received header to stored messages. Disabled by default")
+		receivedHeaderTemplate        = flags.String("receivedHeaderTemplate", "", "Custom Received header template")
+		validateMessage               = flags.Bool("validateMessage", false, "Enables RFC 5322 message validation. Disabled by default")
+		rejectInvalidMessage          = flags.Bool("rejectInvalidMessage", false, "Enables rejection of messages which failed RFC 5322 validation. Disabled by default")
+		smimeCertificates             = flags.String("smimeCertificates", "", "Path to PEM file with trusted S/MIME certificates")
+		smimePrivateKeys              = flags.String("smimePrivateKeys", "", "Path to PEM file with S/MIME RSA private keys")
+		pgpKeyRing                    = flags.String("pgpKeyRing", "", "Path to ASCII armored OpenPGP key ring")
 		blacklistedHeloDomains        = flags.String("blacklistedHeloDomains", "", "Blacklisted HELO domains, separated by commas")
 		blacklistedMailfromEmails     = flags.String("blacklistedMailfromEmails", "", "Blacklisted MAIL FROM emails, separated by commas")
 		blacklistedRcpttoEmails       = flags.String("blacklistedRcpttoEmails", "", "Blacklisted RCPT TO emails, separated by commas")
 		notRegisteredEmails           = flags.String("notRegisteredEmails", "", "Not registered (non-existent) RCPT TO emails, separated by commas")
-		responseDelayHelo             = flags.Int("responseDelayHelo", 0, "HELO"+responseDelayFlagInfo)
-		responseDelayMailfrom         = flags.Int("responseDelayMailfrom", 0, "MAIL FROM"+responseDelayFlagInfo)
-		responseDelayRcptto           = flags.Int("responseDelayRcptto", 0, "RCPT TO"+responseDelayFlagInfo)
-		responseDelayData             = flags.Int("responseDelayData", 0, "DATA"+responseDelayFlagInfo)
-		responseDelayMessage          = flags.Int("responseDelayMessage", 0, "Message"+responseDelayFlagInfo)
-		responseDelayRset             = flags.Int("responseDelayRset", 0, "RSET"+responseDelayFlagInfo)
-		responseDelayNoop             = flags.Int("responseDelayNoop", 0, "NOOP"+responseDelayFlagInfo)
-		responseDelayQuit             = flags.Int("responseDelayQuit", 0, "QUIT"+responseDelayFlagInfo)
+		greylisting                   = flags.Bool("greylisting", false, "Enables RCPT TO greylisting of (IP, sender, recipient) triplets. Disabled by default")
+		greylistingDelay              = flags.Int("greylistingDelay", 0, "Greylisting minimum delay in seconds. It's equal to 0 seconds by default")
+		maxSessions                   = flags.Int("maxSessions", 0, "Concurrent sessions limit. Unlimited by default")
+		maxSessionsPerIP              = flags.Int("maxSessionsPerIP", 0, "Total sessions per remote IP limit. Unlimited by default")
+		maxMessagesPerWindow          = flags.Int("maxMessagesPerWindow", 0, "MAIL FROM attempts per rate limit window limit. Unlimited by default")
+		maxRcpttosPerWindow           = flags.Int("maxRcpttosPerWindow", 0, "RCPT TO attempts per rate limit window limit. Unlimited by default")
+		rateLimitWindow               = flags.Int("rateLimitWindow", 0, "Rate limit sliding window in seconds. It's equal to 60 seconds by default")
+		responseDelayGreeting         = durationFlag(flags, "responseDelayGreeting", "Greeting"+responseDelayFlagInfo)
+		responseDelayHelo             = durationFlag(flags, "responseDelayHelo", "HELO"+responseDelayFlagInfo)
+		responseDelayMailfrom         = durationFlag(flags, "responseDelayMailfrom", "MAIL FROM"+responseDelayFlagInfo)
+		responseDelayRcptto           = durationFlag(flags, "responseDelayRcptto", "RCPT TO"+responseDelayFlagInfo)
+		responseDelayData             = durationFlag(flags, "responseDelayData", "DATA"+responseDelayFlagInfo)
+		responseDelayMessage          = durationFlag(flags, "responseDelayMessage", "Message"+responseDelayFlagInfo)
+		responseDelayRset             = durationFlag(flags, "responseDelayRset", "RSET"+responseDelayFlagInfo)
+		responseDelayNoop             = durationFlag(flags, "responseDelayNoop", "NOOP"+responseDelayFlagInfo)
+		responseDelayQuit             = durationFlag(flags, "responseDelayQuit", "QUIT"+responseDelayFlagInfo)
+		responseDelayJitter           = durationFlag(flags, "responseDelayJitter", "Response delay jitter in seconds or duration, e.g. 2 or 250ms. Disabled by default")
+		jitterDistribution            = flags.String("jitterDistribution", "", "Response delay jitter distribution: uniform or normal. It's equal to uniform by default")
+		scenarioPath                  = flags.String("scenario", "", "Path to JSON or YAML (.yaml, .yml) scenario file which replaces the built-in session flow")
+		randomSeed                    = flags.Int64("randomSeed", 0, "Seed of random source used by faults and jitter. It's based on current time by default")
 		msgSizeLimit                  = flags.Int("msgSizeLimit", 0, "Message body size limit in bytes. It's equal to 10485760 bytes")
 		msgGreeting                   = flags.String("msgGreeting", "", "Custom server greeting message")
 		msgInvalidCmd                 = flags.String("msgInvalidCmd", "", "Custom invalid command message")
@@ -113,26 +187,44 @@ func attrFromCommandLine(args []string, options ...flag.ErrorHandling) (bool, *s
 		msgInvalidCmdMailfromArg      = flags.String("msgInvalidCmdMailfromArg", "", "Custom invalid command MAIL FROM argument message")
 		msgMailfromBlacklistedEmail   = flags.String("msgMailfromBlacklistedEmail", "", "Custom MAIL FROM blacklisted email message")
 		msgMailfromReceived           = flags.String("msgMailfromReceived", "", "Custom MAIL FROM received message")
+		msgMailfromRateLimit          = flags.String("msgMailfromRateLimit", "", "Custom MAIL FROM rate limit message")
 		msgInvalidCmdRcpttoSequence   = flags.String("msgInvalidCmdRcpttoSequence", "", "Custom invalid command RCPT TO sequence message")
 		msgInvalidCmdRcpttoArg        = flags.String("msgInvalidCmdRcpttoArg", "", "Custom invalid command RCPT TO argument message")
 		msgRcpttoNotRegisteredEmail   = flags.String("msgRcpttoNotRegisteredEmail", "", "Custom RCPT TO not registered email message")
 		msgRcpttoBlacklistedEmail     = flags.String("msgRcpttoBlacklistedEmail", "", "Custom RCPT TO blacklisted email message")
 		msgRcpttoReceived             = flags.String("msgRcpttoReceived", "", "Custom RCPT TO received message")
+		msgRcpttoGreylisted           = flags.String("msgRcpttoGreylisted", "", "Custom RCPT TO greylisted message")
+		msgRcpttoRateLimit            = flags.String("msgRcpttoRateLimit", "", "Custom RCPT TO rate limit message")
 		msgInvalidCmdDataSequence     = flags.String("msgInvalidCmdDataSequence", "", "Custom invalid command DATA sequence message")
 		msgDataReceived               = flags.String("msgDataReceived", "", "Custom DATA received message")
 		msgMsgSizeIsTooBig            = flags.String("msgMsgSizeIsTooBig", "", "Custom size is too big message")
 		msgMsgReceived                = flags.String("msgMsgReceived", "", "Custom received message body message")
+		msgMsgInvalid                 = flags.String("msgMsgInvalid", "", "Custom invalid message body message")
 		msgInvalidCmdRsetSequence     = flags.String("msgInvalidCmdRsetSequence", "", "Custom invalid command RSET sequence message")
 		msgInvalidCmdRsetArg          = flags.String("msgInvalidCmdRsetArg", "", "Custom invalid command RSET message")
 		msgRsetReceived               = flags.String("msgRsetReceived", "", "Custom RSET received message")
 		msgNoopReceived               = flags.String("msgNoopReceived", "", "Custom NOOP received message")
 		msgQuitCmd                    = flags.String("msgQuitCmd", "", "Custom QUIT command message")
+		msgSessionLimit               = flags.String("msgSessionLimit", "", "Custom sessions limit greeting message")
 	)
 	if err := flags.Parse(args[1:]); err != nil {
 		return *ver, nil, err
 	}
 
-	return *ver, &smtpmock.ConfigurationAttr{
+	var keys [3]string
+	for index, path := range [3]string{*smimeCertificates, *smimePrivateKeys, *pgpKeyRing} {
+		var err error
+		if keys[index], err = readFile(path); err != nil {
+			return *ver, nil, err
+		}
+	}
+
+	scenario, err := loadScenario(*scenarioPath)
+	if err != nil {
+		return *ver, nil, err
+	}
+
+	configAttr := &smtpmock.ConfigurationAttr{
 		HostAddress:                   *host,
 		PortNumber:                    *port,
 		LogToStdout:                   *log,
@@ -142,18 +234,37 @@ func attrFromCommandLine(args []string, options ...flag.ErrorHandling) (bool, *s
 		IsCmdFailFast:                 *failFast,
 		MultipleRcptto:                *multipleRcptto,
 		MultipleMessageReceiving:      *multipleMessageReceiving,
+		PrependReceivedHeader:         *prependReceivedHeader,
+		ReceivedHeaderTemplate:        *receivedHeaderTemplate,
+		ValidateMessage:               *validateMessage,
+		RejectInvalidMessage:          *rejectInvalidMessage,
+		SMIMECertificates:             keys[0],
+		SMIMEPrivateKeys:              keys[1],
+		PGPKeyRing:                    keys[2],
 		BlacklistedHeloDomains:        toSlice(*blacklistedHeloDomains),
 		BlacklistedMailfromEmails:     toSlice(*blacklistedMailfromEmails),
 		BlacklistedRcpttoEmails:       toSlice(*blacklistedRcpttoEmails),
 		NotRegisteredEmails:           toSlice(*notRegisteredEmails),
-		ResponseDelayHelo:             *responseDelayHelo,
-		ResponseDelayMailfrom:         *responseDelayMailfrom,
-		ResponseDelayRcptto:           *responseDelayRcptto,
-		ResponseDelayData:             *responseDelayData,
-		ResponseDelayMessage:          *responseDelayMessage,
-		ResponseDelayRset:             *responseDelayRset,
-		ResponseDelayNoop:             *responseDelayNoop,
-		ResponseDelayQuit:             *responseDelayQuit,
+		Greylisting:                   *greylisting,
+		GreylistingDelay:              *greylistingDelay,
+		MaxSessions:                   *maxSessions,
+		MaxSessionsPerIP:              *maxSessionsPerIP,
+		MaxMessagesPerWindow:          *maxMessagesPerWindow,
+		MaxRcpttosPerWindow:           *maxRcpttosPerWindow,
+		RateLimitWindow:               *rateLimitWindow,
+		ResponseDelayGreetingDuration: *responseDelayGreeting,
+		ResponseDelayHeloDuration:     *responseDelayHelo,
+		ResponseDelayMailfromDuration: *responseDelayMailfrom,
+		ResponseDelayRcpttoDuration:   *responseDelayRcptto,
+		ResponseDelayDataDuration:     *responseDelayData,
+		ResponseDelayMessageDuration:  *responseDelayMessage,
+		ResponseDelayRsetDuration:     *responseDelayRset,
+		ResponseDelayNoopDuration:     *responseDelayNoop,
+		ResponseDelayQuitDuration:     *responseDelayQuit,
+		ResponseDelayJitterDuration:   *responseDelayJitter,
+		JitterDistribution:            smtpmock.JitterDistribution(*jitterDistribution),
+		Scenario:                      scenario,
+		RandomSeed:                    *randomSeed,
 		MsgSizeLimit:                  *msgSizeLimit,
 		MsgGreeting:                   *msgGreeting,
 		MsgInvalidCmd:                 *msgInvalidCmd,
@@ -165,19 +276,26 @@ func attrFromCommandLine(args []string, options ...flag.ErrorHandling) (bool, *s
 		MsgInvalidCmdMailfromArg:      *msgInvalidCmdMailfromArg,
 		MsgMailfromBlacklistedEmail:   *msgMailfromBlacklistedEmail,
 		MsgMailfromReceived:           *msgMailfromReceived,
+		MsgMailfromRateLimit:          *msgMailfromRateLimit,
 		MsgInvalidCmdRcpttoSequence:   *msgInvalidCmdRcpttoSequence,
 		MsgInvalidCmdRcpttoArg:        *msgInvalidCmdRcpttoArg,
 		MsgRcpttoNotRegisteredEmail:   *msgRcpttoNotRegisteredEmail,
 		MsgRcpttoBlacklistedEmail:     *msgRcpttoBlacklistedEmail,
 		MsgRcpttoReceived:             *msgRcpttoReceived,
+		MsgRcpttoGreylisted:           *msgRcpttoGreylisted,
+		MsgRcpttoRateLimit:            *msgRcpttoRateLimit,
 		MsgInvalidCmdDataSequence:     *msgInvalidCmdDataSequence,
 		MsgDataReceived:               *msgDataReceived,
 		MsgMsgSizeIsTooBig:            *msgMsgSizeIsTooBig,
 		MsgMsgReceived:                *msgMsgReceived,
+		MsgMsgInvalid:                 *msgMsgInvalid,
 		MsgInvalidCmdRsetSequence:     *msgInvalidCmdRsetSequence,
 		MsgInvalidCmdRsetArg:          *msgInvalidCmdRsetArg,
 		MsgRsetReceived:               *msgRsetReceived,
 		MsgNoopReceived:               *msgNoopReceived,
 		MsgQuitCmd:                    *msgQuitCmd,
-	}, nil
+		MsgSessionLimit:               *msgSessionLimit,
+	}
+
+	return *ver, configAttr, nil
 }
@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"errors"
 	"flag"
+	"io/ioutil"
 	"log"
 	"os"
 	"strconv"
 	"syscall"
 	"testing"
+	"time"
 
+	smtpmock "github.com/mocktools/go-smtp-mock/v2"
 	version "github.com/mocktools/go-smtp-mock/v2/cmd/version"
 	"github.com/stretchr/testify/assert"
 )
@@ -39,6 +42,10 @@ func TestRun(t *testing.T) {
 		assert.Error(t, run([]string{path, "-port=a"}, flag.ContinueOnError))
 	})
 
+	t.Run("when configuration attributes are invalid", func(t *testing.T) {
+		assert.Error(t, run([]string{path, "-receivedHeaderTemplate={{.HeloDomain"}))
+	})
+
 	t.Run("when server starting error", func(t *testing.T) {
 		assert.Error(t, run([]string{path, "-host=a"}))
 	})
@@ -72,6 +79,45 @@ func TestToSlice(t *testing.T) {
 	})
 }
 
+func TestReadFile(t *testing.T) {
+	t.Run("when path is empty", func(t *testing.T) {
+		context, err := readFile("")
+
+		assert.Empty(t, context)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when file exists", func(t *testing.T) {
+		context, err := readFile("main.go")
+
+		assert.Contains(t, context, "package main")
+		assert.NoError(t, err)
+	})
+
+	t.Run("when file not exists", func(t *testing.T) {
+		context, err := readFile("not-existent-file")
+
+		assert.Empty(t, context)
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadScenario(t *testing.T) {
+	t.Run("when path is empty", func(t *testing.T) {
+		scenario, err := loadScenario("")
+
+		assert.Nil(t, scenario)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when scenario file exists", func(t *testing.T) {
+		scenario, err := loadScenario("../../testdata/scenario/submission.json")
+
+		assert.Equal(t, "start", scenario.InitialState)
+		assert.NoError(t, err)
+	})
+}
+
 func TestPrintVersionData(t *testing.T) {
 	t.Run("", func(t *testing.T) {
 		bytesBuffer := new(bytes.Buffer)
@@ -94,6 +140,17 @@ func TestAttrFromCommandLine(t *testing.T) {
 		blacklistedMailfromEmails := "a@a.com,b@b.com"
 		blacklistedRcpttoEmails := "c@a.com,d@b.com"
 		notRegisteredEmails := "non-existent@a.com"
+		greylistingDelay := 300
+		maxSessions, maxSessionsPerIP, maxMessagesPerWindow, maxRcpttosPerWindow, rateLimitWindow := 1, 2, 3, 4, 5
+		receivedHeaderTemplate := "Received: from {{.HeloDomain}}"
+		fileContext := func(path string) string {
+			data, _ := ioutil.ReadFile(path)
+			return string(data)
+		}
+		smimeCertificates := "../../testdata/security/smime_ca.crt"
+		smimePrivateKeys := "../../testdata/security/smime_user.key"
+		pgpKeyRing := "../../testdata/security/pgp_secret.asc"
+		responseDelayGreeting := "250ms"
 		responseDelayHelo := 1
 		responseDelayMailfrom := 2
 		responseDelayRcptto := 3
@@ -102,6 +159,10 @@ func TestAttrFromCommandLine(t *testing.T) {
 		responseDelayRset := 6
 		responseDelayNoop := 7
 		responseDelayQuit := 8
+		responseDelayJitter := "1.5s"
+		jitterDistribution := "normal"
+		scenarioPath := "../../testdata/scenario/submission.json"
+		randomSeed := int64(42)
 		msgSizeLimit := 1000
 		msgGreeting := "msgGreeting"
 		msgInvalidCmd := "msgInvalidCmd"
@@ -113,18 +174,23 @@ func TestAttrFromCommandLine(t *testing.T) {
 		msgInvalidCmdMailfromArg := "msgInvalidCmdMailfromArg"
 		msgMailfromBlacklistedEmail := "msgMailfromBlacklistedEmail"
 		msgMailfromReceived := "msgMailfromReceived"
+		msgMailfromRateLimit := "msgMailfromRateLimit"
 		msgInvalidCmdRcpttoSequence := "msgInvalidCmdRcpttoSequence"
 		msgInvalidCmdRcpttoArg := "msgInvalidCmdRcpttoArg"
 		msgRcpttoNotRegisteredEmail := "msgRcpttoNotRegisteredEmail"
 		msgRcpttoBlacklistedEmail := "msgRcpttoBlacklistedEmail"
 		msgRcpttoReceived := "msgRcpttoReceived"
+		msgRcpttoGreylisted := "msgRcpttoGreylisted"
+		msgRcpttoRateLimit := "msgRcpttoRateLimit"
 		msgInvalidCmdDataSequence := "msgInvalidCmdDataSequence"
 		msgDataReceived := "msgDataReceived"
 		msgMsgSizeIsTooBig := "msgMsgSizeIsTooBig"
 		msgMsgReceived := "msgMsgReceived"
+		msgMsgInvalid := "msgMsgInvalid"
 		msgRsetReceived := "msgRsetReceived"
 		msgNoopReceived := "msgNoopReceived"
 		msgQuitCmd := "msgQuitCmd"
+		msgSessionLimit := "msgSessionLimit"
 		ver, configAttr, err := attrFromCommandLine(
 			[]string{
 				"some-path-to-the-program",
@@ -137,10 +203,25 @@ func TestAttrFromCommandLine(t *testing.T) {
 				"-failFast",
 				"-multipleRcptto",
 				"-multipleMessageReceiving",
+				"-prependReceivedHeader",
+				"-receivedHeaderTemplate=" + receivedHeaderTemplate,
+				"-validateMessage",
+				"-rejectInvalidMessage",
+				"-smimeCertificates=" + smimeCertificates,
+				"-smimePrivateKeys=" + smimePrivateKeys,
+				"-pgpKeyRing=" + pgpKeyRing,
 				"-blacklistedHeloDomains=" + blacklistedHeloDomains,
 				"-blacklistedMailfromEmails=" + blacklistedMailfromEmails,
 				"-blacklistedRcpttoEmails=" + blacklistedRcpttoEmails,
 				"-notRegisteredEmails=" + notRegisteredEmails,
+				"-greylisting",
+				"-greylistingDelay=" + strconv.Itoa(greylistingDelay),
+				"-maxSessions=" + strconv.Itoa(maxSessions),
+				"-maxSessionsPerIP=" + strconv.Itoa(maxSessionsPerIP),
+				"-maxMessagesPerWindow=" + strconv.Itoa(maxMessagesPerWindow),
+				"-maxRcpttosPerWindow=" + strconv.Itoa(maxRcpttosPerWindow),
+				"-rateLimitWindow=" + strconv.Itoa(rateLimitWindow),
+				"-responseDelayGreeting=" + responseDelayGreeting,
 				"-responseDelayHelo=" + strconv.Itoa(responseDelayHelo),
 				"-responseDelayMailfrom=" + strconv.Itoa(responseDelayMailfrom),
 				"-responseDelayRcptto=" + strconv.Itoa(responseDelayRcptto),
@@ -149,6 +230,10 @@ func TestAttrFromCommandLine(t *testing.T) {
 				"-responseDelayRset=" + strconv.Itoa(responseDelayRset),
 				"-responseDelayNoop=" + strconv.Itoa(responseDelayNoop),
 				"-responseDelayQuit=" + strconv.Itoa(responseDelayQuit),
+				"-responseDelayJitter=" + responseDelayJitter,
+				"-jitterDistribution=" + jitterDistribution,
+				"-scenario=" + scenarioPath,
+				"-randomSeed=" + strconv.FormatInt(randomSeed, 10),
 				"-msgSizeLimit=" + strconv.Itoa(msgSizeLimit),
 				"-msgGreeting=" + msgGreeting,
 				"-msgInvalidCmd=" + msgInvalidCmd,
@@ -160,18 +245,23 @@ func TestAttrFromCommandLine(t *testing.T) {
 				"-msgInvalidCmdMailfromArg=" + msgInvalidCmdMailfromArg,
 				"-msgMailfromBlacklistedEmail=" + msgMailfromBlacklistedEmail,
 				"-msgMailfromReceived=" + msgMailfromReceived,
+				"-msgMailfromRateLimit=" + msgMailfromRateLimit,
 				"-msgInvalidCmdRcpttoSequence=" + msgInvalidCmdRcpttoSequence,
 				"-msgInvalidCmdRcpttoArg=" + msgInvalidCmdRcpttoArg,
 				"-msgRcpttoNotRegisteredEmail=" + msgRcpttoNotRegisteredEmail,
 				"-msgRcpttoBlacklistedEmail=" + msgRcpttoBlacklistedEmail,
 				"-msgRcpttoReceived=" + msgRcpttoReceived,
+				"-msgRcpttoGreylisted=" + msgRcpttoGreylisted,
+				"-msgRcpttoRateLimit=" + msgRcpttoRateLimit,
 				"-msgInvalidCmdDataSequence=" + msgInvalidCmdDataSequence,
 				"-msgDataReceived=" + msgDataReceived,
 				"-msgMsgSizeIsTooBig=" + msgMsgSizeIsTooBig,
 				"-msgMsgReceived=" + msgMsgReceived,
+				"-msgMsgInvalid=" + msgMsgInvalid,
 				"-msgRsetReceived=" + msgRsetReceived,
 				"-msgNoopReceived=" + msgNoopReceived,
 				"-msgQuitCmd=" + msgQuitCmd,
+				"-msgSessionLimit=" + msgSessionLimit,
 			},
 		)
 
@@ -185,18 +275,37 @@ func TestAttrFromCommandLine(t *testing.T) {
 		assert.True(t, configAttr.IsCmdFailFast)
 		assert.True(t, configAttr.MultipleRcptto)
 		assert.True(t, configAttr.MultipleMessageReceiving)
+		assert.True(t, configAttr.PrependReceivedHeader)
+		assert.Equal(t, receivedHeaderTemplate, configAttr.ReceivedHeaderTemplate)
+		assert.True(t, configAttr.ValidateMessage)
+		assert.True(t, configAttr.RejectInvalidMessage)
+		assert.Equal(t, fileContext(smimeCertificates), configAttr.SMIMECertificates)
+		assert.Equal(t, fileContext(smimePrivateKeys), configAttr.SMIMEPrivateKeys)
+		assert.Equal(t, fileContext(pgpKeyRing), configAttr.PGPKeyRing)
 		assert.Equal(t, toSlice(blacklistedHeloDomains), configAttr.BlacklistedHeloDomains)
 		assert.Equal(t, toSlice(blacklistedMailfromEmails), configAttr.BlacklistedMailfromEmails)
 		assert.Equal(t, toSlice(blacklistedRcpttoEmails), configAttr.BlacklistedRcpttoEmails)
 		assert.Equal(t, toSlice(notRegisteredEmails), configAttr.NotRegisteredEmails)
-		assert.Equal(t, responseDelayHelo, configAttr.ResponseDelayHelo)
-		assert.Equal(t, responseDelayMailfrom, configAttr.ResponseDelayMailfrom)
-		assert.Equal(t, responseDelayRcptto, configAttr.ResponseDelayRcptto)
-		assert.Equal(t, responseDelayData, configAttr.ResponseDelayData)
-		assert.Equal(t, responseDelayMessage, configAttr.ResponseDelayMessage)
-		assert.Equal(t, responseDelayRset, configAttr.ResponseDelayRset)
-		assert.Equal(t, responseDelayNoop, configAttr.ResponseDelayNoop)
-		assert.Equal(t, responseDelayQuit, configAttr.ResponseDelayQuit)
+		assert.True(t, configAttr.Greylisting)
+		assert.Equal(t, greylistingDelay, configAttr.GreylistingDelay)
+		assert.Equal(t, maxSessions, configAttr.MaxSessions)
+		assert.Equal(t, maxSessionsPerIP, configAttr.MaxSessionsPerIP)
+		assert.Equal(t, maxMessagesPerWindow, configAttr.MaxMessagesPerWindow)
+		assert.Equal(t, maxRcpttosPerWindow, configAttr.MaxRcpttosPerWindow)
+		assert.Equal(t, rateLimitWindow, configAttr.RateLimitWindow)
+		assert.Equal(t, 250*time.Millisecond, configAttr.ResponseDelayGreetingDuration)
+		assert.Equal(t, time.Duration(responseDelayHelo)*time.Second, configAttr.ResponseDelayHeloDuration)
+		assert.Equal(t, time.Duration(responseDelayMailfrom)*time.Second, configAttr.ResponseDelayMailfromDuration)
+		assert.Equal(t, time.Duration(responseDelayRcptto)*time.Second, configAttr.ResponseDelayRcpttoDuration)
+		assert.Equal(t, time.Duration(responseDelayData)*time.Second, configAttr.ResponseDelayDataDuration)
+		assert.Equal(t, time.Duration(responseDelayMessage)*time.Second, configAttr.ResponseDelayMessageDuration)
+		assert.Equal(t, time.Duration(responseDelayRset)*time.Second, configAttr.ResponseDelayRsetDuration)
+		assert.Equal(t, time.Duration(responseDelayNoop)*time.Second, configAttr.ResponseDelayNoopDuration)
+		assert.Equal(t, time.Duration(responseDelayQuit)*time.Second, configAttr.ResponseDelayQuitDuration)
+		assert.Equal(t, 1500*time.Millisecond, configAttr.ResponseDelayJitterDuration)
+		assert.Equal(t, smtpmock.NormalJitter, configAttr.JitterDistribution)
+		assert.Equal(t, "220 mx.example.com ESMTP", configAttr.Scenario.Greeting.Response)
+		assert.Equal(t, randomSeed, configAttr.RandomSeed)
 		assert.Equal(t, msgSizeLimit, configAttr.MsgSizeLimit)
 		assert.Equal(t, msgGreeting, configAttr.MsgGreeting)
 		assert.Equal(t, msgInvalidCmd, configAttr.MsgInvalidCmd)
@@ -208,21 +317,50 @@ func TestAttrFromCommandLine(t *testing.T) {
 		assert.Equal(t, msgInvalidCmdMailfromArg, configAttr.MsgInvalidCmdMailfromArg)
 		assert.Equal(t, msgMailfromBlacklistedEmail, configAttr.MsgMailfromBlacklistedEmail)
 		assert.Equal(t, msgMailfromReceived, configAttr.MsgMailfromReceived)
+		assert.Equal(t, msgMailfromRateLimit, configAttr.MsgMailfromRateLimit)
 		assert.Equal(t, msgInvalidCmdRcpttoSequence, configAttr.MsgInvalidCmdRcpttoSequence)
 		assert.Equal(t, msgInvalidCmdRcpttoArg, configAttr.MsgInvalidCmdRcpttoArg)
 		assert.Equal(t, msgRcpttoNotRegisteredEmail, configAttr.MsgRcpttoNotRegisteredEmail)
 		assert.Equal(t, msgRcpttoBlacklistedEmail, configAttr.MsgRcpttoBlacklistedEmail)
 		assert.Equal(t, msgRcpttoReceived, configAttr.MsgRcpttoReceived)
+		assert.Equal(t, msgRcpttoGreylisted, configAttr.MsgRcpttoGreylisted)
+		assert.Equal(t, msgRcpttoRateLimit, configAttr.MsgRcpttoRateLimit)
 		assert.Equal(t, msgInvalidCmdDataSequence, configAttr.MsgInvalidCmdDataSequence)
 		assert.Equal(t, msgDataReceived, configAttr.MsgDataReceived)
 		assert.Equal(t, msgMsgSizeIsTooBig, configAttr.MsgMsgSizeIsTooBig)
 		assert.Equal(t, msgMsgReceived, configAttr.MsgMsgReceived)
+		assert.Equal(t, msgMsgInvalid, configAttr.MsgMsgInvalid)
 		assert.Equal(t, msgRsetReceived, configAttr.MsgRsetReceived)
 		assert.Equal(t, msgNoopReceived, configAttr.MsgNoopReceived)
 		assert.Equal(t, msgQuitCmd, configAttr.MsgQuitCmd)
+		assert.Equal(t, msgSessionLimit, configAttr.MsgSessionLimit)
 		assert.NoError(t, err)
 	})
 
+	t.Run("when key file can't be read", func(t *testing.T) {
+		ver, configAttr, err := attrFromCommandLine([]string{"some-path-to-the-program", "-pgpKeyRing=not-existent-file"}, flag.ContinueOnError)
+
+		assert.False(t, ver)
+		assert.Nil(t, configAttr)
+		assert.Error(t, err)
+	})
+
+	t.Run("when scenario file can't be loaded", func(t *testing.T) {
+		ver, configAttr, err := attrFromCommandLine([]string{"some-path-to-the-program", "-scenario=not-existent-file"}, flag.ContinueOnError)
+
+		assert.False(t, ver)
+		assert.Nil(t, configAttr)
+		assert.Error(t, err)
+	})
+
+	t.Run("when response delay is invalid", func(t *testing.T) {
+		ver, configAttr, err := attrFromCommandLine([]string{"some-path-to-the-program", "-responseDelayHelo=2x"}, flag.ContinueOnError)
+
+		assert.False(t, ver)
+		assert.Nil(t, configAttr)
+		assert.Error(t, err)
+	})
+
 	t.Run("when unknown flags found sends exit signal", func(t *testing.T) {
 		ver, configAttr, err := attrFromCommandLine([]string{"some-path-to-the-program", "-notKnownFlag"}, flag.ContinueOnError)
 
@@ -231,3 +369,42 @@ func TestAttrFromCommandLine(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestDelayValueSet(t *testing.T) {
+	t.Run("when value is number of seconds", func(t *testing.T) {
+		delay := new(delayValue)
+
+		assert.NoError(t, delay.Set("2"))
+		assert.Equal(t, delayValue(2*time.Second), *delay)
+	})
+
+	t.Run("when value is duration", func(t *testing.T) {
+		delay := new(delayValue)
+
+		assert.NoError(t, delay.Set("250ms"))
+		assert.Equal(t, delayValue(250*time.Millisecond), *delay)
+	})
+
+	t.Run("when value is invalid", func(t *testing.T) {
+		assert.Error(t, new(delayValue).Set("2x"))
+	})
+}
+
+func TestDelayValueString(t *testing.T) {
+	t.Run("returns flag value as duration string", func(t *testing.T) {
+		delay := delayValue(1500 * time.Millisecond)
+
+		assert.Equal(t, "1.5s", delay.String())
+	})
+}
+
+func TestDurationFlag(t *testing.T) {
+	t.Run("defines response delay flag, returns pointer to flag value", func(t *testing.T) {
+		flags := flag.NewFlagSet("some-path-to-the-program", flag.ContinueOnError)
+		delay := durationFlag(flags, "delay", "usage")
+
+		assert.NoError(t, flags.Parse([]string{"-delay=3"}))
+		assert.Equal(t, 3*time.Second, *delay)
+		assert.Equal(t, "usage", flags.Lookup("delay").Usage)
+	})
+}
@@ -0,0 +1,77 @@
+package smtpmock
+
+import (
+	"errors"
+	"time"
+)
+
+// CommandHandler is the custom SMTP command handler. Registered command handler is run for
+// each request which starts with its command verb, e.g. ETRN, and takes precedence over the
+// built-in handler of the same verb
+type CommandHandler interface {
+	Handle(context *CommandContext)
+}
+
+// CommandHandlerFunc is the adapter which allows to use ordinary function as CommandHandler
+type CommandHandlerFunc func(context *CommandContext)
+
+// Handle calls commandHandlerFunc(context)
+func (commandHandlerFunc CommandHandlerFunc) Handle(context *CommandContext) {
+	commandHandlerFunc(context)
+}
+
+// CommandContext is the context of command handler and middleware run: request, tentative
+// response, session metadata and current session message
+type CommandContext struct {
+	Request       string        // request line, e.g. "ETRN example.com"
+	Command       string        // upper cased command verb, e.g. "ETRN"
+	Response      string        // tentative response, it's written after middleware chain, empty response is not written
+	ResponseDelay time.Duration // tentative response delay
+	SessionID     int           // session identifier
+	RemoteAddress string        // remote address of SMTP client
+	Message       *Message      // current session message
+	session       sessionInterface
+	configuration *configuration
+	isEnded       bool
+}
+
+// Command context builder. Returns pointer to new command context of the given request
+func newCommandContext(session sessionInterface, message *Message, configuration *configuration, command, request string) *CommandContext {
+	return &CommandContext{
+		Request:       request,
+		Command:       command,
+		SessionID:     message.sessionID,
+		RemoteAddress: session.remoteAddress(),
+		Message:       message,
+		session:       session,
+		configuration: configuration,
+	}
+}
+
+// CommandContext methods
+
+// WriteResponse writes response with the given delay to session and saves request and
+// response into message. Response of HELO, EHLO, MAIL, RCPT, DATA, RSET, NOOP and QUIT
+// commands is saved into message fields of this command, response of other commands is
+// available via Message.CustomRequestResponse(). Negative response is session error, so
+// it ends session for case when fail fast scenario is enabled
+func (context *CommandContext) WriteResponse(response string, delay time.Duration) {
+	if isNegativeCompletionReply(response) {
+		context.session.addError(errors.New(response))
+	}
+
+	context.Message.record(context.Command, context.Request, response)
+	context.session.writeResponse(response, delay)
+}
+
+// ReceiveMessage reads message body until lone period and saves it into message like DATA
+// command does, then writes the given response with the given delay. Message size limit,
+// validation and Received header settings are applied to message body
+func (context *CommandContext) ReceiveMessage(response string, delay time.Duration) {
+	receiveMessage(context.session, context.Message, context.configuration, response, delay)
+}
+
+// EndSession ends session after command handler and middleware chain run
+func (context *CommandContext) EndSession() {
+	context.isEnded = true
+}
@@ -0,0 +1,87 @@
+package smtpmock
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandHandlerFuncHandle(t *testing.T) {
+	t.Run("calls function with command context", func(t *testing.T) {
+		var handledContext *CommandContext
+		context := new(CommandContext)
+		CommandHandlerFunc(func(context *CommandContext) { handledContext = context }).Handle(context)
+
+		assert.Same(t, context, handledContext)
+	})
+}
+
+func TestNewCommandContext(t *testing.T) {
+	t.Run("returns new command context", func(t *testing.T) {
+		session, message, configuration := &sessionMock{}, &Message{sessionID: 42}, createConfiguration()
+		session.On("remoteAddress").Once().Return("127.0.0.1:2525")
+		context := newCommandContext(session, message, configuration, "ETRN", "ETRN example.com")
+
+		assert.True(t, session.AssertExpectations(t))
+		assert.Equal(t, "ETRN example.com", context.Request)
+		assert.Equal(t, "ETRN", context.Command)
+		assert.Equal(t, 42, context.SessionID)
+		assert.Equal(t, "127.0.0.1:2525", context.RemoteAddress)
+		assert.Same(t, message, context.Message)
+		assert.Same(t, session, context.session)
+		assert.Same(t, configuration, context.configuration)
+		assert.False(t, context.isEnded)
+	})
+}
+
+func TestCommandContextWriteResponse(t *testing.T) {
+	t.Run("when response is positive, writes response and saves it into message", func(t *testing.T) {
+		session, message := &sessionMock{}, new(Message)
+		context := &CommandContext{Request: "HELO example.com", Command: "HELO", Message: message, session: session}
+		session.On("writeResponse", "250 Hi", time.Second).Once().Return(nil)
+		context.WriteResponse("250 Hi", time.Second)
+
+		assert.True(t, session.AssertExpectations(t))
+		assert.Equal(t, "HELO example.com", message.HeloRequest())
+		assert.Equal(t, "250 Hi", message.HeloResponse())
+		assert.True(t, message.Helo())
+	})
+
+	t.Run("when response is negative, adds session error", func(t *testing.T) {
+		session, message := &sessionMock{}, new(Message)
+		context := &CommandContext{Request: "ETRN example.com", Command: "ETRN", Message: message, session: session}
+		session.On("addError", errors.New("458 Unable to queue")).Once().Return(nil)
+		session.On("writeResponse", "458 Unable to queue", defaultSessionResponseDelay).Once().Return(nil)
+		context.WriteResponse("458 Unable to queue", defaultSessionResponseDelay)
+
+		assert.True(t, session.AssertExpectations(t))
+		assert.Equal(t, [][]string{{"ETRN example.com", "458 Unable to queue"}}, message.CustomRequestResponse())
+	})
+}
+
+func TestCommandContextReceiveMessage(t *testing.T) {
+	t.Run("reads message body, saves it into message and writes response", func(t *testing.T) {
+		session, message := &sessionMock{}, new(Message)
+		context := &CommandContext{Message: message, session: session, configuration: createConfiguration()}
+		session.On("readBytes").Once().Return([]uint8("Message body\r\n"), nil)
+		session.On("readBytes").Once().Return([]uint8(".\r\n"), nil)
+		session.On("writeResponse", "250 Queued", time.Second).Once().Return(nil)
+		context.ReceiveMessage("250 Queued", time.Second)
+
+		assert.True(t, session.AssertExpectations(t))
+		assert.Equal(t, "Message body\r\n", message.MsgRequest())
+		assert.Equal(t, "250 Queued", message.MsgResponse())
+		assert.True(t, message.Msg())
+	})
+}
+
+func TestCommandContextEndSession(t *testing.T) {
+	t.Run("requests end of session", func(t *testing.T) {
+		context := new(CommandContext)
+		context.EndSession()
+
+		assert.True(t, context.isEnded)
+	})
+}
@@ -1,6 +1,10 @@
 package smtpmock
 
-import "fmt"
+import (
+	"fmt"
+	"text/template"
+	"time"
+)
 
 // SMTP mock configuration structure. Provides to configure mock behavior
 type configuration struct {
@@ -11,9 +15,15 @@ type configuration struct {
 	isCmdFailFast                 bool
 	multipleRcptto                bool
 	multipleMessageReceiving      bool
+	prependReceivedHeader         bool
+	receivedHeaderTemplate        *template.Template
+	validateMessage               bool
+	rejectInvalidMessage          bool
+	securityKeyRing               *securityKeyRing
 	msgGreeting                   string
 	msgInvalidCmd                 string
 	msgQuitCmd                    string
+	msgSessionLimit               string
 	msgInvalidCmdHeloSequence     string
 	msgInvalidCmdHeloArg          string
 	msgHeloBlacklistedDomain      string
@@ -22,15 +32,19 @@ type configuration struct {
 	msgInvalidCmdMailfromArg      string
 	msgMailfromBlacklistedEmail   string
 	msgMailfromReceived           string
+	msgMailfromRateLimit          string
 	msgInvalidCmdRcpttoSequence   string
 	msgInvalidCmdRcpttoArg        string
 	msgRcpttoNotRegisteredEmail   string
 	msgRcpttoBlacklistedEmail     string
 	msgRcpttoReceived             string
+	msgRcpttoGreylisted           string
+	msgRcpttoRateLimit            string
 	msgInvalidCmdDataSequence     string
 	msgDataReceived               string
 	msgMsgSizeIsTooBig            string
 	msgMsgReceived                string
+	msgMsgInvalid                 string
 	msgInvalidCmdRsetSequence     string
 	msgInvalidCmdRsetArg          string
 	msgRsetReceived               string
@@ -39,14 +53,29 @@ type configuration struct {
 	blacklistedMailfromEmails     []string
 	blacklistedRcpttoEmails       []string
 	notRegisteredEmails           []string
-	responseDelayHelo             int
-	responseDelayMailfrom         int
-	responseDelayRcptto           int
-	responseDelayData             int
-	responseDelayMessage          int
-	responseDelayRset             int
-	responseDelayNoop             int
-	responseDelayQuit             int
+	greylisting                   bool
+	greylistingDelay              int
+	maxSessions                   int
+	maxSessionsPerIP              int
+	maxMessagesPerWindow          int
+	maxRcpttosPerWindow           int
+	rateLimitWindow               int
+	rules                         []*rule
+	responseSequences             []ResponseSequence
+	faults                        []*fault
+	scenario                      *scenario
+	randomSeed                    int64
+	responseDelayGreeting         time.Duration
+	responseDelayHelo             time.Duration
+	responseDelayMailfrom         time.Duration
+	responseDelayRcptto           time.Duration
+	responseDelayData             time.Duration
+	responseDelayMessage          time.Duration
+	responseDelayRset             time.Duration
+	responseDelayNoop             time.Duration
+	responseDelayQuit             time.Duration
+	responseDelayJitter           time.Duration
+	jitterDistribution            JitterDistribution
 	msgSizeLimit                  int
 	sessionTimeout                int
 	shutdownTimeout               int
@@ -54,10 +83,52 @@ type configuration struct {
 	// TODO: add ability to send 221 response before end of session for case when fail fast scenario enabled
 }
 
-// New configuration builder. Returns pointer to valid new configuration structure
+// New configuration builder. Returns pointer to valid new configuration structure. Panics
+// for case when configuration attributes are invalid, these can be checked beforehand
+// with ConfigurationAttr.Validate
 func newConfiguration(config ConfigurationAttr) *configuration {
+	configuration, err := buildConfiguration(config)
+	if err != nil {
+		panic(err)
+	}
+
+	return configuration
+}
+
+// Configuration builder. Returns pointer to new configuration structure or error for case
+// when configuration attributes are invalid
+func buildConfiguration(config ConfigurationAttr) (*configuration, error) {
 	config.assignDefaultValues()
 
+	receivedHeaderTemplate, err := newReceivedHeaderTemplate(config.ReceivedHeaderTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	securityKeyRing, err := newSecurityKeyRing(config.SMIMECertificates, config.SMIMEPrivateKeys, config.PGPKeyRing)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := newRules(config.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	faults, err := newFaults(config.Faults, time.Duration(config.SessionTimeout)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateJitterDistribution(config.JitterDistribution); err != nil {
+		return nil, err
+	}
+
+	scenario, err := newScenario(config.Scenario, &config)
+	if err != nil {
+		return nil, err
+	}
+
 	return &configuration{
 		hostAddress:                   config.HostAddress,
 		portNumber:                    config.PortNumber,
@@ -66,6 +137,11 @@ func newConfiguration(config ConfigurationAttr) *configuration {
 		isCmdFailFast:                 config.IsCmdFailFast,
 		multipleRcptto:                config.MultipleRcptto,
 		multipleMessageReceiving:      config.MultipleMessageReceiving,
+		prependReceivedHeader:         config.PrependReceivedHeader,
+		receivedHeaderTemplate:        receivedHeaderTemplate,
+		validateMessage:               config.ValidateMessage,
+		rejectInvalidMessage:          config.RejectInvalidMessage,
+		securityKeyRing:               securityKeyRing,
 		msgGreeting:                   config.MsgGreeting,
 		msgInvalidCmd:                 config.MsgInvalidCmd,
 		msgInvalidCmdHeloSequence:     config.MsgInvalidCmdHeloSequence,
@@ -76,36 +152,66 @@ func newConfiguration(config ConfigurationAttr) *configuration {
 		msgInvalidCmdMailfromArg:      config.MsgInvalidCmdMailfromArg,
 		msgMailfromBlacklistedEmail:   config.MsgMailfromBlacklistedEmail,
 		msgMailfromReceived:           config.MsgMailfromReceived,
+		msgMailfromRateLimit:          config.MsgMailfromRateLimit,
 		msgInvalidCmdRcpttoSequence:   config.MsgInvalidCmdRcpttoSequence,
 		msgInvalidCmdRcpttoArg:        config.MsgInvalidCmdRcpttoArg,
 		msgRcpttoNotRegisteredEmail:   config.MsgRcpttoNotRegisteredEmail,
 		msgRcpttoBlacklistedEmail:     config.MsgRcpttoBlacklistedEmail,
 		msgRcpttoReceived:             config.MsgRcpttoReceived,
+		msgRcpttoGreylisted:           config.MsgRcpttoGreylisted,
+		msgRcpttoRateLimit:            config.MsgRcpttoRateLimit,
 		msgInvalidCmdDataSequence:     config.MsgInvalidCmdDataSequence,
 		msgDataReceived:               config.MsgDataReceived,
 		msgMsgSizeIsTooBig:            config.MsgMsgSizeIsTooBig,
 		msgMsgReceived:                config.MsgMsgReceived,
+		msgMsgInvalid:                 config.MsgMsgInvalid,
 		msgInvalidCmdRsetSequence:     config.MsgInvalidCmdRsetSequence,
 		msgInvalidCmdRsetArg:          config.MsgInvalidCmdRsetArg,
 		msgRsetReceived:               config.MsgRsetReceived,
 		msgNoopReceived:               config.MsgNoopReceived,
 		msgQuitCmd:                    config.MsgQuitCmd,
+		msgSessionLimit:               config.MsgSessionLimit,
 		blacklistedHeloDomains:        config.BlacklistedHeloDomains,
 		blacklistedMailfromEmails:     config.BlacklistedMailfromEmails,
 		blacklistedRcpttoEmails:       config.BlacklistedRcpttoEmails,
 		notRegisteredEmails:           config.NotRegisteredEmails,
-		responseDelayHelo:             config.ResponseDelayHelo,
-		responseDelayMailfrom:         config.ResponseDelayMailfrom,
-		responseDelayRcptto:           config.ResponseDelayRcptto,
-		responseDelayData:             config.ResponseDelayData,
-		responseDelayMessage:          config.ResponseDelayMessage,
-		responseDelayRset:             config.ResponseDelayRset,
-		responseDelayNoop:             config.ResponseDelayNoop,
-		responseDelayQuit:             config.ResponseDelayQuit,
+		greylisting:                   config.Greylisting,
+		greylistingDelay:              config.GreylistingDelay,
+		maxSessions:                   config.MaxSessions,
+		maxSessionsPerIP:              config.MaxSessionsPerIP,
+		maxMessagesPerWindow:          config.MaxMessagesPerWindow,
+		maxRcpttosPerWindow:           config.MaxRcpttosPerWindow,
+		rateLimitWindow:               config.RateLimitWindow,
+		rules:                         rules,
+		responseSequences:             config.ResponseSequences,
+		faults:                        faults,
+		scenario:                      scenario,
+		randomSeed:                    config.RandomSeed,
+		responseDelayGreeting:         responseDelay(config.ResponseDelayGreeting, config.ResponseDelayGreetingDuration),
+		responseDelayHelo:             responseDelay(config.ResponseDelayHelo, config.ResponseDelayHeloDuration),
+		responseDelayMailfrom:         responseDelay(config.ResponseDelayMailfrom, config.ResponseDelayMailfromDuration),
+		responseDelayRcptto:           responseDelay(config.ResponseDelayRcptto, config.ResponseDelayRcpttoDuration),
+		responseDelayData:             responseDelay(config.ResponseDelayData, config.ResponseDelayDataDuration),
+		responseDelayMessage:          responseDelay(config.ResponseDelayMessage, config.ResponseDelayMessageDuration),
+		responseDelayRset:             responseDelay(config.ResponseDelayRset, config.ResponseDelayRsetDuration),
+		responseDelayNoop:             responseDelay(config.ResponseDelayNoop, config.ResponseDelayNoopDuration),
+		responseDelayQuit:             responseDelay(config.ResponseDelayQuit, config.ResponseDelayQuitDuration),
+		responseDelayJitter:           responseDelay(config.ResponseDelayJitter, config.ResponseDelayJitterDuration),
+		jitterDistribution:            config.JitterDistribution,
 		msgSizeLimit:                  config.MsgSizeLimit,
 		sessionTimeout:                config.SessionTimeout,
 		shutdownTimeout:               config.ShutdownTimeout,
+	}, nil
+}
+
+// Returns response delay duration for case when it's specified, otherwise returns response
+// delay in seconds as duration
+func responseDelay(seconds int, duration time.Duration) time.Duration {
+	if duration != 0 {
+		return duration
 	}
+
+	return time.Duration(seconds) * time.Second
 }
 
 // ConfigurationAttr kwargs structure for configuration builder
@@ -117,9 +223,17 @@ type ConfigurationAttr struct {
 	IsCmdFailFast                 bool
 	MultipleRcptto                bool
 	MultipleMessageReceiving      bool
+	PrependReceivedHeader         bool
+	ReceivedHeaderTemplate        string
+	ValidateMessage               bool
+	RejectInvalidMessage          bool
+	SMIMECertificates             string
+	SMIMEPrivateKeys              string
+	PGPKeyRing                    string
 	MsgGreeting                   string
 	MsgInvalidCmd                 string
 	MsgQuitCmd                    string
+	MsgSessionLimit               string
 	MsgInvalidCmdHeloSequence     string
 	MsgInvalidCmdHeloArg          string
 	MsgHeloBlacklistedDomain      string
@@ -128,15 +242,19 @@ type ConfigurationAttr struct {
 	MsgInvalidCmdMailfromArg      string
 	MsgMailfromBlacklistedEmail   string
 	MsgMailfromReceived           string
+	MsgMailfromRateLimit          string
 	MsgInvalidCmdRcpttoSequence   string
 	MsgInvalidCmdRcpttoArg        string
 	MsgRcpttoNotRegisteredEmail   string
 	MsgRcpttoBlacklistedEmail     string
 	MsgRcpttoReceived             string
+	MsgRcpttoGreylisted           string
+	MsgRcpttoRateLimit            string
 	MsgInvalidCmdDataSequence     string
 	MsgDataReceived               string
 	MsgMsgSizeIsTooBig            string
 	MsgMsgReceived                string
+	MsgMsgInvalid                 string
 	MsgInvalidCmdRsetSequence     string
 	MsgInvalidCmdRsetArg          string
 	MsgRsetReceived               string
@@ -145,14 +263,39 @@ type ConfigurationAttr struct {
 	BlacklistedMailfromEmails     []string
 	BlacklistedRcpttoEmails       []string
 	NotRegisteredEmails           []string
+	Greylisting                   bool
+	GreylistingDelay              int
+	MaxSessions                   int
+	MaxSessionsPerIP              int
+	MaxMessagesPerWindow          int
+	MaxRcpttosPerWindow           int
+	RateLimitWindow               int
+	Rules                         []Rule
+	ResponseSequences             []ResponseSequence
+	Faults                        []Fault
+	Scenario                      *Scenario
+	RandomSeed                    int64
+	ResponseDelayGreeting         int
+	ResponseDelayGreetingDuration time.Duration
 	ResponseDelayHelo             int
+	ResponseDelayHeloDuration     time.Duration
 	ResponseDelayMailfrom         int
+	ResponseDelayMailfromDuration time.Duration
 	ResponseDelayRcptto           int
+	ResponseDelayRcpttoDuration   time.Duration
 	ResponseDelayData             int
+	ResponseDelayDataDuration     time.Duration
 	ResponseDelayMessage          int
+	ResponseDelayMessageDuration  time.Duration
 	ResponseDelayRset             int
+	ResponseDelayRsetDuration     time.Duration
 	ResponseDelayNoop             int
+	ResponseDelayNoopDuration     time.Duration
 	ResponseDelayQuit             int
+	ResponseDelayQuitDuration     time.Duration
+	ResponseDelayJitter           int
+	ResponseDelayJitterDuration   time.Duration
+	JitterDistribution            JitterDistribution
 	MsgSizeLimit                  int
 	SessionTimeout                int
 	ShutdownTimeout               int
@@ -160,6 +303,14 @@ type ConfigurationAttr struct {
 
 // ConfigurationAttr methods
 
+// Validate checks configuration attributes without building SMTP mock server. Returns error
+// for case when Received header template, security keys, rules, faults, jitter distribution
+// or scenario are invalid
+func (config *ConfigurationAttr) Validate() error {
+	_, err := buildConfiguration(*config)
+	return err
+}
+
 // Assigns server defaults
 func (config *ConfigurationAttr) assignServerDefaultValues() {
 	if config.HostAddress == emptyString {
@@ -174,6 +325,15 @@ func (config *ConfigurationAttr) assignServerDefaultValues() {
 	if config.MsgQuitCmd == emptyString {
 		config.MsgQuitCmd = defaultQuitMsg
 	}
+	if config.MsgSessionLimit == emptyString {
+		config.MsgSessionLimit = defaultSessionLimitMsg
+	}
+	if config.RateLimitWindow == 0 {
+		config.RateLimitWindow = defaultRateLimitWindow
+	}
+	if config.JitterDistribution == emptyString {
+		config.JitterDistribution = UniformJitter
+	}
 	if config.SessionTimeout == 0 {
 		config.SessionTimeout = defaultSessionTimeout
 	}
@@ -212,6 +372,9 @@ func (config *ConfigurationAttr) assignHandlerMailfromDefaultValues() {
 	if config.MsgMailfromReceived == emptyString {
 		config.MsgMailfromReceived = defaultReceivedMsg
 	}
+	if config.MsgMailfromRateLimit == emptyString {
+		config.MsgMailfromRateLimit = defaultMailfromRateLimitMsg
+	}
 }
 
 // Assigns handlerRcptto defaults
@@ -231,6 +394,12 @@ func (config *ConfigurationAttr) assignHandlerRcpttoDefaultValues() {
 	if config.MsgRcpttoReceived == emptyString {
 		config.MsgRcpttoReceived = defaultReceivedMsg
 	}
+	if config.MsgRcpttoGreylisted == emptyString {
+		config.MsgRcpttoGreylisted = defaultGreylistedRcpttoMsg
+	}
+	if config.MsgRcpttoRateLimit == emptyString {
+		config.MsgRcpttoRateLimit = defaultRcpttoRateLimitMsg
+	}
 }
 
 // Assigns handlerData defaults
@@ -254,6 +423,9 @@ func (config *ConfigurationAttr) assignHandlerMessageDefaultValues() {
 	if config.MsgMsgReceived == emptyString {
 		config.MsgMsgReceived = defaultReceivedMsg
 	}
+	if config.MsgMsgInvalid == emptyString {
+		config.MsgMsgInvalid = defaultMsgInvalidMsg
+	}
 }
 
 // Assigns handlerRset defaults
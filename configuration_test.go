@@ -3,6 +3,7 @@ package smtpmock
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -16,11 +17,18 @@ func TestNewConfiguration(t *testing.T) {
 		assert.False(t, buildedConfiguration.isCmdFailFast)
 		assert.False(t, buildedConfiguration.multipleRcptto)
 		assert.False(t, buildedConfiguration.multipleMessageReceiving)
+		assert.False(t, buildedConfiguration.prependReceivedHeader)
+		assert.False(t, buildedConfiguration.validateMessage)
+		assert.False(t, buildedConfiguration.rejectInvalidMessage)
+		assert.Equal(t, defaultReceivedHeaderTemplate, buildedConfiguration.receivedHeaderTemplate.Root.String())
+		assert.Equal(t, createEmptySecurityKeyRing(), buildedConfiguration.securityKeyRing)
 		assert.False(t, buildedConfiguration.logServerActivity)
 		assert.Equal(t, defaultGreetingMsg, buildedConfiguration.msgGreeting)
 		assert.Equal(t, defaultInvalidCmdMsg, buildedConfiguration.msgInvalidCmd)
 		assert.Equal(t, defaultQuitMsg, buildedConfiguration.msgQuitCmd)
 		assert.Equal(t, defaultSessionTimeout, buildedConfiguration.sessionTimeout)
+		assert.Equal(t, defaultSessionLimitMsg, buildedConfiguration.msgSessionLimit)
+		assert.Equal(t, defaultRateLimitWindow, buildedConfiguration.rateLimitWindow)
 		assert.Equal(t, defaultShutdownTimeout, buildedConfiguration.shutdownTimeout)
 
 		assert.Equal(t, defaultInvalidCmdHeloSequenceMsg, buildedConfiguration.msgInvalidCmdHeloSequence)
@@ -32,12 +40,15 @@ func TestNewConfiguration(t *testing.T) {
 		assert.Equal(t, defaultInvalidCmdMailfromArgMsg, buildedConfiguration.msgInvalidCmdMailfromArg)
 		assert.Equal(t, defaultTransientNegativeMsg, buildedConfiguration.msgMailfromBlacklistedEmail)
 		assert.Equal(t, defaultReceivedMsg, buildedConfiguration.msgMailfromReceived)
+		assert.Equal(t, defaultMailfromRateLimitMsg, buildedConfiguration.msgMailfromRateLimit)
 
 		assert.Equal(t, defaultInvalidCmdRcpttoSequenceMsg, buildedConfiguration.msgInvalidCmdRcpttoSequence)
 		assert.Equal(t, defaultInvalidCmdRcpttoArgMsg, buildedConfiguration.msgInvalidCmdRcpttoArg)
 		assert.Equal(t, defaultTransientNegativeMsg, buildedConfiguration.msgRcpttoBlacklistedEmail)
 		assert.Equal(t, defaultNotRegistredRcpttoEmailMsg, buildedConfiguration.msgRcpttoNotRegisteredEmail)
 		assert.Equal(t, defaultReceivedMsg, buildedConfiguration.msgRcpttoReceived)
+		assert.Equal(t, defaultGreylistedRcpttoMsg, buildedConfiguration.msgRcpttoGreylisted)
+		assert.Equal(t, defaultRcpttoRateLimitMsg, buildedConfiguration.msgRcpttoRateLimit)
 
 		assert.Equal(t, defaultInvalidCmdDataSequenceMsg, buildedConfiguration.msgInvalidCmdDataSequence)
 		assert.Equal(t, defaultReadyForReceiveMsg, buildedConfiguration.msgDataReceived)
@@ -50,13 +61,26 @@ func TestNewConfiguration(t *testing.T) {
 
 		assert.Equal(t, fmt.Sprintf(defaultMsgSizeIsTooBigMsg+" %d bytes", defaultMessageSizeLimit), buildedConfiguration.msgMsgSizeIsTooBig)
 		assert.Equal(t, defaultReceivedMsg, buildedConfiguration.msgMsgReceived)
+		assert.Equal(t, defaultMsgInvalidMsg, buildedConfiguration.msgMsgInvalid)
 		assert.Equal(t, defaultMessageSizeLimit, buildedConfiguration.msgSizeLimit)
 
 		assert.Empty(t, buildedConfiguration.blacklistedHeloDomains)
 		assert.Empty(t, buildedConfiguration.blacklistedMailfromEmails)
 		assert.Empty(t, buildedConfiguration.blacklistedRcpttoEmails)
 		assert.Empty(t, buildedConfiguration.notRegisteredEmails)
-
+		assert.Empty(t, buildedConfiguration.rules)
+		assert.Empty(t, buildedConfiguration.responseSequences)
+		assert.Empty(t, buildedConfiguration.faults)
+		assert.Nil(t, buildedConfiguration.scenario)
+		assert.Equal(t, int64(0), buildedConfiguration.randomSeed)
+		assert.False(t, buildedConfiguration.greylisting)
+		assert.Equal(t, 0, buildedConfiguration.greylistingDelay)
+		assert.Equal(t, 0, buildedConfiguration.maxSessions)
+		assert.Equal(t, 0, buildedConfiguration.maxSessionsPerIP)
+		assert.Equal(t, 0, buildedConfiguration.maxMessagesPerWindow)
+		assert.Equal(t, 0, buildedConfiguration.maxRcpttosPerWindow)
+
+		assert.Equal(t, defaultSessionResponseDelay, buildedConfiguration.responseDelayGreeting)
 		assert.Equal(t, defaultSessionResponseDelay, buildedConfiguration.responseDelayHelo)
 		assert.Equal(t, defaultSessionResponseDelay, buildedConfiguration.responseDelayMailfrom)
 		assert.Equal(t, defaultSessionResponseDelay, buildedConfiguration.responseDelayRcptto)
@@ -65,6 +89,8 @@ func TestNewConfiguration(t *testing.T) {
 		assert.Equal(t, defaultSessionResponseDelay, buildedConfiguration.responseDelayRset)
 		assert.Equal(t, defaultSessionResponseDelay, buildedConfiguration.responseDelayNoop)
 		assert.Equal(t, defaultSessionResponseDelay, buildedConfiguration.responseDelayQuit)
+		assert.Equal(t, defaultSessionResponseDelay, buildedConfiguration.responseDelayJitter)
+		assert.Equal(t, UniformJitter, buildedConfiguration.jitterDistribution)
 	})
 
 	t.Run("creates new configuration with custom settings", func(t *testing.T) {
@@ -76,9 +102,17 @@ func TestNewConfiguration(t *testing.T) {
 			IsCmdFailFast:                 true,
 			MultipleRcptto:                true,
 			MultipleMessageReceiving:      true,
+			PrependReceivedHeader:         true,
+			ReceivedHeaderTemplate:        "Received: from {{.HeloDomain}}",
+			ValidateMessage:               true,
+			RejectInvalidMessage:          true,
+			SMIMECertificates:             securityFixture("smime_ca.crt"),
+			SMIMEPrivateKeys:              securityFixture("smime_user.key"),
+			PGPKeyRing:                    securityFixture("pgp_secret.asc"),
 			MsgGreeting:                   "msgGreeting",
 			MsgInvalidCmd:                 "msgInvalidCmd",
 			MsgQuitCmd:                    "msgQuitCmd",
+			MsgSessionLimit:               "msgSessionLimit",
 			MsgInvalidCmdHeloSequence:     "msgInvalidCmdHeloSequence",
 			MsgInvalidCmdHeloArg:          "msgInvalidCmdHeloArg",
 			MsgHeloBlacklistedDomain:      "msgHeloBlacklistedDomain",
@@ -87,15 +121,19 @@ func TestNewConfiguration(t *testing.T) {
 			MsgInvalidCmdMailfromArg:      "msgInvalidCmdMailfromArg",
 			MsgMailfromBlacklistedEmail:   "msgMailfromBlacklistedEmail",
 			MsgMailfromReceived:           "msgMailfromReceived",
+			MsgMailfromRateLimit:          "msgMailfromRateLimit",
 			MsgInvalidCmdRcpttoSequence:   "msgInvalidCmdRcpttoSequence",
 			MsgInvalidCmdRcpttoArg:        "msgInvalidCmdRcpttoArg",
 			MsgRcpttoNotRegisteredEmail:   "msgRcpttoNotRegisteredEmail",
 			MsgRcpttoBlacklistedEmail:     "msgRcpttoBlacklistedEmail",
 			MsgRcpttoReceived:             "msgRcpttoReceived",
+			MsgRcpttoGreylisted:           "msgRcpttoGreylisted",
+			MsgRcpttoRateLimit:            "msgRcpttoRateLimit",
 			MsgInvalidCmdDataSequence:     "msgInvalidCmdDataSequence",
 			MsgDataReceived:               "msgDataReceived",
 			MsgMsgSizeIsTooBig:            emptyString,
 			MsgMsgReceived:                "msgMsgReceived",
+			MsgMsgInvalid:                 "msgMsgInvalid",
 			MsgInvalidCmdRsetSequence:     "msgInvalidCmdRsetSequence",
 			MsgInvalidCmdRsetArg:          "msgInvalidCmdRsetArg",
 			MsgRsetReceived:               "msgRsetReceived",
@@ -103,7 +141,20 @@ func TestNewConfiguration(t *testing.T) {
 			BlacklistedHeloDomains:        []string{},
 			BlacklistedMailfromEmails:     []string{},
 			NotRegisteredEmails:           []string{},
+			Greylisting:                   true,
+			GreylistingDelay:              300,
+			MaxSessions:                   1,
+			MaxSessionsPerIP:              2,
+			MaxMessagesPerWindow:          3,
+			MaxRcpttosPerWindow:           4,
+			RateLimitWindow:               5,
 			BlacklistedRcpttoEmails:       []string{},
+			Rules:                         []Rule{{Pattern: "*@example.com", Response: "550 Rejected"}},
+			ResponseSequences:             []ResponseSequence{{Command: RuleRcptto, Responses: []string{"451 Try again later"}}},
+			Faults:                        []Fault{{Commands: []FaultCommand{FaultGreeting}, Kind: FaultStall}},
+			Scenario:                      &Scenario{States: map[string][]ScenarioStep{"start": {{Response: "250 Ok"}}}},
+			RandomSeed:                    42,
+			ResponseDelayGreetingDuration: 250 * time.Millisecond,
 			ResponseDelayHelo:             2,
 			ResponseDelayMailfrom:         2,
 			ResponseDelayRcptto:           2,
@@ -112,6 +163,8 @@ func TestNewConfiguration(t *testing.T) {
 			ResponseDelayRset:             2,
 			ResponseDelayNoop:             2,
 			ResponseDelayQuit:             2,
+			ResponseDelayJitterDuration:   50 * time.Millisecond,
+			JitterDistribution:            NormalJitter,
 			MsgSizeLimit:                  42,
 			SessionTimeout:                120,
 			ShutdownTimeout:               2,
@@ -124,11 +177,18 @@ func TestNewConfiguration(t *testing.T) {
 		assert.Equal(t, configAttr.IsCmdFailFast, buildedConfiguration.isCmdFailFast)
 		assert.Equal(t, configAttr.MultipleRcptto, buildedConfiguration.multipleRcptto)
 		assert.Equal(t, configAttr.MultipleMessageReceiving, buildedConfiguration.multipleMessageReceiving)
+		assert.Equal(t, configAttr.PrependReceivedHeader, buildedConfiguration.prependReceivedHeader)
+		assert.Equal(t, configAttr.ReceivedHeaderTemplate, buildedConfiguration.receivedHeaderTemplate.Root.String())
+		assert.Equal(t, configAttr.ValidateMessage, buildedConfiguration.validateMessage)
+		assert.Equal(t, configAttr.RejectInvalidMessage, buildedConfiguration.rejectInvalidMessage)
+		assert.Equal(t, createSecurityKeyRing(), buildedConfiguration.securityKeyRing)
 		assert.Equal(t, configAttr.LogServerActivity, buildedConfiguration.logServerActivity)
 		assert.Equal(t, configAttr.MsgGreeting, buildedConfiguration.msgGreeting)
 		assert.Equal(t, configAttr.MsgInvalidCmd, buildedConfiguration.msgInvalidCmd)
 		assert.Equal(t, configAttr.MsgQuitCmd, buildedConfiguration.msgQuitCmd)
 		assert.Equal(t, configAttr.SessionTimeout, buildedConfiguration.sessionTimeout)
+		assert.Equal(t, configAttr.MsgSessionLimit, buildedConfiguration.msgSessionLimit)
+		assert.Equal(t, configAttr.RateLimitWindow, buildedConfiguration.rateLimitWindow)
 		assert.Equal(t, configAttr.ShutdownTimeout, buildedConfiguration.shutdownTimeout)
 
 		assert.Equal(t, configAttr.MsgInvalidCmdHeloSequence, buildedConfiguration.msgInvalidCmdHeloSequence)
@@ -140,12 +200,15 @@ func TestNewConfiguration(t *testing.T) {
 		assert.Equal(t, configAttr.MsgInvalidCmdMailfromArg, buildedConfiguration.msgInvalidCmdMailfromArg)
 		assert.Equal(t, configAttr.MsgMailfromBlacklistedEmail, buildedConfiguration.msgMailfromBlacklistedEmail)
 		assert.Equal(t, configAttr.MsgMailfromReceived, buildedConfiguration.msgMailfromReceived)
+		assert.Equal(t, configAttr.MsgMailfromRateLimit, buildedConfiguration.msgMailfromRateLimit)
 
 		assert.Equal(t, configAttr.MsgInvalidCmdRcpttoSequence, buildedConfiguration.msgInvalidCmdRcpttoSequence)
 		assert.Equal(t, configAttr.MsgInvalidCmdRcpttoArg, buildedConfiguration.msgInvalidCmdRcpttoArg)
 		assert.Equal(t, configAttr.MsgRcpttoBlacklistedEmail, buildedConfiguration.msgRcpttoBlacklistedEmail)
 		assert.Equal(t, configAttr.MsgRcpttoNotRegisteredEmail, buildedConfiguration.msgRcpttoNotRegisteredEmail)
 		assert.Equal(t, configAttr.MsgRcpttoReceived, buildedConfiguration.msgRcpttoReceived)
+		assert.Equal(t, configAttr.MsgRcpttoGreylisted, buildedConfiguration.msgRcpttoGreylisted)
+		assert.Equal(t, configAttr.MsgRcpttoRateLimit, buildedConfiguration.msgRcpttoRateLimit)
 
 		assert.Equal(t, configAttr.MsgInvalidCmdDataSequence, buildedConfiguration.msgInvalidCmdDataSequence)
 		assert.Equal(t, configAttr.MsgDataReceived, buildedConfiguration.msgDataReceived)
@@ -158,21 +221,101 @@ func TestNewConfiguration(t *testing.T) {
 
 		assert.Equal(t, fmt.Sprintf(defaultMsgSizeIsTooBigMsg+" %d bytes", configAttr.MsgSizeLimit), buildedConfiguration.msgMsgSizeIsTooBig)
 		assert.Equal(t, configAttr.MsgMsgReceived, buildedConfiguration.msgMsgReceived)
+		assert.Equal(t, configAttr.MsgMsgInvalid, buildedConfiguration.msgMsgInvalid)
 		assert.Equal(t, configAttr.MsgSizeLimit, buildedConfiguration.msgSizeLimit)
 
 		assert.Equal(t, configAttr.BlacklistedHeloDomains, buildedConfiguration.blacklistedHeloDomains)
 		assert.Equal(t, configAttr.BlacklistedMailfromEmails, buildedConfiguration.blacklistedMailfromEmails)
 		assert.Equal(t, configAttr.BlacklistedRcpttoEmails, buildedConfiguration.blacklistedRcpttoEmails)
 		assert.Equal(t, configAttr.NotRegisteredEmails, buildedConfiguration.notRegisteredEmails)
+		assert.Equal(t, configAttr.Greylisting, buildedConfiguration.greylisting)
+		assert.Equal(t, configAttr.GreylistingDelay, buildedConfiguration.greylistingDelay)
+		assert.Equal(t, configAttr.MaxSessions, buildedConfiguration.maxSessions)
+		assert.Equal(t, configAttr.MaxSessionsPerIP, buildedConfiguration.maxSessionsPerIP)
+		assert.Equal(t, configAttr.MaxMessagesPerWindow, buildedConfiguration.maxMessagesPerWindow)
+		assert.Equal(t, configAttr.MaxRcpttosPerWindow, buildedConfiguration.maxRcpttosPerWindow)
+		assert.Len(t, buildedConfiguration.rules, 1)
+		assert.Equal(t, configAttr.Rules[0].Response, buildedConfiguration.rules[0].response)
+		assert.Equal(t, configAttr.ResponseSequences, buildedConfiguration.responseSequences)
+		assert.Len(t, buildedConfiguration.faults, 1)
+		assert.Equal(t, configAttr.Faults[0].Kind, buildedConfiguration.faults[0].kind)
+		assert.Equal(t, time.Duration(configAttr.SessionTimeout)*time.Second, buildedConfiguration.faults[0].stallDuration)
+		assert.Equal(t, configAttr.MsgGreeting, buildedConfiguration.scenario.greeting.response)
+		assert.Equal(t, configAttr.RandomSeed, buildedConfiguration.randomSeed)
+
+		assert.Equal(t, configAttr.ResponseDelayGreetingDuration, buildedConfiguration.responseDelayGreeting)
+		assert.Equal(t, time.Duration(configAttr.ResponseDelayHelo)*time.Second, buildedConfiguration.responseDelayHelo)
+		assert.Equal(t, time.Duration(configAttr.ResponseDelayMailfrom)*time.Second, buildedConfiguration.responseDelayMailfrom)
+		assert.Equal(t, time.Duration(configAttr.ResponseDelayRcptto)*time.Second, buildedConfiguration.responseDelayRcptto)
+		assert.Equal(t, time.Duration(configAttr.ResponseDelayData)*time.Second, buildedConfiguration.responseDelayData)
+		assert.Equal(t, time.Duration(configAttr.ResponseDelayMessage)*time.Second, buildedConfiguration.responseDelayMessage)
+		assert.Equal(t, time.Duration(configAttr.ResponseDelayRset)*time.Second, buildedConfiguration.responseDelayRset)
+		assert.Equal(t, time.Duration(configAttr.ResponseDelayNoop)*time.Second, buildedConfiguration.responseDelayNoop)
+		assert.Equal(t, time.Duration(configAttr.ResponseDelayQuit)*time.Second, buildedConfiguration.responseDelayQuit)
+		assert.Equal(t, configAttr.ResponseDelayJitterDuration, buildedConfiguration.responseDelayJitter)
+		assert.Equal(t, configAttr.JitterDistribution, buildedConfiguration.jitterDistribution)
+	})
 
-		assert.Equal(t, configAttr.ResponseDelayHelo, buildedConfiguration.responseDelayHelo)
-		assert.Equal(t, configAttr.ResponseDelayMailfrom, buildedConfiguration.responseDelayMailfrom)
-		assert.Equal(t, configAttr.ResponseDelayRcptto, buildedConfiguration.responseDelayRcptto)
-		assert.Equal(t, configAttr.ResponseDelayData, buildedConfiguration.responseDelayData)
-		assert.Equal(t, configAttr.ResponseDelayMessage, buildedConfiguration.responseDelayMessage)
-		assert.Equal(t, configAttr.ResponseDelayRset, buildedConfiguration.responseDelayRset)
-		assert.Equal(t, configAttr.ResponseDelayNoop, buildedConfiguration.responseDelayNoop)
-		assert.Equal(t, configAttr.ResponseDelayQuit, buildedConfiguration.responseDelayQuit)
+	t.Run("panics when configuration attributes are invalid", func(t *testing.T) {
+		assert.Panics(t, func() { newConfiguration(ConfigurationAttr{ReceivedHeaderTemplate: "{{.HeloDomain"}) })
+	})
+}
+
+func TestBuildConfiguration(t *testing.T) {
+	t.Run("creates new configuration when configuration attributes are valid", func(t *testing.T) {
+		buildedConfiguration, err := buildConfiguration(ConfigurationAttr{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, newConfiguration(ConfigurationAttr{}).msgGreeting, buildedConfiguration.msgGreeting)
+	})
+
+	t.Run("returns error when Received header template is invalid", func(t *testing.T) {
+		buildedConfiguration, err := buildConfiguration(ConfigurationAttr{ReceivedHeaderTemplate: "{{.HeloDomain"})
+
+		assert.Nil(t, buildedConfiguration)
+		assert.Error(t, err)
+	})
+
+	t.Run("returns error when security keys are invalid", func(t *testing.T) {
+		buildedConfiguration, err := buildConfiguration(ConfigurationAttr{PGPKeyRing: "-----BEGIN PGP PUBLIC KEY BLOCK-----\n"})
+
+		assert.Nil(t, buildedConfiguration)
+		assert.Error(t, err)
+	})
+
+	t.Run("returns error when rule is invalid", func(t *testing.T) {
+		buildedConfiguration, err := buildConfiguration(ConfigurationAttr{Rules: []Rule{{Matcher: "exact"}}})
+
+		assert.Nil(t, buildedConfiguration)
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", ruleUnknownMatcherErrorMsg, "exact"))
+	})
+
+	t.Run("returns error when fault is invalid", func(t *testing.T) {
+		buildedConfiguration, err := buildConfiguration(ConfigurationAttr{Faults: []Fault{{Kind: "timeout"}}})
+
+		assert.Nil(t, buildedConfiguration)
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", faultUnknownKindErrorMsg, "timeout"))
+	})
+
+	t.Run("returns error when fault probability is out of range", func(t *testing.T) {
+		buildedConfiguration, err := buildConfiguration(ConfigurationAttr{Faults: []Fault{{Kind: FaultReset, Probability: 2}}})
+
+		assert.Nil(t, buildedConfiguration)
+		assert.EqualError(t, err, fmt.Sprintf("%s: %v", faultInvalidProbabilityErrorMsg, 2))
+	})
+
+	t.Run("returns error when jitter distribution is unknown", func(t *testing.T) {
+		buildedConfiguration, err := buildConfiguration(ConfigurationAttr{JitterDistribution: "poisson"})
+
+		assert.Nil(t, buildedConfiguration)
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", jitterUnknownDistributionErrorMsg, "poisson"))
+	})
+
+	t.Run("returns error when scenario is invalid", func(t *testing.T) {
+		buildedConfiguration, err := buildConfiguration(ConfigurationAttr{Scenario: new(Scenario)})
+
+		assert.Nil(t, buildedConfiguration)
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", scenarioUnknownStateErrorMsg, defaultScenarioInitialState))
 	})
 }
 
@@ -186,6 +329,8 @@ func TestConfigurationAttrAssignDefaultValues(t *testing.T) {
 		assert.Equal(t, defaultInvalidCmdMsg, configurationAttr.MsgInvalidCmd)
 		assert.Equal(t, defaultQuitMsg, configurationAttr.MsgQuitCmd)
 		assert.Equal(t, defaultSessionTimeout, configurationAttr.SessionTimeout)
+		assert.Equal(t, defaultSessionLimitMsg, configurationAttr.MsgSessionLimit)
+		assert.Equal(t, defaultRateLimitWindow, configurationAttr.RateLimitWindow)
 		assert.Equal(t, defaultShutdownTimeout, configurationAttr.ShutdownTimeout)
 
 		assert.Equal(t, defaultInvalidCmdHeloSequenceMsg, configurationAttr.MsgInvalidCmdHeloSequence)
@@ -197,12 +342,15 @@ func TestConfigurationAttrAssignDefaultValues(t *testing.T) {
 		assert.Equal(t, defaultInvalidCmdMailfromArgMsg, configurationAttr.MsgInvalidCmdMailfromArg)
 		assert.Equal(t, defaultTransientNegativeMsg, configurationAttr.MsgMailfromBlacklistedEmail)
 		assert.Equal(t, defaultReceivedMsg, configurationAttr.MsgMailfromReceived)
+		assert.Equal(t, defaultMailfromRateLimitMsg, configurationAttr.MsgMailfromRateLimit)
 
 		assert.Equal(t, defaultInvalidCmdRcpttoSequenceMsg, configurationAttr.MsgInvalidCmdRcpttoSequence)
 		assert.Equal(t, defaultInvalidCmdRcpttoArgMsg, configurationAttr.MsgInvalidCmdRcpttoArg)
 		assert.Equal(t, defaultTransientNegativeMsg, configurationAttr.MsgRcpttoBlacklistedEmail)
 		assert.Equal(t, defaultNotRegistredRcpttoEmailMsg, configurationAttr.MsgRcpttoNotRegisteredEmail)
 		assert.Equal(t, defaultReceivedMsg, configurationAttr.MsgRcpttoReceived)
+		assert.Equal(t, defaultGreylistedRcpttoMsg, configurationAttr.MsgRcpttoGreylisted)
+		assert.Equal(t, defaultRcpttoRateLimitMsg, configurationAttr.MsgRcpttoRateLimit)
 
 		assert.Equal(t, defaultInvalidCmdDataSequenceMsg, configurationAttr.MsgInvalidCmdDataSequence)
 		assert.Equal(t, defaultReadyForReceiveMsg, configurationAttr.MsgDataReceived)
@@ -215,6 +363,32 @@ func TestConfigurationAttrAssignDefaultValues(t *testing.T) {
 
 		assert.Equal(t, fmt.Sprintf(defaultMsgSizeIsTooBigMsg+" %d bytes", defaultMessageSizeLimit), configurationAttr.MsgMsgSizeIsTooBig)
 		assert.Equal(t, defaultReceivedMsg, configurationAttr.MsgMsgReceived)
+		assert.Equal(t, defaultMsgInvalidMsg, configurationAttr.MsgMsgInvalid)
 		assert.Equal(t, defaultMessageSizeLimit, configurationAttr.MsgSizeLimit)
 	})
 }
+
+func TestConfigurationAttrValidate(t *testing.T) {
+	t.Run("when configuration attributes are valid", func(t *testing.T) {
+		configAttr := &ConfigurationAttr{}
+
+		assert.NoError(t, configAttr.Validate())
+		assert.Equal(t, &ConfigurationAttr{}, configAttr)
+	})
+
+	t.Run("when configuration attributes are invalid", func(t *testing.T) {
+		configAttr := &ConfigurationAttr{ReceivedHeaderTemplate: "{{.HeloDomain"}
+
+		assert.Error(t, configAttr.Validate())
+	})
+}
+
+func TestResponseDelay(t *testing.T) {
+	t.Run("returns response delay in seconds as duration when duration is not specified", func(t *testing.T) {
+		assert.Equal(t, 2*time.Second, responseDelay(2, 0))
+	})
+
+	t.Run("returns response delay duration when it's specified", func(t *testing.T) {
+		assert.Equal(t, 250*time.Millisecond, responseDelay(2, 250*time.Millisecond))
+	})
+}
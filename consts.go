@@ -1,6 +1,9 @@
 package smtpmock
 
-import "log"
+import (
+	"log"
+	"time"
+)
 
 const (
 	// SMTP mock default messages
@@ -10,6 +13,10 @@ const (
 	defaultReceivedMsg                   = "250 Received"
 	defaultReadyForReceiveMsg            = "354 Ready for receive message. End data with <CR><LF>.<CR><LF>"
 	defaultTransientNegativeMsg          = "421 Service not available"
+	defaultSessionLimitMsg               = "421 Too many sessions, try again later"
+	defaultGreylistedRcpttoMsg           = "450 Greylisted, please try again later"
+	defaultMailfromRateLimitMsg          = "451 Message rate limit exceeded, try again later"
+	defaultRcpttoRateLimitMsg            = "452 Too many recipients, try again later"
 	defaultInvalidCmdHeloArgMsg          = "501 HELO requires domain address or valid address literal"
 	defaultInvalidCmdMailfromArgMsg      = "501 MAIL FROM requires valid email address"
 	defaultInvalidCmdRcpttoArgMsg        = "501 RCPT TO requires valid email address"
@@ -20,6 +27,7 @@ const (
 	defaultInvalidCmdDataSequenceMsg     = "503 Bad sequence of commands. DATA should be used after RCPT TO"
 	defaultNotRegistredRcpttoEmailMsg    = "550 User not found"
 	defaultMsgSizeIsTooBigMsg            = "552 Message exceeded max size of"
+	defaultMsgInvalidMsg                 = "554 Message is not RFC 5322 compliant"
 
 	// Logger
 	infoLogLevel    = "INFO"
@@ -32,6 +40,7 @@ const (
 	sessionRequestMsg       = "SMTP request: "
 	sessionResponseMsg      = "SMTP response: "
 	sessionResponseDelayMsg = "SMTP response delay"
+	sessionFaultMsg         = "SMTP response fault"
 	sessionEndMsg           = "SMTP session finished"
 	sessionBinaryDataMsg    = "message binary data portion"
 
@@ -41,7 +50,8 @@ const (
 	defaultMessageSizeLimit          = 10485760 // in bytes (10MB)
 	defaultSessionTimeout            = 30       // in seconds
 	defaultShutdownTimeout           = 1        // in seconds
-	defaultSessionResponseDelay      = 0        // in seconds
+	defaultRateLimitWindow           = 60       // in seconds
+	defaultSessionResponseDelay      = time.Duration(0)
 	serverStartMsg                   = "SMTP mock server started on port"
 	serverStartErrorMsg              = "Unable to start SMTP mock server. Server must be inactive"
 	serverErrorMsg                   = "Failed to start SMTP mock server on port"
@@ -49,6 +59,108 @@ const (
 	serverNotAcceptNewConnectionsMsg = "SMTP mock server is in the shutdown mode and won't accept new connections"
 	serverStopMsg                    = "SMTP mock server was stopped successfully"
 	serverForceStopMsg               = "SMTP mock server was force stopped by timeout"
+	serverWaitForMessageErrorMsg     = "Matched message was not received"
+	serverWaitForSessionsErrorMsg    = "Active sessions were not finished"
+	serviceNotAvailableReplyCode     = "421"
+
+	// Rule
+	ruleUnknownMatcherErrorMsg = "Unknown rule matcher"
+
+	// Fault
+	faultUnknownKindErrorMsg        = "Unknown fault kind"
+	faultInvalidProbabilityErrorMsg = "Fault probability should be from 0 to 1"
+
+	// Jitter
+	jitterUnknownDistributionErrorMsg = "Unknown jitter distribution"
+
+	// Scenario
+	defaultScenarioInitialState     = "start"
+	scenarioUnknownStateErrorMsg    = "Unknown scenario state"
+	scenarioInvalidDurationErrorMsg = "Invalid scenario duration"
+	scenarioInvalidYAMLErrorMsg     = "Invalid or unsupported scenario YAML"
+	yamlUnsupportedIndicators       = "{[|>&!%@`"
+	yamlNumberRegexPattern          = `\A[-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?\z`
+
+	// Received header
+	receivedHeaderTemplateName    = "received"
+	receivedHeaderRenderErrorMsg  = "Unable to render Received header"
+	receivedHeaderHostname        = "localhost"
+	receivedHeaderQueueIDSize     = 6 // in bytes
+	defaultReceivedHeaderTemplate = "Received: from {{.HeloDomain}} ({{.RemoteAddress}})\r\n" +
+		"\tby {{.Hostname}} with {{.Protocol}} id {{.QueueID}}{{if .Recipient}}\r\n" +
+		"\tfor <{{.Recipient}}>{{end}};\r\n" +
+		"\t{{.Date}}"
+
+	// Message validator
+	messageValidatorMaxLineLength        = 998 // in characters, excluding CRLF
+	messageValidatorRuleMissingHeader    = "missing-header"
+	messageValidatorRuleDuplicateHeader  = "duplicate-header"
+	messageValidatorRuleLineTooLong      = "line-too-long"
+	messageValidatorRuleInvalidFolding   = "invalid-folding"
+	messageValidatorRuleMalformedHeader  = "malformed-header"
+	messageValidatorRule8BitHeader       = "8bit-header"
+	messageValidatorRuleInvalidAddress   = "invalid-address"
+	messageValidatorRuleInvalidDate      = "invalid-date"
+	messageValidatorRuleInvalidMessageID = "invalid-message-id"
+
+	// Message content
+	textPlainContentType      = "text/plain"
+	textHTMLContentType       = "text/html"
+	defaultPartContentType    = textPlainContentType
+	defaultPartCharset        = "us-ascii"
+	plainTextURLTrailingChars = ".,;:!?)]}"
+
+	// Calendar
+	textCalendarContentType    = "text/calendar"
+	calendarObjectComponent    = "VCALENDAR"
+	calendarEventComponent     = "VEVENT"
+	calendarMailtoScheme       = "mailto:"
+	calendarDateLayout         = "20060102"
+	calendarDateTimeLayout     = "20060102T150405"
+	calendarUTCDateTimeLayout  = "20060102T150405Z"
+	malformedCalendarMsg       = "malformed calendar data"
+	unknownCalendarTimeZoneMsg = "unknown calendar time zone"
+
+	// Charsets
+	unsupportedCharsetMsg = "unsupported charset"
+	iso2022JPModeASCII    = 0
+	iso2022JPModeRoman    = 1
+	iso2022JPModeKatakana = 2
+	iso2022JPModeJIS0208  = 3
+
+	// Message security
+	securityProtocolSMIME         = "S/MIME"
+	securityProtocolOpenPGP       = "OpenPGP"
+	multipartSignedContentType    = "multipart/signed"
+	multipartEncryptedContentType = "multipart/encrypted"
+	pkcs7MIMEContentType          = "application/pkcs7-mime"
+	pkcs7MIMELegacyContentType    = "application/x-pkcs7-mime"
+	pkcs7SignatureProtocol        = "application/pkcs7-signature"
+	pkcs7SignatureLegacyProtocol  = "application/x-pkcs7-signature"
+	pgpSignatureProtocol          = "application/pgp-signature"
+	pgpEncryptedProtocol          = "application/pgp-encrypted"
+	pgpArmorBeginPrefix           = "-----BEGIN PGP "
+	pgpArmorEndPrefix             = "-----END PGP "
+	pgpArmorCRC24Init             = 0xB704CE
+	pgpArmorCRC24Poly             = 0x1864CFB
+	pgpMDCSize                    = 22
+	openPGPTagPKESK               = 1
+	openPGPTagSignature           = 2
+	openPGPTagSecretKey           = 5
+	openPGPTagPublicKey           = 6
+	openPGPTagSecretSubkey        = 7
+	openPGPTagCompressed          = 8
+	openPGPTagLiteral             = 11
+	openPGPTagUserID              = 13
+	openPGPTagPublicSubkey        = 14
+	openPGPTagSEIPD               = 18
+	noDecryptionKeyMsg            = "no suitable decryption key"
+	signerNotFoundMsg             = "signer certificate or key not found"
+	untrustedSignerMsg            = "signer certificate is not trusted"
+	digestMismatchMsg             = "message digest mismatch"
+	unsupportedAlgorithmMsg       = "unsupported algorithm"
+	malformedSecurityDataMsg      = "malformed security data"
+	integrityCheckFailedMsg       = "integrity check failed"
 
 	// Regex patterns
 	availableCmdsRegexPattern  = `(?i)helo|ehlo|mail from:|rcpt to:|data|rset|noop|quit`
@@ -57,6 +169,13 @@ const (
 	emailRegexPattern          = `(?i)(?:[\p{L}\p{N}\s]*?<?)*?(` + localPartChars + `+(?:\.` + localPartChars + `+)*@` + domainRegexPattern + `)>*`
 	ipAddressRegexPattern      = `(\b25[0-5]|\b2[0-4][0-9]|\b[01]?[0-9][0-9]?)(\.(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)){3}`
 	addressLiteralRegexPattern = `|\[` + ipAddressRegexPattern + `\]`
+	messageIDRegexPattern      = `\A<[^<>@\s]+@[^<>@\s]+>\z`
+
+	htmlAnchorRegexPattern           = `(?is)<a\s[^>]*?\bhref\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)[^>]*>(.*?)</a\s*>`
+	htmlTagRegexPattern              = `(?s)<[^>]*>`
+	htmlInvisibleElementRegexPattern = `(?is)<(?:script|style|head)\b.*?</(?:script|style|head)\s*>`
+	plainTextURLRegexPattern         = `(?i)\bhttps?://[^\s<>"']+`
+	calendarDurationRegexPattern     = `\A([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?\z`
 
 	validHeloCmdsRegexPattern           = `(?i)helo|ehlo`
 	validMailfromCmdRegexPattern        = `(?i)mail from:`
@@ -0,0 +1,172 @@
+package smtpmock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FaultKind is the kind of network fault
+type FaultKind string
+
+// Available fault kinds
+const (
+	FaultDropConnection FaultKind = "drop"         // closes connection right after response, dropped DATA command ends session mid-DATA
+	FaultHalfReply      FaultKind = "half reply"   // writes the first half of response line without CRLF and closes connection
+	FaultByteByByte     FaultKind = "byte by byte" // writes response one byte at a time, session goes on
+	FaultStall          FaultKind = "stall"        // stops responding right after response until session timeout, then closes connection
+	FaultReset          FaultKind = "reset"        // sends TCP RST instead of clean close right after response
+)
+
+// FaultCommand is the session point which fault applies to
+type FaultCommand string
+
+// Available fault commands
+const (
+	FaultGreeting FaultCommand = "GREETING" // server greeting
+	FaultHelo     FaultCommand = "HELO"     // HELO or EHLO command
+	FaultMailfrom FaultCommand = "MAIL"     // MAIL FROM command
+	FaultRcptto   FaultCommand = "RCPT"     // RCPT TO command
+	FaultData     FaultCommand = "DATA"     // DATA command
+	FaultRset     FaultCommand = "RSET"     // RSET command
+	FaultNoop     FaultCommand = "NOOP"     // NOOP command
+	FaultQuit     FaultCommand = "QUIT"     // QUIT command
+)
+
+// Fault is the transport level misbehavior of server response. Faults are checked in order,
+// the first triggered fault is applied to the response of the current command. Fault is
+// triggered by matched request, with probability or both
+type Fault struct {
+	Commands    []FaultCommand // commands which fault applies to, all commands and greeting for case when empty
+	Kind        FaultKind      // fault kind
+	Matcher     RuleMatcher    // pattern kind, glob by default
+	Pattern     string         // matched with request line, e.g. "RCPT TO:<user@example.com>", all requests for case when empty
+	Probability float64        // fault probability from 0 to 1, fault is triggered by each matched request for case when it's 0
+	ByteDelay   time.Duration  // delay between bytes of FaultByteByByte response
+}
+
+// Compiled fault
+type fault struct {
+	commands      []FaultCommand
+	kind          FaultKind
+	match         func(string) bool
+	probability   float64
+	byteDelay     time.Duration
+	stallDuration time.Duration
+}
+
+// Faults builder. Returns compiled faults in the same order, stalled session is held for
+// the given duration. Returns error for case when fault has unknown kind, probability out
+// of range from 0 to 1, invalid pattern or unknown matcher
+func newFaults(faults []Fault, stallDuration time.Duration) ([]*fault, error) {
+	compiledFaults := make([]*fault, 0, len(faults))
+	for _, faultAttr := range faults {
+		switch faultAttr.Kind {
+		case FaultDropConnection, FaultHalfReply, FaultByteByByte, FaultStall, FaultReset:
+		default:
+			return nil, fmt.Errorf("%s: %q", faultUnknownKindErrorMsg, faultAttr.Kind)
+		}
+
+		if faultAttr.Probability < 0 || faultAttr.Probability > 1 {
+			return nil, fmt.Errorf("%s: %v", faultInvalidProbabilityErrorMsg, faultAttr.Probability)
+		}
+
+		compiledFault := &fault{
+			commands:      faultAttr.Commands,
+			kind:          faultAttr.Kind,
+			probability:   faultAttr.Probability,
+			byteDelay:     faultAttr.ByteDelay,
+			stallDuration: stallDuration,
+		}
+		if faultAttr.Pattern != emptyString {
+			match, err := newRuleMatch(faultAttr.Matcher, faultAttr.Pattern)
+			if err != nil {
+				return nil, err
+			}
+
+			compiledFault.match = match
+		}
+
+		compiledFaults = append(compiledFaults, compiledFault)
+	}
+
+	return compiledFaults, nil
+}
+
+// Returns fault command of the given recognized SMTP command
+func faultCommand(command string) FaultCommand {
+	if command == "EHLO" {
+		return FaultHelo
+	}
+
+	return FaultCommand(command)
+}
+
+// fault methods
+
+// Returns true for case when fault applies to the given command, otherwise returns false
+func (fault *fault) isAppliedTo(command FaultCommand) bool {
+	if len(fault.commands) == 0 {
+		return true
+	}
+
+	for _, faultCommand := range fault.commands {
+		if faultCommand == command {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns true for case when fault matches the given request, otherwise returns false
+func (fault *fault) isMatched(request string) bool {
+	return fault.match == nil || fault.match(request)
+}
+
+// Returns true for case when fault ends session, otherwise returns false. Nil fault is
+// never terminating
+func (fault *fault) isTerminating() bool {
+	return fault != nil && fault.kind != FaultByteByByte
+}
+
+// Concurrent type that can be safely shared between goroutines. Picks faults triggered by
+// session commands
+type faultInjector struct {
+	sync.Mutex
+	faults []*fault
+	random *randomSource
+}
+
+// Fault injector builder. Returns pointer to new fault injector based on configuration
+// faults and random seed
+func newFaultInjector(configuration *configuration) *faultInjector {
+	return &faultInjector{faults: configuration.faults, random: newRandomSource(configuration.randomSeed)}
+}
+
+// faultInjector methods
+
+// Replaces faults and random source with ones of the given fault injector
+func (faultInjector *faultInjector) reconfigure(otherFaultInjector *faultInjector) {
+	faultInjector.Lock()
+	defer faultInjector.Unlock()
+	faultInjector.faults, faultInjector.random = otherFaultInjector.faults, otherFaultInjector.random
+}
+
+// Returns the first fault triggered by the given command and request. Returns nil for case
+// when no fault was triggered
+func (faultInjector *faultInjector) pick(command FaultCommand, request string) *fault {
+	faultInjector.Lock()
+	defer faultInjector.Unlock()
+	for _, fault := range faultInjector.faults {
+		if !fault.isAppliedTo(command) || !fault.isMatched(request) {
+			continue
+		}
+
+		if fault.probability == 0 || faultInjector.random.float64() < fault.probability {
+			return fault
+		}
+	}
+
+	return nil
+}
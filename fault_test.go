@@ -0,0 +1,180 @@
+package smtpmock
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFaults(t *testing.T) {
+	t.Run("returns compiled faults in the same order", func(t *testing.T) {
+		faultAttrs := []Fault{
+			{Commands: []FaultCommand{FaultData}, Kind: FaultDropConnection, Probability: 0.5},
+			{Kind: FaultByteByByte, Matcher: RegexMatcher, Pattern: `(?i)^ehlo`, ByteDelay: time.Millisecond},
+		}
+		faults, err := newFaults(faultAttrs, 42*time.Second)
+
+		assert.NoError(t, err)
+		assert.Len(t, faults, 2)
+		for index, faultAttr := range faultAttrs {
+			assert.Equal(t, faultAttr.Commands, faults[index].commands)
+			assert.Equal(t, faultAttr.Kind, faults[index].kind)
+			assert.Equal(t, faultAttr.Probability, faults[index].probability)
+			assert.Equal(t, faultAttr.ByteDelay, faults[index].byteDelay)
+			assert.Equal(t, 42*time.Second, faults[index].stallDuration)
+		}
+		assert.Nil(t, faults[0].match)
+		assert.NotNil(t, faults[1].match)
+	})
+
+	t.Run("returns empty faults when faults not passed", func(t *testing.T) {
+		faults, err := newFaults(nil, 42)
+
+		assert.NoError(t, err)
+		assert.Empty(t, faults)
+	})
+
+	t.Run("returns error when fault has unknown kind", func(t *testing.T) {
+		faults, err := newFaults([]Fault{{Kind: "timeout"}}, 42)
+
+		assert.Nil(t, faults)
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", faultUnknownKindErrorMsg, "timeout"))
+	})
+
+	t.Run("returns error when fault probability is out of range", func(t *testing.T) {
+		for _, probability := range []float64{-0.1, 1.5} {
+			faults, err := newFaults([]Fault{{Kind: FaultReset, Probability: probability}}, 42)
+
+			assert.Nil(t, faults)
+			assert.EqualError(t, err, fmt.Sprintf("%s: %v", faultInvalidProbabilityErrorMsg, probability))
+		}
+	})
+
+	t.Run("returns error when fault has invalid regex pattern", func(t *testing.T) {
+		faults, err := newFaults([]Fault{{Kind: FaultReset, Matcher: RegexMatcher, Pattern: "("}}, 42)
+
+		assert.Nil(t, faults)
+		assert.Error(t, err)
+	})
+}
+
+func TestFaultCommand(t *testing.T) {
+	t.Run("returns fault command of recognized SMTP command", func(t *testing.T) {
+		assert.Equal(t, FaultHelo, faultCommand("HELO"))
+		assert.Equal(t, FaultHelo, faultCommand("EHLO"))
+		assert.Equal(t, FaultMailfrom, faultCommand("MAIL"))
+		assert.Equal(t, FaultQuit, faultCommand("QUIT"))
+	})
+}
+
+func TestFaultIsAppliedTo(t *testing.T) {
+	t.Run("when fault commands are not specified", func(t *testing.T) {
+		fault := new(fault)
+
+		assert.True(t, fault.isAppliedTo(FaultGreeting))
+		assert.True(t, fault.isAppliedTo(FaultData))
+	})
+
+	t.Run("when fault commands are specified", func(t *testing.T) {
+		fault := &fault{commands: []FaultCommand{FaultRcptto, FaultData}}
+
+		assert.True(t, fault.isAppliedTo(FaultData))
+		assert.False(t, fault.isAppliedTo(FaultGreeting))
+	})
+}
+
+func TestFaultIsMatched(t *testing.T) {
+	t.Run("when fault pattern is not specified", func(t *testing.T) {
+		assert.True(t, new(fault).isMatched("RCPT TO:<user@example.com>"))
+	})
+
+	t.Run("when fault pattern is specified", func(t *testing.T) {
+		faults, _ := newFaults([]Fault{{Kind: FaultReset, Pattern: "rcpt to:<*@flaky.test>"}}, 42)
+		fault := faults[0]
+
+		assert.True(t, fault.isMatched("RCPT TO:<user@flaky.test>"))
+		assert.False(t, fault.isMatched("RCPT TO:<user@example.com>"))
+	})
+}
+
+func TestFaultIsTerminating(t *testing.T) {
+	t.Run("when fault ends session", func(t *testing.T) {
+		for _, kind := range []FaultKind{FaultDropConnection, FaultHalfReply, FaultStall, FaultReset} {
+			assert.True(t, (&fault{kind: kind}).isTerminating())
+		}
+	})
+
+	t.Run("when fault does not end session", func(t *testing.T) {
+		var nilFault *fault
+
+		assert.False(t, (&fault{kind: FaultByteByByte}).isTerminating())
+		assert.False(t, nilFault.isTerminating())
+	})
+}
+
+func TestNewFaultInjector(t *testing.T) {
+	t.Run("creates new fault injector based on configuration faults and random seed", func(t *testing.T) {
+		configuration := newConfiguration(ConfigurationAttr{Faults: []Fault{{Kind: FaultReset}}, RandomSeed: 42})
+		faultInjector := newFaultInjector(configuration)
+
+		assert.Equal(t, configuration.faults, faultInjector.faults)
+		assert.Equal(t, newRandomSource(42).float64(), faultInjector.random.float64())
+	})
+}
+
+func TestFaultInjectorReconfigure(t *testing.T) {
+	t.Run("replaces faults and random source", func(t *testing.T) {
+		faultInjector := newFaultInjector(createConfiguration())
+		otherFaultInjector := newFaultInjector(newConfiguration(ConfigurationAttr{Faults: []Fault{{Kind: FaultReset}}, RandomSeed: 42}))
+		faultInjector.reconfigure(otherFaultInjector)
+
+		assert.Equal(t, otherFaultInjector.faults, faultInjector.faults)
+		assert.Same(t, otherFaultInjector.random, faultInjector.random)
+		assert.Same(t, faultInjector.faults[0], faultInjector.pick(FaultGreeting, emptyString))
+	})
+}
+
+func TestFaultInjectorPick(t *testing.T) {
+	t.Run("returns the first fault which applies to command and matches request", func(t *testing.T) {
+		faultInjector := newFaultInjector(
+			newConfiguration(
+				ConfigurationAttr{
+					Faults: []Fault{
+						{Commands: []FaultCommand{FaultGreeting}, Kind: FaultStall},
+						{Commands: []FaultCommand{FaultRcptto}, Kind: FaultHalfReply, Pattern: "*@flaky.test>"},
+						{Commands: []FaultCommand{FaultRcptto, FaultData}, Kind: FaultDropConnection},
+					},
+				},
+			),
+		)
+
+		assert.Same(t, faultInjector.faults[0], faultInjector.pick(FaultGreeting, emptyString))
+		assert.Same(t, faultInjector.faults[1], faultInjector.pick(FaultRcptto, "RCPT TO:<user@flaky.test>"))
+		assert.Same(t, faultInjector.faults[2], faultInjector.pick(FaultRcptto, "RCPT TO:<user@example.com>"))
+		assert.Same(t, faultInjector.faults[2], faultInjector.pick(FaultData, "DATA"))
+		assert.Nil(t, faultInjector.pick(FaultQuit, "QUIT"))
+	})
+
+	t.Run("triggers fault with probability", func(t *testing.T) {
+		faultInjector := newFaultInjector(
+			newConfiguration(ConfigurationAttr{Faults: []Fault{{Kind: FaultReset, Probability: 0.5}}, RandomSeed: 42}),
+		)
+		randomSource, triggered := newRandomSource(42), 0
+
+		for attempt := 0; attempt < 100; attempt++ {
+			fault := faultInjector.pick(FaultNoop, "NOOP")
+			assert.Equal(t, randomSource.float64() < 0.5, fault != nil)
+			if fault != nil {
+				triggered++
+			}
+		}
+		assert.Greater(t, triggered, 0)
+		assert.Less(t, triggered, 100)
+	})
+
+	t.Run("returns nil when faults not specified", func(t *testing.T) {
+		assert.Nil(t, newFaultInjector(createConfiguration()).pick(FaultGreeting, emptyString))
+	})
+}
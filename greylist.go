@@ -0,0 +1,89 @@
+package smtpmock
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// GreylistEntry is the greylisting state of (IP, sender, recipient) triplet
+type GreylistEntry struct {
+	IP          string
+	Sender      string
+	Recipient   string
+	FirstSeenAt time.Time // time of the first attempt
+	PassedAt    time.Time // time of the first accepted attempt, zero for case when triplet is not passed yet
+	Attempts    int
+}
+
+// Greylisting triplet
+type greylistTriplet struct {
+	ip, sender, recipient string
+}
+
+// Concurrent type that can be safely shared between goroutines. Keeps greylisted triplets
+// in order of their first attempt
+type greylist struct {
+	sync.Mutex
+	delay   time.Duration
+	entries map[greylistTriplet]*GreylistEntry
+	order   []greylistTriplet
+}
+
+// Greylist builder. Returns pointer to new greylist structure with the given minimum
+// delay in seconds
+func newGreylist(delay int) *greylist {
+	return &greylist{delay: time.Duration(delay) * time.Second, entries: make(map[greylistTriplet]*GreylistEntry)}
+}
+
+// greylist methods
+
+// Replaces minimum delay in seconds. Greylisted triplets are kept
+func (greylist *greylist) reconfigure(delay int) {
+	greylist.Lock()
+	defer greylist.Unlock()
+	greylist.delay = time.Duration(delay) * time.Second
+}
+
+// Records attempt of the given triplet. Returns true for case when triplet has passed
+// greylisting, it happens when minimum delay since the first attempt is elapsed. Otherwise
+// returns false. Sender and recipient are case-insensitive
+func (greylist *greylist) isPassed(ip, sender, recipient string) bool {
+	greylist.Lock()
+	defer greylist.Unlock()
+
+	now := timeNow()
+	triplet := greylistTriplet{ip: ip, sender: strings.ToLower(sender), recipient: strings.ToLower(recipient)}
+	entry, found := greylist.entries[triplet]
+	if !found {
+		entry = &GreylistEntry{IP: triplet.ip, Sender: triplet.sender, Recipient: triplet.recipient, FirstSeenAt: now}
+		greylist.entries[triplet], greylist.order = entry, append(greylist.order, triplet)
+	}
+
+	entry.Attempts++
+	if entry.PassedAt.IsZero() && found && !now.Before(entry.FirstSeenAt.Add(greylist.delay)) {
+		entry.PassedAt = now
+	}
+
+	return !entry.PassedAt.IsZero()
+}
+
+// Returns a copy of greylist entries in order of their first attempt
+func (greylist *greylist) copy() []GreylistEntry {
+	greylist.Lock()
+	defer greylist.Unlock()
+
+	entries := make([]GreylistEntry, 0, len(greylist.order))
+	for _, triplet := range greylist.order {
+		entries = append(entries, *greylist.entries[triplet])
+	}
+
+	return entries
+}
+
+// Erases all greylist entries
+func (greylist *greylist) reset() {
+	greylist.Lock()
+	defer greylist.Unlock()
+	greylist.entries, greylist.order = make(map[greylistTriplet]*GreylistEntry), nil
+}
@@ -0,0 +1,111 @@
+package smtpmock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewGreylist(t *testing.T) {
+	t.Run("creates new empty greylist with minimum delay in seconds", func(t *testing.T) {
+		greylist := newGreylist(300)
+
+		assert.Equal(t, 300*time.Second, greylist.delay)
+		assert.Empty(t, greylist.entries)
+		assert.Empty(t, greylist.order)
+	})
+}
+
+func TestGreylistReconfigure(t *testing.T) {
+	t.Run("replaces minimum delay, keeps entries", func(t *testing.T) {
+		greylist := newGreylist(300)
+		greylist.isPassed("127.0.0.1", "sender@example.com", "user@example.com")
+		greylist.reconfigure(0)
+
+		assert.Equal(t, time.Duration(0), greylist.delay)
+		assert.Len(t, greylist.copy(), 1)
+		assert.True(t, greylist.isPassed("127.0.0.1", "sender@example.com", "user@example.com"))
+	})
+}
+
+func TestGreylistIsPassed(t *testing.T) {
+	ip, sender, recipient := "127.0.0.1", "Sender@example.com", "User@example.com"
+	now := time.Now()
+	defer func(originalTimeNow func() time.Time) { timeNow = originalTimeNow }(timeNow)
+
+	t.Run("tempfails triplet until minimum delay is elapsed, then passes it", func(t *testing.T) {
+		greylist := newGreylist(300)
+		timeNow = func() time.Time { return now }
+		assert.False(t, greylist.isPassed(ip, sender, recipient))
+		timeNow = func() time.Time { return now.Add(299 * time.Second) }
+		assert.False(t, greylist.isPassed(ip, sender, recipient))
+		timeNow = func() time.Time { return now.Add(300 * time.Second) }
+		assert.True(t, greylist.isPassed(ip, "sender@EXAMPLE.com", "user@EXAMPLE.com"))
+		timeNow = func() time.Time { return now.Add(400 * time.Second) }
+		assert.True(t, greylist.isPassed(ip, sender, recipient))
+
+		assert.Equal(
+			t,
+			[]GreylistEntry{
+				{
+					IP:          ip,
+					Sender:      "sender@example.com",
+					Recipient:   "user@example.com",
+					FirstSeenAt: now,
+					PassedAt:    now.Add(300 * time.Second),
+					Attempts:    4,
+				},
+			},
+			greylist.copy(),
+		)
+	})
+
+	t.Run("passes retry of triplet when minimum delay is zero", func(t *testing.T) {
+		greylist := newGreylist(0)
+		timeNow = func() time.Time { return now }
+
+		assert.False(t, greylist.isPassed(ip, sender, recipient))
+		assert.True(t, greylist.isPassed(ip, sender, recipient))
+	})
+
+	t.Run("keeps each triplet separately", func(t *testing.T) {
+		greylist := newGreylist(0)
+		timeNow = func() time.Time { return now }
+
+		assert.False(t, greylist.isPassed(ip, sender, recipient))
+		assert.False(t, greylist.isPassed("127.0.0.2", sender, recipient))
+		assert.False(t, greylist.isPassed(ip, emptyString, recipient))
+		assert.False(t, greylist.isPassed(ip, sender, "other@example.com"))
+		assert.Len(t, greylist.copy(), 4)
+	})
+}
+
+func TestGreylistCopy(t *testing.T) {
+	t.Run("returns copy of entries in order of the first attempt", func(t *testing.T) {
+		greylist := newGreylist(0)
+		greylist.isPassed("127.0.0.1", "sender@example.com", "user2@example.com")
+		greylist.isPassed("127.0.0.1", "sender@example.com", "user1@example.com")
+		entries := greylist.copy()
+		entries[0].Attempts = 42
+
+		assert.Equal(t, "user2@example.com", entries[0].Recipient)
+		assert.Equal(t, "user1@example.com", entries[1].Recipient)
+		assert.Equal(t, 1, greylist.copy()[0].Attempts)
+	})
+
+	t.Run("returns empty slice for empty greylist", func(t *testing.T) {
+		assert.Empty(t, newGreylist(0).copy())
+	})
+}
+
+func TestGreylistReset(t *testing.T) {
+	t.Run("erases all entries", func(t *testing.T) {
+		greylist := newGreylist(0)
+		greylist.isPassed("127.0.0.1", "sender@example.com", "user@example.com")
+		greylist.reset()
+
+		assert.Empty(t, greylist.copy())
+		assert.False(t, greylist.isPassed("127.0.0.1", "sender@example.com", "user@example.com"))
+	})
+}
@@ -2,9 +2,12 @@ package smtpmock
 
 // Base handler
 type handler struct {
-	session       sessionInterface
-	message       *Message
-	configuration *configuration
+	session           sessionInterface
+	message           *Message
+	configuration     *configuration
+	responseSequences *responseSequences
+	greylist          *greylist
+	limiter           *limiter
 }
 
 // handler methods
@@ -13,3 +16,28 @@ type handler struct {
 func (handler *handler) clearError() {
 	handler.session.clearError()
 }
+
+// Returns the first configuration rule which applies to the given command and matches
+// the given target. Returns nil for case when no rule matched
+func (handler *handler) matchedRule(command RuleCommand, target string) *rule {
+	return matchRule(handler.configuration.rules, command, target)
+}
+
+// Counts command attempt in server response sequences. Returns sequenced response and true
+// for case when attempt is covered by one of them, otherwise returns empty string and false
+func (handler *handler) sequencedResponse(command RuleCommand, target string) (string, bool) {
+	if handler.responseSequences == nil {
+		return emptyString, false
+	}
+
+	return handler.responseSequences.next(command, target)
+}
+
+// Applies rule to message. Returns true for case when rule accepts command, otherwise
+// returns false and requests end of session for case when rule fail fast flag is enabled
+func (handler *handler) applyRule(rule *rule) bool {
+	isSuccessful := rule.isSuccessful()
+	handler.message.failFast = !isSuccessful && rule.failFast
+
+	return isSuccessful
+}
@@ -43,6 +43,8 @@ func (handler *handlerData) clearMessage() {
 		mailfrom:              messageWithData.mailfrom,
 		rcpttoRequestResponse: messageWithData.rcpttoRequestResponse,
 		rcptto:                messageWithData.rcptto,
+		customRequestResponse: messageWithData.customRequestResponse,
+		sessionID:             messageWithData.sessionID,
 	}
 	*messageWithData = *clearedMessage
 }
@@ -91,6 +91,20 @@ func TestHandlerDataClearMessage(t *testing.T) {
 		handler.clearMessage()
 		assert.Equal(t, clearedMessage, handler.message)
 	})
+
+	t.Run("keeps message session identifier", func(t *testing.T) {
+		message := &Message{heloRequest: "42", sessionID: 42}
+		newHandlerData(new(session), message, new(configuration)).clearMessage()
+
+		assert.Equal(t, 42, message.sessionID)
+	})
+
+	t.Run("keeps custom requests and responses", func(t *testing.T) {
+		message := &Message{customRequestResponse: [][]string{{"ETRN example.com", "250 Queuing started"}}, dataRequest: "42"}
+		newHandlerData(new(session), message, new(configuration)).clearMessage()
+
+		assert.Equal(t, [][]string{{"ETRN example.com", "250 Queuing started"}}, message.customRequestResponse)
+	})
 }
 
 func TestHandlerDataProcessIncomingMessage(t *testing.T) {
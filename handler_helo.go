@@ -1,6 +1,9 @@
 package smtpmock
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // HELO command handler
 type handlerHelo struct {
@@ -26,21 +29,28 @@ func (handler *handlerHelo) run(request string) {
 	handler.writeResult(true, request, handler.configuration.msgHeloReceived)
 }
 
-// Erases all message data
+// Erases all message data except session identifier
 func (handler *handlerHelo) clearMessage() {
 	Message := handler.message
+	sessionID := Message.sessionID
 	*Message = *zeroMessage
+	Message.sessionID = sessionID
 }
 
 // Writes handled HELO result to session, message. Always returns true
 func (handler *handlerHelo) writeResult(isSuccessful bool, request, response string) bool {
+	return handler.writeResultWithDelay(isSuccessful, request, response, handler.configuration.responseDelayHelo)
+}
+
+// Writes handled HELO result with the given response delay to session, message. Always returns true
+func (handler *handlerHelo) writeResultWithDelay(isSuccessful bool, request, response string, responseDelay time.Duration) bool {
 	session, message := handler.session, handler.message
 	if !isSuccessful {
 		session.addError(errors.New(response))
 	}
 
 	message.heloRequest, message.heloResponse, message.helo = request, response, isSuccessful
-	session.writeResponse(response, handler.configuration.responseDelayHelo)
+	session.writeResponse(response, responseDelay)
 	return true
 }
 
@@ -70,8 +80,33 @@ func (handler *handlerHelo) isBlacklistedDomain(request string) bool {
 	return false
 }
 
+// Custom behavior for HELO domain. Returns true and writes sequenced response for case when
+// HELO domain attempt is covered by one of server response sequences
+func (handler *handlerHelo) isSequencedResponse(request string) bool {
+	response, found := handler.sequencedResponse(RuleHelo, handler.heloDomain(request))
+	if !found {
+		return false
+	}
+
+	return handler.writeResult(isPositiveCompletionReply(response), request, response)
+}
+
+// Custom behavior for HELO domain. Returns true and writes rule result for case when HELO domain
+// matches one of configuration.rules
+func (handler *handlerHelo) isMatchedRule(request string) bool {
+	rule := handler.matchedRule(RuleHelo, handler.heloDomain(request))
+	if rule == nil {
+		return false
+	}
+
+	return handler.writeResultWithDelay(handler.applyRule(rule), request, rule.response, rule.responseDelay)
+}
+
 // Invalid HELO command request complex predicate. Returns true for case when one
 // of the chain checks returns true, otherwise returns false
 func (handler *handlerHelo) isInvalidRequest(request string) bool {
-	return handler.isInvalidCmdArg(request) || handler.isBlacklistedDomain(request)
+	return handler.isInvalidCmdArg(request) ||
+		handler.isSequencedResponse(request) ||
+		handler.isMatchedRule(request) ||
+		handler.isBlacklistedDomain(request)
 }
@@ -3,6 +3,7 @@ package smtpmock
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -81,6 +82,13 @@ func TestHandlerHeloClearMessage(t *testing.T) {
 
 		assert.Equal(t, clearedMessage, handler.message)
 	})
+
+	t.Run("keeps message session identifier", func(t *testing.T) {
+		message := &Message{heloRequest: "42", sessionID: 42}
+		newHandlerHelo(new(session), message, new(configuration)).clearMessage()
+
+		assert.Equal(t, &Message{sessionID: 42}, message)
+	})
 }
 
 func TestHandlerHeloWriteResult(t *testing.T) {
@@ -111,6 +119,19 @@ func TestHandlerHeloWriteResult(t *testing.T) {
 	})
 }
 
+func TestHandlerHeloWriteResultWithDelay(t *testing.T) {
+	t.Run("writes response with the given delay", func(t *testing.T) {
+		request, response, responseDelay := "request context", "response context", 42*time.Millisecond
+		session, message := &sessionMock{}, new(Message)
+		handler := newHandlerHelo(session, message, createConfiguration())
+		session.On("writeResponse", response, responseDelay).Once().Return(nil)
+
+		assert.True(t, handler.writeResultWithDelay(true, request, response, responseDelay))
+		assert.True(t, message.helo)
+		assert.Equal(t, response, message.heloResponse)
+	})
+}
+
 func TestHandlerHeloIsInvalidCmdArg(t *testing.T) {
 	configuration, session := createConfiguration(), &sessionMock{}
 
@@ -266,6 +287,87 @@ func TestHandlerHeloIsBlacklistedDomain(t *testing.T) {
 	})
 }
 
+func TestHandlerHeloIsSequencedResponse(t *testing.T) {
+	request, response := "HELO example.com", "451 Try again later"
+
+	t.Run("when attempt is covered by failing sequenced response", func(t *testing.T) {
+		session, message, configuration := new(sessionMock), new(Message), createConfiguration()
+		handler := newHandlerHelo(session, message, configuration)
+		handler.responseSequences = newResponseSequences([]ResponseSequence{{Command: RuleHelo, Responses: []string{response}}})
+		session.On("addError", errors.New(response)).Once().Return(nil)
+		session.On("writeResponse", response, configuration.responseDelayHelo).Once().Return(nil)
+
+		assert.True(t, handler.isSequencedResponse(request))
+		assert.False(t, message.helo)
+		assert.Equal(t, response, message.heloResponse)
+	})
+
+	t.Run("when attempt is covered by successful sequenced response", func(t *testing.T) {
+		response := "250 Accepted"
+		session, message, configuration := new(sessionMock), new(Message), createConfiguration()
+		handler := newHandlerHelo(session, message, configuration)
+		handler.responseSequences = newResponseSequences([]ResponseSequence{{Responses: []string{response}}})
+		session.On("writeResponse", response, configuration.responseDelayHelo).Once().Return(nil)
+
+		assert.True(t, handler.isSequencedResponse(request))
+		assert.True(t, message.helo)
+		assert.Equal(t, response, message.heloResponse)
+	})
+
+	t.Run("when attempt is not covered by response sequences", func(t *testing.T) {
+		session, message := new(sessionMock), new(Message)
+		handler := newHandlerHelo(session, message, createConfiguration())
+		handler.responseSequences = newResponseSequences([]ResponseSequence{{Command: RuleRcptto, Responses: []string{response}}})
+
+		assert.False(t, handler.isSequencedResponse(request))
+		assert.False(t, message.helo)
+	})
+}
+
+func TestHandlerHeloIsMatchedRule(t *testing.T) {
+	request := "HELO mx.example.com"
+
+	t.Run("when request matches rejecting rule", func(t *testing.T) {
+		response := "550 Rejected"
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(
+			ConfigurationAttr{
+				Rules: []Rule{{Commands: []RuleCommand{RuleHelo}, Matcher: DomainSuffixMatcher, Pattern: "example.com", Response: response, ResponseDelay: 2 * time.Second, FailFast: true}},
+			},
+		)
+		handler := newHandlerHelo(session, message, configuration)
+		session.On("addError", errors.New(response)).Once().Return(nil)
+		session.On("writeResponse", response, 2*time.Second).Once().Return(nil)
+
+		assert.True(t, handler.isMatchedRule(request))
+		assert.False(t, message.helo)
+		assert.True(t, message.failFast)
+		assert.Equal(t, response, message.heloResponse)
+	})
+
+	t.Run("when request matches accepting rule", func(t *testing.T) {
+		response := "250 Accepted"
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(ConfigurationAttr{Rules: []Rule{{Pattern: "MX.*", Response: response}}})
+		handler := newHandlerHelo(session, message, configuration)
+		session.On("writeResponse", response, defaultSessionResponseDelay).Once().Return(nil)
+
+		assert.True(t, handler.isMatchedRule(request))
+		assert.True(t, message.helo)
+		assert.False(t, message.failFast)
+		assert.Equal(t, response, message.heloResponse)
+	})
+
+	t.Run("when request not matches rules", func(t *testing.T) {
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(ConfigurationAttr{Rules: []Rule{{Commands: []RuleCommand{RuleRcptto}, Pattern: "*", Response: "550 Rejected"}}})
+		handler := newHandlerHelo(session, message, configuration)
+
+		assert.False(t, handler.isMatchedRule(request))
+		assert.False(t, message.helo)
+	})
+}
+
 func TestHandlerHeloIsInvalidRequest(t *testing.T) {
 	configuration := createConfiguration()
 
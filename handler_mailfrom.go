@@ -1,6 +1,9 @@
 package smtpmock
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // MAILFROM command handler
 type handlerMailfrom struct {
@@ -30,22 +33,29 @@ func (handler *handlerMailfrom) run(request string) {
 func (handler *handlerMailfrom) clearMessage() {
 	messageWithData := handler.message
 	clearedMessage := &Message{
-		heloRequest:  messageWithData.heloRequest,
-		heloResponse: messageWithData.heloResponse,
-		helo:         messageWithData.helo,
+		heloRequest:           messageWithData.heloRequest,
+		heloResponse:          messageWithData.heloResponse,
+		helo:                  messageWithData.helo,
+		customRequestResponse: messageWithData.customRequestResponse,
+		sessionID:             messageWithData.sessionID,
 	}
 	*messageWithData = *clearedMessage
 }
 
-// Writes handled HELO result to session, message. Always returns true
+// Writes handled MAILFROM result to session, message. Always returns true
 func (handler *handlerMailfrom) writeResult(isSuccessful bool, request, response string) bool {
+	return handler.writeResultWithDelay(isSuccessful, request, response, handler.configuration.responseDelayMailfrom)
+}
+
+// Writes handled MAILFROM result with the given response delay to session, message. Always returns true
+func (handler *handlerMailfrom) writeResultWithDelay(isSuccessful bool, request, response string, responseDelay time.Duration) bool {
 	session, message := handler.session, handler.message
 	if !isSuccessful {
 		session.addError(errors.New(response))
 	}
 
 	message.mailfromRequest, message.mailfromResponse, message.mailfrom = request, response, isSuccessful
-	session.writeResponse(response, handler.configuration.responseDelayMailfrom)
+	session.writeResponse(response, responseDelay)
 	return true
 }
 
@@ -85,10 +95,48 @@ func (handler *handlerMailfrom) isBlacklistedEmail(request string) bool {
 	return false
 }
 
+// Custom behavior for MAILFROM email. Returns true and writes sequenced response for case when
+// MAILFROM email attempt is covered by one of server response sequences
+func (handler *handlerMailfrom) isSequencedResponse(request string) bool {
+	response, found := handler.sequencedResponse(RuleMailfrom, handler.mailfromEmail(request))
+	if !found {
+		return false
+	}
+
+	return handler.writeResult(isPositiveCompletionReply(response), request, response)
+}
+
+// Custom behavior for MAILFROM email. Returns true and writes rule result for case when
+// MAILFROM email matches one of configuration.rules
+func (handler *handlerMailfrom) isMatchedRule(request string) bool {
+	rule := handler.matchedRule(RuleMailfrom, handler.mailfromEmail(request))
+	if rule == nil {
+		return false
+	}
+
+	return handler.writeResultWithDelay(handler.applyRule(rule), request, rule.response, rule.responseDelay)
+}
+
+// Custom behavior for MAILFROM command. Returns true and writes rate limit result for case when
+// server MAILFROM attempts per window limit is reached. Rate limit response 421 ends session
+func (handler *handlerMailfrom) isRateLimited(request string) bool {
+	if handler.limiter == nil || handler.limiter.allowMessage() {
+		return false
+	}
+
+	response := handler.configuration.msgMailfromRateLimit
+	handler.message.failFast = isServiceNotAvailableReply(response)
+
+	return handler.writeResult(false, request, response)
+}
+
 // Invalid MAILFROM command request complex predicate. Returns true for case when one
 // of the chain checks returns true, otherwise returns false
 func (handler *handlerMailfrom) isInvalidRequest(request string) bool {
 	return handler.isInvalidCmdSequence(request) ||
 		handler.isInvalidCmdArg(request) ||
+		handler.isRateLimited(request) ||
+		handler.isSequencedResponse(request) ||
+		handler.isMatchedRule(request) ||
 		handler.isBlacklistedEmail(request)
 }
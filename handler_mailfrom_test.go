@@ -3,6 +3,7 @@ package smtpmock
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -102,6 +103,19 @@ func TestHandlerMailfromClearMessage(t *testing.T) {
 		handler.clearMessage()
 		assert.Equal(t, clearedMessage, handler.message)
 	})
+
+	t.Run("keeps message session identifier", func(t *testing.T) {
+		message := &Message{heloRequest: "42", sessionID: 42}
+		newHandlerMailfrom(new(session), message, new(configuration)).clearMessage()
+
+		assert.Equal(t, 42, message.sessionID)
+	})
+	t.Run("keeps custom requests and responses", func(t *testing.T) {
+		message := &Message{customRequestResponse: [][]string{{"ETRN example.com", "250 Queuing started"}}, mailfromRequest: "42"}
+		newHandlerMailfrom(new(session), message, new(configuration)).clearMessage()
+
+		assert.Equal(t, [][]string{{"ETRN example.com", "250 Queuing started"}}, message.customRequestResponse)
+	})
 }
 
 func TestHandlerMailfromWriteResult(t *testing.T) {
@@ -132,6 +146,19 @@ func TestHandlerMailfromWriteResult(t *testing.T) {
 	})
 }
 
+func TestHandlerMailfromWriteResultWithDelay(t *testing.T) {
+	t.Run("writes response with the given delay", func(t *testing.T) {
+		request, response, responseDelay := "request context", "response context", 42*time.Millisecond
+		session, message := &sessionMock{}, new(Message)
+		handler := newHandlerMailfrom(session, message, createConfiguration())
+		session.On("writeResponse", response, responseDelay).Once().Return(nil)
+
+		assert.True(t, handler.writeResultWithDelay(true, request, response, responseDelay))
+		assert.True(t, message.mailfrom)
+		assert.Equal(t, response, message.mailfromResponse)
+	})
+}
+
 func TestHandlerMailfromIsInvalidCmdSequence(t *testing.T) {
 	request, configuration, session := "some request", createConfiguration(), &sessionMock{}
 
@@ -312,6 +339,134 @@ func TestHandlerHeloIsBlacklistedEmail(t *testing.T) {
 	})
 }
 
+func TestHandlerMailfromIsRateLimited(t *testing.T) {
+	request := "MAIL FROM: user@example.com"
+
+	t.Run("when rate limit is reached", func(t *testing.T) {
+		session, message, configuration := new(sessionMock), new(Message), newConfiguration(ConfigurationAttr{MaxMessagesPerWindow: 1})
+		handler, response := newHandlerMailfrom(session, message, configuration), configuration.msgMailfromRateLimit
+		handler.limiter = newLimiter(configuration)
+		handler.limiter.allowMessage()
+		session.On("addError", errors.New(response)).Once().Return(nil)
+		session.On("writeResponse", response, configuration.responseDelayMailfrom).Once().Return(nil)
+
+		assert.True(t, handler.isRateLimited(request))
+		assert.False(t, message.mailfrom)
+		assert.False(t, message.failFast)
+		assert.Equal(t, response, message.mailfromResponse)
+	})
+
+	t.Run("when rate limit is reached, rate limit response is 421", func(t *testing.T) {
+		response := "421 Rate limit exceeded"
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(ConfigurationAttr{MaxMessagesPerWindow: 1, MsgMailfromRateLimit: response})
+		handler := newHandlerMailfrom(session, message, configuration)
+		handler.limiter = newLimiter(configuration)
+		handler.limiter.allowMessage()
+		session.On("addError", errors.New(response)).Once().Return(nil)
+		session.On("writeResponse", response, configuration.responseDelayMailfrom).Once().Return(nil)
+
+		assert.True(t, handler.isRateLimited(request))
+		assert.True(t, message.failFast)
+	})
+
+	t.Run("when rate limit is not reached", func(t *testing.T) {
+		session, message, configuration := new(sessionMock), new(Message), newConfiguration(ConfigurationAttr{MaxMessagesPerWindow: 1})
+		handler := newHandlerMailfrom(session, message, configuration)
+		handler.limiter = newLimiter(configuration)
+
+		assert.False(t, handler.isRateLimited(request))
+		assert.False(t, handler.limiter.allowMessage())
+	})
+
+	t.Run("when limiter is not shared with handler", func(t *testing.T) {
+		handler := newHandlerMailfrom(new(sessionMock), new(Message), createConfiguration())
+
+		assert.False(t, handler.isRateLimited(request))
+	})
+}
+
+func TestHandlerMailfromIsSequencedResponse(t *testing.T) {
+	request, response := "MAIL FROM: user@example.com", "451 Try again later"
+
+	t.Run("when attempt is covered by failing sequenced response", func(t *testing.T) {
+		session, message, configuration := new(sessionMock), new(Message), createConfiguration()
+		handler := newHandlerMailfrom(session, message, configuration)
+		handler.responseSequences = newResponseSequences([]ResponseSequence{{Command: RuleMailfrom, Responses: []string{response}}})
+		session.On("addError", errors.New(response)).Once().Return(nil)
+		session.On("writeResponse", response, configuration.responseDelayMailfrom).Once().Return(nil)
+
+		assert.True(t, handler.isSequencedResponse(request))
+		assert.False(t, message.mailfrom)
+		assert.Equal(t, response, message.mailfromResponse)
+	})
+
+	t.Run("when attempt is covered by successful sequenced response", func(t *testing.T) {
+		response := "250 Accepted"
+		session, message, configuration := new(sessionMock), new(Message), createConfiguration()
+		handler := newHandlerMailfrom(session, message, configuration)
+		handler.responseSequences = newResponseSequences([]ResponseSequence{{Responses: []string{response}}})
+		session.On("writeResponse", response, configuration.responseDelayMailfrom).Once().Return(nil)
+
+		assert.True(t, handler.isSequencedResponse(request))
+		assert.True(t, message.mailfrom)
+		assert.Equal(t, response, message.mailfromResponse)
+	})
+
+	t.Run("when attempt is not covered by response sequences", func(t *testing.T) {
+		session, message := new(sessionMock), new(Message)
+		handler := newHandlerMailfrom(session, message, createConfiguration())
+		handler.responseSequences = newResponseSequences([]ResponseSequence{{Command: RuleHelo, Responses: []string{response}}})
+
+		assert.False(t, handler.isSequencedResponse(request))
+		assert.False(t, message.mailfrom)
+	})
+}
+
+func TestHandlerMailfromIsMatchedRule(t *testing.T) {
+	request := "MAIL FROM: user@sub.example.com"
+
+	t.Run("when request matches rejecting rule", func(t *testing.T) {
+		response := "550 Rejected"
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(
+			ConfigurationAttr{
+				Rules: []Rule{{Commands: []RuleCommand{RuleMailfrom}, Matcher: DomainSuffixMatcher, Pattern: "example.com", Response: response, ResponseDelay: 2 * time.Second, FailFast: true}},
+			},
+		)
+		handler := newHandlerMailfrom(session, message, configuration)
+		session.On("addError", errors.New(response)).Once().Return(nil)
+		session.On("writeResponse", response, 2*time.Second).Once().Return(nil)
+
+		assert.True(t, handler.isMatchedRule(request))
+		assert.False(t, message.mailfrom)
+		assert.True(t, message.failFast)
+		assert.Equal(t, response, message.mailfromResponse)
+	})
+
+	t.Run("when request matches accepting rule", func(t *testing.T) {
+		response := "250 Accepted"
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(ConfigurationAttr{Rules: []Rule{{Pattern: "user@*.com", Response: response}}})
+		handler := newHandlerMailfrom(session, message, configuration)
+		session.On("writeResponse", response, defaultSessionResponseDelay).Once().Return(nil)
+
+		assert.True(t, handler.isMatchedRule(request))
+		assert.True(t, message.mailfrom)
+		assert.False(t, message.failFast)
+		assert.Equal(t, response, message.mailfromResponse)
+	})
+
+	t.Run("when request not matches rules", func(t *testing.T) {
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(ConfigurationAttr{Rules: []Rule{{Commands: []RuleCommand{RuleHelo}, Pattern: "*", Response: "550 Rejected"}}})
+		handler := newHandlerMailfrom(session, message, configuration)
+
+		assert.False(t, handler.isMatchedRule(request))
+		assert.False(t, message.mailfrom)
+	})
+}
+
 func TestHandlerMailfromIsInvalidRequest(t *testing.T) {
 	configuration := createConfiguration()
 
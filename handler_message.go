@@ -3,6 +3,8 @@ package smtpmock
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"time"
 )
 
 // Message handler interface
@@ -20,12 +22,20 @@ func newHandlerMessage(session sessionInterface, message *Message, configuration
 	return &handlerMessage{&handler{session: session, message: message, configuration: configuration}}
 }
 
+// Reads and saves message body context using handlerMessage under the hood. Message body is
+// answered by the given response with the given delay instead of configured ones
+func receiveMessage(session sessionInterface, message *Message, configuration *configuration, response string, delay time.Duration) {
+	messageConfiguration := *configuration
+	messageConfiguration.msgMsgReceived, messageConfiguration.responseDelayMessage = response, delay
+	newHandlerMessage(session, message, &messageConfiguration).run()
+}
+
 // Message handler methods
 
 // Main message handler runner
 func (handler *handlerMessage) run() {
 	var request string
-	var msgData []byte
+	var msgData, rawMsgData []byte
 	session, configuration := handler.session, handler.configuration
 
 	for {
@@ -34,6 +44,9 @@ func (handler *handlerMessage) run() {
 			return
 		}
 
+		// Keeps exact wire bytes including dot-stuffing and terminator
+		rawMsgData = append(rawMsgData, line...)
+
 		// Handles end of data denoted by lone period (\r\n.\r\n)
 		if bytes.Equal(line, []byte(".\r\n")) {
 			break
@@ -47,6 +60,7 @@ func (handler *handlerMessage) run() {
 		// Enforces the maximum message size limit
 		if len(msgData)+len(line) > configuration.msgSizeLimit {
 			session.discardBufin()
+			handler.message.msgRawRequest = string(rawMsgData)
 			handler.writeResult(false, request, configuration.msgMsgSizeIsTooBig)
 			return
 		}
@@ -54,7 +68,47 @@ func (handler *handlerMessage) run() {
 		msgData = append(msgData, line...)
 	}
 
-	handler.writeResult(true, string(msgData), configuration.msgMsgReceived)
+	handler.message.msgRawRequest = string(rawMsgData)
+	if handler.isInvalidMessage(string(msgData)) {
+		handler.writeResult(false, string(msgData), configuration.msgMsgInvalid)
+		return
+	}
+
+	handler.message.security = newMessageSecurity(string(msgData), configuration.securityKeyRing)
+	handler.writeResult(true, handler.prependReceivedHeader(string(msgData)), configuration.msgMsgReceived)
+}
+
+// Invalid message predicate. Validates message for case when message validation is enabled,
+// attaches findings to message. Returns true for case when message has findings and
+// invalid message rejection is enabled, otherwise returns false
+func (handler *handlerMessage) isInvalidMessage(msgData string) bool {
+	configuration, message := handler.configuration, handler.message
+	if !configuration.validateMessage {
+		return false
+	}
+
+	message.validationFindings = newMessageValidator().validate(msgData)
+	return configuration.rejectInvalidMessage && len(message.validationFindings) > 0
+}
+
+// Prepends Received header to message body for case when this feature is enabled.
+// Returns message body without changes for case when header rendering failed, triggers
+// session logger with warning level in this case
+func (handler *handlerMessage) prependReceivedHeader(msgData string) string {
+	configuration, message := handler.configuration, handler.message
+	if !configuration.prependReceivedHeader {
+		return msgData
+	}
+
+	context := newReceivedHeaderContext(message, handler.session.remoteAddress())
+	header, err := renderReceivedHeader(configuration.receivedHeaderTemplate, context)
+	if err != nil {
+		handler.session.logWarning(fmt.Sprintf("%s: %s", receivedHeaderRenderErrorMsg, err))
+		return msgData
+	}
+
+	message.queueID = context.QueueID
+	return header + msgData
 }
 
 // Writes handled message result to session, message. Always returns true
@@ -2,9 +2,13 @@ package smtpmock
 
 import (
 	"errors"
+	"strings"
 	"testing"
+	"text/template"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestNewHandlerMessage(t *testing.T) {
@@ -44,6 +48,7 @@ func TestHandlerMessageRun(t *testing.T) {
 
 		assert.False(t, message.msg)
 		assert.Equal(t, emptyString, message.msgRequest)
+		assert.Equal(t, "some message", message.msgRawRequest)
 		assert.Equal(t, errorMessage, message.msgResponse)
 	})
 
@@ -57,8 +62,172 @@ func TestHandlerMessageRun(t *testing.T) {
 
 		assert.True(t, message.msg)
 		assert.Equal(t, msgContext, message.msgRequest)
+		assert.Equal(t, "."+msgContext+".\r\n", message.msgRawRequest)
 		assert.Equal(t, defaultReceivedMsg, message.msgResponse)
 	})
+
+	t.Run("when message received with dot-stuffed and bare LF lines", func(t *testing.T) {
+		session, message, configuration := new(sessionMock), new(Message), createConfiguration()
+		handler := newHandlerMessage(session, message, configuration)
+		session.On("readBytes").Once().Return([]uint8("..leading dot\r\n"), nil)
+		session.On("readBytes").Once().Return([]uint8("bare lf\n"), nil)
+		session.On("readBytes").Once().Return([]uint8(".\r\n"), nil)
+		session.On("writeResponse", defaultReceivedMsg, configuration.responseDelayMessage).Once().Return(nil)
+		handler.run()
+
+		assert.True(t, message.msg)
+		assert.Equal(t, ".leading dot\r\nbare lf\n", message.msgRequest)
+		assert.Equal(t, "..leading dot\r\nbare lf\n.\r\n", message.msgRawRequest)
+	})
+
+	t.Run("when encrypted message received", func(t *testing.T) {
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(
+			ConfigurationAttr{SMIMEPrivateKeys: securityFixture("smime_user.key"), PGPKeyRing: securityFixture("pgp_secret.asc")},
+		)
+		handler := newHandlerMessage(session, message, configuration)
+		session.On("readBytes").Once().Return([]uint8(securityFixture("pgp_encrypted.eml")), nil)
+		session.On("readBytes").Once().Return([]uint8(".\r\n"), nil)
+		session.On("writeResponse", defaultReceivedMsg, configuration.responseDelayMessage).Once().Return(nil)
+		handler.run()
+
+		assert.True(t, message.msg)
+		assert.True(t, message.security.Decrypted)
+		assert.Equal(t, "Secret text\r\n", string(message.security.Part.Body))
+	})
+
+	t.Run("when message is neither encrypted nor signed", func(t *testing.T) {
+		session, message, configuration := new(sessionMock), new(Message), createConfiguration()
+		handler := newHandlerMessage(session, message, configuration)
+		session.On("readBytes").Once().Return([]uint8("Subject: Test\r\n\r\nBody\r\n"), nil)
+		session.On("readBytes").Once().Return([]uint8(".\r\n"), nil)
+		session.On("writeResponse", defaultReceivedMsg, configuration.responseDelayMessage).Once().Return(nil)
+		handler.run()
+
+		assert.True(t, message.msg)
+		assert.Nil(t, message.security)
+	})
+}
+
+func TestHandlerMessageRunWithValidation(t *testing.T) {
+	invalidMsgContext := "Subject: Test\r\n\r\nBody\r\n"
+
+	t.Run("when invalid message received, rejection disabled", func(t *testing.T) {
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(ConfigurationAttr{ValidateMessage: true})
+		handler := newHandlerMessage(session, message, configuration)
+		session.On("readBytes").Once().Return([]uint8(invalidMsgContext), nil)
+		session.On("readBytes").Once().Return([]uint8(".\r\n"), nil)
+		session.On("writeResponse", configuration.msgMsgReceived, configuration.responseDelayMessage).Once().Return(nil)
+		handler.run()
+
+		assert.True(t, message.msg)
+		assert.Equal(t, invalidMsgContext, message.msgRequest)
+		assert.Len(t, message.validationFindings, 2)
+	})
+
+	t.Run("when invalid message received, rejection enabled", func(t *testing.T) {
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(ConfigurationAttr{ValidateMessage: true, RejectInvalidMessage: true})
+		handler := newHandlerMessage(session, message, configuration)
+		session.On("readBytes").Once().Return([]uint8(invalidMsgContext), nil)
+		session.On("readBytes").Once().Return([]uint8(".\r\n"), nil)
+		session.On("addError", errors.New(configuration.msgMsgInvalid)).Once().Return(nil)
+		session.On("writeResponse", configuration.msgMsgInvalid, configuration.responseDelayMessage).Once().Return(nil)
+		handler.run()
+
+		assert.False(t, message.msg)
+		assert.Equal(t, invalidMsgContext, message.msgRequest)
+		assert.Equal(t, configuration.msgMsgInvalid, message.msgResponse)
+		assert.Len(t, message.validationFindings, 2)
+	})
+}
+
+func TestHandlerMessageIsInvalidMessage(t *testing.T) {
+	validMsgData := "Date: Tue, 30 Nov 2021 22:07:30 +0000\r\nFrom: user@example.com\r\n\r\nBody\r\n"
+	invalidMsgData := "Subject: Test\r\n\r\nBody\r\n"
+
+	t.Run("when message validation disabled", func(t *testing.T) {
+		message := new(Message)
+		handler := newHandlerMessage(new(sessionMock), message, createConfiguration())
+
+		assert.False(t, handler.isInvalidMessage(invalidMsgData))
+		assert.Empty(t, message.validationFindings)
+	})
+
+	t.Run("when valid message, rejection enabled", func(t *testing.T) {
+		message := new(Message)
+		configuration := newConfiguration(ConfigurationAttr{ValidateMessage: true, RejectInvalidMessage: true})
+		handler := newHandlerMessage(new(sessionMock), message, configuration)
+
+		assert.False(t, handler.isInvalidMessage(validMsgData))
+		assert.Empty(t, message.validationFindings)
+	})
+
+	t.Run("when invalid message, rejection disabled", func(t *testing.T) {
+		message := new(Message)
+		configuration := newConfiguration(ConfigurationAttr{ValidateMessage: true})
+		handler := newHandlerMessage(new(sessionMock), message, configuration)
+
+		assert.False(t, handler.isInvalidMessage(invalidMsgData))
+		assert.NotEmpty(t, message.validationFindings)
+	})
+
+	t.Run("when invalid message, rejection enabled", func(t *testing.T) {
+		message := new(Message)
+		configuration := newConfiguration(ConfigurationAttr{ValidateMessage: true, RejectInvalidMessage: true})
+		handler := newHandlerMessage(new(sessionMock), message, configuration)
+
+		assert.True(t, handler.isInvalidMessage(invalidMsgData))
+		assert.NotEmpty(t, message.validationFindings)
+	})
+}
+
+func TestHandlerMessagePrependReceivedHeader(t *testing.T) {
+	msgData := "Subject: Test\r\n\r\nBody\r\n"
+
+	t.Run("when prepending Received header disabled", func(t *testing.T) {
+		session, message := new(sessionMock), new(Message)
+		handler := newHandlerMessage(session, message, createConfiguration())
+
+		assert.Equal(t, msgData, handler.prependReceivedHeader(msgData))
+		assert.Empty(t, message.queueID)
+	})
+
+	t.Run("when prepending Received header enabled", func(t *testing.T) {
+		timeStub, queueID := time.Date(2021, 11, 30, 22, 7, 30, 0, time.UTC), "ABCDEF012345"
+		timeNow, generateQueueID = func() time.Time { return timeStub }, func() string { return queueID }
+		defer func() { timeNow, generateQueueID = time.Now, originalGenerateQueueID }()
+		session, configuration := new(sessionMock), newConfiguration(ConfigurationAttr{PrependReceivedHeader: true})
+		message := &Message{
+			heloRequest:           "EHLO example.com",
+			rcpttoRequestResponse: [][]string{{"RCPT TO:<user@example.com>", configuration.msgRcpttoReceived}},
+		}
+		handler := newHandlerMessage(session, message, configuration)
+		session.On("remoteAddress").Once().Return("127.0.0.1:42")
+		expectedHeader := "Received: from example.com ([127.0.0.1])\r\n" +
+			"\tby localhost with ESMTP id ABCDEF012345\r\n" +
+			"\tfor <user@example.com>;\r\n" +
+			"\tTue, 30 Nov 2021 22:07:30 +0000\r\n"
+
+		assert.Equal(t, expectedHeader+msgData, handler.prependReceivedHeader(msgData))
+		assert.Equal(t, queueID, message.queueID)
+	})
+
+	t.Run("when Received header rendering failed", func(t *testing.T) {
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(ConfigurationAttr{PrependReceivedHeader: true})
+		configuration.receivedHeaderTemplate = template.Must(template.New(receivedHeaderTemplateName).Parse("{{.NotExistingField}}"))
+		handler := newHandlerMessage(session, message, configuration)
+		session.On("remoteAddress").Once().Return("127.0.0.1:42")
+		session.On("logWarning", mock.MatchedBy(func(warning string) bool {
+			return strings.HasPrefix(warning, receivedHeaderRenderErrorMsg+": ") && strings.Contains(warning, "NotExistingField")
+		})).Once().Return()
+
+		assert.Equal(t, msgData, handler.prependReceivedHeader(msgData))
+		assert.Empty(t, message.queueID)
+		session.AssertExpectations(t)
+	})
 }
 
 func TestHandlerMessageWriteResult(t *testing.T) {
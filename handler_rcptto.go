@@ -1,6 +1,9 @@
 package smtpmock
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // RCPTTO command handler
 type handlerRcptto struct {
@@ -31,12 +34,14 @@ func (handler *handlerRcptto) clearMessage() {
 	if !handler.configuration.multipleRcptto {
 		messageWithData := handler.message
 		clearedMessage := &Message{
-			heloRequest:      messageWithData.heloRequest,
-			heloResponse:     messageWithData.heloResponse,
-			helo:             messageWithData.helo,
-			mailfromRequest:  messageWithData.mailfromRequest,
-			mailfromResponse: messageWithData.mailfromResponse,
-			mailfrom:         messageWithData.mailfrom,
+			heloRequest:           messageWithData.heloRequest,
+			heloResponse:          messageWithData.heloResponse,
+			helo:                  messageWithData.helo,
+			mailfromRequest:       messageWithData.mailfromRequest,
+			mailfromResponse:      messageWithData.mailfromResponse,
+			mailfrom:              messageWithData.mailfrom,
+			customRequestResponse: messageWithData.customRequestResponse,
+			sessionID:             messageWithData.sessionID,
 		}
 		*messageWithData = *clearedMessage
 	}
@@ -46,14 +51,16 @@ func (handler *handlerRcptto) clearMessage() {
 // when multiple RCPTTO scenario is enabled and message includes at least one successful
 // RCPTTO response. Otherwise returns false
 func (handler *handlerRcptto) resolveMessageStatus(currentRcpttoStatus bool) bool {
-	configuration, message := handler.configuration, handler.message
-	multipleRcptto, msgRcpttoReceived := configuration.multipleRcptto, configuration.msgRcpttoReceived
-
-	return currentRcpttoStatus || (multipleRcptto && message.isIncludesSuccessfulRcpttoResponse(msgRcpttoReceived))
+	return currentRcpttoStatus || (handler.configuration.multipleRcptto && handler.message.isIncludesSuccessfulRcpttoResponse())
 }
 
 // Writes handled RCPTTO result to session, message. Always returns true
 func (handler *handlerRcptto) writeResult(isSuccessful bool, request, response string) bool {
+	return handler.writeResultWithDelay(isSuccessful, request, response, handler.configuration.responseDelayRcptto)
+}
+
+// Writes handled RCPTTO result with the given response delay to session, message. Always returns true
+func (handler *handlerRcptto) writeResultWithDelay(isSuccessful bool, request, response string, responseDelay time.Duration) bool {
 	session, message := handler.session, handler.message
 	if !isSuccessful {
 		session.addError(errors.New(response))
@@ -61,7 +68,7 @@ func (handler *handlerRcptto) writeResult(isSuccessful bool, request, response s
 
 	message.rcpttoRequestResponse = append(message.rcpttoRequestResponse, []string{request, response})
 	message.rcptto = handler.resolveMessageStatus(isSuccessful)
-	session.writeResponse(response, handler.configuration.responseDelayRcptto)
+	session.writeResponse(response, responseDelay)
 	return true
 }
 
@@ -114,11 +121,66 @@ func (handler *handlerRcptto) isNotRegisteredEmail(request string) bool {
 	return false
 }
 
+// Custom behavior for RCPTTO email. Returns true and writes sequenced response for case when
+// RCPTTO email attempt is covered by one of server response sequences
+func (handler *handlerRcptto) isSequencedResponse(request string) bool {
+	response, found := handler.sequencedResponse(RuleRcptto, handler.rcpttoEmail(request))
+	if !found {
+		return false
+	}
+
+	return handler.writeResult(isPositiveCompletionReply(response), request, response)
+}
+
+// Custom behavior for RCPTTO email. Returns true and writes rule result for case when
+// RCPTTO email matches one of configuration.rules
+func (handler *handlerRcptto) isMatchedRule(request string) bool {
+	rule := handler.matchedRule(RuleRcptto, handler.rcpttoEmail(request))
+	if rule == nil {
+		return false
+	}
+
+	return handler.writeResultWithDelay(handler.applyRule(rule), request, rule.response, rule.responseDelay)
+}
+
+// Custom behavior for RCPTTO email. Returns true and writes result for case when greylisting
+// is enabled and (IP, sender, recipient) triplet has not passed server greylist yet
+func (handler *handlerRcptto) isGreylisted(request string) bool {
+	configuration, greylist := handler.configuration, handler.greylist
+	if !configuration.greylisting || greylist == nil {
+		return false
+	}
+
+	ip, sender := remoteHost(handler.session.remoteAddress()), handler.message.Sender()
+	if greylist.isPassed(ip, sender, handler.rcpttoEmail(request)) {
+		return false
+	}
+
+	return handler.writeResult(false, request, configuration.msgRcpttoGreylisted)
+}
+
+// Custom behavior for RCPTTO command. Returns true and writes rate limit result for case when
+// server RCPTTO attempts per window limit is reached. Rate limit response 421 ends session
+func (handler *handlerRcptto) isRateLimited(request string) bool {
+	if handler.limiter == nil || handler.limiter.allowRcptto() {
+		return false
+	}
+
+	response := handler.configuration.msgRcpttoRateLimit
+	handler.message.failFast = isServiceNotAvailableReply(response)
+
+	return handler.writeResult(false, request, response)
+}
+
 // Invalid RCPTTO command request complex predicate. Returns true for case when one
 // of the chain checks returns true, otherwise returns false
 func (handler *handlerRcptto) isInvalidRequest(request string) bool {
 	return handler.isInvalidCmdSequence(request) ||
 		handler.isInvalidCmdArg(request) ||
+		handler.isRateLimited(request) ||
+		handler.isSequencedResponse(request) ||
+		handler.isMatchedRule(request) ||
 		handler.isBlacklistedEmail(request) ||
-		handler.isNotRegisteredEmail(request)
+		handler.isNotRegisteredEmail(request) ||
+		handler.isGreylisted(request)
 }
@@ -3,6 +3,7 @@ package smtpmock
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -127,6 +128,19 @@ func TestHandlerRcpttoClearMessage(t *testing.T) {
 
 		assert.Same(t, notEmptyMessage, handler.message)
 	})
+
+	t.Run("keeps message session identifier", func(t *testing.T) {
+		message := &Message{heloRequest: "42", sessionID: 42}
+		newHandlerRcptto(new(session), message, new(configuration)).clearMessage()
+
+		assert.Equal(t, 42, message.sessionID)
+	})
+	t.Run("keeps custom requests and responses", func(t *testing.T) {
+		message := &Message{customRequestResponse: [][]string{{"ETRN example.com", "250 Queuing started"}}, mailfromRequest: "42"}
+		newHandlerRcptto(new(session), message, new(configuration)).clearMessage()
+
+		assert.Equal(t, [][]string{{"ETRN example.com", "250 Queuing started"}}, message.customRequestResponse)
+	})
 }
 
 func TestHandlerRcpttoResolveMessageStatus(t *testing.T) {
@@ -137,9 +151,8 @@ func TestHandlerRcpttoResolveMessageStatus(t *testing.T) {
 	})
 
 	t.Run("when current RCPTTO status is false, multiple RCPTTO is enabled, includes successful RCPTTO responses", func(t *testing.T) {
-		msgRcpttoReceived := "response"
-		message := &Message{rcpttoRequestResponse: [][]string{{"request", msgRcpttoReceived}}}
-		configuration := &configuration{multipleRcptto: true, msgRcpttoReceived: msgRcpttoReceived}
+		message := &Message{rcpttoRequestResponse: [][]string{{"request", "250 Accepted"}}}
+		configuration := &configuration{multipleRcptto: true, msgRcpttoReceived: "250 Received"}
 		handler := newHandlerRcptto(new(session), message, configuration)
 
 		assert.True(t, handler.resolveMessageStatus(false))
@@ -158,9 +171,8 @@ func TestHandlerRcpttoResolveMessageStatus(t *testing.T) {
 	})
 
 	t.Run("when current RCPTTO status is false, multiple RCPTTO is disabled, includes successful RCPTTO responses", func(t *testing.T) {
-		msgRcpttoReceived := "response"
-		message := &Message{rcpttoRequestResponse: [][]string{{"request", msgRcpttoReceived}}}
-		configuration := &configuration{msgRcpttoReceived: msgRcpttoReceived}
+		message := &Message{rcpttoRequestResponse: [][]string{{"request", "250 Received"}}}
+		configuration := &configuration{msgRcpttoReceived: "250 Received"}
 		handler := newHandlerRcptto(new(session), message, configuration)
 
 		assert.False(t, handler.resolveMessageStatus(false))
@@ -181,15 +193,16 @@ func TestHandlerRcpttoWriteResult(t *testing.T) {
 	})
 
 	t.Run("when successful request received, current RCPTTO status is false, multiple RCPTTO is enabled, includes successful RCPTTO responses", func(t *testing.T) {
-		configuration := &configuration{multipleRcptto: true, msgRcpttoReceived: response}
-		message, err := new(Message), errors.New(response)
+		successfulResponse := "250 Accepted"
+		configuration := &configuration{multipleRcptto: true, msgRcpttoReceived: "250 Received"}
+		message, err := &Message{rcpttoRequestResponse: [][]string{{request, successfulResponse}}}, errors.New(response)
 		handler := newHandlerRcptto(session, message, configuration)
 		session.On("addError", err).Once().Return(nil)
 		session.On("writeResponse", response, configuration.responseDelayRcptto).Once().Return(nil)
 
 		assert.True(t, handler.writeResult(false, request, response))
 		assert.True(t, message.rcptto)
-		assert.Equal(t, [][]string{{request, response}}, message.rcpttoRequestResponse)
+		assert.Equal(t, [][]string{{request, successfulResponse}, {request, response}}, message.rcpttoRequestResponse)
 	})
 
 	t.Run("when failed request received, RCPTTO status is false, multiple RCPTTO is enabled, not includes successful RCPTTO responses", func(t *testing.T) {
@@ -215,7 +228,7 @@ func TestHandlerRcpttoWriteResult(t *testing.T) {
 	})
 
 	t.Run("when failed request received, RCPTTO status is false, multiple RCPTTO is disabled, includes successful RCPTTO responses", func(t *testing.T) {
-		successfulResponse := "successfulResponse"
+		successfulResponse := "250 Received"
 		configuration := &configuration{msgRcpttoReceived: successfulResponse}
 		message, err := &Message{rcpttoRequestResponse: [][]string{{request, successfulResponse}}}, errors.New(response)
 		handler := newHandlerRcptto(session, message, configuration)
@@ -228,6 +241,19 @@ func TestHandlerRcpttoWriteResult(t *testing.T) {
 	})
 }
 
+func TestHandlerRcpttoWriteResultWithDelay(t *testing.T) {
+	t.Run("writes response with the given delay", func(t *testing.T) {
+		request, response, responseDelay := "request context", "response context", 42*time.Millisecond
+		session, message := &sessionMock{}, new(Message)
+		handler := newHandlerRcptto(session, message, createConfiguration())
+		session.On("writeResponse", response, responseDelay).Once().Return(nil)
+
+		assert.True(t, handler.writeResultWithDelay(true, request, response, responseDelay))
+		assert.True(t, message.rcptto)
+		assert.Equal(t, [][]string{{request, response}}, message.rcpttoRequestResponse)
+	})
+}
+
 func TestHandlerRcpttoIsInvalidCmdSequence(t *testing.T) {
 	request, configuration, session := "some request", createConfiguration(), &sessionMock{}
 
@@ -415,6 +441,184 @@ func TestHandlerRcpttoIsNotRegisteredEmail(t *testing.T) {
 	})
 }
 
+func TestHandlerRcpttoIsRateLimited(t *testing.T) {
+	request := "RCPT TO: user@example.com"
+
+	t.Run("when rate limit is reached", func(t *testing.T) {
+		session, message, configuration := new(sessionMock), new(Message), newConfiguration(ConfigurationAttr{MaxRcpttosPerWindow: 1})
+		handler, response := newHandlerRcptto(session, message, configuration), configuration.msgRcpttoRateLimit
+		handler.limiter = newLimiter(configuration)
+		handler.limiter.allowRcptto()
+		session.On("addError", errors.New(response)).Once().Return(nil)
+		session.On("writeResponse", response, configuration.responseDelayRcptto).Once().Return(nil)
+
+		assert.True(t, handler.isRateLimited(request))
+		assert.False(t, message.rcptto)
+		assert.False(t, message.failFast)
+		assert.Equal(t, [][]string{{request, response}}, message.rcpttoRequestResponse)
+	})
+
+	t.Run("when rate limit is reached, rate limit response is 421", func(t *testing.T) {
+		response := "421 Rate limit exceeded"
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(ConfigurationAttr{MaxRcpttosPerWindow: 1, MsgRcpttoRateLimit: response})
+		handler := newHandlerRcptto(session, message, configuration)
+		handler.limiter = newLimiter(configuration)
+		handler.limiter.allowRcptto()
+		session.On("addError", errors.New(response)).Once().Return(nil)
+		session.On("writeResponse", response, configuration.responseDelayRcptto).Once().Return(nil)
+
+		assert.True(t, handler.isRateLimited(request))
+		assert.True(t, message.failFast)
+	})
+
+	t.Run("when rate limit is not reached", func(t *testing.T) {
+		session, message, configuration := new(sessionMock), new(Message), newConfiguration(ConfigurationAttr{MaxRcpttosPerWindow: 1})
+		handler := newHandlerRcptto(session, message, configuration)
+		handler.limiter = newLimiter(configuration)
+
+		assert.False(t, handler.isRateLimited(request))
+		assert.False(t, handler.limiter.allowRcptto())
+	})
+
+	t.Run("when limiter is not shared with handler", func(t *testing.T) {
+		handler := newHandlerRcptto(new(sessionMock), new(Message), createConfiguration())
+
+		assert.False(t, handler.isRateLimited(request))
+	})
+}
+
+func TestHandlerRcpttoIsSequencedResponse(t *testing.T) {
+	request, response := "RCPT TO: user@example.com", "451 Try again later"
+
+	t.Run("when attempt is covered by failing sequenced response", func(t *testing.T) {
+		session, message, configuration := new(sessionMock), new(Message), createConfiguration()
+		handler := newHandlerRcptto(session, message, configuration)
+		handler.responseSequences = newResponseSequences([]ResponseSequence{{Command: RuleRcptto, Responses: []string{response}}})
+		session.On("addError", errors.New(response)).Once().Return(nil)
+		session.On("writeResponse", response, configuration.responseDelayRcptto).Once().Return(nil)
+
+		assert.True(t, handler.isSequencedResponse(request))
+		assert.False(t, message.rcptto)
+		assert.Equal(t, [][]string{{request, response}}, message.rcpttoRequestResponse)
+	})
+
+	t.Run("when attempt is covered by successful sequenced response", func(t *testing.T) {
+		response := "250 Accepted"
+		session, message, configuration := new(sessionMock), new(Message), createConfiguration()
+		handler := newHandlerRcptto(session, message, configuration)
+		handler.responseSequences = newResponseSequences([]ResponseSequence{{Responses: []string{response}}})
+		session.On("writeResponse", response, configuration.responseDelayRcptto).Once().Return(nil)
+
+		assert.True(t, handler.isSequencedResponse(request))
+		assert.True(t, message.rcptto)
+		assert.Equal(t, [][]string{{request, response}}, message.rcpttoRequestResponse)
+	})
+
+	t.Run("when attempt is not covered by response sequences", func(t *testing.T) {
+		session, message := new(sessionMock), new(Message)
+		handler := newHandlerRcptto(session, message, createConfiguration())
+		handler.responseSequences = newResponseSequences([]ResponseSequence{{Command: RuleMailfrom, Responses: []string{response}}})
+
+		assert.False(t, handler.isSequencedResponse(request))
+		assert.False(t, message.rcptto)
+	})
+}
+
+func TestHandlerRcpttoIsMatchedRule(t *testing.T) {
+	request := "RCPT TO: user@example.com"
+
+	t.Run("when request matches rejecting rule", func(t *testing.T) {
+		response := "550 Rejected"
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(
+			ConfigurationAttr{
+				Rules: []Rule{{Commands: []RuleCommand{RuleRcptto}, Matcher: DomainSuffixMatcher, Pattern: "example.com", Response: response, ResponseDelay: 2 * time.Second, FailFast: true}},
+			},
+		)
+		handler := newHandlerRcptto(session, message, configuration)
+		session.On("addError", errors.New(response)).Once().Return(nil)
+		session.On("writeResponse", response, 2*time.Second).Once().Return(nil)
+
+		assert.True(t, handler.isMatchedRule(request))
+		assert.False(t, message.rcptto)
+		assert.True(t, message.failFast)
+		assert.Equal(t, [][]string{{request, response}}, message.rcpttoRequestResponse)
+	})
+
+	t.Run("when request matches accepting rule", func(t *testing.T) {
+		response := "250 Accepted"
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(ConfigurationAttr{Rules: []Rule{{Pattern: "user@example.???", Response: response}}})
+		handler := newHandlerRcptto(session, message, configuration)
+		session.On("writeResponse", response, defaultSessionResponseDelay).Once().Return(nil)
+
+		assert.True(t, handler.isMatchedRule(request))
+		assert.True(t, message.rcptto)
+		assert.False(t, message.failFast)
+		assert.Equal(t, [][]string{{request, response}}, message.rcpttoRequestResponse)
+	})
+
+	t.Run("when request not matches rules", func(t *testing.T) {
+		session, message := new(sessionMock), new(Message)
+		configuration := newConfiguration(ConfigurationAttr{Rules: []Rule{{Commands: []RuleCommand{RuleMailfrom}, Pattern: "*", Response: "550 Rejected"}}})
+		handler := newHandlerRcptto(session, message, configuration)
+
+		assert.False(t, handler.isMatchedRule(request))
+		assert.False(t, message.rcptto)
+	})
+}
+
+func TestHandlerRcpttoIsGreylisted(t *testing.T) {
+	request, address := "RCPT TO: user@example.com", "127.0.0.1:2525"
+	message := &Message{mailfromRequest: "MAIL FROM: sender@example.com"}
+
+	t.Run("when triplet has not passed greylist", func(t *testing.T) {
+		session, message, configuration := new(sessionMock), &Message{mailfromRequest: message.mailfromRequest}, createConfiguration()
+		configuration.greylisting = true
+		handler, errorMessage := newHandlerRcptto(session, message, configuration), configuration.msgRcpttoGreylisted
+		handler.greylist = newGreylist(0)
+		session.On("remoteAddress").Once().Return(address)
+		session.On("addError", errors.New(errorMessage)).Once().Return(nil)
+		session.On("writeResponse", errorMessage, configuration.responseDelayRcptto).Once().Return(nil)
+
+		assert.True(t, handler.isGreylisted(request))
+		assert.False(t, message.rcptto)
+		assert.Equal(t, [][]string{{request, errorMessage}}, message.rcpttoRequestResponse)
+		assert.Equal(t, "127.0.0.1", handler.greylist.copy()[0].IP)
+		assert.Equal(t, "sender@example.com", handler.greylist.copy()[0].Sender)
+	})
+
+	t.Run("when triplet has passed greylist", func(t *testing.T) {
+		session, message, configuration := new(sessionMock), &Message{mailfromRequest: message.mailfromRequest}, createConfiguration()
+		configuration.greylisting = true
+		handler := newHandlerRcptto(session, message, configuration)
+		handler.greylist = newGreylist(0)
+		handler.greylist.isPassed("127.0.0.1", "sender@example.com", "user@example.com")
+		session.On("remoteAddress").Once().Return(address)
+
+		assert.False(t, handler.isGreylisted(request))
+		assert.Empty(t, message.rcpttoRequestResponse)
+	})
+
+	t.Run("when greylisting is disabled", func(t *testing.T) {
+		session := new(sessionMock)
+		handler := newHandlerRcptto(session, message, createConfiguration())
+		handler.greylist = newGreylist(0)
+
+		assert.False(t, handler.isGreylisted(request))
+		assert.Empty(t, handler.greylist.copy())
+	})
+
+	t.Run("when greylist is not shared with handler", func(t *testing.T) {
+		session, configuration := new(sessionMock), createConfiguration()
+		configuration.greylisting = true
+		handler := newHandlerRcptto(session, message, configuration)
+
+		assert.False(t, handler.isGreylisted(request))
+	})
+}
+
 func TestHandlerRcpttoIsInvalidRequest(t *testing.T) {
 	configuration := createConfiguration()
 
@@ -458,6 +662,21 @@ func TestHandlerRcpttoIsInvalidRequest(t *testing.T) {
 		assert.Equal(t, [][]string{{request, errorMessage}}, message.rcpttoRequestResponse)
 	})
 
+	t.Run("when request matches rule, rule takes precedence over blacklisted RCPTTO email", func(t *testing.T) {
+		email, response := "user@example.com", "250 Accepted"
+		configuration := newConfiguration(ConfigurationAttr{Rules: []Rule{{Pattern: email, Response: response}}})
+		request := "RCPT TO: " + email
+		session, message := new(sessionMock), new(Message)
+		configuration.blacklistedRcpttoEmails = []string{email}
+		message.helo, message.mailfrom = true, true
+		handler := newHandlerRcptto(session, message, configuration)
+		session.On("writeResponse", response, defaultSessionResponseDelay).Once().Return(nil)
+
+		assert.True(t, handler.isInvalidRequest(request))
+		assert.True(t, message.rcptto)
+		assert.Equal(t, [][]string{{request, response}}, message.rcpttoRequestResponse)
+	})
+
 	t.Run("when request includes not registered RCPTTO email", func(t *testing.T) {
 		configuration, notRegisteredEmail := createConfiguration(), "user@example.com"
 		request := "RCPT TO: " + notRegisteredEmail
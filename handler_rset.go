@@ -36,6 +36,7 @@ func (handler *handlerRset) clearMessage() {
 			heloRequest:  messageWithData.heloRequest,
 			heloResponse: messageWithData.heloResponse,
 			helo:         messageWithData.helo,
+			sessionID:    messageWithData.sessionID,
 		}
 		*messageWithData = *clearedMessage
 	}
@@ -92,6 +92,13 @@ func TestHandlerRsetClearMessage(t *testing.T) {
 
 		assert.Equal(t, message, handler.message)
 	})
+
+	t.Run("keeps message session identifier", func(t *testing.T) {
+		message := &Message{heloRequest: "42", sessionID: 42}
+		newHandlerRset(new(session), message, new(configuration)).clearMessage()
+
+		assert.Equal(t, 42, message.sessionID)
+	})
 }
 
 func TestHandlerRsetWriteResult(t *testing.T) {
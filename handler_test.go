@@ -16,3 +16,67 @@ func TestHandlerClearError(t *testing.T) {
 		assert.Nil(t, session.err)
 	})
 }
+
+func TestHandlerMatchedRule(t *testing.T) {
+	configuration := newConfiguration(
+		ConfigurationAttr{
+			Rules: []Rule{
+				{Commands: []RuleCommand{RuleRcptto}, Pattern: "user@example.com", Response: "250 Accepted"},
+				{Matcher: DomainSuffixMatcher, Pattern: "example.com", Response: "550 Rejected"},
+			},
+		},
+	)
+	handler := &handler{configuration: configuration}
+
+	t.Run("returns the first matched rule", func(t *testing.T) {
+		assert.Same(t, configuration.rules[0], handler.matchedRule(RuleRcptto, "user@example.com"))
+		assert.Same(t, configuration.rules[1], handler.matchedRule(RuleMailfrom, "user@example.com"))
+	})
+
+	t.Run("returns nil when rule not matched", func(t *testing.T) {
+		assert.Nil(t, handler.matchedRule(RuleRcptto, "user@domain.com"))
+	})
+}
+
+func TestHandlerSequencedResponse(t *testing.T) {
+	t.Run("returns sequenced response when attempt is covered by response sequence", func(t *testing.T) {
+		handler := &handler{responseSequences: newResponseSequences([]ResponseSequence{{Responses: []string{"451 Try again later"}}})}
+		response, found := handler.sequencedResponse(RuleRcptto, "user@example.com")
+
+		assert.True(t, found)
+		assert.Equal(t, "451 Try again later", response)
+	})
+
+	t.Run("returns false when response sequences are not shared with handler", func(t *testing.T) {
+		response, found := new(handler).sequencedResponse(RuleRcptto, "user@example.com")
+
+		assert.False(t, found)
+		assert.Empty(t, response)
+	})
+}
+
+func TestHandlerApplyRule(t *testing.T) {
+	t.Run("when rule accepts command", func(t *testing.T) {
+		message := new(Message)
+		handler := &handler{message: message}
+
+		assert.True(t, handler.applyRule(&rule{response: "250 Accepted", failFast: true}))
+		assert.False(t, message.failFast)
+	})
+
+	t.Run("when rule rejects command, fail fast flag is enabled", func(t *testing.T) {
+		message := new(Message)
+		handler := &handler{message: message}
+
+		assert.False(t, handler.applyRule(&rule{response: "550 Rejected", failFast: true}))
+		assert.True(t, message.failFast)
+	})
+
+	t.Run("when rule rejects command, fail fast flag is disabled", func(t *testing.T) {
+		message := &Message{failFast: true}
+		handler := &handler{message: message}
+
+		assert.False(t, handler.applyRule(&rule{response: "550 Rejected"}))
+		assert.False(t, message.failFast)
+	})
+}
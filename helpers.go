@@ -2,7 +2,9 @@ package smtpmock
 
 import (
 	"fmt"
+	"net"
 	"regexp"
+	"strings"
 	"time"
 )
 
@@ -44,6 +46,51 @@ func isIncluded(slice []string, target string) bool {
 	return false
 }
 
+// Splits string around the first occurrence of separator. Returns string as is and false
+// for case when separator not found
+func cutString(str, separator string) (string, string, bool) {
+	if index := strings.Index(str, separator); index >= 0 {
+		return str[:index], str[index+len(separator):], true
+	}
+
+	return str, emptyString, false
+}
+
+// Returns true for case when SMTP response is positive completion reply (2xx), otherwise
+// returns false
+func isPositiveCompletionReply(response string) bool {
+	return strings.HasPrefix(response, "2")
+}
+
+// Returns true for case when SMTP response is positive intermediate reply, e.g. 354 response
+// to DATA command, otherwise returns false
+func isPositiveIntermediateReply(response string) bool {
+	return strings.HasPrefix(response, "3")
+}
+
+// Returns true for case when SMTP response is transient or permanent negative completion
+// reply, otherwise returns false
+func isNegativeCompletionReply(response string) bool {
+	return strings.HasPrefix(response, "4") || strings.HasPrefix(response, "5")
+}
+
+// Returns true for case when SMTP response is 421 service not available reply, which closes
+// transmission channel, otherwise returns false
+func isServiceNotAvailableReply(response string) bool {
+	return strings.HasPrefix(response, serviceNotAvailableReplyCode)
+}
+
+// Returns host of network address in host:port form. Returns address as is for case when
+// address has no port
+func remoteHost(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+
+	return host
+}
+
 // Returns server with port number follows {server}:{portNumber} pattern
 func serverWithPortNumber(server string, portNumber int) string {
 	return fmt.Sprintf("%s:%d", server, portNumber)
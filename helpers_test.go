@@ -68,6 +68,81 @@ func TestIsIncluded(t *testing.T) {
 	})
 }
 
+func TestCutString(t *testing.T) {
+	t.Run("when separator found", func(t *testing.T) {
+		before, after, found := cutString("a=b=c", "=")
+
+		assert.Equal(t, "a", before)
+		assert.Equal(t, "b=c", after)
+		assert.True(t, found)
+	})
+
+	t.Run("when separator not found", func(t *testing.T) {
+		before, after, found := cutString("abc", "=")
+
+		assert.Equal(t, "abc", before)
+		assert.Empty(t, after)
+		assert.False(t, found)
+	})
+}
+
+func TestIsPositiveCompletionReply(t *testing.T) {
+	t.Run("when response is positive completion reply", func(t *testing.T) {
+		assert.True(t, isPositiveCompletionReply("250 Received"))
+	})
+
+	t.Run("when response is not positive completion reply", func(t *testing.T) {
+		assert.False(t, isPositiveCompletionReply("354 Ready for receive message"))
+		assert.False(t, isPositiveCompletionReply("451 Try again later"))
+		assert.False(t, isPositiveCompletionReply(emptyString))
+	})
+}
+
+func TestIsPositiveIntermediateReply(t *testing.T) {
+	t.Run("when response is positive intermediate reply", func(t *testing.T) {
+		assert.True(t, isPositiveIntermediateReply("354 Ready for receive message"))
+	})
+
+	t.Run("when response is not positive intermediate reply", func(t *testing.T) {
+		assert.False(t, isPositiveIntermediateReply("250 Received"))
+		assert.False(t, isPositiveIntermediateReply(emptyString))
+	})
+}
+
+func TestIsNegativeCompletionReply(t *testing.T) {
+	t.Run("when response is negative completion reply", func(t *testing.T) {
+		assert.True(t, isNegativeCompletionReply("451 Try again later"))
+		assert.True(t, isNegativeCompletionReply("550 User not found"))
+	})
+
+	t.Run("when response is not negative completion reply", func(t *testing.T) {
+		assert.False(t, isNegativeCompletionReply("250 Received"))
+		assert.False(t, isNegativeCompletionReply("354 Ready for receive message"))
+		assert.False(t, isNegativeCompletionReply(emptyString))
+	})
+}
+
+func TestIsServiceNotAvailableReply(t *testing.T) {
+	t.Run("when response is 421 reply", func(t *testing.T) {
+		assert.True(t, isServiceNotAvailableReply("421 Service not available"))
+	})
+
+	t.Run("when response is not 421 reply", func(t *testing.T) {
+		assert.False(t, isServiceNotAvailableReply("451 Try again later"))
+	})
+}
+
+func TestRemoteHost(t *testing.T) {
+	t.Run("when address includes port", func(t *testing.T) {
+		assert.Equal(t, "127.0.0.1", remoteHost("127.0.0.1:2525"))
+		assert.Equal(t, "::1", remoteHost("[::1]:2525"))
+	})
+
+	t.Run("when address does not include port", func(t *testing.T) {
+		assert.Equal(t, "127.0.0.1", remoteHost("127.0.0.1"))
+	})
+}
+
 func TestServerWithPortNumber(t *testing.T) {
 	t.Run("returns server with port number", func(t *testing.T) {
 		server, portNumber := "1.2.3.4", 42
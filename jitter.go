@@ -0,0 +1,82 @@
+package smtpmock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// JitterDistribution is the distribution of response delay jitter
+type JitterDistribution string
+
+// Available jitter distributions
+const (
+	UniformJitter JitterDistribution = "uniform" // delay is uniformly distributed within [delay - jitter, delay + jitter]
+	NormalJitter  JitterDistribution = "normal"  // delay is normally distributed with jitter as standard deviation
+)
+
+// Concurrent type that can be safely shared between goroutines. Response delay jitter with
+// its own random source
+type jitter struct {
+	sync.Mutex
+	amount       time.Duration
+	distribution JitterDistribution
+	random       *randomSource
+}
+
+// Jitter builder. Returns pointer to new jitter based on configuration response delay
+// jitter, distribution and random seed
+func newJitter(configuration *configuration) *jitter {
+	return &jitter{
+		amount:       configuration.responseDelayJitter,
+		distribution: configuration.jitterDistribution,
+		random:       newRandomSource(configuration.randomSeed),
+	}
+}
+
+// Returns error for case when the given jitter distribution is unknown
+func validateJitterDistribution(distribution JitterDistribution) error {
+	switch distribution {
+	case UniformJitter, NormalJitter:
+		return nil
+	default:
+		return fmt.Errorf("%s: %q", jitterUnknownDistributionErrorMsg, distribution)
+	}
+}
+
+// jitter methods
+
+// Replaces amount, distribution and random source with ones of the given jitter
+func (jitter *jitter) reconfigure(otherJitter *jitter) {
+	jitter.Lock()
+	defer jitter.Unlock()
+	jitter.amount, jitter.distribution, jitter.random = otherJitter.amount, otherJitter.distribution, otherJitter.random
+}
+
+// Returns the given response delay with random jitter, result is never negative. Zero delay
+// is returned as is, as well as any delay for case when jitter is nil or zero
+func (jitter *jitter) apply(delay time.Duration) time.Duration {
+	if jitter == nil || delay == 0 {
+		return delay
+	}
+
+	jitter.Lock()
+	defer jitter.Unlock()
+	if jitter.amount == 0 {
+		return delay
+	}
+
+	var deviation float64
+	switch jitter.distribution {
+	case NormalJitter:
+		deviation = jitter.random.normFloat64()
+	default:
+		deviation = 2*jitter.random.float64() - 1
+	}
+
+	if delay += time.Duration(deviation * float64(jitter.amount)); delay < 0 {
+		return 0
+	}
+
+	return delay
+}
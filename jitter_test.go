@@ -0,0 +1,100 @@
+package smtpmock
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewJitter(t *testing.T) {
+	t.Run("creates new jitter based on configuration", func(t *testing.T) {
+		configuration := newConfiguration(
+			ConfigurationAttr{ResponseDelayJitterDuration: time.Second, JitterDistribution: NormalJitter, RandomSeed: 42},
+		)
+		jitter := newJitter(configuration)
+
+		assert.Equal(t, time.Second, jitter.amount)
+		assert.Equal(t, NormalJitter, jitter.distribution)
+		assert.Equal(t, newRandomSource(42).float64(), jitter.random.float64())
+	})
+
+	t.Run("creates new jitter with uniform distribution by default", func(t *testing.T) {
+		assert.Equal(t, UniformJitter, newJitter(createConfiguration()).distribution)
+	})
+
+}
+
+func TestValidateJitterDistribution(t *testing.T) {
+	t.Run("when jitter distribution is known", func(t *testing.T) {
+		assert.NoError(t, validateJitterDistribution(UniformJitter))
+		assert.NoError(t, validateJitterDistribution(NormalJitter))
+	})
+
+	t.Run("when jitter distribution is unknown", func(t *testing.T) {
+		assert.EqualError(t, validateJitterDistribution("poisson"), fmt.Sprintf("%s: %q", jitterUnknownDistributionErrorMsg, "poisson"))
+	})
+}
+
+func TestJitterReconfigure(t *testing.T) {
+	t.Run("replaces amount, distribution and random source", func(t *testing.T) {
+		jitter := newJitter(createConfiguration())
+		otherJitter := newJitter(
+			newConfiguration(ConfigurationAttr{ResponseDelayJitterDuration: time.Second, JitterDistribution: NormalJitter, RandomSeed: 42}),
+		)
+		jitter.reconfigure(otherJitter)
+
+		assert.Equal(t, time.Second, jitter.amount)
+		assert.Equal(t, NormalJitter, jitter.distribution)
+		assert.Same(t, otherJitter.random, jitter.random)
+	})
+}
+
+func TestJitterApply(t *testing.T) {
+	delay := 100 * time.Millisecond
+
+	t.Run("returns delay as is when jitter is nil or zero, or delay is zero", func(t *testing.T) {
+		var nilJitter *jitter
+		jitter := newJitter(newConfiguration(ConfigurationAttr{ResponseDelayJitterDuration: time.Second}))
+
+		assert.Equal(t, delay, nilJitter.apply(delay))
+		assert.Equal(t, delay, newJitter(createConfiguration()).apply(delay))
+		assert.Equal(t, time.Duration(0), jitter.apply(0))
+	})
+
+	t.Run("returns delay with uniform jitter", func(t *testing.T) {
+		jitter := newJitter(newConfiguration(ConfigurationAttr{ResponseDelayJitterDuration: 50 * time.Millisecond, RandomSeed: 42}))
+		randomSource := newRandomSource(42)
+
+		for attempt := 0; attempt < 100; attempt++ {
+			expectedDelay := delay + time.Duration((2*randomSource.float64()-1)*float64(50*time.Millisecond))
+			jitteredDelay := jitter.apply(delay)
+
+			assert.Equal(t, expectedDelay, jitteredDelay)
+			assert.GreaterOrEqual(t, int64(jitteredDelay), int64(50*time.Millisecond))
+			assert.LessOrEqual(t, int64(jitteredDelay), int64(150*time.Millisecond))
+		}
+	})
+
+	t.Run("returns delay with normal jitter", func(t *testing.T) {
+		jitter := newJitter(
+			newConfiguration(ConfigurationAttr{ResponseDelayJitterDuration: 10 * time.Millisecond, JitterDistribution: NormalJitter, RandomSeed: 42}),
+		)
+		randomSource := newRandomSource(42)
+
+		for attempt := 0; attempt < 100; attempt++ {
+			expectedDelay := delay + time.Duration(randomSource.normFloat64()*float64(10*time.Millisecond))
+
+			assert.Equal(t, expectedDelay, jitter.apply(delay))
+		}
+	})
+
+	t.Run("returns zero when jittered delay is negative", func(t *testing.T) {
+		jitter := newJitter(newConfiguration(ConfigurationAttr{ResponseDelayJitterDuration: time.Hour, JitterDistribution: NormalJitter}))
+
+		for attempt := 0; attempt < 100; attempt++ {
+			assert.GreaterOrEqual(t, int64(jitter.apply(time.Nanosecond)), int64(0))
+		}
+	})
+}
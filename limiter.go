@@ -0,0 +1,138 @@
+package smtpmock
+
+import (
+	"sync"
+	"time"
+)
+
+// Concurrent type that can be safely shared between goroutines. Keeps counters of sessions
+// and sliding windows of MAIL FROM and RCPT TO attempts. Zero limit means no limit
+type limiter struct {
+	sync.Mutex
+	maxSessions      int
+	maxSessionsPerIP int
+	maxMessages      int
+	maxRcpttos       int
+	window           time.Duration
+	activeSessions   int
+	idleWaiters      []chan struct{}
+	sessionsPerIP    map[string]int
+	messageAttempts  []time.Time
+	rcpttoAttempts   []time.Time
+}
+
+// Limiter builder. Returns pointer to new limiter structure based on configuration limits
+func newLimiter(configuration *configuration) *limiter {
+	return &limiter{
+		maxSessions:      configuration.maxSessions,
+		maxSessionsPerIP: configuration.maxSessionsPerIP,
+		maxMessages:      configuration.maxMessagesPerWindow,
+		maxRcpttos:       configuration.maxRcpttosPerWindow,
+		window:           time.Duration(configuration.rateLimitWindow) * time.Second,
+		sessionsPerIP:    make(map[string]int),
+	}
+}
+
+// limiter methods
+
+// Counts new session from the given IP. Returns true for case when session is within
+// concurrent sessions and sessions per IP limits, otherwise returns false and session is
+// not counted
+func (limiter *limiter) acquireSession(ip string) bool {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	if (limiter.maxSessions > 0 && limiter.activeSessions >= limiter.maxSessions) ||
+		(limiter.maxSessionsPerIP > 0 && limiter.sessionsPerIP[ip] >= limiter.maxSessionsPerIP) {
+		return false
+	}
+
+	limiter.activeSessions++
+	limiter.sessionsPerIP[ip]++
+
+	return true
+}
+
+// Replaces limits with limits of the given configuration. Counters of sessions and attempts
+// are kept
+func (limiter *limiter) reconfigure(configuration *configuration) {
+	limiter.Lock()
+	defer limiter.Unlock()
+	limiter.maxSessions, limiter.maxSessionsPerIP = configuration.maxSessions, configuration.maxSessionsPerIP
+	limiter.maxMessages, limiter.maxRcpttos = configuration.maxMessagesPerWindow, configuration.maxRcpttosPerWindow
+	limiter.window = time.Duration(configuration.rateLimitWindow) * time.Second
+}
+
+// Finishes counted session, notifies idle waiters for case when it was the last active
+// session. Sessions per IP are total, so they are not decreased
+func (limiter *limiter) releaseSession() {
+	limiter.Lock()
+	defer limiter.Unlock()
+	limiter.activeSessions--
+	if limiter.activeSessions > 0 {
+		return
+	}
+
+	for _, idleWaiter := range limiter.idleWaiters {
+		close(idleWaiter)
+	}
+	limiter.idleWaiters = nil
+}
+
+// Returns channel which is closed when there are no active sessions
+func (limiter *limiter) idle() <-chan struct{} {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	idleWaiter := make(chan struct{})
+	if limiter.activeSessions == 0 {
+		close(idleWaiter)
+		return idleWaiter
+	}
+
+	limiter.idleWaiters = append(limiter.idleWaiters, idleWaiter)
+	return idleWaiter
+}
+
+// Counts MAIL FROM attempt. Returns true for case when attempt is within messages per
+// window limit, otherwise returns false and attempt is not counted
+func (limiter *limiter) allowMessage() bool {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	return limiter.allow(&limiter.messageAttempts, limiter.maxMessages)
+}
+
+// Counts RCPT TO attempt. Returns true for case when attempt is within recipients per
+// window limit, otherwise returns false and attempt is not counted
+func (limiter *limiter) allowRcptto() bool {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	return limiter.allow(&limiter.rcpttoAttempts, limiter.maxRcpttos)
+}
+
+// Drops attempts which are out of sliding window, counts new attempt for case when limit
+// is not reached. Should be called under the lock
+func (limiter *limiter) allow(attempts *[]time.Time, limit int) bool {
+	if limit == 0 {
+		return true
+	}
+
+	now := timeNow()
+	windowStart, actualAttempts := now.Add(-limiter.window), (*attempts)[:0]
+	for _, attempt := range *attempts {
+		if attempt.After(windowStart) {
+			actualAttempts = append(actualAttempts, attempt)
+		}
+	}
+
+	*attempts = actualAttempts
+	if len(actualAttempts) >= limit {
+		return false
+	}
+
+	*attempts = append(actualAttempts, now)
+
+	return true
+}
@@ -0,0 +1,176 @@
+package smtpmock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLimiter(t *testing.T) {
+	t.Run("creates new limiter based on configuration limits", func(t *testing.T) {
+		configuration := newConfiguration(
+			ConfigurationAttr{
+				MaxSessions:          1,
+				MaxSessionsPerIP:     2,
+				MaxMessagesPerWindow: 3,
+				MaxRcpttosPerWindow:  4,
+				RateLimitWindow:      5,
+			},
+		)
+		limiter := newLimiter(configuration)
+
+		assert.Equal(t, 1, limiter.maxSessions)
+		assert.Equal(t, 2, limiter.maxSessionsPerIP)
+		assert.Equal(t, 3, limiter.maxMessages)
+		assert.Equal(t, 4, limiter.maxRcpttos)
+		assert.Equal(t, 5*time.Second, limiter.window)
+		assert.Empty(t, limiter.sessionsPerIP)
+		assert.Equal(t, 0, limiter.activeSessions)
+	})
+}
+
+func TestLimiterReconfigure(t *testing.T) {
+	t.Run("replaces limits, keeps counters", func(t *testing.T) {
+		limiter := newLimiter(newConfiguration(ConfigurationAttr{MaxSessions: 1}))
+		limiter.acquireSession("127.0.0.1")
+		limiter.reconfigure(
+			newConfiguration(
+				ConfigurationAttr{
+					MaxSessions:          2,
+					MaxSessionsPerIP:     3,
+					MaxMessagesPerWindow: 4,
+					MaxRcpttosPerWindow:  5,
+					RateLimitWindow:      6,
+				},
+			),
+		)
+
+		assert.Equal(t, 2, limiter.maxSessions)
+		assert.Equal(t, 3, limiter.maxSessionsPerIP)
+		assert.Equal(t, 4, limiter.maxMessages)
+		assert.Equal(t, 5, limiter.maxRcpttos)
+		assert.Equal(t, 6*time.Second, limiter.window)
+		assert.Equal(t, 1, limiter.activeSessions)
+		assert.Equal(t, 1, limiter.sessionsPerIP["127.0.0.1"])
+	})
+}
+
+func TestLimiterAcquireSession(t *testing.T) {
+	t.Run("when limits are not specified", func(t *testing.T) {
+		limiter := newLimiter(createConfiguration())
+
+		for attempt := 0; attempt < 3; attempt++ {
+			assert.True(t, limiter.acquireSession("127.0.0.1"))
+		}
+		assert.Equal(t, 3, limiter.activeSessions)
+	})
+
+	t.Run("when concurrent sessions limit is reached", func(t *testing.T) {
+		limiter := newLimiter(newConfiguration(ConfigurationAttr{MaxSessions: 1}))
+
+		assert.True(t, limiter.acquireSession("127.0.0.1"))
+		assert.False(t, limiter.acquireSession("127.0.0.2"))
+		limiter.releaseSession()
+		assert.True(t, limiter.acquireSession("127.0.0.2"))
+		assert.Equal(t, map[string]int{"127.0.0.1": 1, "127.0.0.2": 1}, limiter.sessionsPerIP)
+	})
+
+	t.Run("when total sessions per IP limit is reached", func(t *testing.T) {
+		limiter := newLimiter(newConfiguration(ConfigurationAttr{MaxSessionsPerIP: 1}))
+
+		assert.True(t, limiter.acquireSession("127.0.0.1"))
+		limiter.releaseSession()
+		assert.False(t, limiter.acquireSession("127.0.0.1"))
+		assert.True(t, limiter.acquireSession("127.0.0.2"))
+		assert.Equal(t, 1, limiter.activeSessions)
+	})
+}
+
+func TestLimiterReleaseSession(t *testing.T) {
+	t.Run("decreases active sessions, keeps sessions per IP", func(t *testing.T) {
+		limiter := newLimiter(createConfiguration())
+		limiter.acquireSession("127.0.0.1")
+		limiter.releaseSession()
+
+		assert.Equal(t, 0, limiter.activeSessions)
+		assert.Equal(t, 1, limiter.sessionsPerIP["127.0.0.1"])
+	})
+
+	t.Run("notifies idle waiters when the last active session is finished", func(t *testing.T) {
+		limiter := newLimiter(createConfiguration())
+		limiter.acquireSession("127.0.0.1")
+		limiter.acquireSession("127.0.0.1")
+		idle := limiter.idle()
+
+		limiter.releaseSession()
+		assert.Len(t, limiter.idleWaiters, 1)
+		limiter.releaseSession()
+		_, isOpened := <-idle
+		assert.False(t, isOpened)
+		assert.Empty(t, limiter.idleWaiters)
+	})
+}
+
+func TestLimiterIdle(t *testing.T) {
+	t.Run("returns closed channel when there are no active sessions", func(t *testing.T) {
+		_, isOpened := <-newLimiter(createConfiguration()).idle()
+
+		assert.False(t, isOpened)
+	})
+
+	t.Run("returns opened channel when there are active sessions", func(t *testing.T) {
+		limiter := newLimiter(createConfiguration())
+		limiter.acquireSession("127.0.0.1")
+
+		assert.NotNil(t, limiter.idle())
+		assert.Len(t, limiter.idleWaiters, 1)
+	})
+}
+
+func TestLimiterAllowMessage(t *testing.T) {
+	t.Run("allows MAIL FROM attempts within messages per window limit", func(t *testing.T) {
+		limiter := newLimiter(newConfiguration(ConfigurationAttr{MaxMessagesPerWindow: 1}))
+
+		assert.True(t, limiter.allowMessage())
+		assert.False(t, limiter.allowMessage())
+		assert.True(t, limiter.allowRcptto())
+	})
+}
+
+func TestLimiterAllowRcptto(t *testing.T) {
+	t.Run("allows RCPT TO attempts within recipients per window limit", func(t *testing.T) {
+		limiter := newLimiter(newConfiguration(ConfigurationAttr{MaxRcpttosPerWindow: 1}))
+
+		assert.True(t, limiter.allowRcptto())
+		assert.False(t, limiter.allowRcptto())
+		assert.True(t, limiter.allowMessage())
+	})
+}
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Now()
+	defer func(originalTimeNow func() time.Time) { timeNow = originalTimeNow }(timeNow)
+
+	t.Run("when limit is not specified", func(t *testing.T) {
+		var attempts []time.Time
+		limiter := newLimiter(createConfiguration())
+
+		assert.True(t, limiter.allow(&attempts, 0))
+		assert.Empty(t, attempts)
+	})
+
+	t.Run("counts attempts within sliding window", func(t *testing.T) {
+		var attempts []time.Time
+		limiter := newLimiter(newConfiguration(ConfigurationAttr{RateLimitWindow: 10}))
+
+		timeNow = func() time.Time { return now }
+		assert.True(t, limiter.allow(&attempts, 2))
+		timeNow = func() time.Time { return now.Add(5 * time.Second) }
+		assert.True(t, limiter.allow(&attempts, 2))
+		assert.False(t, limiter.allow(&attempts, 2))
+		timeNow = func() time.Time { return now.Add(10 * time.Second) }
+		assert.True(t, limiter.allow(&attempts, 2))
+		assert.Equal(t, []time.Time{now.Add(5 * time.Second), now.Add(10 * time.Second)}, attempts)
+	})
+}
@@ -1,6 +1,9 @@
 package smtpmock
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 // Structure for storing the result of SMTP client-server interaction. Context-included
 // commands should be represented as request/response structure fields
@@ -10,8 +13,16 @@ type Message struct {
 	rcpttoRequestResponse                                   [][]string
 	dataRequest, dataResponse                               string
 	msgRequest, msgResponse                                 string
+	msgRawRequest                                           string
+	queueID                                                 string
+	validationFindings                                      []MessageValidationFinding
+	security                                                *MessageSecurity
 	rsetRequest, rsetResponse                               string
+	customRequestResponse                                   [][]string
+	receivedAt                                              time.Time
+	sessionID                                               int
 	helo, mailfrom, rcptto, data, msg, rset, noop, quitSent bool
+	failFast                                                bool
 }
 
 // message methods
@@ -58,6 +69,30 @@ func (message Message) Rcptto() bool {
 	return message.rcptto
 }
 
+// Sender returns MAIL FROM address. Returns empty string for case when message has no
+// MAIL FROM request
+func (message Message) Sender() string {
+	return regexCaptureGroup(message.mailfromRequest, validMailfromComplexCmdRegexPattern, 2)
+}
+
+// Recipients returns RCPT TO addresses accepted by server, any 2xx response is accepting
+func (message Message) Recipients() []string {
+	var recipients []string
+	for _, requestResponse := range message.rcpttoRequestResponse {
+		if isPositiveCompletionReply(requestResponse[1]) {
+			recipients = append(recipients, regexCaptureGroup(requestResponse[0], validRcpttoComplexCmdRegexPattern, 2))
+		}
+	}
+
+	return recipients
+}
+
+// Getter for customRequestResponse field. Returns requests and responses of custom
+// commands, e.g. ETRN, recorded by registered command handlers
+func (message Message) CustomRequestResponse() [][]string {
+	return message.customRequestResponse
+}
+
 // Getter for dataRequest field
 func (message Message) DataRequest() string {
 	return message.dataRequest
@@ -78,6 +113,29 @@ func (message Message) MsgRequest() string {
 	return message.msgRequest
 }
 
+// Getter for msgRawRequest field. Returns message body exactly as it was received
+// on the wire, including dot-stuffing and the <CR><LF>.<CR><LF> terminator
+func (message Message) MsgRawRequest() string {
+	return message.msgRawRequest
+}
+
+// Getter for queueID field. Returns queue identifier from prepended Received header
+func (message Message) QueueID() string {
+	return message.queueID
+}
+
+// Getter for validationFindings field. Returns RFC 5322 validation findings for case
+// when message validation is enabled
+func (message Message) ValidationFindings() []MessageValidationFinding {
+	return message.validationFindings
+}
+
+// Getter for security field. Returns S/MIME or OpenPGP processing result for case when
+// message is encrypted or signed, otherwise returns nil
+func (message Message) Security() *MessageSecurity {
+	return message.security
+}
+
 // Getter for msgResponse field
 func (message Message) MsgResponse() string {
 	return message.msgResponse
@@ -113,6 +171,17 @@ func (message Message) QuitSent() bool {
 	return message.quitSent
 }
 
+// Getter for receivedAt field. Returns time when message was stored by server
+func (message Message) ReceivedAt() time.Time {
+	return message.receivedAt
+}
+
+// Getter for sessionID field. Returns identifier of SMTP session in which message was
+// received, use Server.Transcript() to get session transcript
+func (message Message) SessionID() int {
+	return message.sessionID
+}
+
 // Getter for message consistency status predicate. Returns true
 // for case when message struct is consistent. It means that
 // MAILFROM, RCPTTO, DATA commands and message context
@@ -122,10 +191,10 @@ func (message Message) IsConsistent() bool {
 }
 
 // Message RCPTTO successful response predicate. Returns true when at least one
-// successful RCPTTO response exists. Otherwise returns false
-func (message *Message) isIncludesSuccessfulRcpttoResponse(targetSuccessfulResponse string) bool {
+// successful RCPTTO response exists, any 2xx response is successful. Otherwise returns false
+func (message *Message) isIncludesSuccessfulRcpttoResponse() bool {
 	for _, slice := range message.rcpttoRequestResponse {
-		if slice[1] == targetSuccessfulResponse {
+		if isPositiveCompletionReply(slice[1]) {
 			return true
 		}
 	}
@@ -133,22 +202,104 @@ func (message *Message) isIncludesSuccessfulRcpttoResponse(targetSuccessfulRespo
 	return false
 }
 
+// Saves request and response into message fields of the given SMTP command, request and
+// response of unknown command are saved as custom request and response
+func (message *Message) record(command, request, response string) {
+	isSuccessful := isPositiveCompletionReply(response)
+	switch command {
+	case "HELO", "EHLO":
+		message.heloRequest, message.heloResponse, message.helo = request, response, isSuccessful
+	case "MAIL":
+		message.mailfromRequest, message.mailfromResponse, message.mailfrom = request, response, isSuccessful
+	case "RCPT":
+		message.rcpttoRequestResponse = append(message.rcpttoRequestResponse, []string{request, response})
+		message.rcptto = message.rcptto || isSuccessful
+	case "DATA":
+		message.dataRequest, message.dataResponse, message.data = request, response, isPositiveIntermediateReply(response)
+	case "RSET":
+		message.rsetRequest, message.rsetResponse, message.rset = request, response, isSuccessful
+	case "NOOP":
+		message.noop = true
+	case "QUIT":
+		message.quitSent = true
+	default:
+		message.customRequestResponse = append(message.customRequestResponse, []string{request, response})
+	}
+}
+
+// Returns the last server response within message context. Returns empty string for case
+// when message has no responses
+func (message Message) lastResponse() string {
+	if message.msgResponse != emptyString {
+		return message.msgResponse
+	}
+	if message.dataResponse != emptyString {
+		return message.dataResponse
+	}
+	if count := len(message.rcpttoRequestResponse); count > 0 {
+		return message.rcpttoRequestResponse[count-1][1]
+	}
+	if message.mailfromResponse != emptyString {
+		return message.mailfromResponse
+	}
+
+	return message.heloResponse
+}
+
 // Pointer to empty message
 var zeroMessage = &Message{}
 
 // Concurrent type that can be safely shared between goroutines
 type messages struct {
 	sync.RWMutex
-	items []*Message
+	items         []*Message
+	subscriptions []*Subscription
 }
 
 // messages methods
 
-// Adds new message pointer into concurrent messages slice
+// Adds new message pointer into concurrent messages slice, stamps message received time.
+// Delivers copy of message to all active subscriptions
 func (messages *messages) append(item *Message) {
+	for _, subscription := range messages.store(item) {
+		subscription.deliver(*item)
+	}
+}
+
+// Stores message pointer, returns snapshot of subscriptions with added pending delivery
+func (messages *messages) store(item *Message) []*Subscription {
 	messages.Lock()
 	defer messages.Unlock()
+	item.receivedAt = timeNow()
 	messages.items = append(messages.items, item)
+
+	for _, subscription := range messages.subscriptions {
+		subscription.pending.Add(1)
+	}
+
+	return append([]*Subscription{}, messages.subscriptions...)
+}
+
+// Adds the given subscription, returns it
+func (messages *messages) subscribe(subscription *Subscription) *Subscription {
+	messages.Lock()
+	defer messages.Unlock()
+	messages.subscriptions = append(messages.subscriptions, subscription)
+
+	return subscription
+}
+
+// Removes the given subscription
+func (messages *messages) unsubscribe(subscription *Subscription) {
+	messages.Lock()
+	defer messages.Unlock()
+
+	for index, item := range messages.subscriptions {
+		if item == subscription {
+			messages.subscriptions = append(messages.subscriptions[:index], messages.subscriptions[index+1:]...)
+			return
+		}
+	}
 }
 
 // Returns a copy of all messages
@@ -179,6 +330,79 @@ func (messages *messages) purge() []Message {
 	return copiedMessages
 }
 
+// Returns copy of messages which match the given filter
+func (messages *messages) filter(filter MessageFilter) []Message {
+	messages.RLock()
+	defer messages.RUnlock()
+
+	matchedMessages := []Message{}
+	for _, item := range messages.items {
+		if filter.Match(*item) {
+			matchedMessages = append(matchedMessages, *item)
+		}
+	}
+
+	return matchedMessages
+}
+
+// Returns messages which match the given filter and removes them at the same time,
+// other messages are kept
+func (messages *messages) purgeMatched(filter MessageFilter) []Message {
+	messages.Lock()
+	defer messages.Unlock()
+
+	matchedMessages, keptItems := []Message{}, []*Message{}
+	for _, item := range messages.items {
+		if filter.Match(*item) {
+			matchedMessages = append(matchedMessages, *item)
+			continue
+		}
+
+		keptItems = append(keptItems, item)
+	}
+	messages.items = keptItems
+
+	return matchedMessages
+}
+
+// Returns copy of the first message which matches the given predicate and true, removes
+// this message for case when withPurge is true. Returns zero message and false for case when
+// there are no matched messages. Predicate is called without lock, so it can access messages
+func (messages *messages) find(predicate func(Message) bool, withPurge bool) (Message, bool) {
+	for _, item := range messages.snapshot() {
+		if !predicate(*item) || (withPurge && !messages.remove(item)) {
+			continue
+		}
+
+		return *item, true
+	}
+
+	return Message{}, false
+}
+
+// Returns copy of message pointers slice
+func (messages *messages) snapshot() []*Message {
+	messages.RLock()
+	defer messages.RUnlock()
+
+	return append([]*Message{}, messages.items...)
+}
+
+// Removes the given message pointer. Returns false for case when message was already removed
+func (messages *messages) remove(item *Message) bool {
+	messages.Lock()
+	defer messages.Unlock()
+
+	for index, storedItem := range messages.items {
+		if storedItem == item {
+			messages.items = append(messages.items[:index:index], messages.items[index+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
 // Clears the messages slice
 func (messages *messages) clear() {
 	messages.Lock()
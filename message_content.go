@@ -0,0 +1,219 @@
+package smtpmock
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Link is the hyperlink extracted from message text part. Text is the anchor text
+// for links from HTML parts, it's equal to empty string for links from plain text parts
+type Link struct {
+	URL         string
+	Text        string
+	ContentType string
+}
+
+// MIMETree returns decoded MIME parts tree of message body. Returns error for case when
+// message body can't be parsed
+func (message Message) MIMETree() (*MessagePart, error) {
+	return parseMessagePart(message.msgRequest)
+}
+
+// DecodedHeader returns the first value of message header with the given name. RFC 2047
+// encoded-words are decoded and converted to UTF-8. Returns empty string for case when header
+// not found. Returns error for case when message can't be parsed or charset is not supported
+func (message Message) DecodedHeader(name string) (string, error) {
+	tree, err := message.MIMETree()
+	if err != nil {
+		return emptyString, err
+	}
+
+	return decodeHeaderValue(tree.Header.Get(name))
+}
+
+// Subject returns decoded message subject. Works the same way as DecodedHeader
+func (message Message) Subject() (string, error) {
+	return message.DecodedHeader("Subject")
+}
+
+// TextBody returns the first not attached plain text part of message body converted
+// to UTF-8. Returns empty string for case when part not found. Returns error for case
+// when message can't be parsed or charset is not supported
+func (message Message) TextBody() (string, error) {
+	return message.textPartContext(textPlainContentType)
+}
+
+// HTMLBody returns the first not attached HTML part of message body converted
+// to UTF-8. Works the same way as TextBody
+func (message Message) HTMLBody() (string, error) {
+	return message.textPartContext(textHTMLContentType)
+}
+
+// Links returns all unique hyperlinks from HTML and plain text parts of message body
+// in order of appearance. Attachments are skipped. Returns error for case when message
+// body can't be parsed
+func (message Message) Links() ([]Link, error) {
+	parts, err := message.textParts()
+	if err != nil {
+		return nil, err
+	}
+
+	var links []Link
+	for _, part := range parts {
+		for _, link := range extractLinks(part) {
+			if !isLinkIncluded(links, link) {
+				links = append(links, link)
+			}
+		}
+	}
+
+	return links, nil
+}
+
+// Codes returns all unique matches of the given regex pattern from the visible text
+// of HTML and plain text parts of message body, for example one-time verification codes.
+// For case when pattern has capture group, the first capture group is returned instead of
+// the whole match. Returns error for case when pattern is invalid or message body
+// can't be parsed
+func (message Message) Codes(regexPattern string) ([]string, error) {
+	regex, err := newRegex(regexPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := message.textParts()
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	for _, part := range parts {
+		for _, match := range regex.FindAllStringSubmatch(partText(part), -1) {
+			code := match[0]
+			if len(match) > 1 {
+				code = match[1]
+			}
+
+			if !isIncluded(codes, code) {
+				codes = append(codes, code)
+			}
+		}
+	}
+
+	return codes, nil
+}
+
+// CalendarEvents returns VEVENT components of all text/calendar parts of message body
+// (for example meeting invitations) in order of appearance. Returns error for case when
+// message body or calendar data can't be parsed
+func (message Message) CalendarEvents() ([]CalendarEvent, error) {
+	tree, err := message.MIMETree()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []CalendarEvent
+	for _, part := range tree.PartsByContentType(textCalendarContentType) {
+		partEvents, err := part.CalendarEvents()
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, partEvents...)
+	}
+
+	return events, nil
+}
+
+// Returns UTF-8 context of the first not attached text part with the given content type
+func (message Message) textPartContext(contentType string) (string, error) {
+	parts, err := message.textParts()
+	if err != nil {
+		return emptyString, err
+	}
+
+	for _, part := range parts {
+		if part.ContentType == contentType {
+			return part.Text()
+		}
+	}
+
+	return emptyString, nil
+}
+
+// Returns not attached HTML and plain text parts of message body
+func (message Message) textParts() ([]*MessagePart, error) {
+	tree, err := message.MIMETree()
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []*MessagePart
+	for _, part := range tree.PartsByContentType(textPlainContentType, textHTMLContentType) {
+		if !part.IsAttachment() {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts, nil
+}
+
+// Extracts links from text part. Uses anchor tags for HTML part, URL pattern otherwise
+func extractLinks(part *MessagePart) []Link {
+	var links []Link
+	body := partContext(part)
+
+	if part.ContentType == textHTMLContentType {
+		for _, match := range regexp.MustCompile(htmlAnchorRegexPattern).FindAllStringSubmatch(body, -1) {
+			href := strings.Trim(match[1], `"'`)
+			links = append(links, Link{URL: html.UnescapeString(href), Text: htmlToText(match[2]), ContentType: part.ContentType})
+		}
+
+		return links
+	}
+
+	for _, url := range regexp.MustCompile(plainTextURLRegexPattern).FindAllString(body, -1) {
+		links = append(links, Link{URL: strings.TrimRight(url, plainTextURLTrailingChars), ContentType: part.ContentType})
+	}
+
+	return links
+}
+
+// Returns visible text of text part. Strips tags and unescapes entities for HTML part
+func partText(part *MessagePart) string {
+	if part.ContentType == textHTMLContentType {
+		return htmlToText(partContext(part))
+	}
+
+	return partContext(part)
+}
+
+// Returns part body converted to UTF-8. Returns part body as is for case when
+// part charset is not supported
+func partContext(part *MessagePart) string {
+	text, err := part.Text()
+	if err != nil {
+		return string(part.Body)
+	}
+
+	return text
+}
+
+// Converts HTML fragment to plain text with collapsed whitespaces
+func htmlToText(htmlContext string) string {
+	text := regexp.MustCompile(htmlInvisibleElementRegexPattern).ReplaceAllString(htmlContext, " ")
+	text = html.UnescapeString(regexp.MustCompile(htmlTagRegexPattern).ReplaceAllString(text, " "))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// Returns true if the given link is present in slice, otherwise returns false
+func isLinkIncluded(links []Link, target Link) bool {
+	for _, link := range links {
+		if link == target {
+			return true
+		}
+	}
+
+	return false
+}
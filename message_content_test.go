@@ -0,0 +1,242 @@
+package smtpmock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageMIMETree(t *testing.T) {
+	t.Run("returns decoded MIME parts tree of message body", func(t *testing.T) {
+		message := Message{msgRequest: multipartMessageBody()}
+		tree, err := message.MIMETree()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "multipart/mixed", tree.ContentType)
+	})
+}
+
+// Returns multipart/alternative message body with non UTF-8 charsets
+func internationalMessageBody() string {
+	return "Subject: =?ISO-2022-JP?B?GyRCN29MPiVGJTklSBsoQg==?=\r\n" +
+		"X-Unsupported: =?koi8-u?Q?text?=\r\n" +
+		"Content-Type: multipart/alternative; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=Shift_JIS\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"ir+OmpVc\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/html; charset=windows-1252\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"<p>=80 caf=E9</p>\r\n" +
+		"--b--\r\n"
+}
+
+func TestMessageDecodedHeader(t *testing.T) {
+	message := Message{msgRequest: internationalMessageBody()}
+
+	t.Run("returns decoded header value", func(t *testing.T) {
+		value, err := message.DecodedHeader("subject")
+
+		assert.Equal(t, "件名テスト", value)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when header not found", func(t *testing.T) {
+		value, err := message.DecodedHeader("X-Not-Found")
+
+		assert.Empty(t, value)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when header charset is not supported", func(t *testing.T) {
+		_, err := message.DecodedHeader("X-Unsupported")
+
+		assert.Error(t, err)
+	})
+
+	t.Run("when message can't be parsed", func(t *testing.T) {
+		value, err := Message{msgRequest: "Malformed header\r\n"}.DecodedHeader("Subject")
+
+		assert.Empty(t, value)
+		assert.Error(t, err)
+	})
+}
+
+func TestMessageSubject(t *testing.T) {
+	t.Run("returns decoded message subject", func(t *testing.T) {
+		subject, err := Message{msgRequest: internationalMessageBody()}.Subject()
+
+		assert.Equal(t, "件名テスト", subject)
+		assert.NoError(t, err)
+	})
+}
+
+func TestMessageTextBody(t *testing.T) {
+	t.Run("returns plain text part converted to UTF-8", func(t *testing.T) {
+		text, err := Message{msgRequest: internationalMessageBody()}.TextBody()
+
+		assert.Equal(t, "漢字表", text)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when plain text part not found", func(t *testing.T) {
+		message := Message{msgRequest: "Content-Type: text/html\r\n\r\n<p>a</p>\r\n"}
+		text, err := message.TextBody()
+
+		assert.Empty(t, text)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when plain text part charset is not supported", func(t *testing.T) {
+		message := Message{msgRequest: "Content-Type: text/plain; charset=koi8-u\r\n\r\ntext\r\n"}
+		text, err := message.TextBody()
+
+		assert.Empty(t, text)
+		assert.Error(t, err)
+	})
+
+	t.Run("when message can't be parsed", func(t *testing.T) {
+		text, err := Message{msgRequest: "Malformed header\r\n"}.TextBody()
+
+		assert.Empty(t, text)
+		assert.Error(t, err)
+	})
+}
+
+func TestMessageHTMLBody(t *testing.T) {
+	t.Run("returns HTML part converted to UTF-8", func(t *testing.T) {
+		html, err := Message{msgRequest: internationalMessageBody()}.HTMLBody()
+
+		assert.Equal(t, "<p>€ café</p>", html)
+		assert.NoError(t, err)
+	})
+}
+
+func TestMessageLinks(t *testing.T) {
+	t.Run("returns links from HTML and plain text parts", func(t *testing.T) {
+		links, err := Message{msgRequest: multipartMessageBody()}.Links()
+
+		assert.NoError(t, err)
+		assert.Equal(
+			t,
+			[]Link{
+				{URL: "https://example.com/reset?token=abc", ContentType: textPlainContentType},
+				{URL: "https://example.com/reset?token=abc&a=1", Text: "Reset password", ContentType: textHTMLContentType},
+			},
+			links,
+		)
+	})
+
+	t.Run("skips duplicated links", func(t *testing.T) {
+		message := Message{msgRequest: "Subject: Test\r\n\r\nhttp://a.com, http://a.com\r\n"}
+		links, err := message.Links()
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Link{{URL: "http://a.com", ContentType: textPlainContentType}}, links)
+	})
+
+	t.Run("when message body can't be parsed", func(t *testing.T) {
+		links, err := Message{msgRequest: "Malformed header\r\n"}.Links()
+
+		assert.Nil(t, links)
+		assert.Error(t, err)
+	})
+}
+
+func TestMessageCodes(t *testing.T) {
+	message := Message{msgRequest: multipartMessageBody()}
+
+	t.Run("returns unique whole matches for pattern without capture groups", func(t *testing.T) {
+		codes, err := message.Codes(`\b\d{6}\b`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"123456"}, codes)
+	})
+
+	t.Run("returns the first capture group for pattern with capture groups", func(t *testing.T) {
+		codes, err := message.Codes(`Code: (\d+)`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"123456"}, codes)
+	})
+
+	t.Run("when pattern is invalid", func(t *testing.T) {
+		codes, err := message.Codes(`\K`)
+
+		assert.Nil(t, codes)
+		assert.Error(t, err)
+	})
+
+	t.Run("when message body can't be parsed", func(t *testing.T) {
+		codes, err := Message{msgRequest: "Malformed header\r\n"}.Codes(`\d+`)
+
+		assert.Nil(t, codes)
+		assert.Error(t, err)
+	})
+}
+
+func TestMessageCalendarEvents(t *testing.T) {
+	t.Run("returns events from all text/calendar parts", func(t *testing.T) {
+		message := Message{
+			msgRequest: "Content-Type: multipart/alternative; boundary=b\r\n\r\n" +
+				"--b\r\nContent-Type: text/plain\r\n\r\nInvitation\r\n" +
+				"--b\r\nContent-Type: text/calendar; method=REQUEST\r\n\r\n" + calendarInvitation() +
+				"--b\r\nContent-Type: text/calendar; method=CANCEL\r\n\r\nBEGIN:VEVENT\r\nUID:1\r\nEND:VEVENT\r\n" +
+				"--b--\r\n",
+		}
+		events, err := message.CalendarEvents()
+
+		assert.NoError(t, err)
+		assert.Len(t, events, 3)
+		assert.Equal(t, "event-1@example.com", events[0].UID)
+		assert.Equal(t, "event-2@example.com", events[1].UID)
+		assert.Equal(t, CalendarEvent{Method: "CANCEL", UID: "1"}, events[2])
+	})
+
+	t.Run("when message has no text/calendar parts", func(t *testing.T) {
+		events, err := Message{msgRequest: multipartMessageBody()}.CalendarEvents()
+
+		assert.Nil(t, events)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when message body can't be parsed", func(t *testing.T) {
+		events, err := Message{msgRequest: "Malformed header\r\n"}.CalendarEvents()
+
+		assert.Nil(t, events)
+		assert.Error(t, err)
+	})
+
+	t.Run("when calendar data can't be parsed", func(t *testing.T) {
+		events, err := Message{msgRequest: "Content-Type: text/calendar\r\n\r\nBEGIN:VEVENT\r\n"}.CalendarEvents()
+
+		assert.Nil(t, events)
+		assert.Error(t, err)
+	})
+}
+
+func TestPartContext(t *testing.T) {
+	t.Run("returns part body converted to UTF-8", func(t *testing.T) {
+		part := &MessagePart{Params: map[string]string{"charset": "windows-1252"}, Body: []byte("\x80")}
+
+		assert.Equal(t, "€", partContext(part))
+	})
+
+	t.Run("when part charset is not supported", func(t *testing.T) {
+		part := &MessagePart{Params: map[string]string{"charset": "koi8-u"}, Body: []byte("text")}
+
+		assert.Equal(t, "text", partContext(part))
+	})
+}
+
+func TestHTMLToText(t *testing.T) {
+	t.Run("strips tags, invisible elements and unescapes entities", func(t *testing.T) {
+		htmlContext := "<head><title>x</title></head><style>p {}</style><p>a&amp;b\r\n  <b>c</b></p>"
+
+		assert.Equal(t, "a&b c", htmlToText(htmlContext))
+	})
+}
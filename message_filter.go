@@ -0,0 +1,118 @@
+package smtpmock
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MessageConsistency is the message consistency criterion of MessageFilter
+type MessageConsistency int
+
+// Available message consistency criteria
+const (
+	AnyMessages          MessageConsistency = iota // consistent and not consistent messages
+	ConsistentMessages                             // messages with true Message.IsConsistent()
+	InconsistentMessages                           // messages with false Message.IsConsistent()
+)
+
+// MessageFilter is the set of criteria for querying captured messages. Zero value criteria
+// are ignored, so zero value MessageFilter matches all messages
+type MessageFilter struct {
+	From           string                    // MAIL FROM address, case-insensitive
+	To             string                    // any RCPT TO address accepted by server, case-insensitive
+	Subject        *regexp.Regexp            // decoded Subject header
+	Headers        map[string]*regexp.Regexp // decoded header values by header name
+	ReceivedAfter  time.Time                 // message was received at or after this time
+	ReceivedBefore time.Time                 // message was received before this time
+	Consistency    MessageConsistency        // message consistency status
+	ResponseClass  int                       // class of the last server response: 2, 3, 4 or 5
+}
+
+// Match returns true for case when message satisfies all filter criteria, otherwise
+// returns false
+func (filter MessageFilter) Match(message Message) bool {
+	return filter.matchAddresses(message) &&
+		filter.matchHeaders(message) &&
+		filter.matchReceivedAt(message) &&
+		filter.matchConsistency(message) &&
+		filter.matchResponseClass(message)
+}
+
+// Checks message MAIL FROM and RCPT TO addresses
+func (filter MessageFilter) matchAddresses(message Message) bool {
+	if filter.From != emptyString && !strings.EqualFold(message.Sender(), filter.From) {
+		return false
+	}
+
+	if filter.To != emptyString {
+		for _, recipient := range message.Recipients() {
+			if strings.EqualFold(recipient, filter.To) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// Checks decoded message headers
+func (filter MessageFilter) matchHeaders(message Message) bool {
+	if filter.Subject != nil && !matchHeader(message, "Subject", filter.Subject) {
+		return false
+	}
+
+	for name, regex := range filter.Headers {
+		if !matchHeader(message, name, regex) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Checks message received time range
+func (filter MessageFilter) matchReceivedAt(message Message) bool {
+	if !filter.ReceivedAfter.IsZero() && message.receivedAt.Before(filter.ReceivedAfter) {
+		return false
+	}
+
+	return filter.ReceivedBefore.IsZero() || message.receivedAt.Before(filter.ReceivedBefore)
+}
+
+// Checks message consistency status
+func (filter MessageFilter) matchConsistency(message Message) bool {
+	switch filter.Consistency {
+	case ConsistentMessages:
+		return message.IsConsistent()
+	case InconsistentMessages:
+		return !message.IsConsistent()
+	default:
+		return true
+	}
+}
+
+// Checks class of the last server response
+func (filter MessageFilter) matchResponseClass(message Message) bool {
+	if filter.ResponseClass == 0 {
+		return true
+	}
+
+	lastResponse := message.lastResponse()
+
+	return lastResponse != emptyString && int(lastResponse[0]-'0') == filter.ResponseClass
+}
+
+// Checks decoded message header value. Message without body or with header which can't be
+// decoded doesn't match
+func matchHeader(message Message, name string, regex *regexp.Regexp) bool {
+	if message.msgRequest == emptyString {
+		return false
+	}
+
+	value, err := message.DecodedHeader(name)
+
+	return err == nil && regex.MatchString(value)
+}
@@ -0,0 +1,85 @@
+package smtpmock
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageFilterMatch(t *testing.T) {
+	receivedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	message := Message{
+		mailfromRequest: "MAIL FROM:<sender@example.com>",
+		rcpttoRequestResponse: [][]string{
+			{"RCPT TO:<user1@example.com>", defaultReceivedMsg},
+			{"RCPT TO:<user2@example.com>", defaultReceivedMsg},
+			{"RCPT TO:<user3@example.com>", defaultNotRegistredRcpttoEmailMsg},
+		},
+		msgRequest:  "Subject: =?UTF-8?B?SGVsbG8sIHdvcmxk?=\r\nX-Campaign: q4\r\n\r\nBody\r\n",
+		msgResponse: defaultReceivedMsg,
+		receivedAt:  receivedAt,
+		mailfrom:    true,
+		rcptto:      true,
+		data:        true,
+		msg:         true,
+	}
+
+	t.Run("when filter is empty", func(t *testing.T) {
+		assert.True(t, MessageFilter{}.Match(message))
+		assert.True(t, MessageFilter{}.Match(Message{}))
+	})
+
+	t.Run("when message matches all criteria", func(t *testing.T) {
+		filter := MessageFilter{
+			From:           "SENDER@example.com",
+			To:             "user2@EXAMPLE.com",
+			Subject:        regexp.MustCompile(`\AHello, world\z`),
+			Headers:        map[string]*regexp.Regexp{"X-Campaign": regexp.MustCompile(`q4`)},
+			ReceivedAfter:  receivedAt,
+			ReceivedBefore: receivedAt.Add(time.Second),
+			Consistency:    ConsistentMessages,
+			ResponseClass:  2,
+		}
+
+		assert.True(t, filter.Match(message))
+	})
+
+	t.Run("when message doesn't match one of criteria", func(t *testing.T) {
+		for _, filter := range []MessageFilter{
+			{From: "other@example.com"},
+			{To: "other@example.com"},
+			{To: "user@example.com"},
+			{To: "user3@example.com"},
+			{Subject: regexp.MustCompile(`Goodbye`)},
+			{Headers: map[string]*regexp.Regexp{"X-Campaign": regexp.MustCompile(`q3`)}},
+			{Headers: map[string]*regexp.Regexp{"X-Missing": regexp.MustCompile(`.`)}},
+			{ReceivedAfter: receivedAt.Add(time.Nanosecond)},
+			{ReceivedBefore: receivedAt},
+			{Consistency: InconsistentMessages},
+			{ResponseClass: 5},
+		} {
+			assert.False(t, filter.Match(message))
+		}
+	})
+
+	t.Run("when message is not consistent", func(t *testing.T) {
+		message := Message{mailfromRequest: "MAIL FROM:<sender@example.com>", mailfromResponse: "503 Bad sequence"}
+
+		assert.True(t, MessageFilter{Consistency: InconsistentMessages, ResponseClass: 5}.Match(message))
+		assert.False(t, MessageFilter{Consistency: ConsistentMessages}.Match(message))
+	})
+
+	t.Run("when message has no body", func(t *testing.T) {
+		assert.False(t, MessageFilter{Subject: regexp.MustCompile(`.*`)}.Match(Message{}))
+	})
+
+	t.Run("when header can't be decoded", func(t *testing.T) {
+		assert.False(t, MessageFilter{Subject: regexp.MustCompile(`.*`)}.Match(Message{msgRequest: "Malformed header\r\n"}))
+	})
+
+	t.Run("when message has no responses", func(t *testing.T) {
+		assert.False(t, MessageFilter{ResponseClass: 2}.Match(Message{}))
+	})
+}
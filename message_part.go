@@ -0,0 +1,138 @@
+package smtpmock
+
+import (
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// MessagePart is the decoded MIME part of captured message. Body is decoded
+// according to Content-Transfer-Encoding. For multipart parts Body is empty
+// and nested parts are available in Parts
+type MessagePart struct {
+	Header      textproto.MIMEHeader
+	ContentType string
+	Params      map[string]string
+	Body        []byte
+	Parts       []*MessagePart
+}
+
+// Parses message body context into MIME parts tree. Returns error for case when
+// message header or multipart structure is malformed
+func parseMessagePart(msgData string) (*MessagePart, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(msgData))
+	if err != nil {
+		return nil, err
+	}
+
+	return newMessagePart(textproto.MIMEHeader(msg.Header), msg.Body)
+}
+
+// MIME part builder. Reads and decodes part body, parses nested parts for case
+// when part is multipart
+func newMessagePart(header textproto.MIMEHeader, body io.Reader) (*MessagePart, error) {
+	contentType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		contentType, params = defaultPartContentType, map[string]string{"charset": defaultPartCharset}
+	}
+
+	part := &MessagePart{Header: header, ContentType: contentType, Params: params}
+	body = transferDecoder(header.Get("Content-Transfer-Encoding"), body)
+
+	if part.IsMultipart() {
+		return part, part.parseNestedParts(body)
+	}
+
+	part.Body, err = ioutil.ReadAll(body)
+	return part, err
+}
+
+// Returns reader which decodes data according to the given Content-Transfer-Encoding
+func transferDecoder(encoding string, reader io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, reader)
+	case "quoted-printable":
+		return quotedprintable.NewReader(reader)
+	default:
+		return reader
+	}
+}
+
+// MessagePart methods
+
+// Returns true for case when part is multipart, otherwise returns false
+func (part *MessagePart) IsMultipart() bool {
+	return strings.HasPrefix(part.ContentType, "multipart/")
+}
+
+// Returns true for case when part has attachment Content-Disposition, otherwise returns false
+func (part *MessagePart) IsAttachment() bool {
+	disposition, _, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	return err == nil && disposition == "attachment"
+}
+
+// Text returns part body converted from part charset to UTF-8. Returns error for case
+// when part charset is not supported
+func (part *MessagePart) Text() (string, error) {
+	return decodeCharset(part.Params["charset"], part.Body)
+}
+
+// CalendarEvents returns VEVENT components of text/calendar part body. Method of events
+// without METHOD calendar property is taken from part method parameter. Returns error for
+// case when part charset is not supported or calendar data is malformed
+func (part *MessagePart) CalendarEvents() ([]CalendarEvent, error) {
+	text, err := part.Text()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCalendarEvents(text, strings.ToUpper(part.Params["method"]))
+}
+
+// PartsByContentType returns all non-multipart parts of the tree (including part itself)
+// with the given content types in depth-first order. Returns all non-multipart parts
+// for case when content types were not passed
+func (part *MessagePart) PartsByContentType(contentTypes ...string) []*MessagePart {
+	var parts []*MessagePart
+	if part.IsMultipart() {
+		for _, nestedPart := range part.Parts {
+			parts = append(parts, nestedPart.PartsByContentType(contentTypes...)...)
+		}
+
+		return parts
+	}
+
+	if len(contentTypes) == 0 || isIncluded(contentTypes, part.ContentType) {
+		parts = append(parts, part)
+	}
+
+	return parts
+}
+
+// Reads and parses nested parts of multipart part
+func (part *MessagePart) parseNestedParts(body io.Reader) error {
+	reader := multipart.NewReader(body, part.Params["boundary"])
+	for {
+		rawPart, err := reader.NextRawPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		nestedPart, err := newMessagePart(rawPart.Header, rawPart)
+		if err != nil {
+			return err
+		}
+
+		part.Parts = append(part.Parts, nestedPart)
+	}
+}
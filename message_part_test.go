@@ -0,0 +1,204 @@
+package smtpmock
+
+import (
+	"io/ioutil"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Creates multipart message body context
+func multipartMessageBody() string {
+	return strings.Join(
+		[]string{
+			"From: user@example.com",
+			"Content-Type: multipart/mixed; boundary=outer",
+			"",
+			"--outer",
+			"Content-Type: multipart/alternative; boundary=inner",
+			"",
+			"--inner",
+			"Content-Type: text/plain; charset=utf-8",
+			"Content-Transfer-Encoding: quoted-printable",
+			"",
+			"Reset link: https://example.com/reset?token=3Dabc.",
+			"Your code is 123456",
+			"--inner",
+			"Content-Type: text/html; charset=utf-8",
+			"Content-Transfer-Encoding: base64",
+			"",
+			"PHA+PGEgaHJlZj0iaHR0cHM6Ly9leGFtcGxlLmNvbS9yZXNldD90b2tlbj1hYmMmYW1wO2E9MSI+",
+			"UmVzZXQgPGI+cGFzc3dvcmQ8L2I+PC9hPiBDb2RlOiA8Yj4xMjM0NTY8L2I+PC9wPg==",
+			"--inner--",
+			"--outer",
+			"Content-Type: text/plain",
+			"Content-Disposition: attachment; filename=a.txt",
+			"",
+			"https://example.com/attachment 654321",
+			"--outer--",
+			"",
+		},
+		"\r\n",
+	)
+}
+
+func TestParseMessagePart(t *testing.T) {
+	t.Run("when message is not multipart", func(t *testing.T) {
+		part, err := parseMessagePart("Subject: Test\r\n\r\nBody\r\n")
+
+		assert.NoError(t, err)
+		assert.Equal(t, defaultPartContentType, part.ContentType)
+		assert.Equal(t, map[string]string{"charset": defaultPartCharset}, part.Params)
+		assert.Equal(t, "Test", part.Header.Get("Subject"))
+		assert.Equal(t, []byte("Body\r\n"), part.Body)
+		assert.Empty(t, part.Parts)
+	})
+
+	t.Run("when message is multipart", func(t *testing.T) {
+		part, err := parseMessagePart(multipartMessageBody())
+
+		assert.NoError(t, err)
+		assert.Equal(t, "multipart/mixed", part.ContentType)
+		assert.Empty(t, part.Body)
+		assert.Len(t, part.Parts, 2)
+		assert.Equal(t, "multipart/alternative", part.Parts[0].ContentType)
+		assert.Equal(t, "Reset link: https://example.com/reset?token=abc.\r\nYour code is 123456", string(part.Parts[0].Parts[0].Body))
+		assert.Contains(t, string(part.Parts[0].Parts[1].Body), `<a href="https://example.com/reset?token=abc&amp;a=1">`)
+	})
+
+	t.Run("when message header is malformed", func(t *testing.T) {
+		part, err := parseMessagePart("Malformed header\r\n\r\nBody\r\n")
+
+		assert.Nil(t, part)
+		assert.Error(t, err)
+	})
+
+	t.Run("when multipart structure is malformed", func(t *testing.T) {
+		part, err := parseMessagePart("Content-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\nMalformed header\r\n\r\n--b--\r\n")
+
+		assert.NotNil(t, part)
+		assert.Error(t, err)
+	})
+
+	t.Run("when nested multipart structure is malformed", func(t *testing.T) {
+		msgData := "Content-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\n" +
+			"Content-Type: multipart/mixed; boundary=c\r\n\r\n--c\r\nMalformed header\r\n\r\n--c--\r\n--b--\r\n"
+		part, err := parseMessagePart(msgData)
+
+		assert.NotNil(t, part)
+		assert.Error(t, err)
+	})
+}
+
+func TestTransferDecoder(t *testing.T) {
+	t.Run("decodes base64", func(t *testing.T) {
+		data, _ := ioutil.ReadAll(transferDecoder(" Base64 ", strings.NewReader("Ym9k\r\neQ==")))
+
+		assert.Equal(t, "body", string(data))
+	})
+
+	t.Run("decodes quoted-printable", func(t *testing.T) {
+		data, _ := ioutil.ReadAll(transferDecoder("quoted-printable", strings.NewReader("a=3Db=\r\nc")))
+
+		assert.Equal(t, "a=bc", string(data))
+	})
+
+	t.Run("returns data as is for other encodings", func(t *testing.T) {
+		data, _ := ioutil.ReadAll(transferDecoder("8bit", strings.NewReader("a=3Db")))
+
+		assert.Equal(t, "a=3Db", string(data))
+	})
+}
+
+func TestMessagePartIsMultipart(t *testing.T) {
+	t.Run("when part is multipart", func(t *testing.T) {
+		assert.True(t, (&MessagePart{ContentType: "multipart/mixed"}).IsMultipart())
+	})
+
+	t.Run("when part is not multipart", func(t *testing.T) {
+		assert.False(t, (&MessagePart{ContentType: textPlainContentType}).IsMultipart())
+	})
+}
+
+func TestMessagePartIsAttachment(t *testing.T) {
+	t.Run("when part is attachment", func(t *testing.T) {
+		part := &MessagePart{Header: textproto.MIMEHeader{"Content-Disposition": {"attachment; filename=a.txt"}}}
+
+		assert.True(t, part.IsAttachment())
+	})
+
+	t.Run("when part is not attachment", func(t *testing.T) {
+		part := &MessagePart{Header: textproto.MIMEHeader{"Content-Disposition": {"inline"}}}
+
+		assert.False(t, part.IsAttachment())
+	})
+
+	t.Run("when part has no disposition", func(t *testing.T) {
+		assert.False(t, (&MessagePart{Header: textproto.MIMEHeader{}}).IsAttachment())
+	})
+}
+
+func TestMessagePartText(t *testing.T) {
+	t.Run("returns part body converted to UTF-8", func(t *testing.T) {
+		part := &MessagePart{Params: map[string]string{"charset": "ISO-8859-1"}, Body: []byte("caf\xe9")}
+		text, err := part.Text()
+
+		assert.Equal(t, "café", text)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when part has no charset", func(t *testing.T) {
+		text, err := (&MessagePart{Body: []byte("text")}).Text()
+
+		assert.Equal(t, "text", text)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when part charset is not supported", func(t *testing.T) {
+		part := &MessagePart{Params: map[string]string{"charset": "koi8-u"}, Body: []byte("text")}
+		text, err := part.Text()
+
+		assert.Empty(t, text)
+		assert.Error(t, err)
+	})
+}
+
+func TestMessagePartCalendarEvents(t *testing.T) {
+	t.Run("returns events with method from part parameter", func(t *testing.T) {
+		part := &MessagePart{Params: map[string]string{"method": "cancel"}, Body: []byte("BEGIN:VEVENT\r\nUID:1\r\nEND:VEVENT\r\n")}
+		events, err := part.CalendarEvents()
+
+		assert.Equal(t, []CalendarEvent{{Method: "CANCEL", UID: "1"}}, events)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when part charset is not supported", func(t *testing.T) {
+		part := &MessagePart{Params: map[string]string{"charset": "koi8-u"}, Body: []byte("BEGIN:VEVENT\r\nEND:VEVENT\r\n")}
+		events, err := part.CalendarEvents()
+
+		assert.Nil(t, events)
+		assert.Error(t, err)
+	})
+}
+
+func TestMessagePartPartsByContentType(t *testing.T) {
+	part, _ := parseMessagePart(multipartMessageBody())
+	alternative := part.Parts[0]
+
+	t.Run("when content types passed", func(t *testing.T) {
+		assert.Equal(t, []*MessagePart{alternative.Parts[1]}, part.PartsByContentType(textHTMLContentType))
+	})
+
+	t.Run("when content types not passed", func(t *testing.T) {
+		assert.Equal(t, []*MessagePart{alternative.Parts[0], alternative.Parts[1], part.Parts[1]}, part.PartsByContentType())
+	})
+
+	t.Run("when part is not multipart", func(t *testing.T) {
+		leaf := alternative.Parts[0]
+
+		assert.Equal(t, []*MessagePart{leaf}, leaf.PartsByContentType(textPlainContentType))
+		assert.Empty(t, leaf.PartsByContentType(textHTMLContentType))
+	})
+}
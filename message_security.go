@@ -0,0 +1,366 @@
+package smtpmock
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+)
+
+// MessageSecurity is the result of S/MIME or OpenPGP processing of captured message.
+// Protocol is the protocol of the outermost security layer, S/MIME or OpenPGP. Signer is
+// the signer identity: e-mail address (or subject common name) of S/MIME certificate or
+// OpenPGP key user ID. Part is the innermost decrypted and unwrapped MIME parts tree, it's
+// equal to nil for case when message can't be decrypted. Error is the reason of failed
+// decryption or signature verification
+type MessageSecurity struct {
+	Protocol       string
+	Encrypted      bool
+	Decrypted      bool
+	Signed         bool
+	SignatureValid bool
+	Signer         string
+	Part           *MessagePart
+	Error          error
+}
+
+// Keys and certificates for decryption and signature verification of captured messages
+type securityKeyRing struct {
+	smimeCertificates []*x509.Certificate
+	smimePrivateKeys  []*rsa.PrivateKey
+	pgpKeys           map[uint64]*openPGPKey
+}
+
+// Security key ring builder. Parses PEM encoded S/MIME certificates and RSA private keys
+// (PKCS #1 or PKCS #8) and ASCII armored OpenPGP key ring. Returns error for case when keys
+// or certificates are invalid
+func newSecurityKeyRing(smimeCertificates, smimePrivateKeys, pgpKeyRing string) (*securityKeyRing, error) {
+	keyRing := &securityKeyRing{pgpKeys: make(map[uint64]*openPGPKey)}
+
+	for _, block := range pemBlocks(smimeCertificates) {
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		keyRing.smimeCertificates = append(keyRing.smimeCertificates, certificate)
+	}
+
+	for _, block := range pemBlocks(smimePrivateKeys) {
+		privateKey, err := parseRSAPrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+
+		keyRing.smimePrivateKeys = append(keyRing.smimePrivateKeys, privateKey)
+	}
+
+	if err := keyRing.addOpenPGPKeys(pgpKeyRing); err != nil {
+		return nil, err
+	}
+
+	return keyRing, nil
+}
+
+// Returns all PEM blocks from the given data
+func pemBlocks(data string) []*pem.Block {
+	var blocks []*pem.Block
+	rest := []byte(data)
+
+	for {
+		block, remainder := pem.Decode(rest)
+		if block == nil {
+			return blocks
+		}
+
+		blocks, rest = append(blocks, block), remainder
+	}
+}
+
+// Parses RSA private key from PKCS #1 or PKCS #8 PEM block
+func parseRSAPrivateKey(block *pem.Block) (*rsa.PrivateKey, error) {
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaPrivateKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: %T", unsupportedAlgorithmMsg, privateKey)
+	}
+
+	return rsaPrivateKey, nil
+}
+
+// Message security processor. Unwraps security layers one by one and accumulates
+// processing result
+type messageSecurityProcessor struct {
+	keyRing    *securityKeyRing
+	security   *MessageSecurity
+	signatures int
+}
+
+// Processes S/MIME and OpenPGP layers of the given message. Returns nil for case when
+// message is neither encrypted nor signed
+func newMessageSecurity(msgData string, keyRing *securityKeyRing) *MessageSecurity {
+	header, body, err := splitEntity([]byte(msgData))
+	if err != nil || securityProtocol(header) == emptyString {
+		return nil
+	}
+
+	processor := &messageSecurityProcessor{keyRing: keyRing, security: &MessageSecurity{Protocol: securityProtocol(header)}}
+	processor.process(header, body)
+
+	return processor.security
+}
+
+// Splits MIME entity into parsed header and raw body
+func splitEntity(entity []byte) (textproto.MIMEHeader, []byte, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(entity))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, _ := ioutil.ReadAll(msg.Body)
+	return textproto.MIMEHeader(msg.Header), body, nil
+}
+
+// Returns security protocol of MIME entity by its header. Returns empty string for case when
+// entity is neither encrypted nor signed
+func securityProtocol(header textproto.MIMEHeader) string {
+	contentType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+
+	switch {
+	case contentType == pkcs7MIMEContentType || contentType == pkcs7MIMELegacyContentType,
+		contentType == multipartSignedContentType &&
+			(params["protocol"] == pkcs7SignatureProtocol || params["protocol"] == pkcs7SignatureLegacyProtocol):
+		return securityProtocolSMIME
+	case contentType == multipartSignedContentType && params["protocol"] == pgpSignatureProtocol,
+		contentType == multipartEncryptedContentType && params["protocol"] == pgpEncryptedProtocol:
+		return securityProtocolOpenPGP
+	default:
+		return emptyString
+	}
+}
+
+// messageSecurityProcessor methods
+
+// Unwraps security layer of MIME entity and processes its content recursively. Parses
+// MIME parts tree for case when entity is neither encrypted nor signed
+func (processor *messageSecurityProcessor) process(header textproto.MIMEHeader, body []byte) {
+	contentType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	var content []byte
+	var err error
+
+	switch securityProtocol(header) {
+	case securityProtocolSMIME:
+		if contentType == multipartSignedContentType {
+			content, err = processor.processMultipartSigned(body, params["boundary"], processor.verifySMIMESignature)
+			break
+		}
+
+		content, err = processor.processPKCS7(header, body)
+	case securityProtocolOpenPGP:
+		if contentType == multipartSignedContentType {
+			content, err = processor.processMultipartSigned(body, params["boundary"], processor.verifyOpenPGPSignature)
+			break
+		}
+
+		content, err = processor.processOpenPGPEncrypted(body, params["boundary"])
+	default:
+		processor.security.Part, err = newMessagePart(header, transferDecoder(header.Get("Content-Transfer-Encoding"), bytes.NewReader(body)))
+		processor.fail(err)
+		return
+	}
+
+	processor.fail(err)
+	if content == nil {
+		return
+	}
+
+	nestedHeader, nestedBody, err := splitEntity(canonicalizeLineEndings(content))
+	if err != nil {
+		processor.fail(err)
+		return
+	}
+
+	processor.process(nestedHeader, nestedBody)
+}
+
+// Keeps the first processing error
+func (processor *messageSecurityProcessor) fail(err error) {
+	if err != nil && processor.security.Error == nil {
+		processor.security.Error = err
+	}
+}
+
+// Processes S/MIME application/pkcs7-mime entity. Returns decrypted or encapsulated content
+func (processor *messageSecurityProcessor) processPKCS7(header textproto.MIMEHeader, body []byte) ([]byte, error) {
+	data, err := ioutil.ReadAll(transferDecoder(header.Get("Content-Transfer-Encoding"), bytes.NewReader(body)))
+	if err != nil {
+		return nil, err
+	}
+
+	contentInfo, err := parsePKCS7ContentInfo(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentInfo.ContentType.Equal(oidPKCS7EnvelopedData) {
+		processor.security.Encrypted = true
+		content, err := decryptPKCS7EnvelopedData(contentInfo.Content.Bytes, processor.keyRing.smimePrivateKeys)
+		processor.security.Decrypted = err == nil
+		return content, err
+	}
+
+	processor.security.Signed = true
+	content, signer, err := verifyPKCS7SignedData(contentInfo, nil, processor.keyRing.smimeCertificates)
+	processor.setSignatureResult(signer, err)
+	return content, err
+}
+
+// Processes multipart/signed entity with the given signature verifier. Returns signed content
+func (processor *messageSecurityProcessor) processMultipartSigned(
+	body []byte,
+	boundary string,
+	verifySignature func(content, signature []byte) (string, error),
+) ([]byte, error) {
+	processor.security.Signed = true
+
+	content, signature, err := splitMultipartSigned(body, boundary)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := verifySignature(canonicalizeLineEndings(content), signature)
+	processor.setSignatureResult(signer, err)
+	return content, err
+}
+
+// Verifies S/MIME detached signature. Returns signer identity
+func (processor *messageSecurityProcessor) verifySMIMESignature(content, signature []byte) (string, error) {
+	contentInfo, err := parsePKCS7ContentInfo(signature)
+	if err != nil {
+		return emptyString, err
+	}
+
+	_, signer, err := verifyPKCS7SignedData(contentInfo, content, processor.keyRing.smimeCertificates)
+	return signer, err
+}
+
+// Verifies OpenPGP detached signature. Returns signer identity
+func (processor *messageSecurityProcessor) verifyOpenPGPSignature(content, signature []byte) (string, error) {
+	data, err := decodeOpenPGPArmor(signature)
+	if err != nil {
+		return emptyString, err
+	}
+
+	packets, err := readOpenPGPPackets(data)
+	if err != nil {
+		return emptyString, err
+	}
+
+	for _, packet := range packets {
+		if packet.tag == openPGPTagSignature {
+			return verifyOpenPGPSignature(packet.body, content, processor.keyRing.pgpKeys)
+		}
+	}
+
+	return emptyString, errors.New(malformedSecurityDataMsg)
+}
+
+// Processes OpenPGP multipart/encrypted entity. Returns decrypted content, verifies inline
+// signature for case when content is signed and encrypted at once
+func (processor *messageSecurityProcessor) processOpenPGPEncrypted(body []byte, boundary string) ([]byte, error) {
+	processor.security.Encrypted = true
+
+	reader, encryptedData := multipart.NewReader(bytes.NewReader(body), boundary), []byte(nil)
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); mediaType == "application/octet-stream" {
+			encryptedData, _ = ioutil.ReadAll(part)
+		}
+	}
+
+	literal, err := decryptOpenPGPMessage(encryptedData, processor.keyRing.pgpKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	processor.security.Decrypted = true
+	if literal.signature != nil {
+		processor.security.Signed = true
+		signer, err := verifyOpenPGPSignature(literal.signature, literal.data, processor.keyRing.pgpKeys)
+		processor.setSignatureResult(signer, err)
+	}
+
+	return literal.data, nil
+}
+
+// Sets signature verification result. Signature is valid only for case when all
+// signature layers were verified successfully
+func (processor *messageSecurityProcessor) setSignatureResult(signer string, err error) {
+	security := processor.security
+	security.SignatureValid = err == nil && (processor.signatures == 0 || security.SignatureValid)
+	processor.signatures++
+
+	if signer != emptyString {
+		security.Signer = signer
+	}
+
+	processor.fail(err)
+}
+
+// Splits multipart/signed body into raw signed content (without the line break preceding
+// the next boundary delimiter) and decoded signature
+func splitMultipartSigned(body []byte, boundary string) ([]byte, []byte, error) {
+	delimiter := []byte("\r\n--" + boundary)
+	body = canonicalizeLineEndings(body)
+
+	delimiterStart := bytes.Index(append([]byte("\r\n"), body...), delimiter)
+	if delimiterStart < 0 {
+		return nil, nil, errors.New(malformedSecurityDataMsg)
+	}
+
+	contentStart := delimiterStart + bytes.Index(body[delimiterStart:], []byte("\r\n")) + 2
+	contentEnd := bytes.Index(body[contentStart:], delimiter)
+	if contentEnd < 0 {
+		return nil, nil, errors.New(malformedSecurityDataMsg)
+	}
+
+	var part *multipart.Part
+	var err error
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for index := 0; index < 2; index++ {
+		if part, err = reader.NextRawPart(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	signature, err := ioutil.ReadAll(transferDecoder(part.Header.Get("Content-Transfer-Encoding"), part))
+	return body[contentStart : contentStart+contentEnd], signature, err
+}
+
+// Converts line endings to <CR><LF>
+func canonicalizeLineEndings(data []byte) []byte {
+	return bytes.ReplaceAll(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+}
@@ -0,0 +1,386 @@
+package smtpmock
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSecurityKeyRing(t *testing.T) {
+	t.Run("returns key ring with parsed certificates and keys", func(t *testing.T) {
+		keyRing, err := newSecurityKeyRing(
+			securityFixture("smime_ca.crt")+securityFixture("smime_user.crt"),
+			securityFixture("smime_user.key"),
+			securityFixture("pgp_public.asc")+securityFixture("pgp_secret.asc"),
+		)
+
+		assert.NoError(t, err)
+		assert.Len(t, keyRing.smimeCertificates, 2)
+		assert.Len(t, keyRing.smimePrivateKeys, 1)
+		assert.Len(t, keyRing.pgpKeys, 2)
+		for _, key := range keyRing.pgpKeys {
+			assert.Equal(t, "smtpmock test <user@example.com>", key.userID)
+			assert.NotNil(t, key.privateKey)
+		}
+	})
+
+	t.Run("returns empty key ring", func(t *testing.T) {
+		keyRing, err := newSecurityKeyRing(emptyString, emptyString, emptyString)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &securityKeyRing{pgpKeys: map[uint64]*openPGPKey{}}, keyRing)
+	})
+
+	t.Run("when certificate is invalid", func(t *testing.T) {
+		certificate := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("invalid")}))
+
+		keyRing, err := newSecurityKeyRing(certificate, emptyString, emptyString)
+
+		assert.Nil(t, keyRing)
+		assert.Error(t, err)
+	})
+
+	t.Run("when private key is invalid", func(t *testing.T) {
+		privateKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("invalid")}))
+
+		keyRing, err := newSecurityKeyRing(emptyString, privateKey, emptyString)
+
+		assert.Nil(t, keyRing)
+		assert.Error(t, err)
+	})
+
+	t.Run("when OpenPGP key ring is invalid", func(t *testing.T) {
+		keyRing, err := newSecurityKeyRing(emptyString, emptyString, "-----BEGIN PGP PUBLIC KEY BLOCK-----\n")
+
+		assert.Nil(t, keyRing)
+		assert.Error(t, err)
+	})
+}
+
+func TestPemBlocks(t *testing.T) {
+	t.Run("returns all PEM blocks", func(t *testing.T) {
+		blocks := pemBlocks(securityFixture("smime_ca.crt") + securityFixture("smime_user.key"))
+
+		assert.Len(t, blocks, 2)
+		assert.Equal(t, "CERTIFICATE", blocks[0].Type)
+		assert.Equal(t, "PRIVATE KEY", blocks[1].Type)
+	})
+
+	t.Run("when data has no PEM blocks", func(t *testing.T) {
+		assert.Empty(t, pemBlocks("data"))
+	})
+}
+
+func TestParseRSAPrivateKey(t *testing.T) {
+	privateKey := createSecurityKeyRing().smimePrivateKeys[0]
+
+	t.Run("when PKCS #1 private key", func(t *testing.T) {
+		parsedPrivateKey, err := parseRSAPrivateKey(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+		assert.NoError(t, err)
+		assert.True(t, privateKey.Equal(parsedPrivateKey))
+	})
+
+	t.Run("when PKCS #8 private key", func(t *testing.T) {
+		parsedPrivateKey, err := parseRSAPrivateKey(pemBlocks(securityFixture("smime_user.key"))[0])
+
+		assert.NoError(t, err)
+		assert.True(t, privateKey.Equal(parsedPrivateKey))
+	})
+
+	t.Run("when private key is invalid", func(t *testing.T) {
+		parsedPrivateKey, err := parseRSAPrivateKey(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("invalid")})
+
+		assert.Nil(t, parsedPrivateKey)
+		assert.Error(t, err)
+	})
+
+	t.Run("when private key is not RSA key", func(t *testing.T) {
+		ecdsaPrivateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		data, _ := x509.MarshalPKCS8PrivateKey(ecdsaPrivateKey)
+		parsedPrivateKey, err := parseRSAPrivateKey(&pem.Block{Type: "PRIVATE KEY", Bytes: data})
+
+		assert.Nil(t, parsedPrivateKey)
+		assert.EqualError(t, err, unsupportedAlgorithmMsg+": *ecdsa.PrivateKey")
+	})
+}
+
+func TestNewMessageSecurity(t *testing.T) {
+	keyRing, signer := createSecurityKeyRing(), "user@example.com"
+	pgpSigner := "smtpmock test <user@example.com>"
+
+	for _, testCase := range []struct {
+		fixture  string
+		security MessageSecurity
+	}{
+		{"smime_encrypted.eml", MessageSecurity{Protocol: securityProtocolSMIME, Encrypted: true, Decrypted: true}},
+		{"smime_signed.eml", MessageSecurity{Protocol: securityProtocolSMIME, Signed: true, SignatureValid: true, Signer: signer}},
+		{"smime_opaque_signed.eml", MessageSecurity{Protocol: securityProtocolSMIME, Signed: true, SignatureValid: true, Signer: signer}},
+		{
+			"smime_signed_encrypted.eml",
+			MessageSecurity{Protocol: securityProtocolSMIME, Encrypted: true, Decrypted: true, Signed: true, SignatureValid: true, Signer: signer},
+		},
+		{"pgp_encrypted.eml", MessageSecurity{Protocol: securityProtocolOpenPGP, Encrypted: true, Decrypted: true}},
+		{"pgp_signed.eml", MessageSecurity{Protocol: securityProtocolOpenPGP, Signed: true, SignatureValid: true, Signer: pgpSigner}},
+		{
+			"pgp_signed_encrypted.eml",
+			MessageSecurity{Protocol: securityProtocolOpenPGP, Encrypted: true, Decrypted: true, Signed: true, SignatureValid: true, Signer: pgpSigner},
+		},
+	} {
+		testCase := testCase
+
+		t.Run("processes "+testCase.fixture, func(t *testing.T) {
+			security := newMessageSecurity(securityFixture(testCase.fixture), keyRing)
+			part := security.Part
+			security.Part = nil
+
+			assert.Equal(t, testCase.security, *security)
+			assert.Equal(t, textPlainContentType, part.ContentType)
+			assert.Equal(t, "Secret text\r\n", string(part.Body))
+		})
+	}
+
+	t.Run("when message is neither encrypted nor signed", func(t *testing.T) {
+		assert.Nil(t, newMessageSecurity("Subject: Test\r\n\r\nBody\r\n", keyRing))
+	})
+
+	t.Run("when message can't be parsed", func(t *testing.T) {
+		assert.Nil(t, newMessageSecurity("Malformed header\r\n", keyRing))
+	})
+
+	t.Run("when decryption key not found", func(t *testing.T) {
+		emptyKeyRing := createEmptySecurityKeyRing()
+
+		for _, fixture := range []string{"smime_encrypted.eml", "pgp_encrypted.eml"} {
+			security := newMessageSecurity(securityFixture(fixture), emptyKeyRing)
+
+			assert.True(t, security.Encrypted)
+			assert.False(t, security.Decrypted)
+			assert.Nil(t, security.Part)
+			assert.EqualError(t, security.Error, noDecryptionKeyMsg)
+		}
+	})
+
+	t.Run("when S/MIME signer certificate is not trusted", func(t *testing.T) {
+		security := newMessageSecurity(securityFixture("smime_signed.eml"), createEmptySecurityKeyRing())
+
+		assert.True(t, security.Signed)
+		assert.False(t, security.SignatureValid)
+		assert.Equal(t, signer, security.Signer)
+		assert.NotNil(t, security.Part)
+		assert.EqualError(t, security.Error, untrustedSignerMsg)
+	})
+
+	t.Run("when signed content was modified", func(t *testing.T) {
+		for _, fixture := range []string{"smime_signed.eml", "pgp_signed.eml"} {
+			security := newMessageSecurity(strings.Replace(securityFixture(fixture), "Secret text", "Secret test", 1), keyRing)
+
+			assert.False(t, security.SignatureValid)
+			assert.Equal(t, "Secret test\r\n", string(security.Part.Body))
+			assert.Error(t, security.Error)
+		}
+	})
+
+	t.Run("when OpenPGP signer key not found", func(t *testing.T) {
+		security := newMessageSecurity(securityFixture("pgp_signed.eml"), createEmptySecurityKeyRing())
+
+		assert.False(t, security.SignatureValid)
+		assert.Regexp(t, `\A[0-9A-F]{16}\z`, security.Signer)
+		assert.EqualError(t, security.Error, signerNotFoundMsg)
+	})
+}
+
+func TestSplitEntity(t *testing.T) {
+	t.Run("returns parsed header and raw body", func(t *testing.T) {
+		header, body, err := splitEntity([]byte("Subject: Test\r\n\r\n=3D\r\n"))
+
+		assert.Equal(t, textproto.MIMEHeader{"Subject": {"Test"}}, header)
+		assert.Equal(t, "=3D\r\n", string(body))
+		assert.NoError(t, err)
+	})
+
+	t.Run("when entity can't be parsed", func(t *testing.T) {
+		header, body, err := splitEntity([]byte("Malformed header\r\n"))
+
+		assert.Nil(t, header)
+		assert.Nil(t, body)
+		assert.Error(t, err)
+	})
+}
+
+func TestSecurityProtocol(t *testing.T) {
+	for contentType, protocol := range map[string]string{
+		pkcs7MIMEContentType + "; smime-type=enveloped-data":                     securityProtocolSMIME,
+		pkcs7MIMELegacyContentType + "; smime-type=signed-data":                  securityProtocolSMIME,
+		`multipart/signed; protocol="application/pkcs7-signature"; boundary=b`:   securityProtocolSMIME,
+		`multipart/signed; protocol="application/x-pkcs7-signature"; boundary=b`: securityProtocolSMIME,
+		`multipart/signed; protocol="application/pgp-signature"; boundary=b`:     securityProtocolOpenPGP,
+		`multipart/encrypted; protocol="application/pgp-encrypted"; boundary=b`:  securityProtocolOpenPGP,
+		`multipart/signed; protocol="application/unknown"; boundary=b`:           emptyString,
+		textPlainContentType: emptyString,
+	} {
+		assert.Equal(t, protocol, securityProtocol(textproto.MIMEHeader{"Content-Type": {contentType}}))
+	}
+}
+
+func TestMessageSecurityProcessorProcess(t *testing.T) {
+	newProcessor := func() *messageSecurityProcessor {
+		return &messageSecurityProcessor{keyRing: createSecurityKeyRing(), security: new(MessageSecurity)}
+	}
+	pgpSignedHeader := textproto.MIMEHeader{"Content-Type": {`multipart/signed; protocol="application/pgp-signature"; boundary=b`}}
+	pgpEncryptedHeader := textproto.MIMEHeader{"Content-Type": {`multipart/encrypted; protocol="application/pgp-encrypted"; boundary=b`}}
+	pkcs7Header := textproto.MIMEHeader{"Content-Type": {pkcs7MIMEContentType}, "Content-Transfer-Encoding": {"base64"}}
+
+	t.Run("when MIME parts tree can't be parsed", func(t *testing.T) {
+		processor := newProcessor()
+		processor.process(textproto.MIMEHeader{"Content-Type": {"multipart/mixed; boundary=b"}}, []byte("--b\r\nA: b\r\n\r\ntext"))
+
+		assert.Error(t, processor.security.Error)
+	})
+
+	t.Run("when decrypted content can't be parsed", func(t *testing.T) {
+		processor := newProcessor()
+		encryptedData := encryptOpenPGPMessage(createOpenPGPKey(), openPGPLiteralPacket("Malformed header\r\n"))
+		processor.process(pgpEncryptedHeader, append(append([]byte("--b\r\nContent-Type: application/octet-stream\r\n\r\n"), encryptedData...), "\r\n--b--\r\n"...))
+
+		assert.True(t, processor.security.Decrypted)
+		assert.Nil(t, processor.security.Part)
+		assert.Error(t, processor.security.Error)
+	})
+
+	t.Run("when multipart/signed body is malformed", func(t *testing.T) {
+		processor := newProcessor()
+		processor.process(pgpSignedHeader, []byte("text"))
+
+		assert.True(t, processor.security.Signed)
+		assert.EqualError(t, processor.security.Error, malformedSecurityDataMsg)
+	})
+
+	t.Run("when OpenPGP signature has no signature packet", func(t *testing.T) {
+		processor := newProcessor()
+		signature := armorOpenPGPPackets("MESSAGE", openPGPPacket{tag: openPGPTagLiteral, body: []byte{'b', 0, 0, 0, 0, 0}})
+		processor.process(pgpSignedHeader, []byte("--b\r\nA: b\r\n\r\ntext\r\n--b\r\n\r\n"+signature+"\r\n--b--\r\n"))
+
+		assert.EqualError(t, processor.security.Error, malformedSecurityDataMsg)
+	})
+
+	t.Run("when OpenPGP signature armor is malformed", func(t *testing.T) {
+		processor := newProcessor()
+		processor.process(pgpSignedHeader, []byte("--b\r\nA: b\r\n\r\ntext\r\n--b\r\n\r\nsignature\r\n--b--\r\n"))
+
+		assert.False(t, processor.security.SignatureValid)
+		assert.Error(t, processor.security.Error)
+	})
+
+	t.Run("when OpenPGP signature packets are malformed", func(t *testing.T) {
+		processor := newProcessor()
+		signature := "-----BEGIN PGP SIGNATURE-----\r\n\r\nAA==\r\n-----END PGP SIGNATURE-----"
+		processor.process(pgpSignedHeader, []byte("--b\r\nA: b\r\n\r\ntext\r\n--b\r\n\r\n"+signature+"\r\n--b--\r\n"))
+
+		assert.EqualError(t, processor.security.Error, malformedSecurityDataMsg)
+	})
+
+	t.Run("when S/MIME signature is malformed", func(t *testing.T) {
+		processor := newProcessor()
+		header := textproto.MIMEHeader{"Content-Type": {`multipart/signed; protocol="application/pkcs7-signature"; boundary=b`}}
+		processor.process(header, []byte("--b\r\nA: b\r\n\r\ntext\r\n--b\r\n\r\nsignature\r\n--b--\r\n"))
+
+		assert.True(t, processor.security.Signed)
+		assert.False(t, processor.security.SignatureValid)
+		assert.Error(t, processor.security.Error)
+	})
+
+	t.Run("when application/pkcs7-mime body can't be decoded", func(t *testing.T) {
+		processor := newProcessor()
+		processor.process(pkcs7Header, []byte("!!!"))
+
+		assert.Error(t, processor.security.Error)
+	})
+
+	t.Run("when application/pkcs7-mime body is malformed", func(t *testing.T) {
+		processor := newProcessor()
+		processor.process(pkcs7Header, []byte("AA=="))
+
+		assert.Error(t, processor.security.Error)
+	})
+
+	t.Run("when multipart/encrypted body is malformed", func(t *testing.T) {
+		processor := newProcessor()
+		processor.process(pgpEncryptedHeader, []byte("--b\r\nMalformed header\r\n\r\n--b--\r\n"))
+
+		assert.True(t, processor.security.Encrypted)
+		assert.Error(t, processor.security.Error)
+	})
+
+	t.Run("when multipart/encrypted body has no encrypted data", func(t *testing.T) {
+		processor := newProcessor()
+		processor.process(pgpEncryptedHeader, []byte("--b\r\nContent-Type: application/pgp-encrypted\r\n\r\nVersion: 1\r\n--b--\r\n"))
+
+		assert.False(t, processor.security.Decrypted)
+		assert.EqualError(t, processor.security.Error, malformedSecurityDataMsg)
+	})
+}
+
+func TestMessageSecurityProcessorSetSignatureResult(t *testing.T) {
+	t.Run("signature is valid when all signature layers are valid", func(t *testing.T) {
+		processor := &messageSecurityProcessor{security: new(MessageSecurity)}
+		processor.setSignatureResult("inner", nil)
+		processor.setSignatureResult(emptyString, nil)
+
+		assert.True(t, processor.security.SignatureValid)
+		assert.Equal(t, "inner", processor.security.Signer)
+		assert.NoError(t, processor.security.Error)
+	})
+
+	t.Run("signature is invalid when any signature layer is invalid", func(t *testing.T) {
+		processor := &messageSecurityProcessor{security: new(MessageSecurity)}
+		processor.setSignatureResult("outer", assert.AnError)
+		processor.setSignatureResult("inner", nil)
+
+		assert.False(t, processor.security.SignatureValid)
+		assert.Equal(t, "inner", processor.security.Signer)
+		assert.Equal(t, assert.AnError, processor.security.Error)
+	})
+}
+
+func TestSplitMultipartSigned(t *testing.T) {
+	t.Run("returns signed content and decoded signature", func(t *testing.T) {
+		body := "preamble\n--b\nA: b\n\ntext\n\n--b\nContent-Transfer-Encoding: base64\n\nc2lnbmF0dXJl\n--b--\n"
+		content, signature, err := splitMultipartSigned([]byte(body), "b")
+
+		assert.Equal(t, "A: b\r\n\r\ntext\r\n", string(content))
+		assert.Equal(t, "signature", string(signature))
+		assert.NoError(t, err)
+	})
+
+	t.Run("when first boundary delimiter not found", func(t *testing.T) {
+		_, _, err := splitMultipartSigned([]byte("text"), "b")
+
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+
+	t.Run("when second boundary delimiter not found", func(t *testing.T) {
+		_, _, err := splitMultipartSigned([]byte("--b\r\ntext"), "b")
+
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+
+	t.Run("when signature part not found", func(t *testing.T) {
+		_, _, err := splitMultipartSigned([]byte("--b\r\nA: b\r\n\r\ntext\r\n--b--\r\n"), "b")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestCanonicalizeLineEndings(t *testing.T) {
+	t.Run("converts line endings to CRLF", func(t *testing.T) {
+		assert.Equal(t, "a\r\nb\r\nc", string(canonicalizeLineEndings([]byte("a\nb\r\nc"))))
+	})
+}
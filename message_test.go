@@ -1,7 +1,9 @@
 package smtpmock
 
 import (
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -70,6 +72,14 @@ func TestMessageRcptto(t *testing.T) {
 	})
 }
 
+func TestMessageCustomRequestResponse(t *testing.T) {
+	t.Run("getter for customRequestResponse field", func(t *testing.T) {
+		message := Message{customRequestResponse: [][]string{{"ETRN example.com", "250 Queuing started"}}}
+
+		assert.Equal(t, message.customRequestResponse, message.CustomRequestResponse())
+	})
+}
+
 func TestMessageDataRequest(t *testing.T) {
 	t.Run("getter for dataRequest field", func(t *testing.T) {
 		message := Message{dataRequest: "some context"}
@@ -102,6 +112,38 @@ func TestMessageMsgRequest(t *testing.T) {
 	})
 }
 
+func TestMessageMsgRawRequest(t *testing.T) {
+	t.Run("getter for msgRawRequest field", func(t *testing.T) {
+		message := Message{msgRawRequest: "some context"}
+
+		assert.Equal(t, message.msgRawRequest, message.MsgRawRequest())
+	})
+}
+
+func TestMessageQueueID(t *testing.T) {
+	t.Run("getter for queueID field", func(t *testing.T) {
+		message := Message{queueID: "some context"}
+
+		assert.Equal(t, message.queueID, message.QueueID())
+	})
+}
+
+func TestMessageValidationFindings(t *testing.T) {
+	t.Run("getter for validationFindings field", func(t *testing.T) {
+		message := Message{validationFindings: []MessageValidationFinding{{Rule: messageValidatorRuleMissingHeader}}}
+
+		assert.Equal(t, message.validationFindings, message.ValidationFindings())
+	})
+}
+
+func TestMessageSecurity(t *testing.T) {
+	t.Run("getter for security field", func(t *testing.T) {
+		message := Message{security: &MessageSecurity{Protocol: securityProtocolSMIME}}
+
+		assert.Equal(t, message.security, message.Security())
+	})
+}
+
 func TestMessageMsgResponse(t *testing.T) {
 	t.Run("getter for msgRequest field", func(t *testing.T) {
 		message := Message{msgResponse: "some context"}
@@ -158,6 +200,22 @@ func TestMessageQuitSent(t *testing.T) {
 	})
 }
 
+func TestMessageReceivedAt(t *testing.T) {
+	t.Run("getter for receivedAt field", func(t *testing.T) {
+		message := Message{receivedAt: time.Now()}
+
+		assert.Equal(t, message.receivedAt, message.ReceivedAt())
+	})
+}
+
+func TestMessageSessionID(t *testing.T) {
+	t.Run("getter for sessionID field", func(t *testing.T) {
+		message := Message{sessionID: 42}
+
+		assert.Equal(t, message.sessionID, message.SessionID())
+	})
+}
+
 func TestMessageIsConsistent(t *testing.T) {
 	t.Run("when consistent", func(t *testing.T) {
 		message := &Message{mailfrom: true, rcptto: true, data: true, msg: true}
@@ -221,16 +279,65 @@ func TestMessagePointerIsConsistent(t *testing.T) {
 }
 
 func TestMessageIsIncludesSuccessfulRcpttoResponse(t *testing.T) {
-	targetSuccessfulResponse := "response"
-
 	t.Run("when successful RCPTTO response exists", func(t *testing.T) {
-		message := &Message{rcpttoRequestResponse: [][]string{{"request", targetSuccessfulResponse}}}
+		message := &Message{rcpttoRequestResponse: [][]string{{"request", "550 User not found"}, {"request", "250 Accepted"}}}
 
-		assert.True(t, message.isIncludesSuccessfulRcpttoResponse(targetSuccessfulResponse))
+		assert.True(t, message.isIncludesSuccessfulRcpttoResponse())
 	})
 
 	t.Run("when successful RCPTTO response not exists", func(t *testing.T) {
-		assert.False(t, new(Message).isIncludesSuccessfulRcpttoResponse(targetSuccessfulResponse))
+		message := &Message{rcpttoRequestResponse: [][]string{{"request", "550 User not found"}}}
+
+		assert.False(t, message.isIncludesSuccessfulRcpttoResponse())
+		assert.False(t, new(Message).isIncludesSuccessfulRcpttoResponse())
+	})
+}
+
+func TestMessageSender(t *testing.T) {
+	t.Run("returns MAIL FROM address", func(t *testing.T) {
+		assert.Equal(t, "user@example.com", Message{mailfromRequest: "MAIL FROM:<user@example.com>"}.Sender())
+	})
+
+	t.Run("when MAIL FROM request is empty", func(t *testing.T) {
+		assert.Empty(t, new(Message).Sender())
+	})
+}
+
+func TestMessageRecipients(t *testing.T) {
+	t.Run("returns RCPT TO addresses accepted by server", func(t *testing.T) {
+		message := Message{
+			rcpttoRequestResponse: [][]string{
+				{"RCPT TO:<user1@example.com>", defaultReceivedMsg},
+				{"RCPT TO:<user2@example.com>", defaultNotRegistredRcpttoEmailMsg},
+				{"RCPT TO:<user3@example.com>", "250 Accepted"},
+			},
+		}
+
+		assert.Equal(t, []string{"user1@example.com", "user3@example.com"}, message.Recipients())
+	})
+
+	t.Run("when RCPT TO requests are empty", func(t *testing.T) {
+		assert.Nil(t, new(Message).Recipients())
+	})
+}
+
+func TestMessageLastResponse(t *testing.T) {
+	t.Run("returns the last server response within message context", func(t *testing.T) {
+		rcpttoRequestResponse := [][]string{{"request", defaultReceivedMsg}, {"request", defaultNotRegistredRcpttoEmailMsg}}
+
+		for response, message := range map[string]Message{
+			"msg":                             {heloResponse: "helo", mailfromResponse: "mailfrom", rcpttoRequestResponse: rcpttoRequestResponse, dataResponse: "data", msgResponse: "msg"},
+			"data":                            {heloResponse: "helo", mailfromResponse: "mailfrom", rcpttoRequestResponse: rcpttoRequestResponse, dataResponse: "data"},
+			defaultNotRegistredRcpttoEmailMsg: {heloResponse: "helo", mailfromResponse: "mailfrom", rcpttoRequestResponse: rcpttoRequestResponse},
+			"mailfrom":                        {heloResponse: "helo", mailfromResponse: "mailfrom"},
+			"helo":                            {heloResponse: "helo"},
+		} {
+			assert.Equal(t, response, message.lastResponse())
+		}
+	})
+
+	t.Run("when message has no responses", func(t *testing.T) {
+		assert.Empty(t, new(Message).lastResponse())
 	})
 }
 
@@ -243,6 +350,75 @@ func TestMessagesAppend(t *testing.T) {
 		assert.Same(t, message, messages.items[0])
 		messages.RUnlock()
 	})
+
+	t.Run("stamps message received time", func(t *testing.T) {
+		timeStub := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		timeNow = func() time.Time { return timeStub }
+		defer func() { timeNow = time.Now }()
+		message, messages := new(Message), new(messages)
+		messages.append(message)
+
+		assert.Equal(t, timeStub, message.receivedAt)
+	})
+}
+
+func TestMessagesStore(t *testing.T) {
+	t.Run("stores message pointer, returns snapshot of subscriptions with added pending delivery", func(t *testing.T) {
+		message, messages, unsubscribed := new(Message), new(messages), make(chan interface{})
+		subscription := messages.subscribe(newSubscription(messages, func(Message) {}))
+		subscriptions := messages.store(message)
+		go func() {
+			defer close(unsubscribed)
+			subscription.Unsubscribe()
+		}()
+
+		assert.Equal(t, []*Subscription{subscription}, subscriptions)
+		assert.Same(t, message, messages.items[0])
+		assert.Never(t, func() bool {
+			select {
+			case <-unsubscribed:
+				return true
+			default:
+				return false
+			}
+		}, 10*time.Millisecond, time.Millisecond)
+
+		subscription.deliver(*message)
+		<-unsubscribed
+	})
+}
+
+func TestMessagesSubscribe(t *testing.T) {
+	t.Run("adds subscription, delivers stored messages to it", func(t *testing.T) {
+		var deliveredMessages []Message
+		message, messages := &Message{heloRequest: "some context"}, new(messages)
+		subscription := messages.subscribe(newSubscription(messages, func(message Message) {
+			deliveredMessages = append(deliveredMessages, message)
+		}))
+		messages.append(message)
+
+		assert.Equal(t, []*Subscription{subscription}, messages.subscriptions)
+		assert.Equal(t, []Message{*message}, deliveredMessages)
+	})
+}
+
+func TestMessagesUnsubscribe(t *testing.T) {
+	t.Run("removes the given subscription only", func(t *testing.T) {
+		messages := new(messages)
+		firstSubscription := messages.subscribe(newSubscription(messages, func(Message) {}))
+		secondSubscription := messages.subscribe(newSubscription(messages, func(Message) {}))
+		messages.unsubscribe(firstSubscription)
+
+		assert.Equal(t, []*Subscription{secondSubscription}, messages.subscriptions)
+	})
+
+	t.Run("when subscription not found", func(t *testing.T) {
+		messages := new(messages)
+		subscription := messages.subscribe(newSubscription(messages, func(Message) {}))
+		messages.unsubscribe(newSubscription(messages, func(Message) {}))
+
+		assert.Equal(t, []*Subscription{subscription}, messages.subscriptions)
+	})
 }
 
 func TestMessagesCopy(t *testing.T) {
@@ -268,6 +444,134 @@ func TestMessagesPurge(t *testing.T) {
 	})
 }
 
+func TestMessagesFilter(t *testing.T) {
+	filter := MessageFilter{From: "user@example.com"}
+
+	t.Run("returns copy of matched messages", func(t *testing.T) {
+		message, messages := &Message{mailfromRequest: "MAIL FROM:<user@example.com>"}, new(messages)
+		messages.append(message)
+		messages.append(new(Message))
+
+		assert.Equal(t, []Message{*message}, messages.filter(filter))
+		assert.Len(t, messages.copy(), 2)
+	})
+
+	t.Run("when there are no matched messages", func(t *testing.T) {
+		messages := new(messages)
+		messages.append(new(Message))
+
+		assert.Equal(t, []Message{}, messages.filter(filter))
+	})
+}
+
+func TestMessagesPurgeMatched(t *testing.T) {
+	filter := MessageFilter{Subject: regexp.MustCompile("Hello")}
+
+	t.Run("returns matched messages and removes them, keeps other messages", func(t *testing.T) {
+		matchedMessage, otherMessage, messages := &Message{msgRequest: "Subject: Hello\r\n\r\n"}, new(Message), new(messages)
+		messages.append(matchedMessage)
+		messages.append(otherMessage)
+
+		assert.Equal(t, []Message{*matchedMessage}, messages.purgeMatched(filter))
+		assert.Equal(t, []Message{*otherMessage}, messages.copy())
+	})
+
+	t.Run("when there are no matched messages", func(t *testing.T) {
+		messages := new(messages)
+		messages.append(new(Message))
+
+		assert.Equal(t, []Message{}, messages.purgeMatched(filter))
+		assert.Len(t, messages.copy(), 1)
+	})
+}
+
+func TestMessagesFind(t *testing.T) {
+	predicate := func(message Message) bool { return message.heloRequest == "matched" }
+
+	t.Run("returns the first matched message without purging", func(t *testing.T) {
+		messages, message := new(messages), &Message{heloRequest: "matched"}
+		messages.append(new(Message))
+		messages.append(message)
+		messages.append(&Message{heloRequest: "matched", heloResponse: "other"})
+		foundMessage, found := messages.find(predicate, false)
+
+		assert.True(t, found)
+		assert.Equal(t, *message, foundMessage)
+		assert.Len(t, messages.copy(), 3)
+	})
+
+	t.Run("returns the first matched message with purging", func(t *testing.T) {
+		messages, message, otherMessage := new(messages), &Message{heloRequest: "matched"}, new(Message)
+		messages.append(otherMessage)
+		messages.append(message)
+		foundMessage, found := messages.find(predicate, true)
+
+		assert.True(t, found)
+		assert.Equal(t, *message, foundMessage)
+		assert.Equal(t, []Message{*otherMessage}, messages.copy())
+	})
+
+	t.Run("when there are no matched messages", func(t *testing.T) {
+		messages := new(messages)
+		messages.append(new(Message))
+		foundMessage, found := messages.find(predicate, true)
+
+		assert.False(t, found)
+		assert.Equal(t, Message{}, foundMessage)
+		assert.Len(t, messages.copy(), 1)
+	})
+
+	t.Run("calls predicate without lock", func(t *testing.T) {
+		messages, message := new(messages), new(Message)
+		messages.append(message)
+		foundMessage, found := messages.find(func(Message) bool { return len(messages.copy()) == 1 }, true)
+
+		assert.True(t, found)
+		assert.Equal(t, *message, foundMessage)
+		assert.Empty(t, messages.copy())
+	})
+
+	t.Run("skips matched message which was removed before purging", func(t *testing.T) {
+		messages := new(messages)
+		messages.append(new(Message))
+		foundMessage, found := messages.find(func(Message) bool { messages.clear(); return true }, true)
+
+		assert.False(t, found)
+		assert.Equal(t, Message{}, foundMessage)
+	})
+}
+
+func TestMessagesSnapshot(t *testing.T) {
+	t.Run("returns copy of message pointers", func(t *testing.T) {
+		messages, message := new(messages), new(Message)
+		messages.append(message)
+		snapshot := messages.snapshot()
+		messages.clear()
+
+		assert.Len(t, snapshot, 1)
+		assert.Same(t, message, snapshot[0])
+	})
+}
+
+func TestMessagesRemove(t *testing.T) {
+	t.Run("removes the given message", func(t *testing.T) {
+		messages, message, otherMessage := new(messages), new(Message), &Message{heloRequest: "other"}
+		messages.append(message)
+		messages.append(otherMessage)
+
+		assert.True(t, messages.remove(message))
+		assert.Equal(t, []Message{*otherMessage}, messages.copy())
+	})
+
+	t.Run("when message was already removed", func(t *testing.T) {
+		messages := new(messages)
+		messages.append(new(Message))
+
+		assert.False(t, messages.remove(new(Message)))
+		assert.Len(t, messages.copy(), 1)
+	})
+}
+
 func TestMessagesClear(t *testing.T) {
 	t.Run("clears messages from items slice", func(t *testing.T) {
 		message, messages := new(Message), new(messages)
@@ -277,3 +581,49 @@ func TestMessagesClear(t *testing.T) {
 		assert.Len(t, messages.copy(), 0)
 	})
 }
+
+func TestMessageRecord(t *testing.T) {
+	t.Run("saves request and response into message fields of SMTP command", func(t *testing.T) {
+		message := new(Message)
+		message.record("EHLO", "EHLO example.com", "250 Hi")
+		message.record("MAIL", "MAIL FROM:<user@example.com>", "250 Sender ok")
+		message.record("RCPT", "RCPT TO:<user@olo.com>", "250 Recipient ok")
+		message.record("RCPT", "RCPT TO:<user@blocked.test>", "550 Mailbox unavailable")
+		message.record("DATA", "DATA", "354 Go ahead")
+		message.record("RSET", "RSET", "250 Ok")
+		message.record("NOOP", "NOOP", "250 Ok")
+		message.record("QUIT", "QUIT", "221 Bye")
+		message.record("VRFY", "VRFY user", "252 Maybe")
+
+		assert.Equal(t, "EHLO example.com", message.heloRequest)
+		assert.Equal(t, "250 Hi", message.heloResponse)
+		assert.True(t, message.helo)
+		assert.Equal(t, "MAIL FROM:<user@example.com>", message.mailfromRequest)
+		assert.Equal(t, "250 Sender ok", message.mailfromResponse)
+		assert.True(t, message.mailfrom)
+		assert.Equal(
+			t,
+			[][]string{{"RCPT TO:<user@olo.com>", "250 Recipient ok"}, {"RCPT TO:<user@blocked.test>", "550 Mailbox unavailable"}},
+			message.rcpttoRequestResponse,
+		)
+		assert.True(t, message.rcptto)
+		assert.Equal(t, "DATA", message.dataRequest)
+		assert.Equal(t, "354 Go ahead", message.dataResponse)
+		assert.True(t, message.data)
+		assert.Equal(t, "RSET", message.rsetRequest)
+		assert.Equal(t, "250 Ok", message.rsetResponse)
+		assert.True(t, message.rset)
+		assert.True(t, message.noop)
+		assert.True(t, message.quitSent)
+		assert.Equal(t, [][]string{{"VRFY user", "252 Maybe"}}, message.customRequestResponse)
+	})
+
+	t.Run("saves failed responses", func(t *testing.T) {
+		message := new(Message)
+		message.record("HELO", "HELO example.com", "550 Go away")
+		message.record("DATA", "DATA", "554 No")
+
+		assert.False(t, message.helo)
+		assert.False(t, message.data)
+	})
+}
@@ -0,0 +1,215 @@
+package smtpmock
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// MessageValidationFinding is the result of single failed RFC 5322 message check.
+// Rule is one of: missing-header, duplicate-header, line-too-long, invalid-folding,
+// malformed-header, 8bit-header, invalid-address, invalid-date, invalid-message-id.
+// Line is the 1-based header section line number, it's equal to 0 for message-wide findings
+type MessageValidationFinding struct {
+	Rule        string
+	Header      string
+	Line        int
+	Description string
+}
+
+// Header fields checked by validator
+var (
+	messageValidatorMandatoryHeaders = []string{"Date", "From"}
+	messageValidatorSingletonHeaders = []string{
+		"Date", "From", "Sender", "Reply-To", "To", "Cc", "Bcc",
+		"Message-ID", "In-Reply-To", "References", "Subject",
+	}
+	messageValidatorAddressHeaders = []string{"From", "Sender", "Reply-To", "To", "Cc", "Bcc"}
+)
+
+// Parsed message header field
+type messageHeaderField struct {
+	name, value string
+	line        int
+}
+
+// RFC 5322 message validator
+type messageValidator struct {
+	findings []MessageValidationFinding
+	fields   []*messageHeaderField
+}
+
+// RFC 5322 message validator builder. Returns pointer to new messageValidator structure
+func newMessageValidator() *messageValidator {
+	return new(messageValidator)
+}
+
+// messageValidator methods
+
+// Validates message and returns list of findings. Returns empty list for case when
+// message is RFC 5322 compliant
+func (validator *messageValidator) validate(msgData string) []MessageValidationFinding {
+	validator.parseHeaderSection(messageHeaderSection(msgData))
+	validator.validateHeaderCount()
+	validator.validateAddressHeaders()
+	validator.validateDateHeader()
+	validator.validateMessageIDHeader()
+
+	return validator.findings
+}
+
+// Adds new finding to validator findings list
+func (validator *messageValidator) addFinding(rule, header string, line int, description string) {
+	validator.findings = append(
+		validator.findings,
+		MessageValidationFinding{Rule: rule, Header: header, Line: line, Description: description},
+	)
+}
+
+// Parses header section line by line, checks line length, folding, 8-bit bytes
+// and header field name syntax
+func (validator *messageValidator) parseHeaderSection(headerSection []string) {
+	var currentField *messageHeaderField
+
+	for index, line := range headerSection {
+		lineNumber := index + 1
+
+		if len(line) > messageValidatorMaxLineLength {
+			validator.addFinding(
+				messageValidatorRuleLineTooLong, emptyString, lineNumber,
+				fmt.Sprintf("header line length %d exceeds %d characters", len(line), messageValidatorMaxLineLength),
+			)
+		}
+
+		if isContains8BitBytes(line) {
+			validator.addFinding(messageValidatorRule8BitHeader, emptyString, lineNumber, "header line contains 8-bit bytes")
+		}
+
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if currentField == nil || strings.TrimSpace(line) == emptyString {
+				validator.addFinding(messageValidatorRuleInvalidFolding, emptyString, lineNumber, "invalid header folding")
+				continue
+			}
+
+			currentField.value += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		separatorIndex := strings.Index(line, ":")
+		if separatorIndex < 1 || !isValidHeaderFieldName(line[:separatorIndex]) {
+			currentField = nil
+			validator.addFinding(messageValidatorRuleMalformedHeader, emptyString, lineNumber, "malformed header field")
+			continue
+		}
+
+		currentField = &messageHeaderField{
+			name:  line[:separatorIndex],
+			value: strings.TrimSpace(line[separatorIndex+1:]),
+			line:  lineNumber,
+		}
+		validator.fields = append(validator.fields, currentField)
+	}
+}
+
+// Returns all header fields with the given case-insensitive name
+func (validator *messageValidator) headerFields(name string) []*messageHeaderField {
+	var fields []*messageHeaderField
+	for _, field := range validator.fields {
+		if strings.EqualFold(field.name, name) {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// Checks mandatory (Date, From) and singleton header fields count
+func (validator *messageValidator) validateHeaderCount() {
+	for _, name := range messageValidatorMandatoryHeaders {
+		if len(validator.headerFields(name)) == 0 {
+			validator.addFinding(messageValidatorRuleMissingHeader, name, 0, "mandatory header field is missing")
+		}
+	}
+
+	for _, name := range messageValidatorSingletonHeaders {
+		if fields := validator.headerFields(name); len(fields) > 1 {
+			validator.addFinding(
+				messageValidatorRuleDuplicateHeader, name, fields[1].line,
+				fmt.Sprintf("header field occurs %d times, allowed once", len(fields)),
+			)
+		}
+	}
+}
+
+// Checks address syntax of originator and destination header fields
+func (validator *messageValidator) validateAddressHeaders() {
+	for _, name := range messageValidatorAddressHeaders {
+		for _, field := range validator.headerFields(name) {
+			if field.value == emptyString && strings.EqualFold(name, "Bcc") {
+				continue
+			}
+
+			if _, err := mail.ParseAddressList(field.value); err != nil {
+				validator.addFinding(messageValidatorRuleInvalidAddress, field.name, field.line, err.Error())
+			}
+		}
+	}
+}
+
+// Checks Date header field syntax
+func (validator *messageValidator) validateDateHeader() {
+	for _, field := range validator.headerFields("Date") {
+		if _, err := mail.ParseDate(field.value); err != nil {
+			validator.addFinding(messageValidatorRuleInvalidDate, field.name, field.line, err.Error())
+		}
+	}
+}
+
+// Checks Message-ID header field syntax
+func (validator *messageValidator) validateMessageIDHeader() {
+	for _, field := range validator.headerFields("Message-ID") {
+		if !matchRegex(field.value, messageIDRegexPattern) {
+			validator.addFinding(messageValidatorRuleInvalidMessageID, field.name, field.line, "invalid msg-id syntax")
+		}
+	}
+}
+
+// Returns message header section lines. Header section ends with the first empty line
+// or with the end of message for case when body is absent
+func messageHeaderSection(msgData string) []string {
+	var headerSection []string
+	for _, line := range strings.Split(msgData, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == emptyString {
+			break
+		}
+
+		headerSection = append(headerSection, line)
+	}
+
+	return headerSection
+}
+
+// Returns true if the given string contains bytes outside of 7-bit ASCII range,
+// otherwise returns false
+func isContains8BitBytes(str string) bool {
+	for index := 0; index < len(str); index++ {
+		if str[index] > 127 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns true if the given header field name consists of printable US-ASCII
+// characters except colon, otherwise returns false
+func isValidHeaderFieldName(name string) bool {
+	for index := 0; index < len(name); index++ {
+		if character := name[index]; character < 33 || character > 126 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,155 @@
+package smtpmock
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns rules of the given findings
+func findingRules(findings []MessageValidationFinding) []string {
+	var rules []string
+	for _, finding := range findings {
+		rules = append(rules, finding.Rule)
+	}
+
+	return rules
+}
+
+// Builds message data from header lines and body
+func messageData(headerLines ...string) string {
+	return strings.Join(headerLines, "\r\n") + "\r\n\r\nBody\r\n"
+}
+
+func TestNewMessageValidator(t *testing.T) {
+	t.Run("returns new messageValidator", func(t *testing.T) {
+		assert.Equal(t, new(messageValidator), newMessageValidator())
+	})
+}
+
+func TestMessageValidatorValidate(t *testing.T) {
+	date, from := "Date: Tue, 30 Nov 2021 22:07:30 +0000", "From: User <user@example.com>"
+
+	t.Run("when message is RFC 5322 compliant", func(t *testing.T) {
+		msgData := messageData(
+			date,
+			from,
+			"To: a@example.com, B <b@example.com>",
+			"Bcc:",
+			"Message-ID: <id@example.com>",
+			"Subject: folded",
+			"\tsubject",
+		)
+
+		assert.Empty(t, newMessageValidator().validate(msgData))
+	})
+
+	t.Run("when mandatory headers are missing", func(t *testing.T) {
+		findings := newMessageValidator().validate(messageData("Subject: Test"))
+
+		assert.Equal(
+			t,
+			[]MessageValidationFinding{
+				{Rule: messageValidatorRuleMissingHeader, Header: "Date", Description: "mandatory header field is missing"},
+				{Rule: messageValidatorRuleMissingHeader, Header: "From", Description: "mandatory header field is missing"},
+			},
+			findings,
+		)
+	})
+
+	t.Run("when singleton header is duplicated", func(t *testing.T) {
+		findings := newMessageValidator().validate(
+			messageData(date, from, "Message-ID: <1@example.com>", "message-id: <2@example.com>"),
+		)
+
+		assert.Equal(
+			t,
+			[]MessageValidationFinding{
+				{Rule: messageValidatorRuleDuplicateHeader, Header: "Message-ID", Line: 4, Description: "header field occurs 2 times, allowed once"},
+			},
+			findings,
+		)
+	})
+
+	t.Run("when header line is too long", func(t *testing.T) {
+		findings := newMessageValidator().validate(messageData(date, from, "Subject: "+strings.Repeat("a", 990)))
+
+		assert.Equal(t, []string{messageValidatorRuleLineTooLong}, findingRules(findings))
+		assert.Equal(t, 3, findings[0].Line)
+	})
+
+	t.Run("when header has invalid folding", func(t *testing.T) {
+		findings := newMessageValidator().validate(messageData(" folded", date, from, "Subject: a", " \t"))
+
+		assert.Equal(t, []string{messageValidatorRuleInvalidFolding, messageValidatorRuleInvalidFolding}, findingRules(findings))
+		assert.Equal(t, 1, findings[0].Line)
+		assert.Equal(t, 5, findings[1].Line)
+	})
+
+	t.Run("when header is malformed", func(t *testing.T) {
+		findings := newMessageValidator().validate(messageData(date, from, "No separator", ": empty name", "Bad Name: value"))
+
+		assert.Equal(
+			t,
+			[]string{messageValidatorRuleMalformedHeader, messageValidatorRuleMalformedHeader, messageValidatorRuleMalformedHeader},
+			findingRules(findings),
+		)
+	})
+
+	t.Run("when header contains 8-bit bytes", func(t *testing.T) {
+		findings := newMessageValidator().validate(messageData(date, from, "Subject: Тест"))
+
+		assert.Equal(t, []string{messageValidatorRule8BitHeader}, findingRules(findings))
+	})
+
+	t.Run("when address header is malformed", func(t *testing.T) {
+		findings := newMessageValidator().validate(messageData(date, "From: not an address", "Cc:"))
+
+		assert.Equal(t, []string{messageValidatorRuleInvalidAddress, messageValidatorRuleInvalidAddress}, findingRules(findings))
+		assert.Equal(t, "From", findings[0].Header)
+		assert.Equal(t, "Cc", findings[1].Header)
+	})
+
+	t.Run("when date header is malformed", func(t *testing.T) {
+		findings := newMessageValidator().validate(messageData("Date: yesterday", from))
+
+		assert.Equal(t, []string{messageValidatorRuleInvalidDate}, findingRules(findings))
+	})
+
+	t.Run("when message-id header is malformed", func(t *testing.T) {
+		findings := newMessageValidator().validate(messageData(date, from, "Message-ID: id@example.com"))
+
+		assert.Equal(t, []string{messageValidatorRuleInvalidMessageID}, findingRules(findings))
+	})
+}
+
+func TestMessageHeaderSection(t *testing.T) {
+	t.Run("when message has body", func(t *testing.T) {
+		assert.Equal(t, []string{"A: 1", "B: 2"}, messageHeaderSection("A: 1\r\nB: 2\n\r\nBody\r\n"))
+	})
+
+	t.Run("when message has no body", func(t *testing.T) {
+		assert.Equal(t, []string{"A: 1"}, messageHeaderSection("A: 1\r\n"))
+	})
+}
+
+func TestIsContains8BitBytes(t *testing.T) {
+	t.Run("when string contains 8-bit bytes", func(t *testing.T) {
+		assert.True(t, isContains8BitBytes("caf\xc3\xa9"))
+	})
+
+	t.Run("when string contains only 7-bit bytes", func(t *testing.T) {
+		assert.False(t, isContains8BitBytes("cafe"))
+	})
+}
+
+func TestIsValidHeaderFieldName(t *testing.T) {
+	t.Run("when header field name is valid", func(t *testing.T) {
+		assert.True(t, isValidHeaderFieldName("X-Custom-Header"))
+	})
+
+	t.Run("when header field name is invalid", func(t *testing.T) {
+		assert.False(t, isValidHeaderFieldName("X Custom"))
+	})
+}
@@ -0,0 +1,54 @@
+package smtpmock
+
+import (
+	"errors"
+	"time"
+)
+
+// Middleware wraps each command handler run. Middleware runs the rest of chain and command
+// handler by calling next, it's able to skip them, change tentative context.Response after
+// next returns or end session with context.EndSession()
+type Middleware func(context *CommandContext, next func())
+
+// Session decorator which holds the last command handler response until the end of
+// middleware chain, so middleware is able to change it
+type middlewareSession struct {
+	sessionInterface
+	context   *CommandContext
+	isPending bool
+}
+
+// Middleware session builder. Returns pointer to new session decorator of the given session
+func newMiddlewareSession(session sessionInterface, context *CommandContext) *middlewareSession {
+	return &middlewareSession{sessionInterface: session, context: context}
+}
+
+// middlewareSession methods
+
+// Writes pending response, holds the given response as tentative context response
+func (session *middlewareSession) writeResponse(response string, responseDelay time.Duration) {
+	session.flush()
+	session.context.Response, session.context.ResponseDelay, session.isPending = response, responseDelay, true
+}
+
+// Writes pending response before reading, so client receives intermediate response, e.g.
+// 354 response to DATA command, before sending message body
+func (session *middlewareSession) readBytes() ([]byte, error) {
+	session.flush()
+	return session.sessionInterface.readBytes()
+}
+
+// Writes pending tentative context response to session. Session error is recomputed from
+// written response, so response changed by middleware defines fail fast behavior: negative
+// response is session error, other responses clear it. Empty response is not written
+func (session *middlewareSession) flush() {
+	if response := session.context.Response; session.isPending && response != emptyString {
+		session.clearError()
+		if isNegativeCompletionReply(response) {
+			session.addError(errors.New(response))
+		}
+		session.sessionInterface.writeResponse(response, session.context.ResponseDelay)
+	}
+
+	session.isPending = false
+}
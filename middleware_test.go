@@ -0,0 +1,104 @@
+package smtpmock
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNewMiddlewareSession(t *testing.T) {
+	t.Run("returns new session decorator", func(t *testing.T) {
+		session, context := &sessionMock{}, new(CommandContext)
+		middlewareSession := newMiddlewareSession(session, context)
+
+		assert.Same(t, session, middlewareSession.sessionInterface)
+		assert.Same(t, context, middlewareSession.context)
+		assert.False(t, middlewareSession.isPending)
+	})
+}
+
+func TestMiddlewareSessionWriteResponse(t *testing.T) {
+	t.Run("holds response as tentative context response", func(t *testing.T) {
+		session, context := &sessionMock{}, new(CommandContext)
+		middlewareSession := newMiddlewareSession(session, context)
+		middlewareSession.writeResponse("250 Ok", time.Second)
+
+		assert.True(t, session.AssertExpectations(t))
+		assert.Equal(t, "250 Ok", context.Response)
+		assert.Equal(t, time.Second, context.ResponseDelay)
+		assert.True(t, middlewareSession.isPending)
+	})
+
+	t.Run("writes pending response before holding the next one", func(t *testing.T) {
+		session, context := &sessionMock{}, new(CommandContext)
+		middlewareSession := newMiddlewareSession(session, context)
+		session.On("clearError").Once().Return(nil)
+		session.On("writeResponse", "354 Go ahead", defaultSessionResponseDelay).Once().Return(nil)
+		middlewareSession.writeResponse("354 Go ahead", defaultSessionResponseDelay)
+		middlewareSession.writeResponse("250 Queued", time.Second)
+
+		assert.True(t, session.AssertExpectations(t))
+		assert.Equal(t, "250 Queued", context.Response)
+	})
+}
+
+func TestMiddlewareSessionReadBytes(t *testing.T) {
+	t.Run("writes pending response before reading", func(t *testing.T) {
+		session, context := &sessionMock{}, new(CommandContext)
+		middlewareSession := newMiddlewareSession(session, context)
+		session.On("clearError").Once().Return(nil)
+		session.On("writeResponse", "354 Go ahead", defaultSessionResponseDelay).Once().Return(nil)
+		session.On("readBytes").Once().Return([]uint8(".\r\n"), nil)
+		middlewareSession.writeResponse("354 Go ahead", defaultSessionResponseDelay)
+		data, err := middlewareSession.readBytes()
+
+		assert.True(t, session.AssertExpectations(t))
+		assert.Equal(t, []uint8(".\r\n"), data)
+		assert.NoError(t, err)
+		assert.False(t, middlewareSession.isPending)
+	})
+}
+
+func TestMiddlewareSessionFlush(t *testing.T) {
+	t.Run("writes pending tentative context response, negative response is session error", func(t *testing.T) {
+		session, context := &sessionMock{}, new(CommandContext)
+		middlewareSession := newMiddlewareSession(session, context)
+		session.On("clearError").Once().Return(nil)
+		session.On("addError", errors.New("550 Changed")).Once().Return(nil)
+		session.On("writeResponse", "550 Changed", time.Second).Once().Return(nil)
+		middlewareSession.writeResponse("250 Ok", defaultSessionResponseDelay)
+		context.Response, context.ResponseDelay = "550 Changed", time.Second
+		middlewareSession.flush()
+		middlewareSession.flush()
+
+		assert.True(t, session.AssertExpectations(t))
+		assert.False(t, middlewareSession.isPending)
+	})
+
+	t.Run("clears session error for positive tentative context response", func(t *testing.T) {
+		session, context := &sessionMock{}, new(CommandContext)
+		middlewareSession := newMiddlewareSession(session, context)
+		session.On("clearError").Once().Return(nil)
+		session.On("writeResponse", "250 Changed", defaultSessionResponseDelay).Once().Return(nil)
+		middlewareSession.writeResponse("550 Rejected", defaultSessionResponseDelay)
+		context.Response = "250 Changed"
+		middlewareSession.flush()
+
+		assert.True(t, session.AssertExpectations(t))
+		session.AssertNotCalled(t, "addError", mock.Anything)
+	})
+
+	t.Run("does not write empty tentative context response", func(t *testing.T) {
+		session, context := &sessionMock{}, new(CommandContext)
+		middlewareSession := newMiddlewareSession(session, context)
+		middlewareSession.writeResponse("250 Ok", defaultSessionResponseDelay)
+		context.Response = emptyString
+		middlewareSession.flush()
+
+		assert.True(t, session.AssertExpectations(t))
+		assert.False(t, middlewareSession.isPending)
+	})
+}
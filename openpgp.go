@@ -0,0 +1,641 @@
+package smtpmock
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/zlib"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"strings"
+)
+
+// OpenPGP symmetric cipher key sizes, only AES is supported
+var openPGPCipherKeySizes = map[byte]int{7: 16, 8: 24, 9: 32}
+
+// OpenPGP hash algorithms
+var openPGPHashAlgorithms = map[byte]crypto.Hash{
+	2:  crypto.SHA1,
+	8:  crypto.SHA256,
+	9:  crypto.SHA384,
+	10: crypto.SHA512,
+	11: crypto.SHA224,
+}
+
+// OpenPGP RSA public key algorithms: encrypt or sign, encrypt only, sign only
+var openPGPRSAAlgorithms = map[byte]bool{1: true, 2: true, 3: true}
+
+// OpenPGP packet
+type openPGPPacket struct {
+	tag  byte
+	body []byte
+}
+
+// OpenPGP RSA key or subkey. Private key is equal to nil for public keys
+type openPGPKey struct {
+	keyID      uint64
+	userID     string
+	publicKey  *rsa.PublicKey
+	privateKey *rsa.PrivateKey
+}
+
+// OpenPGP literal data with optional inline signature packet body
+type openPGPLiteral struct {
+	data, signature []byte
+}
+
+// Returns key identity: user ID or key ID for case when user ID is absent
+func (key *openPGPKey) identity() string {
+	if key.userID != emptyString {
+		return key.userID
+	}
+
+	return fmt.Sprintf("%016X", key.keyID)
+}
+
+// securityKeyRing methods
+
+// Adds RSA keys and subkeys from ASCII armored OpenPGP key ring. Protected secret keys
+// and keys with not RSA algorithms are skipped
+func (keyRing *securityKeyRing) addOpenPGPKeys(armoredKeys string) error {
+	blocks, err := openPGPArmorBlocks([]byte(armoredKeys))
+	if err != nil {
+		return err
+	}
+
+	for _, block := range blocks {
+		packets, err := readOpenPGPPackets(block)
+		if err != nil {
+			return err
+		}
+
+		var entityKeys []*openPGPKey
+		var userID string
+		for _, packet := range packets {
+			switch packet.tag {
+			case openPGPTagPublicKey, openPGPTagSecretKey, openPGPTagPublicSubkey, openPGPTagSecretSubkey:
+				if packet.tag == openPGPTagPublicKey || packet.tag == openPGPTagSecretKey {
+					entityKeys, userID = nil, emptyString
+				}
+
+				if key := keyRing.addOpenPGPKey(parseOpenPGPKey(packet)); key != nil {
+					if key.userID == emptyString {
+						key.userID = userID
+					}
+
+					entityKeys = append(entityKeys, key)
+				}
+			case openPGPTagUserID:
+				if userID != emptyString {
+					continue
+				}
+
+				userID = string(packet.body)
+				for _, key := range entityKeys {
+					if key.userID == emptyString {
+						key.userID = userID
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Adds OpenPGP key into key ring. Merges private key into existing public key with
+// the same key ID. Returns key ring key
+func (keyRing *securityKeyRing) addOpenPGPKey(key *openPGPKey) *openPGPKey {
+	if key == nil {
+		return nil
+	}
+
+	existingKey, ok := keyRing.pgpKeys[key.keyID]
+	if !ok {
+		keyRing.pgpKeys[key.keyID] = key
+		return key
+	}
+
+	if existingKey.privateKey == nil {
+		existingKey.privateKey = key.privateKey
+	}
+
+	return existingKey
+}
+
+// Returns decoded data of all ASCII armored blocks. Returns error for case when
+// armored block is malformed or its checksum is invalid
+func openPGPArmorBlocks(armored []byte) ([][]byte, error) {
+	var blocks [][]byte
+	var encoded strings.Builder
+	var checksum string
+	isBlock, isHeader := false, false
+
+	scanner := bufio.NewScanner(bytes.NewReader(armored))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case !isBlock:
+			isBlock = strings.HasPrefix(line, pgpArmorBeginPrefix)
+			isHeader, checksum = isBlock, emptyString
+			encoded.Reset()
+		case isHeader:
+			isHeader = line != emptyString
+		case strings.HasPrefix(line, pgpArmorEndPrefix):
+			block, err := decodeOpenPGPArmorBlock(encoded.String(), checksum)
+			if err != nil {
+				return nil, err
+			}
+
+			blocks, isBlock = append(blocks, block), false
+		case strings.HasPrefix(line, "=") && len(line) == 5:
+			checksum = line[1:]
+		default:
+			encoded.WriteString(line)
+		}
+	}
+
+	if isBlock {
+		return nil, errors.New(malformedSecurityDataMsg)
+	}
+
+	return blocks, nil
+}
+
+// Decodes base64 context of ASCII armored block and checks its CRC-24 checksum
+// for case when checksum is present
+func decodeOpenPGPArmorBlock(encoded, checksum string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if checksum == emptyString {
+		return data, nil
+	}
+
+	expectedChecksum, err := base64.StdEncoding.DecodeString(checksum)
+	crc := openPGPCRC24(data)
+	if err != nil || !bytes.Equal(expectedChecksum, []byte{byte(crc >> 16), byte(crc >> 8), byte(crc)}) {
+		return nil, errors.New(integrityCheckFailedMsg)
+	}
+
+	return data, nil
+}
+
+// Returns decoded data of the first ASCII armored block
+func decodeOpenPGPArmor(armored []byte) ([]byte, error) {
+	blocks, err := openPGPArmorBlocks(armored)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 {
+		return nil, errors.New(malformedSecurityDataMsg)
+	}
+
+	return blocks[0], nil
+}
+
+// Returns CRC-24 checksum of data (RFC 4880 section 6.1)
+func openPGPCRC24(data []byte) uint32 {
+	crc := uint32(pgpArmorCRC24Init)
+	for _, character := range data {
+		crc ^= uint32(character) << 16
+		for index := 0; index < 8; index++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= pgpArmorCRC24Poly
+			}
+		}
+	}
+
+	return crc & 0xFFFFFF
+}
+
+// Reads all OpenPGP packets. Supports old and new packet formats including partial
+// body lengths
+func readOpenPGPPackets(data []byte) ([]openPGPPacket, error) {
+	var packets []openPGPPacket
+
+	for len(data) > 0 {
+		header := data[0]
+		if header&0x80 == 0 {
+			return nil, errors.New(malformedSecurityDataMsg)
+		}
+
+		packet, rest := openPGPPacket{tag: (header >> 2) & 0x0F}, data[1:]
+		if header&0x40 != 0 {
+			packet.tag = header & 0x3F
+			for isPartial := true; isPartial; {
+				var length int
+				var err error
+				if length, isPartial, rest, err = readOpenPGPNewFormatLength(rest); err != nil {
+					return nil, err
+				}
+
+				packet.body, rest = append(packet.body, rest[:length]...), rest[length:]
+			}
+		} else {
+			length, lengthSize := len(rest), 1<<(header&0x03)
+			if header&0x03 != 0x03 {
+				if len(rest) < lengthSize {
+					return nil, errors.New(malformedSecurityDataMsg)
+				}
+
+				length, rest = int(bigEndianUint(rest[:lengthSize])), rest[lengthSize:]
+			}
+			if length > len(rest) {
+				return nil, errors.New(malformedSecurityDataMsg)
+			}
+
+			packet.body, rest = rest[:length], rest[length:]
+		}
+
+		packets, data = append(packets, packet), rest
+	}
+
+	return packets, nil
+}
+
+// Reads new format packet length. Returns length, partial body length flag and rest of data
+func readOpenPGPNewFormatLength(data []byte) (int, bool, []byte, error) {
+	lengthSize := 1
+	if len(data) > 0 && data[0] >= 192 && data[0] < 224 {
+		lengthSize = 2
+	} else if len(data) > 0 && data[0] == 255 {
+		lengthSize = 5
+	}
+	if len(data) < lengthSize {
+		return 0, false, nil, errors.New(malformedSecurityDataMsg)
+	}
+
+	length, isPartial := 0, false
+	switch {
+	case data[0] < 192:
+		length = int(data[0])
+	case data[0] < 224:
+		length = (int(data[0])-192)<<8 + int(data[1]) + 192
+	case data[0] < 255:
+		length, isPartial = 1<<(data[0]&0x1F), true
+	default:
+		length = int(bigEndianUint(data[1:5]))
+	}
+
+	if data = data[lengthSize:]; length > len(data) {
+		return 0, false, nil, errors.New(malformedSecurityDataMsg)
+	}
+
+	return length, isPartial, data, nil
+}
+
+// Returns big-endian unsigned integer from 1, 2 or 4 bytes
+func bigEndianUint(data []byte) uint32 {
+	var value uint32
+	for _, character := range data {
+		value = value<<8 | uint32(character)
+	}
+
+	return value
+}
+
+// Reads OpenPGP multiprecision integer. Returns integer bytes and rest of data
+func readOpenPGPMPI(data []byte) ([]byte, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errors.New(malformedSecurityDataMsg)
+	}
+
+	size := (int(binary.BigEndian.Uint16(data))+7)/8 + 2
+	if len(data) < size {
+		return nil, nil, errors.New(malformedSecurityDataMsg)
+	}
+
+	return data[2:size], data[size:], nil
+}
+
+// Reads the given number of OpenPGP multiprecision integers
+func readOpenPGPMPIs(data []byte, count int) ([]*big.Int, []byte, error) {
+	var numbers []*big.Int
+
+	for index := 0; index < count; index++ {
+		number, rest, err := readOpenPGPMPI(data)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		numbers, data = append(numbers, new(big.Int).SetBytes(number)), rest
+	}
+
+	return numbers, data, nil
+}
+
+// Parses version 4 RSA public or secret key packet. Returns nil for case when key is
+// not supported or secret key is protected
+func parseOpenPGPKey(packet openPGPPacket) *openPGPKey {
+	body := packet.body
+	if len(body) < 6 || body[0] != 4 || !openPGPRSAAlgorithms[body[5]] {
+		return nil
+	}
+
+	publicNumbers, rest, err := readOpenPGPMPIs(body[6:], 2)
+	if err != nil || !publicNumbers[1].IsInt64() {
+		return nil
+	}
+
+	publicKeyBody := body[:len(body)-len(rest)]
+	fingerprint := sha1.Sum(append([]byte{0x99, byte(len(publicKeyBody) >> 8), byte(len(publicKeyBody))}, publicKeyBody...))
+	key := &openPGPKey{
+		keyID:     binary.BigEndian.Uint64(fingerprint[12:]),
+		publicKey: &rsa.PublicKey{N: publicNumbers[0], E: int(publicNumbers[1].Int64())},
+	}
+
+	if packet.tag != openPGPTagSecretKey && packet.tag != openPGPTagSecretSubkey {
+		return key
+	}
+
+	// Only unprotected secret keys (S2K usage octet is equal to 0) are supported
+	if len(rest) == 0 || rest[0] != 0 {
+		return nil
+	}
+
+	secretNumbers, _, err := readOpenPGPMPIs(rest[1:], 4)
+	if err != nil {
+		return nil
+	}
+
+	key.privateKey = &rsa.PrivateKey{
+		PublicKey: *key.publicKey,
+		D:         secretNumbers[0],
+		Primes:    []*big.Int{secretNumbers[1], secretNumbers[2]},
+	}
+	key.privateKey.Precompute()
+
+	return key
+}
+
+// Decrypts ASCII armored OpenPGP message with the given keys. Only RSA public key encrypted
+// session keys and symmetrically encrypted integrity protected data are supported
+func decryptOpenPGPMessage(armored []byte, keys map[uint64]*openPGPKey) (*openPGPLiteral, error) {
+	data, err := decodeOpenPGPArmor(armored)
+	if err != nil {
+		return nil, err
+	}
+
+	packets, err := readOpenPGPPackets(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var cipherAlgorithm byte
+	var sessionKey []byte
+	for _, packet := range packets {
+		switch packet.tag {
+		case openPGPTagPKESK:
+			if sessionKey == nil {
+				cipherAlgorithm, sessionKey = decryptOpenPGPSessionKey(packet.body, keys)
+			}
+		case openPGPTagSEIPD:
+			if sessionKey == nil {
+				return nil, errors.New(noDecryptionKeyMsg)
+			}
+
+			plaintext, err := decryptOpenPGPSEIPD(packet.body, cipherAlgorithm, sessionKey)
+			if err != nil {
+				return nil, err
+			}
+
+			packets, err := readOpenPGPPackets(plaintext)
+			if err != nil {
+				return nil, err
+			}
+
+			return readOpenPGPLiteral(packets)
+		}
+	}
+
+	return nil, errors.New(malformedSecurityDataMsg)
+}
+
+// Decrypts version 3 RSA public key encrypted session key packet. Returns symmetric
+// cipher algorithm and session key. Returns nil session key for case when key not found
+// or session key can't be decrypted
+func decryptOpenPGPSessionKey(body []byte, keys map[uint64]*openPGPKey) (byte, []byte) {
+	if len(body) < 10 || body[0] != 3 || !openPGPRSAAlgorithms[body[9]] {
+		return 0, nil
+	}
+
+	key := keys[binary.BigEndian.Uint64(body[1:9])]
+	encryptedKey, _, err := readOpenPGPMPI(body[10:])
+	if key == nil || key.privateKey == nil || err != nil {
+		return 0, nil
+	}
+
+	decryptedKey, err := rsa.DecryptPKCS1v15(nil, key.privateKey, leftPad(encryptedKey, key.privateKey.Size()))
+	if err != nil || len(decryptedKey) < 4 {
+		return 0, nil
+	}
+
+	sessionKey, checksum := decryptedKey[1:len(decryptedKey)-2], 0
+	for _, character := range sessionKey {
+		checksum += int(character)
+	}
+	if uint16(checksum) != binary.BigEndian.Uint16(decryptedKey[len(decryptedKey)-2:]) {
+		return 0, nil
+	}
+
+	return decryptedKey[0], sessionKey
+}
+
+// Decrypts version 1 symmetrically encrypted integrity protected data packet and checks
+// its modification detection code. Returns decrypted packets data
+func decryptOpenPGPSEIPD(body []byte, cipherAlgorithm byte, sessionKey []byte) ([]byte, error) {
+	keySize, ok := openPGPCipherKeySizes[cipherAlgorithm]
+	if !ok || len(body) == 0 || body[0] != 1 {
+		return nil, fmt.Errorf("%s: %d", unsupportedAlgorithmMsg, cipherAlgorithm)
+	}
+	if len(sessionKey) != keySize {
+		return nil, errors.New(noDecryptionKeyMsg)
+	}
+
+	block, _ := aes.NewCipher(sessionKey)
+	blockSize := block.BlockSize()
+	plaintext := make([]byte, len(body)-1)
+	cipher.NewCFBDecrypter(block, make([]byte, blockSize)).XORKeyStream(plaintext, body[1:])
+
+	if len(plaintext) < blockSize+2+pgpMDCSize || !bytes.Equal(plaintext[blockSize-2:blockSize], plaintext[blockSize:blockSize+2]) {
+		return nil, errors.New(integrityCheckFailedMsg)
+	}
+
+	mdc := plaintext[len(plaintext)-pgpMDCSize:]
+	digest := sha1.Sum(plaintext[:len(plaintext)-pgpMDCSize+2])
+	if mdc[0] != 0xD3 || mdc[1] != 0x14 || subtle.ConstantTimeCompare(mdc[2:], digest[:]) != 1 {
+		return nil, errors.New(integrityCheckFailedMsg)
+	}
+
+	return plaintext[blockSize+2 : len(plaintext)-pgpMDCSize], nil
+}
+
+// Returns literal data with optional inline signature from decrypted packets.
+// Decompresses compressed data packet
+func readOpenPGPLiteral(packets []openPGPPacket) (*openPGPLiteral, error) {
+	literal, isFound := new(openPGPLiteral), false
+
+	for _, packet := range packets {
+		switch packet.tag {
+		case openPGPTagCompressed:
+			data, err := decompressOpenPGPData(packet.body)
+			if err != nil {
+				return nil, err
+			}
+
+			nestedPackets, err := readOpenPGPPackets(data)
+			if err != nil {
+				return nil, err
+			}
+
+			return readOpenPGPLiteral(nestedPackets)
+		case openPGPTagLiteral:
+			body := packet.body
+			if len(body) < 2 || len(body) < 6+int(body[1]) {
+				return nil, errors.New(malformedSecurityDataMsg)
+			}
+
+			literal.data, isFound = body[6+int(body[1]):], true
+		case openPGPTagSignature:
+			literal.signature = packet.body
+		}
+	}
+
+	if !isFound {
+		return nil, errors.New(malformedSecurityDataMsg)
+	}
+
+	return literal, nil
+}
+
+// Decompresses compressed data packet body
+func decompressOpenPGPData(body []byte) ([]byte, error) {
+	if len(body) == 0 {
+		return nil, errors.New(malformedSecurityDataMsg)
+	}
+
+	var reader io.Reader
+	var err error
+	data := bytes.NewReader(body[1:])
+
+	switch body[0] {
+	case 0:
+		reader = data
+	case 1:
+		reader = flate.NewReader(data)
+	case 2:
+		reader, err = zlib.NewReader(data)
+	case 3:
+		reader = bzip2.NewReader(data)
+	default:
+		return nil, fmt.Errorf("%s: %d", unsupportedAlgorithmMsg, body[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(reader)
+}
+
+// Verifies version 4 RSA binary or text document signature of data. Returns signer identity
+func verifyOpenPGPSignature(body, data []byte, keys map[uint64]*openPGPKey) (string, error) {
+	if len(body) < 6 || body[0] != 4 {
+		return emptyString, errors.New(malformedSecurityDataMsg)
+	}
+
+	signatureType, publicKeyAlgorithm, hashAlgorithm := body[1], body[2], body[3]
+	hashedSize := 6 + int(binary.BigEndian.Uint16(body[4:6]))
+	if len(body) < hashedSize+2 {
+		return emptyString, errors.New(malformedSecurityDataMsg)
+	}
+
+	unhashedSize := int(binary.BigEndian.Uint16(body[hashedSize:]))
+	if len(body) < hashedSize+2+unhashedSize+2 {
+		return emptyString, errors.New(malformedSecurityDataMsg)
+	}
+
+	signature, _, err := readOpenPGPMPI(body[hashedSize+2+unhashedSize+2:])
+	if err != nil {
+		return emptyString, err
+	}
+
+	keyID := openPGPIssuerKeyID(body[6:hashedSize], body[hashedSize+2:hashedSize+2+unhashedSize])
+	key, ok := keys[keyID]
+	if !ok {
+		return fmt.Sprintf("%016X", keyID), errors.New(signerNotFoundMsg)
+	}
+
+	hash, ok := openPGPHashAlgorithms[hashAlgorithm]
+	if !ok || !openPGPRSAAlgorithms[publicKeyAlgorithm] || signatureType > 0x01 {
+		return key.identity(), fmt.Errorf("%s: %d/%d/%d", unsupportedAlgorithmMsg, signatureType, publicKeyAlgorithm, hashAlgorithm)
+	}
+
+	if signatureType == 0x01 {
+		data = canonicalizeLineEndings(data)
+	}
+
+	digest := hash.New()
+	digest.Write(data)
+	digest.Write(body[:hashedSize])
+	digest.Write([]byte{0x04, 0xFF, byte(hashedSize >> 24), byte(hashedSize >> 16), byte(hashedSize >> 8), byte(hashedSize)})
+
+	return key.identity(), rsa.VerifyPKCS1v15(key.publicKey, hash, digest.Sum(nil), leftPad(signature, key.publicKey.Size()))
+}
+
+// Returns issuer key ID from signature subpackets: issuer or issuer fingerprint subpacket.
+// Returns 0 for case when issuer not found
+func openPGPIssuerKeyID(subpacketsAreas ...[]byte) uint64 {
+	for _, subpackets := range subpacketsAreas {
+		for len(subpackets) > 0 {
+			length, lengthSize := int(subpackets[0]), 1
+			switch {
+			case subpackets[0] >= 255 && len(subpackets) >= 5:
+				length, lengthSize = int(bigEndianUint(subpackets[1:5])), 5
+			case subpackets[0] >= 192 && subpackets[0] < 255 && len(subpackets) >= 2:
+				length, lengthSize = (int(subpackets[0])-192)<<8+int(subpackets[1])+192, 2
+			}
+
+			if length == 0 || len(subpackets) < lengthSize+length {
+				break
+			}
+
+			subpacket := subpackets[lengthSize : lengthSize+length]
+			subpackets = subpackets[lengthSize+length:]
+
+			switch subpacketType := subpacket[0] & 0x7F; {
+			case subpacketType == 16 && len(subpacket) == 9:
+				return binary.BigEndian.Uint64(subpacket[1:])
+			case subpacketType == 33 && len(subpacket) == 22 && subpacket[1] == 4:
+				return binary.BigEndian.Uint64(subpacket[14:])
+			}
+		}
+	}
+
+	return 0
+}
+
+// Returns data padded with leading zeros to the given size
+func leftPad(data []byte, size int) []byte {
+	if len(data) >= size {
+		return data
+	}
+
+	return append(make([]byte, size-len(data)), data...)
+}
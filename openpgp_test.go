@@ -0,0 +1,680 @@
+package smtpmock
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Encodes OpenPGP packets in new format with five-octet lengths
+func encodeOpenPGPPackets(packets ...openPGPPacket) []byte {
+	var data []byte
+	for _, packet := range packets {
+		length := len(packet.body)
+		data = append(data, 0xC0|packet.tag, 0xFF, byte(length>>24), byte(length>>16), byte(length>>8), byte(length))
+		data = append(data, packet.body...)
+	}
+
+	return data
+}
+
+// Returns ASCII armored OpenPGP packets
+func armorOpenPGPPackets(blockType string, packets ...openPGPPacket) string {
+	data := encodeOpenPGPPackets(packets...)
+	crc := openPGPCRC24(data)
+
+	return "-----BEGIN PGP " + blockType + "-----\r\nVersion: test\r\n\r\n" +
+		base64.StdEncoding.EncodeToString(data) + "\r\n" +
+		"=" + base64.StdEncoding.EncodeToString([]byte{byte(crc >> 16), byte(crc >> 8), byte(crc)}) + "\r\n" +
+		"-----END PGP " + blockType + "-----\r\n"
+}
+
+// Returns OpenPGP multiprecision integer
+func openPGPMPI(data []byte) []byte {
+	number := new(big.Int).SetBytes(data)
+	return append([]byte{byte(number.BitLen() >> 8), byte(number.BitLen())}, number.Bytes()...)
+}
+
+// Returns literal data packet
+func openPGPLiteralPacket(data string) openPGPPacket {
+	return openPGPPacket{tag: openPGPTagLiteral, body: append([]byte{'b', 0, 0, 0, 0, 0}, data...)}
+}
+
+// Returns public key encrypted session key packet
+func openPGPPKESKPacket(key *openPGPKey, sessionData []byte) openPGPPacket {
+	encryptedKey, _ := rsa.EncryptPKCS1v15(rand.Reader, key.publicKey, sessionData)
+	body := []byte{3, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	binary.BigEndian.PutUint64(body[1:9], key.keyID)
+
+	return openPGPPacket{tag: openPGPTagPKESK, body: append(body, openPGPMPI(encryptedKey)...)}
+}
+
+// Returns session key data: cipher algorithm, session key and checksum
+func openPGPSessionData(cipherAlgorithm byte, sessionKey []byte) []byte {
+	checksum := 0
+	for _, character := range sessionKey {
+		checksum += int(character)
+	}
+
+	return append(append([]byte{cipherAlgorithm}, sessionKey...), byte(checksum>>8), byte(checksum))
+}
+
+// Returns symmetrically encrypted integrity protected data packet body
+func encryptOpenPGPSEIPD(sessionKey, data []byte) []byte {
+	block, _ := aes.NewCipher(sessionKey)
+	plaintext := make([]byte, block.BlockSize())
+	_, _ = rand.Read(plaintext)
+	plaintext = append(append(append(plaintext, plaintext[block.BlockSize()-2:]...), data...), 0xD3, 0x14)
+	digest := sha1.Sum(plaintext)
+	plaintext = append(plaintext, digest[:]...)
+
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCFBEncrypter(block, make([]byte, block.BlockSize())).XORKeyStream(ciphertext, plaintext)
+	return append([]byte{1}, ciphertext...)
+}
+
+// Returns ASCII armored OpenPGP message with the given packets encrypted for the given key
+func encryptOpenPGPMessage(key *openPGPKey, packets ...openPGPPacket) []byte {
+	sessionKey := make([]byte, 32)
+	_, _ = rand.Read(sessionKey)
+
+	return []byte(armorOpenPGPPackets(
+		"MESSAGE",
+		openPGPPKESKPacket(key, openPGPSessionData(9, sessionKey)),
+		openPGPPacket{tag: openPGPTagSEIPD, body: encryptOpenPGPSEIPD(sessionKey, encodeOpenPGPPackets(packets...))},
+	))
+}
+
+// Returns version 4 RSA signature packet body with issuer subpacket
+func signOpenPGP(key *openPGPKey, signatureType, hashAlgorithm byte, data []byte) []byte {
+	hashedSubpackets := []byte{9, 16, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(hashedSubpackets[2:], key.keyID)
+	body := append([]byte{4, signatureType, 1, hashAlgorithm, 0, byte(len(hashedSubpackets))}, hashedSubpackets...)
+
+	hash := openPGPHashAlgorithms[hashAlgorithm]
+	digest := hash.New()
+	digest.Write(data)
+	digest.Write(body)
+	digest.Write([]byte{0x04, 0xFF, 0, 0, 0, byte(len(body))})
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, key.privateKey, hash, digest.Sum(nil))
+
+	return append(append(body, 0, 0, 0, 0), openPGPMPI(signature)...)
+}
+
+// Returns the first OpenPGP key from test key ring
+func createOpenPGPKey() *openPGPKey {
+	for _, key := range createSecurityKeyRing().pgpKeys {
+		return key
+	}
+
+	return nil
+}
+
+func TestOpenPGPKeyIdentity(t *testing.T) {
+	t.Run("returns user ID", func(t *testing.T) {
+		assert.Equal(t, "user", (&openPGPKey{keyID: 1, userID: "user"}).identity())
+	})
+
+	t.Run("returns key ID for case when user ID is absent", func(t *testing.T) {
+		assert.Equal(t, "00000000000000FF", (&openPGPKey{keyID: 255}).identity())
+	})
+}
+
+func TestSecurityKeyRingAddOpenPGPKeys(t *testing.T) {
+	key := createOpenPGPKey()
+
+	t.Run("adds keys with the first user ID", func(t *testing.T) {
+		keyRing := createEmptySecurityKeyRing()
+		publicKeyPacket := openPGPPacket{tag: openPGPTagPublicKey, body: openPGPPublicKeyBody(key)}
+		keyID := parseOpenPGPKey(publicKeyPacket).keyID
+		err := keyRing.addOpenPGPKeys(armorOpenPGPPackets(
+			"PUBLIC KEY BLOCK",
+			publicKeyPacket,
+			openPGPPacket{tag: openPGPTagUserID, body: []byte("first")},
+			openPGPPacket{tag: openPGPTagUserID, body: []byte("second")},
+			openPGPPacket{tag: openPGPTagPublicKey, body: []byte{3}},
+		))
+
+		assert.NoError(t, err)
+		assert.Len(t, keyRing.pgpKeys, 1)
+		assert.Equal(t, "first", keyRing.pgpKeys[keyID].userID)
+		assert.Nil(t, keyRing.pgpKeys[keyID].privateKey)
+	})
+
+	t.Run("when armored block is malformed", func(t *testing.T) {
+		keyRing := createEmptySecurityKeyRing()
+
+		assert.Error(t, keyRing.addOpenPGPKeys("-----BEGIN PGP PUBLIC KEY BLOCK-----\r\n\r\n!!!\r\n-----END PGP PUBLIC KEY BLOCK-----"))
+	})
+
+	t.Run("when packets are malformed", func(t *testing.T) {
+		keyRing := createEmptySecurityKeyRing()
+
+		assert.EqualError(
+			t,
+			keyRing.addOpenPGPKeys("-----BEGIN PGP PUBLIC KEY BLOCK-----\r\n\r\nAA==\r\n-----END PGP PUBLIC KEY BLOCK-----"),
+			malformedSecurityDataMsg,
+		)
+	})
+}
+
+// Returns public key packet body of the given key
+func openPGPPublicKeyBody(key *openPGPKey) []byte {
+	body := append([]byte{4, 0, 0, 0, 0, 1}, openPGPMPI(key.publicKey.N.Bytes())...)
+	return append(body, openPGPMPI(big.NewInt(int64(key.publicKey.E)).Bytes())...)
+}
+
+func TestSecurityKeyRingAddOpenPGPKey(t *testing.T) {
+	publicKey, privateKey := &rsa.PublicKey{N: big.NewInt(1), E: 1}, &rsa.PrivateKey{}
+
+	t.Run("when key is nil", func(t *testing.T) {
+		keyRing := createEmptySecurityKeyRing()
+
+		assert.Nil(t, keyRing.addOpenPGPKey(nil))
+		assert.Empty(t, keyRing.pgpKeys)
+	})
+
+	t.Run("merges private key into existing public key", func(t *testing.T) {
+		keyRing := createEmptySecurityKeyRing()
+		key := keyRing.addOpenPGPKey(&openPGPKey{keyID: 1, publicKey: publicKey})
+
+		assert.Equal(t, key, keyRing.addOpenPGPKey(&openPGPKey{keyID: 1, publicKey: publicKey, privateKey: privateKey}))
+		assert.Equal(t, privateKey, key.privateKey)
+		assert.Equal(t, key, keyRing.addOpenPGPKey(&openPGPKey{keyID: 1, publicKey: publicKey}))
+		assert.Equal(t, privateKey, key.privateKey)
+	})
+}
+
+func TestOpenPGPArmorBlocks(t *testing.T) {
+	t.Run("returns decoded data of all armored blocks", func(t *testing.T) {
+		armored := armorOpenPGPPackets("MESSAGE", openPGPLiteralPacket("a")) + "text\r\n" +
+			"-----BEGIN PGP MESSAGE-----\r\n\r\nYg==\r\n-----END PGP MESSAGE-----\r\n"
+		blocks, err := openPGPArmorBlocks([]byte(armored))
+
+		assert.NoError(t, err)
+		assert.Equal(t, [][]byte{encodeOpenPGPPackets(openPGPLiteralPacket("a")), []byte("b")}, blocks)
+	})
+
+	t.Run("when armored block is not terminated", func(t *testing.T) {
+		blocks, err := openPGPArmorBlocks([]byte("-----BEGIN PGP MESSAGE-----\r\n\r\nYg==\r\n"))
+
+		assert.Nil(t, blocks)
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+
+	t.Run("when armored block checksum is invalid", func(t *testing.T) {
+		blocks, err := openPGPArmorBlocks([]byte("-----BEGIN PGP MESSAGE-----\r\n\r\nYg==\r\n=AAAA\r\n-----END PGP MESSAGE-----\r\n"))
+
+		assert.Nil(t, blocks)
+		assert.EqualError(t, err, integrityCheckFailedMsg)
+	})
+}
+
+func TestDecodeOpenPGPArmor(t *testing.T) {
+	t.Run("returns decoded data of the first armored block", func(t *testing.T) {
+		data, err := decodeOpenPGPArmor([]byte("-----BEGIN PGP MESSAGE-----\r\n\r\nYg==\r\n-----END PGP MESSAGE-----\r\n"))
+
+		assert.Equal(t, []byte("b"), data)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when armored block not found", func(t *testing.T) {
+		data, err := decodeOpenPGPArmor([]byte("text"))
+
+		assert.Nil(t, data)
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+
+	t.Run("when armored block is malformed", func(t *testing.T) {
+		data, err := decodeOpenPGPArmor([]byte("-----BEGIN PGP MESSAGE-----\r\n"))
+
+		assert.Nil(t, data)
+		assert.Error(t, err)
+	})
+}
+
+func TestOpenPGPCRC24(t *testing.T) {
+	t.Run("returns CRC-24 checksum", func(t *testing.T) {
+		assert.Equal(t, uint32(pgpArmorCRC24Init), openPGPCRC24(nil))
+		assert.Equal(t, uint32(0x21CF02), openPGPCRC24([]byte("123456789")))
+	})
+}
+
+func TestReadOpenPGPPackets(t *testing.T) {
+	t.Run("reads new format packets with partial body lengths", func(t *testing.T) {
+		data := append([]byte{0xCB, 0xE1, 'a', 'b', 0x01, 'c', 0xC2, 0xC0, 0x00}, bytes.Repeat([]byte{'d'}, 192)...)
+		packets, err := readOpenPGPPackets(data)
+
+		assert.NoError(t, err)
+		assert.Equal(
+			t,
+			[]openPGPPacket{{tag: openPGPTagLiteral, body: []byte("abc")}, {tag: openPGPTagSignature, body: bytes.Repeat([]byte{'d'}, 192)}},
+			packets,
+		)
+	})
+
+	t.Run("reads old format packets", func(t *testing.T) {
+		data := []byte{0xAC, 0x01, 'a', 0xAD, 0x00, 0x01, 'b', 0xAE, 0x00, 0x00, 0x00, 0x01, 'c', 0xA3, 0x01, 'd'}
+		packets, err := readOpenPGPPackets(data)
+
+		assert.NoError(t, err)
+		assert.Equal(
+			t,
+			[]openPGPPacket{
+				{tag: openPGPTagLiteral, body: []byte("a")},
+				{tag: openPGPTagLiteral, body: []byte("b")},
+				{tag: openPGPTagLiteral, body: []byte("c")},
+				{tag: openPGPTagCompressed, body: []byte{0x01, 'd'}},
+			},
+			packets,
+		)
+	})
+
+	for name, data := range map[string][]byte{
+		"when packet header is invalid":        {0x00},
+		"when new format length is malformed":  {0xCB, 0x05, 'a'},
+		"when old format length is truncated":  {0xAD, 0x00},
+		"when old format length is too large":  {0xAC, 0x05, 'a'},
+		"when new format length is truncated":  {0xCB},
+		"when partial body length is too long": {0xCB, 0xE2, 'a'},
+	} {
+		data := data
+
+		t.Run(name, func(t *testing.T) {
+			packets, err := readOpenPGPPackets(data)
+
+			assert.Nil(t, packets)
+			assert.EqualError(t, err, malformedSecurityDataMsg)
+		})
+	}
+}
+
+func TestReadOpenPGPNewFormatLength(t *testing.T) {
+	t.Run("reads five-octet length", func(t *testing.T) {
+		length, isPartial, rest, err := readOpenPGPNewFormatLength([]byte{0xFF, 0, 0, 0, 1, 'a'})
+
+		assert.Equal(t, 1, length)
+		assert.False(t, isPartial)
+		assert.Equal(t, []byte("a"), rest)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when length is truncated", func(t *testing.T) {
+		_, _, _, err := readOpenPGPNewFormatLength([]byte{0xFF, 0})
+
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+}
+
+func TestBigEndianUint(t *testing.T) {
+	t.Run("returns big-endian unsigned integer", func(t *testing.T) {
+		assert.Equal(t, uint32(0x01020304), bigEndianUint([]byte{1, 2, 3, 4}))
+	})
+}
+
+func TestReadOpenPGPMPI(t *testing.T) {
+	t.Run("returns integer bytes and rest of data", func(t *testing.T) {
+		number, rest, err := readOpenPGPMPI([]byte{0, 9, 1, 0xFF, 'a'})
+
+		assert.Equal(t, []byte{1, 0xFF}, number)
+		assert.Equal(t, []byte("a"), rest)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when length is truncated", func(t *testing.T) {
+		_, _, err := readOpenPGPMPI([]byte{0})
+
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+
+	t.Run("when integer is truncated", func(t *testing.T) {
+		_, _, err := readOpenPGPMPI([]byte{0, 9, 1})
+
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+}
+
+func TestReadOpenPGPMPIs(t *testing.T) {
+	t.Run("returns the given number of integers", func(t *testing.T) {
+		numbers, rest, err := readOpenPGPMPIs([]byte{0, 1, 1, 0, 2, 2}, 2)
+
+		assert.Equal(t, []*big.Int{big.NewInt(1), big.NewInt(2)}, numbers)
+		assert.Empty(t, rest)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when integer is malformed", func(t *testing.T) {
+		numbers, _, err := readOpenPGPMPIs([]byte{0, 1, 1}, 2)
+
+		assert.Nil(t, numbers)
+		assert.Error(t, err)
+	})
+}
+
+func TestParseOpenPGPKey(t *testing.T) {
+	key := createOpenPGPKey()
+	publicKeyBody := openPGPPublicKeyBody(key)
+
+	t.Run("parses public key", func(t *testing.T) {
+		parsedKey := parseOpenPGPKey(openPGPPacket{tag: openPGPTagPublicSubkey, body: publicKeyBody})
+
+		assert.Equal(t, key.publicKey, parsedKey.publicKey)
+		assert.Nil(t, parsedKey.privateKey)
+	})
+
+	for name, packet := range map[string]openPGPPacket{
+		"when key version is not supported":    {tag: openPGPTagPublicKey, body: []byte{3, 0, 0, 0, 0, 1}},
+		"when key algorithm is not supported":  {tag: openPGPTagPublicKey, body: []byte{4, 0, 0, 0, 0, 22}},
+		"when public key is malformed":         {tag: openPGPTagPublicKey, body: []byte{4, 0, 0, 0, 0, 1, 0, 1, 1}},
+		"when public exponent is too large":    {tag: openPGPTagPublicKey, body: append([]byte{4, 0, 0, 0, 0, 1, 0, 1, 1, 0, 72}, bytes.Repeat([]byte{0xFF}, 9)...)},
+		"when secret key is protected":         {tag: openPGPTagSecretKey, body: append(publicKeyBody, 254)},
+		"when secret key has no secret part":   {tag: openPGPTagSecretKey, body: publicKeyBody},
+		"when secret key is malformed":         {tag: openPGPTagSecretSubkey, body: append(publicKeyBody, 0, 0, 1, 1)},
+		"when public key packet is too short":  {tag: openPGPTagPublicKey, body: []byte{4}},
+		"when secret key is malformed (short)": {tag: openPGPTagSecretKey, body: append(publicKeyBody, 0)},
+	} {
+		packet := packet
+
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, parseOpenPGPKey(packet))
+		})
+	}
+}
+
+func TestDecryptOpenPGPMessage(t *testing.T) {
+	key := createOpenPGPKey()
+	keys := map[uint64]*openPGPKey{key.keyID: key}
+
+	t.Run("returns literal data", func(t *testing.T) {
+		literal, err := decryptOpenPGPMessage(encryptOpenPGPMessage(key, openPGPLiteralPacket("text")), keys)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &openPGPLiteral{data: []byte("text")}, literal)
+	})
+
+	t.Run("when armored message is malformed", func(t *testing.T) {
+		_, err := decryptOpenPGPMessage([]byte("text"), keys)
+
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+
+	t.Run("when message packets are malformed", func(t *testing.T) {
+		_, err := decryptOpenPGPMessage([]byte("-----BEGIN PGP MESSAGE-----\r\n\r\nAA==\r\n-----END PGP MESSAGE-----"), keys)
+
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+
+	t.Run("when message has no encrypted data", func(t *testing.T) {
+		_, err := decryptOpenPGPMessage([]byte(armorOpenPGPPackets("MESSAGE", openPGPLiteralPacket("text"))), keys)
+
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+
+	t.Run("when encrypted data is malformed", func(t *testing.T) {
+		message := armorOpenPGPPackets(
+			"MESSAGE",
+			openPGPPKESKPacket(key, openPGPSessionData(9, make([]byte, 32))),
+			openPGPPacket{tag: openPGPTagSEIPD, body: []byte{1}},
+		)
+		_, err := decryptOpenPGPMessage([]byte(message), keys)
+
+		assert.EqualError(t, err, integrityCheckFailedMsg)
+	})
+
+	t.Run("when decrypted packets are malformed", func(t *testing.T) {
+		sessionKey := make([]byte, 32)
+		message := armorOpenPGPPackets(
+			"MESSAGE",
+			openPGPPKESKPacket(key, openPGPSessionData(9, sessionKey)),
+			openPGPPKESKPacket(key, openPGPSessionData(9, sessionKey)),
+			openPGPPacket{tag: openPGPTagSEIPD, body: encryptOpenPGPSEIPD(sessionKey, []byte{0})},
+		)
+		_, err := decryptOpenPGPMessage([]byte(message), keys)
+
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+}
+
+func TestDecryptOpenPGPSessionKey(t *testing.T) {
+	key := createOpenPGPKey()
+	keys := map[uint64]*openPGPKey{key.keyID: key}
+
+	t.Run("returns cipher algorithm and session key", func(t *testing.T) {
+		cipherAlgorithm, sessionKey := decryptOpenPGPSessionKey(openPGPPKESKPacket(key, openPGPSessionData(7, []byte{1, 2})).body, keys)
+
+		assert.Equal(t, byte(7), cipherAlgorithm)
+		assert.Equal(t, []byte{1, 2}, sessionKey)
+	})
+
+	for name, body := range map[string][]byte{
+		"when packet is too short":             {3},
+		"when packet version is not supported": {2, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+		"when key not found":                   {3, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 1, 1},
+		"when session key is too short":        openPGPPKESKPacket(key, []byte{7, 0, 0}).body,
+		"when session key checksum is invalid": openPGPPKESKPacket(key, []byte{7, 1, 0, 0}).body,
+		"when session key can't be decrypted":  append(openPGPPKESKPacket(key, nil).body[:10], 0, 1, 1),
+	} {
+		body := body
+
+		t.Run(name, func(t *testing.T) {
+			_, sessionKey := decryptOpenPGPSessionKey(body, keys)
+
+			assert.Nil(t, sessionKey)
+		})
+	}
+}
+
+func TestDecryptOpenPGPSEIPD(t *testing.T) {
+	sessionKey := make([]byte, 16)
+
+	t.Run("returns decrypted packets data", func(t *testing.T) {
+		data, err := decryptOpenPGPSEIPD(encryptOpenPGPSEIPD(sessionKey, []byte("data")), 7, sessionKey)
+
+		assert.Equal(t, []byte("data"), data)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when cipher algorithm is not supported", func(t *testing.T) {
+		_, err := decryptOpenPGPSEIPD([]byte{1}, 3, sessionKey)
+
+		assert.EqualError(t, err, unsupportedAlgorithmMsg+": 3")
+	})
+
+	t.Run("when session key size is invalid", func(t *testing.T) {
+		_, err := decryptOpenPGPSEIPD([]byte{1}, 9, sessionKey)
+
+		assert.EqualError(t, err, noDecryptionKeyMsg)
+	})
+
+	t.Run("when quick check failed", func(t *testing.T) {
+		body := encryptOpenPGPSEIPD(sessionKey, []byte("data"))
+		_, err := decryptOpenPGPSEIPD(body, 7, append([]byte{1}, sessionKey[1:]...))
+
+		assert.EqualError(t, err, integrityCheckFailedMsg)
+	})
+
+	t.Run("when modification detection code is invalid", func(t *testing.T) {
+		body := encryptOpenPGPSEIPD(sessionKey, []byte("data"))
+		body[len(body)-1] ^= 0xFF
+		_, err := decryptOpenPGPSEIPD(body, 7, sessionKey)
+
+		assert.EqualError(t, err, integrityCheckFailedMsg)
+	})
+}
+
+func TestReadOpenPGPLiteral(t *testing.T) {
+	t.Run("returns literal data and signature", func(t *testing.T) {
+		literal, err := readOpenPGPLiteral([]openPGPPacket{
+			{tag: openPGPTagSignature, body: []byte("signature")},
+			{tag: openPGPTagLiteral, body: []byte{'b', 1, 'a', 0, 0, 0, 0, 'd'}},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, &openPGPLiteral{data: []byte("d"), signature: []byte("signature")}, literal)
+	})
+
+	t.Run("returns literal data from compressed packet", func(t *testing.T) {
+		compressed := append([]byte{0}, encodeOpenPGPPackets(openPGPLiteralPacket("d"))...)
+		literal, err := readOpenPGPLiteral([]openPGPPacket{{tag: openPGPTagCompressed, body: compressed}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("d"), literal.data)
+	})
+
+	for name, packets := range map[string][]openPGPPacket{
+		"when compressed packet is malformed":            {{tag: openPGPTagCompressed}},
+		"when compressed packet has malformed packets":   {{tag: openPGPTagCompressed, body: []byte{0, 0}}},
+		"when literal data packet is malformed":          {{tag: openPGPTagLiteral, body: []byte{'b', 1}}},
+		"when literal data packet not found":             {{tag: openPGPTagSignature}},
+		"when literal data packet has no filename octet": {{tag: openPGPTagLiteral, body: []byte{'b'}}},
+	} {
+		packets := packets
+
+		t.Run(name, func(t *testing.T) {
+			literal, err := readOpenPGPLiteral(packets)
+
+			assert.Nil(t, literal)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDecompressOpenPGPData(t *testing.T) {
+	bzip2Data, _ := hex.DecodeString("425a6839314159265359648cbb73000000010038002000219819846177245385090648cbb730")
+
+	for name, body := range map[string][]byte{
+		"uncompressed": {0, 'a', 'b', 'c'},
+		"ZIP":          {1, 0x4B, 0x4C, 0x4A, 0x06, 0x00},
+		"ZLIB":         {2, 0x78, 0x9C, 0x4B, 0x4C, 0x4A, 0x06, 0x00, 0x02, 0x4D, 0x01, 0x27},
+		"BZip2":        append([]byte{3}, bzip2Data...),
+	} {
+		body := body
+
+		t.Run("decompresses "+name+" data", func(t *testing.T) {
+			data, err := decompressOpenPGPData(body)
+
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("abc"), data)
+		})
+	}
+
+	t.Run("when body is empty", func(t *testing.T) {
+		_, err := decompressOpenPGPData(nil)
+
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+
+	t.Run("when compression algorithm is not supported", func(t *testing.T) {
+		_, err := decompressOpenPGPData([]byte{110})
+
+		assert.EqualError(t, err, unsupportedAlgorithmMsg+": 110")
+	})
+
+	t.Run("when ZLIB header is invalid", func(t *testing.T) {
+		_, err := decompressOpenPGPData([]byte{2, 0})
+
+		assert.Error(t, err)
+	})
+}
+
+func TestVerifyOpenPGPSignature(t *testing.T) {
+	key := createOpenPGPKey()
+	keys := map[uint64]*openPGPKey{key.keyID: key}
+	data := []byte("line\nline\r\n")
+
+	t.Run("verifies binary document signature", func(t *testing.T) {
+		signer, err := verifyOpenPGPSignature(signOpenPGP(key, 0x00, 8, data), data, keys)
+
+		assert.Equal(t, key.identity(), signer)
+		assert.NoError(t, err)
+	})
+
+	t.Run("verifies text document signature", func(t *testing.T) {
+		signer, err := verifyOpenPGPSignature(signOpenPGP(key, 0x01, 10, canonicalizeLineEndings(data)), data, keys)
+
+		assert.Equal(t, key.identity(), signer)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when signature is invalid", func(t *testing.T) {
+		_, err := verifyOpenPGPSignature(signOpenPGP(key, 0x00, 8, data), []byte("other"), keys)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("when signature type is not supported", func(t *testing.T) {
+		signer, err := verifyOpenPGPSignature(signOpenPGP(key, 0x10, 8, data), data, keys)
+
+		assert.Equal(t, key.identity(), signer)
+		assert.EqualError(t, err, unsupportedAlgorithmMsg+": 16/1/8")
+	})
+
+	t.Run("when signer key not found", func(t *testing.T) {
+		signer, err := verifyOpenPGPSignature(signOpenPGP(key, 0x00, 8, data), data, map[uint64]*openPGPKey{})
+
+		assert.Equal(t, key.identity(), keys[key.keyID].identity())
+		assert.Equal(t, (&openPGPKey{keyID: key.keyID}).identity(), signer)
+		assert.EqualError(t, err, signerNotFoundMsg)
+	})
+
+	for name, body := range map[string][]byte{
+		"when signature is too short":               {4},
+		"when signature version is not supported":   {3, 0, 1, 8, 0, 0},
+		"when hashed subpackets are truncated":      {4, 0, 1, 8, 0, 5},
+		"when unhashed subpackets are truncated":    {4, 0, 1, 8, 0, 0, 0, 5},
+		"when signature integer is malformed":       {4, 0, 1, 8, 0, 0, 0, 0, 0, 0, 0},
+		"when signature integer is truncated (mpi)": {4, 0, 1, 8, 0, 0, 0, 0, 0, 0, 0, 9},
+	} {
+		body := body
+
+		t.Run(name, func(t *testing.T) {
+			_, err := verifyOpenPGPSignature(body, data, keys)
+
+			assert.EqualError(t, err, malformedSecurityDataMsg)
+		})
+	}
+}
+
+func TestOpenPGPIssuerKeyID(t *testing.T) {
+	t.Run("returns key ID from issuer subpacket", func(t *testing.T) {
+		assert.Equal(t, uint64(0x0102030405060708), openPGPIssuerKeyID(nil, []byte{9, 16, 1, 2, 3, 4, 5, 6, 7, 8}))
+	})
+
+	t.Run("returns key ID from issuer fingerprint subpacket", func(t *testing.T) {
+		subpacket := append([]byte{22, 33, 4}, bytes.Repeat([]byte{0}, 12)...)
+		subpacket = append(subpacket, 1, 2, 3, 4, 5, 6, 7, 8)
+
+		assert.Equal(t, uint64(0x0102030405060708), openPGPIssuerKeyID(subpacket))
+	})
+
+	t.Run("skips subpackets with two-octet and five-octet lengths", func(t *testing.T) {
+		subpackets := append([]byte{192, 0}, bytes.Repeat([]byte{2}, 192)...)
+		subpackets = append(subpackets, 255, 0, 0, 0, 1, 2, 9, 16, 0, 0, 0, 0, 0, 0, 0, 1)
+
+		assert.Equal(t, uint64(1), openPGPIssuerKeyID(subpackets))
+	})
+
+	t.Run("when issuer not found", func(t *testing.T) {
+		assert.Equal(t, uint64(0), openPGPIssuerKeyID([]byte{2, 2, 0}, []byte{0, 2}, []byte{5, 2}))
+	})
+}
+
+func TestLeftPad(t *testing.T) {
+	t.Run("pads data with leading zeros", func(t *testing.T) {
+		assert.Equal(t, []byte{0, 0, 1}, leftPad([]byte{1}, 3))
+	})
+
+	t.Run("when data is not shorter than size", func(t *testing.T) {
+		assert.Equal(t, []byte{1, 2}, leftPad([]byte{1, 2}, 1))
+	})
+}
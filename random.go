@@ -0,0 +1,38 @@
+package smtpmock
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// Concurrent pseudo-random source that can be safely shared between goroutines
+type randomSource struct {
+	sync.Mutex
+	random *rand.Rand
+}
+
+// Random source builder. Returns pointer to new random source with the given seed, seed is
+// based on current time for case when it's zero
+func newRandomSource(seed int64) *randomSource {
+	if seed == 0 {
+		seed = timeNow().UnixNano()
+	}
+
+	return &randomSource{random: rand.New(rand.NewSource(seed))}
+}
+
+// randomSource methods
+
+// Returns pseudo-random number in [0.0, 1.0)
+func (randomSource *randomSource) float64() float64 {
+	randomSource.Lock()
+	defer randomSource.Unlock()
+	return randomSource.random.Float64()
+}
+
+// Returns normally distributed pseudo-random number with mean 0 and standard deviation 1
+func (randomSource *randomSource) normFloat64() float64 {
+	randomSource.Lock()
+	defer randomSource.Unlock()
+	return randomSource.random.NormFloat64()
+}
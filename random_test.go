@@ -0,0 +1,41 @@
+package smtpmock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRandomSource(t *testing.T) {
+	t.Run("creates new random source with the given seed", func(t *testing.T) {
+		assert.Equal(t, newRandomSource(42).float64(), newRandomSource(42).float64())
+	})
+
+	t.Run("creates new random source with current time based seed when seed is zero", func(t *testing.T) {
+		assert.NotNil(t, newRandomSource(0).random)
+	})
+}
+
+func TestRandomSourceNormFloat64(t *testing.T) {
+	t.Run("returns normally distributed pseudo-random number", func(t *testing.T) {
+		randomSource, sum := newRandomSource(42), 0.0
+
+		for attempt := 0; attempt < 1000; attempt++ {
+			sum += randomSource.normFloat64()
+		}
+		assert.InDelta(t, 0.0, sum/1000, 0.1)
+		assert.Equal(t, newRandomSource(42).normFloat64(), newRandomSource(42).normFloat64())
+	})
+}
+
+func TestRandomSourceFloat64(t *testing.T) {
+	t.Run("returns pseudo-random number in [0.0, 1.0)", func(t *testing.T) {
+		randomSource := newRandomSource(42)
+
+		for attempt := 0; attempt < 100; attempt++ {
+			number := randomSource.float64()
+			assert.GreaterOrEqual(t, number, 0.0)
+			assert.Less(t, number, 1.0)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package smtpmock
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Allows to stub queue identifier generation
+var generateQueueID = func() string {
+	buffer := make([]byte, receivedHeaderQueueIDSize)
+	_, _ = rand.Read(buffer)
+	return strings.ToUpper(hex.EncodeToString(buffer))
+}
+
+// ReceivedHeaderContext is the data passed into Received header template. All fields are
+// ready to be used as RFC 5321 time-stamp-line parts
+type ReceivedHeaderContext struct {
+	HeloDomain    string
+	RemoteAddress string
+	Hostname      string
+	Protocol      string
+	QueueID       string
+	Recipient     string
+	Date          string
+	Time          time.Time
+}
+
+// Received header template builder. Uses default template for case when template
+// text is empty. Returns error for case when template text is invalid or template can't be
+// executed with sample context
+func newReceivedHeaderTemplate(templateText string) (*template.Template, error) {
+	if templateText == emptyString {
+		templateText = defaultReceivedHeaderTemplate
+	}
+
+	receivedHeaderTemplate, err := template.New(receivedHeaderTemplateName).Parse(templateText)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := renderReceivedHeader(receivedHeaderTemplate, sampleReceivedHeaderContext()); err != nil {
+		return nil, err
+	}
+
+	return receivedHeaderTemplate, nil
+}
+
+// Returns Received header context with sample values of all fields, it's used for template
+// validation
+func sampleReceivedHeaderContext() *ReceivedHeaderContext {
+	sampleTime := time.Unix(0, 0).UTC()
+
+	return &ReceivedHeaderContext{
+		HeloDomain:    "example.com",
+		RemoteAddress: "[127.0.0.1]",
+		Hostname:      receivedHeaderHostname,
+		Protocol:      "ESMTP",
+		QueueID:       "0123456789AB",
+		Recipient:     "user@example.com",
+		Date:          sampleTime.Format(time.RFC1123Z),
+		Time:          sampleTime,
+	}
+}
+
+// Received header context builder. Creates new context based on message and session data
+func newReceivedHeaderContext(message *Message, remoteAddress string) *ReceivedHeaderContext {
+	now := timeNow()
+
+	return &ReceivedHeaderContext{
+		HeloDomain:    regexCaptureGroup(message.heloRequest, validHeloComplexCmdRegexPattern, 2),
+		RemoteAddress: addressLiteral(remoteAddress),
+		Hostname:      receivedHeaderHostname,
+		Protocol:      receivedHeaderProtocol(message.heloRequest),
+		QueueID:       generateQueueID(),
+		Recipient:     receivedHeaderRecipient(message),
+		Date:          now.Format(time.RFC1123Z),
+		Time:          now,
+	}
+}
+
+// Renders Received header by template. Each rendered line is terminated by <CR><LF>.
+// Returns error for case when template execution failed
+func renderReceivedHeader(receivedHeaderTemplate *template.Template, context *ReceivedHeaderContext) (string, error) {
+	var buffer bytes.Buffer
+	if err := receivedHeaderTemplate.Execute(&buffer, context); err != nil {
+		return emptyString, err
+	}
+
+	header := strings.TrimRight(buffer.String(), "\r\n")
+	header = strings.ReplaceAll(strings.ReplaceAll(header, "\r\n", "\n"), "\n", "\r\n")
+
+	return header + "\r\n", nil
+}
+
+// Returns ESMTP for case when session was started with EHLO command, otherwise returns SMTP
+func receivedHeaderProtocol(heloRequest string) string {
+	if strings.HasPrefix(strings.ToUpper(heloRequest), "EHLO") {
+		return "ESMTP"
+	}
+
+	return "SMTP"
+}
+
+// Returns recipient email for case when message has only one successful RCPTTO, any 2xx
+// response is successful. Otherwise returns empty string
+func receivedHeaderRecipient(message *Message) string {
+	if recipients := message.Recipients(); len(recipients) == 1 {
+		return recipients[0]
+	}
+
+	return emptyString
+}
+
+// Converts host:port address to RFC 5321 address literal
+func addressLiteral(address string) string {
+	host := remoteHost(address)
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return "[IPv6:" + host + "]"
+	}
+
+	return "[" + host + "]"
+}
@@ -0,0 +1,168 @@
+package smtpmock
+
+import (
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var originalGenerateQueueID = generateQueueID
+
+func TestGenerateQueueID(t *testing.T) {
+	t.Run("returns random upper case hex queue identifier", func(t *testing.T) {
+		queueID := generateQueueID()
+
+		assert.Regexp(t, `\A[0-9A-F]{12}\z`, queueID)
+		assert.NotEqual(t, queueID, generateQueueID())
+	})
+}
+
+func TestNewReceivedHeaderTemplate(t *testing.T) {
+	t.Run("when template text is empty", func(t *testing.T) {
+		receivedHeaderTemplate, err := newReceivedHeaderTemplate(emptyString)
+
+		assert.NoError(t, err)
+		assert.Equal(t, receivedHeaderTemplateName, receivedHeaderTemplate.Name())
+		assert.Equal(t, defaultReceivedHeaderTemplate, receivedHeaderTemplate.Root.String())
+	})
+
+	t.Run("when template text is not empty", func(t *testing.T) {
+		templateText := "Received: from {{.HeloDomain}}"
+		receivedHeaderTemplate, err := newReceivedHeaderTemplate(templateText)
+
+		assert.NoError(t, err)
+		assert.Equal(t, templateText, receivedHeaderTemplate.Root.String())
+	})
+
+	t.Run("when template text is invalid", func(t *testing.T) {
+		receivedHeaderTemplate, err := newReceivedHeaderTemplate("{{.HeloDomain")
+
+		assert.Nil(t, receivedHeaderTemplate)
+		assert.Error(t, err)
+	})
+
+	t.Run("when template can't be executed", func(t *testing.T) {
+		receivedHeaderTemplate, err := newReceivedHeaderTemplate("Received: {{.Foo}}")
+
+		assert.Nil(t, receivedHeaderTemplate)
+		assert.Error(t, err)
+	})
+}
+
+func TestSampleReceivedHeaderContext(t *testing.T) {
+	t.Run("returns context with sample values of all fields", func(t *testing.T) {
+		context := sampleReceivedHeaderContext()
+
+		assert.Equal(t, "example.com", context.HeloDomain)
+		assert.Equal(t, "[127.0.0.1]", context.RemoteAddress)
+		assert.Equal(t, receivedHeaderHostname, context.Hostname)
+		assert.Equal(t, "ESMTP", context.Protocol)
+		assert.Equal(t, "0123456789AB", context.QueueID)
+		assert.Equal(t, "user@example.com", context.Recipient)
+		assert.Equal(t, "Thu, 01 Jan 1970 00:00:00 +0000", context.Date)
+		assert.Equal(t, time.Unix(0, 0).UTC(), context.Time)
+	})
+}
+
+func TestNewReceivedHeaderContext(t *testing.T) {
+	t.Run("creates new Received header context", func(t *testing.T) {
+		timeStub, queueID := time.Date(2021, 11, 30, 22, 7, 30, 0, time.UTC), "ABCDEF012345"
+		timeNow, generateQueueID = func() time.Time { return timeStub }, func() string { return queueID }
+		defer func() { timeNow, generateQueueID = time.Now, originalGenerateQueueID }()
+		message := &Message{
+			heloRequest:           "HELO example.com",
+			rcpttoRequestResponse: [][]string{{"RCPT TO:<user@example.com>", "250 Accepted"}},
+		}
+
+		assert.Equal(
+			t,
+			&ReceivedHeaderContext{
+				HeloDomain:    "example.com",
+				RemoteAddress: "[127.0.0.1]",
+				Hostname:      receivedHeaderHostname,
+				Protocol:      "SMTP",
+				QueueID:       queueID,
+				Recipient:     "user@example.com",
+				Date:          "Tue, 30 Nov 2021 22:07:30 +0000",
+				Time:          timeStub,
+			},
+			newReceivedHeaderContext(message, "127.0.0.1:42"),
+		)
+	})
+}
+
+func TestRenderReceivedHeader(t *testing.T) {
+	context := &ReceivedHeaderContext{HeloDomain: "example.com", RemoteAddress: "[127.0.0.1]"}
+
+	t.Run("when template has been executed successfully", func(t *testing.T) {
+		receivedHeaderTemplate := template.Must(template.New("test").Parse("Received: from {{.HeloDomain}}\n\t({{.RemoteAddress}})\n"))
+		header, err := renderReceivedHeader(receivedHeaderTemplate, context)
+
+		assert.Equal(t, "Received: from example.com\r\n\t([127.0.0.1])\r\n", header)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when template execution failed", func(t *testing.T) {
+		receivedHeaderTemplate := template.Must(template.New("test").Parse("{{.NotExistingField}}"))
+		header, err := renderReceivedHeader(receivedHeaderTemplate, context)
+
+		assert.Empty(t, header)
+		assert.Error(t, err)
+	})
+}
+
+func TestReceivedHeaderProtocol(t *testing.T) {
+	t.Run("when session was started with EHLO command", func(t *testing.T) {
+		assert.Equal(t, "ESMTP", receivedHeaderProtocol("ehlo example.com"))
+	})
+
+	t.Run("when session was started with HELO command", func(t *testing.T) {
+		assert.Equal(t, "SMTP", receivedHeaderProtocol("HELO example.com"))
+	})
+}
+
+func TestReceivedHeaderRecipient(t *testing.T) {
+	successfulResponse, failedResponse := "250 Accepted", "550 User not found"
+
+	t.Run("when message has only one successful RCPTTO", func(t *testing.T) {
+		message := &Message{
+			rcpttoRequestResponse: [][]string{
+				{"RCPT TO:<user1@example.com>", failedResponse},
+				{"RCPT TO:<user2@example.com>", successfulResponse},
+			},
+		}
+
+		assert.Equal(t, "user2@example.com", receivedHeaderRecipient(message))
+	})
+
+	t.Run("when message has multiple successful RCPTTO", func(t *testing.T) {
+		message := &Message{
+			rcpttoRequestResponse: [][]string{
+				{"RCPT TO:<user1@example.com>", successfulResponse},
+				{"RCPT TO:<user2@example.com>", successfulResponse},
+			},
+		}
+
+		assert.Empty(t, receivedHeaderRecipient(message))
+	})
+
+	t.Run("when message has no successful RCPTTO", func(t *testing.T) {
+		assert.Empty(t, receivedHeaderRecipient(new(Message)))
+	})
+}
+
+func TestAddressLiteral(t *testing.T) {
+	t.Run("when IPv4 address with port", func(t *testing.T) {
+		assert.Equal(t, "[127.0.0.1]", addressLiteral("127.0.0.1:25"))
+	})
+
+	t.Run("when IPv6 address with port", func(t *testing.T) {
+		assert.Equal(t, "[IPv6:::1]", addressLiteral("[::1]:25"))
+	})
+
+	t.Run("when address without port", func(t *testing.T) {
+		assert.Equal(t, "[127.0.0.1]", addressLiteral("127.0.0.1"))
+	})
+}
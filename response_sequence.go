@@ -0,0 +1,95 @@
+package smtpmock
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ResponseSequence is the list of responses to the first attempts of HELO, MAIL FROM or
+// RCPT TO command, e.g. two "451 Try again later" responses followed by usual handling.
+// Attempts are counted by server across sessions, use Server.ResetResponseSequences() to
+// start sequences over
+type ResponseSequence struct {
+	Command    RuleCommand // command which sequence applies to, all commands for case when empty
+	Address    string      // HELO domain or email, case-insensitive, any address for case when empty
+	PerAddress bool        // counts attempts of each address separately, otherwise attempts are shared
+	Responses  []string    // responses to the first attempts, 2xx response accepts command
+}
+
+// Concurrent type that can be safely shared between goroutines. Keeps response sequences
+// and counters of attempts
+type responseSequences struct {
+	sync.Mutex
+	sequences []ResponseSequence
+	attempts  map[string]int
+}
+
+// Response sequences builder. Returns pointer to new responseSequences structure
+func newResponseSequences(sequences []ResponseSequence) *responseSequences {
+	return &responseSequences{sequences: sequences, attempts: make(map[string]int)}
+}
+
+// responseSequences methods
+
+// Replaces response sequences. Counters of attempts are erased for case when sequences are
+// changed, otherwise they are kept
+func (responseSequences *responseSequences) reconfigure(sequences []ResponseSequence) {
+	responseSequences.Lock()
+	defer responseSequences.Unlock()
+	if !reflect.DeepEqual(responseSequences.sequences, sequences) {
+		responseSequences.sequences, responseSequences.attempts = sequences, make(map[string]int)
+	}
+}
+
+// Counts command attempt in each matched sequence. Returns response of the first not
+// exhausted sequence and true. Returns empty string and false for case when no sequence
+// matched or all matched sequences are exhausted
+func (responseSequences *responseSequences) next(command RuleCommand, address string) (string, bool) {
+	responseSequences.Lock()
+	defer responseSequences.Unlock()
+
+	response, found := emptyString, false
+	for index, sequence := range responseSequences.sequences {
+		if !sequence.isAppliedTo(command, address) {
+			continue
+		}
+
+		key := sequence.attemptsKey(index, address)
+		attempt := responseSequences.attempts[key]
+		responseSequences.attempts[key]++
+
+		if !found && attempt < len(sequence.Responses) {
+			response, found = sequence.Responses[attempt], true
+		}
+	}
+
+	return response, found
+}
+
+// Erases counters of attempts
+func (responseSequences *responseSequences) reset() {
+	responseSequences.Lock()
+	defer responseSequences.Unlock()
+	responseSequences.attempts = make(map[string]int)
+}
+
+// ResponseSequence methods
+
+// Returns true for case when sequence applies to the given command and address, otherwise
+// returns false
+func (sequence ResponseSequence) isAppliedTo(command RuleCommand, address string) bool {
+	return (sequence.Command == emptyString || sequence.Command == command) &&
+		(sequence.Address == emptyString || strings.EqualFold(sequence.Address, address))
+}
+
+// Returns key of attempts counter for sequence with the given index
+func (sequence ResponseSequence) attemptsKey(index int, address string) string {
+	key := strconv.Itoa(index)
+	if sequence.PerAddress {
+		key += ":" + strings.ToLower(address)
+	}
+
+	return key
+}
@@ -0,0 +1,136 @@
+package smtpmock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewResponseSequences(t *testing.T) {
+	t.Run("creates new response sequences without attempts", func(t *testing.T) {
+		sequences := []ResponseSequence{{Command: RuleRcptto, Responses: []string{"451 Try again later"}}}
+		responseSequences := newResponseSequences(sequences)
+
+		assert.Equal(t, sequences, responseSequences.sequences)
+		assert.Empty(t, responseSequences.attempts)
+	})
+}
+
+func TestResponseSequencesNext(t *testing.T) {
+	tempFailure, accepted := "451 Try again later", "250 Accepted"
+
+	t.Run("returns responses of the first attempts shared by all addresses", func(t *testing.T) {
+		responseSequences := newResponseSequences(
+			[]ResponseSequence{{Command: RuleRcptto, Responses: []string{tempFailure, tempFailure}}},
+		)
+
+		for _, address := range []string{"user1@example.com", "user2@example.com"} {
+			response, found := responseSequences.next(RuleRcptto, address)
+			assert.True(t, found)
+			assert.Equal(t, tempFailure, response)
+		}
+
+		response, found := responseSequences.next(RuleRcptto, "user1@example.com")
+		assert.False(t, found)
+		assert.Empty(t, response)
+	})
+
+	t.Run("counts attempts of each address separately", func(t *testing.T) {
+		responseSequences := newResponseSequences(
+			[]ResponseSequence{{Command: RuleRcptto, PerAddress: true, Responses: []string{tempFailure}}},
+		)
+
+		for _, address := range []string{"user@example.com", "User@Example.com", "other@example.com"} {
+			response, found := responseSequences.next(RuleRcptto, address)
+			assert.Equal(t, address != "User@Example.com", found)
+			assert.Equal(t, address != "User@Example.com", response == tempFailure)
+		}
+	})
+
+	t.Run("applies sequence to the specified address only", func(t *testing.T) {
+		responseSequences := newResponseSequences(
+			[]ResponseSequence{{Address: "user@example.com", Responses: []string{tempFailure}}},
+		)
+
+		_, found := responseSequences.next(RuleRcptto, "other@example.com")
+		assert.False(t, found)
+		response, found := responseSequences.next(RuleMailfrom, "USER@example.com")
+		assert.True(t, found)
+		assert.Equal(t, tempFailure, response)
+	})
+
+	t.Run("returns response of the first not exhausted sequence, counts attempt in each matched sequence", func(t *testing.T) {
+		responseSequences := newResponseSequences(
+			[]ResponseSequence{
+				{Command: RuleRcptto, Responses: []string{tempFailure}},
+				{Command: RuleHelo, Responses: []string{tempFailure}},
+				{Command: RuleRcptto, Responses: []string{accepted, accepted, tempFailure}},
+			},
+		)
+
+		for _, expectedResponse := range []string{tempFailure, accepted, tempFailure} {
+			response, found := responseSequences.next(RuleRcptto, "user@example.com")
+			assert.True(t, found)
+			assert.Equal(t, expectedResponse, response)
+		}
+
+		_, found := responseSequences.next(RuleRcptto, "user@example.com")
+		assert.False(t, found)
+		assert.Equal(t, map[string]int{"0": 4, "2": 4}, responseSequences.attempts)
+	})
+}
+
+func TestResponseSequencesReconfigure(t *testing.T) {
+	sequences := []ResponseSequence{{Responses: []string{"451 Try again later"}}}
+
+	t.Run("keeps counters of attempts when sequences are not changed", func(t *testing.T) {
+		responseSequences := newResponseSequences(sequences)
+		_, _ = responseSequences.next(RuleHelo, "example.com")
+		responseSequences.reconfigure([]ResponseSequence{{Responses: []string{"451 Try again later"}}})
+
+		assert.Equal(t, map[string]int{"0": 1}, responseSequences.attempts)
+	})
+
+	t.Run("replaces sequences, erases counters of attempts when sequences are changed", func(t *testing.T) {
+		responseSequences, newSequences := newResponseSequences(sequences), []ResponseSequence{{Responses: []string{"250 Ok"}}}
+		_, _ = responseSequences.next(RuleHelo, "example.com")
+		responseSequences.reconfigure(newSequences)
+
+		assert.Equal(t, newSequences, responseSequences.sequences)
+		assert.Empty(t, responseSequences.attempts)
+	})
+}
+
+func TestResponseSequencesReset(t *testing.T) {
+	t.Run("erases counters of attempts", func(t *testing.T) {
+		responseSequences := newResponseSequences([]ResponseSequence{{Responses: []string{"451 Try again later"}}})
+		_, _ = responseSequences.next(RuleHelo, "example.com")
+		responseSequences.reset()
+
+		assert.Empty(t, responseSequences.attempts)
+	})
+}
+
+func TestResponseSequenceIsAppliedTo(t *testing.T) {
+	t.Run("when command and address are not specified", func(t *testing.T) {
+		assert.True(t, ResponseSequence{}.isAppliedTo(RuleMailfrom, "user@example.com"))
+	})
+
+	t.Run("when command and address are specified", func(t *testing.T) {
+		sequence := ResponseSequence{Command: RuleRcptto, Address: "user@example.com"}
+
+		assert.True(t, sequence.isAppliedTo(RuleRcptto, "USER@example.com"))
+		assert.False(t, sequence.isAppliedTo(RuleMailfrom, "user@example.com"))
+		assert.False(t, sequence.isAppliedTo(RuleRcptto, "other@example.com"))
+	})
+}
+
+func TestResponseSequenceAttemptsKey(t *testing.T) {
+	t.Run("when attempts are shared", func(t *testing.T) {
+		assert.Equal(t, "1", ResponseSequence{}.attemptsKey(1, "User@example.com"))
+	})
+
+	t.Run("when attempts are counted per address", func(t *testing.T) {
+		assert.Equal(t, "1:user@example.com", ResponseSequence{PerAddress: true}.attemptsKey(1, "User@example.com"))
+	})
+}
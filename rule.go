@@ -0,0 +1,154 @@
+package smtpmock
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// RuleCommand is the SMTP command which rule applies to
+type RuleCommand string
+
+// Available rule commands
+const (
+	RuleHelo     RuleCommand = "HELO"      // HELO or EHLO domain
+	RuleMailfrom RuleCommand = "MAIL FROM" // MAIL FROM email
+	RuleRcptto   RuleCommand = "RCPT TO"   // RCPT TO email
+)
+
+// RuleMatcher is the kind of rule pattern
+type RuleMatcher string
+
+// Available rule matchers
+const (
+	GlobMatcher         RuleMatcher = "glob"   // case-insensitive glob, * matches any sequence, ? matches single character
+	RegexMatcher        RuleMatcher = "regex"  // Go regular expression, unanchored
+	DomainSuffixMatcher RuleMatcher = "domain" // case-insensitive domain or any of its subdomains
+)
+
+// Rule is the pattern based behavior of HELO, MAIL FROM and RCPT TO commands. Rules are
+// checked in order after command sequence and argument validation, the first matched rule
+// wins and takes precedence over blacklists. Rule with 2xx response accepts command
+type Rule struct {
+	Commands      []RuleCommand // commands which rule applies to, all commands for case when empty
+	Matcher       RuleMatcher   // pattern kind, glob by default
+	Pattern       string        // matched with HELO domain or email address
+	Response      string        // server response, e.g. "550 Mailbox unavailable"
+	ResponseDelay time.Duration // response delay
+	FailFast      bool          // ends session after failed response regardless of IsCmdFailFast
+}
+
+// Compiled rule
+type rule struct {
+	commands      []RuleCommand
+	match         func(string) bool
+	response      string
+	responseDelay time.Duration
+	failFast      bool
+}
+
+// Rules builder. Returns compiled rules in the same order. Returns error for case when rule
+// has invalid pattern or unknown matcher
+func newRules(rules []Rule) ([]*rule, error) {
+	compiledRules := make([]*rule, 0, len(rules))
+	for _, ruleAttr := range rules {
+		match, err := newRuleMatch(ruleAttr.Matcher, ruleAttr.Pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		compiledRules = append(compiledRules, &rule{
+			commands:      ruleAttr.Commands,
+			match:         match,
+			response:      ruleAttr.Response,
+			responseDelay: ruleAttr.ResponseDelay,
+			failFast:      ruleAttr.FailFast,
+		})
+	}
+
+	return compiledRules, nil
+}
+
+// Returns rule pattern predicate for the given matcher. Returns error for case when pattern
+// is invalid or matcher is unknown
+func newRuleMatch(matcher RuleMatcher, pattern string) (func(string) bool, error) {
+	switch matcher {
+	case emptyString, GlobMatcher:
+		return newRegexMatch(globRegexPattern(pattern))
+	case RegexMatcher:
+		return newRegexMatch(pattern)
+	case DomainSuffixMatcher:
+		domain := strings.ToLower(strings.TrimLeft(pattern, "*."))
+		return func(target string) bool {
+			targetDomain := strings.ToLower(target[strings.LastIndex(target, "@")+1:])
+			return targetDomain == domain || strings.HasSuffix(targetDomain, "."+domain)
+		}, nil
+	default:
+		return nil, fmt.Errorf("%s: %q", ruleUnknownMatcherErrorMsg, matcher)
+	}
+}
+
+// Returns regex pattern predicate. Returns error for case when regex pattern is invalid
+func newRegexMatch(pattern string) (func(string) bool, error) {
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return regex.MatchString, nil
+}
+
+// Returns anchored case-insensitive regex pattern equivalent to the given glob pattern
+func globRegexPattern(pattern string) string {
+	var regexPattern strings.Builder
+	regexPattern.WriteString("(?i)^")
+	for _, char := range pattern {
+		switch char {
+		case '*':
+			regexPattern.WriteString(".*")
+		case '?':
+			regexPattern.WriteString(".")
+		default:
+			regexPattern.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+	regexPattern.WriteString("$")
+
+	return regexPattern.String()
+}
+
+// rule methods
+
+// Returns true for case when rule applies to the given command, otherwise returns false
+func (rule *rule) isAppliedTo(command RuleCommand) bool {
+	if len(rule.commands) == 0 {
+		return true
+	}
+
+	for _, ruleCommand := range rule.commands {
+		if ruleCommand == command {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns true for case when rule response is positive completion reply, otherwise
+// returns false
+func (rule *rule) isSuccessful() bool {
+	return isPositiveCompletionReply(rule.response)
+}
+
+// Returns the first rule which applies to the given command and matches the given target.
+// Returns nil for case when no rule matched
+func matchRule(rules []*rule, command RuleCommand, target string) *rule {
+	for _, rule := range rules {
+		if rule.isAppliedTo(command) && rule.match(target) {
+			return rule
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package smtpmock
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRules(t *testing.T) {
+	t.Run("returns compiled rules in the same order", func(t *testing.T) {
+		ruleAttrs := []Rule{
+			{Commands: []RuleCommand{RuleRcptto}, Pattern: "user@example.com", Response: "250 Accepted"},
+			{Matcher: RegexMatcher, Pattern: `^bounce-`, Response: "550 Rejected", ResponseDelay: 2 * time.Second, FailFast: true},
+		}
+		rules, err := newRules(ruleAttrs)
+
+		assert.NoError(t, err)
+		assert.Len(t, rules, 2)
+		for index, ruleAttr := range ruleAttrs {
+			assert.Equal(t, ruleAttr.Commands, rules[index].commands)
+			assert.Equal(t, ruleAttr.Response, rules[index].response)
+			assert.Equal(t, ruleAttr.ResponseDelay, rules[index].responseDelay)
+			assert.Equal(t, ruleAttr.FailFast, rules[index].failFast)
+			assert.NotNil(t, rules[index].match)
+		}
+	})
+
+	t.Run("returns empty rules when rules not passed", func(t *testing.T) {
+		rules, err := newRules(nil)
+
+		assert.NoError(t, err)
+		assert.Empty(t, rules)
+	})
+
+	t.Run("returns error when rule has invalid regex pattern", func(t *testing.T) {
+		rules, err := newRules([]Rule{{Matcher: RegexMatcher, Pattern: "("}})
+
+		assert.Nil(t, rules)
+		assert.Error(t, err)
+	})
+
+	t.Run("returns error when rule has unknown matcher", func(t *testing.T) {
+		rules, err := newRules([]Rule{{Matcher: "exact", Pattern: "user@example.com"}})
+
+		assert.Nil(t, rules)
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", ruleUnknownMatcherErrorMsg, "exact"))
+	})
+}
+
+func TestNewRuleMatch(t *testing.T) {
+	t.Run("glob matcher", func(t *testing.T) {
+		match, err := newRuleMatch(GlobMatcher, "*@*.invalid.test")
+
+		assert.NoError(t, err)
+		assert.True(t, match("user@mx.invalid.test"))
+		assert.True(t, match("User@MX.Invalid.Test"))
+		assert.False(t, match("user@invalid.test"))
+		assert.False(t, match("user@mx.invalid.test.com"))
+	})
+
+	t.Run("glob matcher is used by default", func(t *testing.T) {
+		match, err := newRuleMatch(emptyString, "bounce-?@example.com")
+
+		assert.NoError(t, err)
+		assert.True(t, match("bounce-1@example.com"))
+		assert.False(t, match("bounce-12@example.com"))
+		assert.False(t, match("bounce-1@example+com"))
+	})
+
+	t.Run("regex matcher", func(t *testing.T) {
+		match, err := newRuleMatch(RegexMatcher, `^bounce-\d+@`)
+
+		assert.NoError(t, err)
+		assert.True(t, match("bounce-42@example.com"))
+		assert.False(t, match("user@example.com"))
+	})
+
+	t.Run("domain suffix matcher", func(t *testing.T) {
+		match, err := newRuleMatch(DomainSuffixMatcher, "invalid.test")
+
+		assert.NoError(t, err)
+		assert.True(t, match("user@invalid.test"))
+		assert.True(t, match("user@mx.Invalid.Test"))
+		assert.True(t, match("mx.invalid.test"))
+		assert.False(t, match("user@notinvalid.test"))
+		assert.False(t, match("invalid.test@example.com"))
+	})
+
+	t.Run("domain suffix matcher with wildcard prefix", func(t *testing.T) {
+		match, err := newRuleMatch(DomainSuffixMatcher, "*.invalid.test")
+
+		assert.NoError(t, err)
+		assert.True(t, match("user@invalid.test"))
+		assert.True(t, match("user@mx.invalid.test"))
+	})
+}
+
+func TestNewRegexMatch(t *testing.T) {
+	t.Run("when regex pattern is valid", func(t *testing.T) {
+		match, err := newRegexMatch(`^bounce-\d+@`)
+
+		assert.NoError(t, err)
+		assert.True(t, match("bounce-42@example.com"))
+		assert.False(t, match("user@example.com"))
+	})
+
+	t.Run("when regex pattern is invalid", func(t *testing.T) {
+		match, err := newRegexMatch("(")
+
+		assert.Nil(t, match)
+		assert.Error(t, err)
+	})
+}
+
+func TestGlobRegexPattern(t *testing.T) {
+	t.Run("returns anchored case-insensitive regex pattern with quoted characters", func(t *testing.T) {
+		assert.Equal(t, `(?i)^bounce-.@.*\.test$`, globRegexPattern("bounce-?@*.test"))
+	})
+}
+
+func TestRuleIsAppliedTo(t *testing.T) {
+	t.Run("when rule commands are not specified", func(t *testing.T) {
+		rule := new(rule)
+
+		assert.True(t, rule.isAppliedTo(RuleHelo))
+		assert.True(t, rule.isAppliedTo(RuleMailfrom))
+		assert.True(t, rule.isAppliedTo(RuleRcptto))
+	})
+
+	t.Run("when rule commands are specified", func(t *testing.T) {
+		rule := &rule{commands: []RuleCommand{RuleMailfrom, RuleRcptto}}
+
+		assert.False(t, rule.isAppliedTo(RuleHelo))
+		assert.True(t, rule.isAppliedTo(RuleMailfrom))
+		assert.True(t, rule.isAppliedTo(RuleRcptto))
+	})
+}
+
+func TestRuleIsSuccessful(t *testing.T) {
+	t.Run("when rule response is positive completion reply", func(t *testing.T) {
+		assert.True(t, (&rule{response: "250 Accepted"}).isSuccessful())
+	})
+
+	t.Run("when rule response is negative reply", func(t *testing.T) {
+		assert.False(t, (&rule{response: "421 Try again later"}).isSuccessful())
+		assert.False(t, (&rule{response: "550 Rejected"}).isSuccessful())
+	})
+}
+
+func TestMatchRule(t *testing.T) {
+	rules, _ := newRules(
+		[]Rule{
+			{Commands: []RuleCommand{RuleRcptto}, Pattern: "postmaster@*", Response: "250 Accepted"},
+			{Matcher: DomainSuffixMatcher, Pattern: "invalid.test", Response: "550 Rejected"},
+			{Pattern: "*@invalid.test", Response: "421 Try again later"},
+		},
+	)
+
+	t.Run("returns the first rule which applies to command and matches target", func(t *testing.T) {
+		assert.Same(t, rules[0], matchRule(rules, RuleRcptto, "postmaster@invalid.test"))
+		assert.Same(t, rules[1], matchRule(rules, RuleMailfrom, "postmaster@invalid.test"))
+		assert.Same(t, rules[1], matchRule(rules, RuleHelo, "mx.invalid.test"))
+	})
+
+	t.Run("returns nil when no rule matched", func(t *testing.T) {
+		assert.Nil(t, matchRule(rules, RuleRcptto, "user@example.com"))
+		assert.Nil(t, matchRule(nil, RuleRcptto, "user@example.com"))
+	})
+}
@@ -0,0 +1,275 @@
+package smtpmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Scenario is the declarative SMTP conversation script. Scenario replaces the built-in
+// session flow with state machine: each request is answered by the first matched step of
+// current state or by the first matched step of Any, then session moves to the next state
+// of this step. Scenario can be defined in code or loaded from JSON or YAML file
+type Scenario struct {
+	InitialState      string                    `json:"initial_state"`      // state of new session, it's equal to "start" by default
+	Greeting          ScenarioStep              `json:"greeting"`           // server greeting, only response, delay and fault are used
+	States            map[string][]ScenarioStep `json:"states"`             // steps of each state, checked in order
+	Any               []ScenarioStep            `json:"any"`                // steps checked in any state after steps of current state
+	UnmatchedResponse string                    `json:"unmatched_response"` // response to request without matched step, it's equal to MsgInvalidCmd by default
+}
+
+// ScenarioStep is the expectation of scenario request and server reaction to it
+type ScenarioStep struct {
+	Matcher      RuleMatcher      `json:"matcher"`       // pattern kind, glob by default
+	Pattern      string           `json:"pattern"`       // matched with request line, e.g. "MAIL FROM:*", all requests for case when empty
+	Response     string           `json:"response"`      // server response, e.g. "250 Ok"
+	Delay        ScenarioDuration `json:"delay"`         // response delay
+	Fault        FaultKind        `json:"fault"`         // fault applied to response, no fault for case when empty
+	ByteDelay    ScenarioDuration `json:"byte_delay"`    // delay between bytes of FaultByteByByte response
+	DataResponse string           `json:"data_response"` // reads message body after response and answers it with this response for case when it's not empty
+	DataDelay    ScenarioDuration `json:"data_delay"`    // message body response delay
+	Next         string           `json:"next"`          // next state, session stays in current state for case when empty
+	End          bool             `json:"end"`           // ends session after response
+}
+
+// ScenarioDuration is the scenario delay. It's unmarshaled from JSON number of seconds,
+// e.g. 2 or 0.25, or from JSON duration string, e.g. "250ms"
+type ScenarioDuration time.Duration
+
+// UnmarshalJSON parses JSON number of seconds or duration string
+func (duration *ScenarioDuration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case float64:
+		*duration = ScenarioDuration(value * float64(time.Second))
+		return nil
+	case string:
+		parsedDuration, err := time.ParseDuration(value)
+		*duration = ScenarioDuration(parsedDuration)
+		return err
+	default:
+		return fmt.Errorf("%s: %s", scenarioInvalidDurationErrorMsg, data)
+	}
+}
+
+// ParseScenario parses and validates JSON scenario. Returns error for case when JSON is
+// malformed or scenario is invalid
+func ParseScenario(data []byte) (*Scenario, error) {
+	scenario := new(Scenario)
+	if err := json.Unmarshal(data, scenario); err != nil {
+		return nil, err
+	}
+
+	if err := scenario.validate(); err != nil {
+		return nil, err
+	}
+
+	return scenario, nil
+}
+
+// LoadScenario reads, parses and validates scenario file. File with .yaml or .yml extension
+// is parsed as YAML, other files are parsed as JSON. Returns error for case when file can't
+// be read or scenario is invalid
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseScenarioYAML(data)
+	default:
+		return ParseScenario(data)
+	}
+}
+
+// Scenario methods
+
+// Validates scenario. Returns error for case when scenario has unknown state, invalid
+// pattern, unknown matcher or unknown fault kind
+func (scenario *Scenario) validate() error {
+	config := new(ConfigurationAttr)
+	config.assignDefaultValues()
+	_, err := newScenario(scenario, config)
+	return err
+}
+
+// Compiled scenario step
+type scenarioStep struct {
+	match        func(string) bool
+	response     string
+	delay        time.Duration
+	fault        *fault
+	dataResponse string
+	dataDelay    time.Duration
+	next         string
+	end          bool
+}
+
+// Compiled scenario
+type scenario struct {
+	initialState      string
+	greeting          *scenarioStep
+	states            map[string][]*scenarioStep
+	any               []*scenarioStep
+	unmatchedResponse string
+}
+
+// Scenario builder. Returns nil for case when scenario is not defined, otherwise returns
+// compiled scenario with defaults from the given configuration attributes. Returns error for
+// case when scenario has unknown state, invalid pattern, unknown matcher or unknown fault kind
+func newScenario(scenarioAttr *Scenario, config *ConfigurationAttr) (*scenario, error) {
+	if scenarioAttr == nil {
+		return nil, nil
+	}
+
+	stallDuration := time.Duration(config.SessionTimeout) * time.Second
+	greeting, err := newScenarioStep(scenarioAttr.Greeting, stallDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	anySteps, err := newScenarioSteps(scenarioAttr.Any, stallDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	compiledScenario := &scenario{
+		initialState:      scenarioAttr.InitialState,
+		greeting:          greeting,
+		states:            make(map[string][]*scenarioStep, len(scenarioAttr.States)),
+		any:               anySteps,
+		unmatchedResponse: scenarioAttr.UnmatchedResponse,
+	}
+	if compiledScenario.initialState == emptyString {
+		compiledScenario.initialState = defaultScenarioInitialState
+	}
+	if compiledScenario.greeting.response == emptyString {
+		compiledScenario.greeting.response = config.MsgGreeting
+		compiledScenario.greeting.delay = responseDelay(config.ResponseDelayGreeting, config.ResponseDelayGreetingDuration)
+	}
+	if compiledScenario.unmatchedResponse == emptyString {
+		compiledScenario.unmatchedResponse = config.MsgInvalidCmd
+	}
+	for state, steps := range scenarioAttr.States {
+		if compiledScenario.states[state], err = newScenarioSteps(steps, stallDuration); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := compiledScenario.validateStates(); err != nil {
+		return nil, err
+	}
+
+	return compiledScenario, nil
+}
+
+// Scenario steps builder. Returns compiled steps in the same order. Returns error for case
+// when step has invalid pattern, unknown matcher or unknown fault kind
+func newScenarioSteps(steps []ScenarioStep, stallDuration time.Duration) ([]*scenarioStep, error) {
+	compiledSteps := make([]*scenarioStep, 0, len(steps))
+	for _, step := range steps {
+		compiledStep, err := newScenarioStep(step, stallDuration)
+		if err != nil {
+			return nil, err
+		}
+
+		compiledSteps = append(compiledSteps, compiledStep)
+	}
+
+	return compiledSteps, nil
+}
+
+// Scenario step builder. Returns compiled step, step fault holds stalled session for the
+// given duration. Returns error for case when step has invalid pattern, unknown matcher
+// or unknown fault kind
+func newScenarioStep(step ScenarioStep, stallDuration time.Duration) (*scenarioStep, error) {
+	compiledStep := &scenarioStep{
+		response:     step.Response,
+		delay:        time.Duration(step.Delay),
+		dataResponse: step.DataResponse,
+		dataDelay:    time.Duration(step.DataDelay),
+		next:         step.Next,
+		end:          step.End,
+	}
+	if step.Pattern != emptyString {
+		match, err := newRuleMatch(step.Matcher, step.Pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		compiledStep.match = match
+	}
+	if step.Fault != emptyString {
+		faults, err := newFaults([]Fault{{Kind: step.Fault, ByteDelay: time.Duration(step.ByteDelay)}}, stallDuration)
+		if err != nil {
+			return nil, err
+		}
+
+		compiledStep.fault = faults[0]
+	}
+
+	return compiledStep, nil
+}
+
+// scenario methods
+
+// Checks that initial state and next states of all steps are defined. Returns error for case
+// when state is unknown
+func (scenario *scenario) validateStates() error {
+	if err := scenario.validateState(scenario.initialState); err != nil {
+		return err
+	}
+	for _, step := range scenario.any {
+		if err := scenario.validateState(step.next); err != nil {
+			return err
+		}
+	}
+	for _, steps := range scenario.states {
+		for _, step := range steps {
+			if err := scenario.validateState(step.next); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns error for case when the given not empty state is not defined
+func (scenario *scenario) validateState(state string) error {
+	if _, ok := scenario.states[state]; state != emptyString && !ok {
+		return fmt.Errorf("%s: %q", scenarioUnknownStateErrorMsg, state)
+	}
+
+	return nil
+}
+
+// Returns the first step of the given state or the first step of any state which matches
+// the given request. Returns nil for case when no step matched
+func (scenario *scenario) match(state, request string) *scenarioStep {
+	for _, steps := range [2][]*scenarioStep{scenario.states[state], scenario.any} {
+		for _, step := range steps {
+			if step.isMatched(request) {
+				return step
+			}
+		}
+	}
+
+	return nil
+}
+
+// scenarioStep methods
+
+// Returns true for case when step matches the given request, otherwise returns false
+func (step *scenarioStep) isMatched(request string) bool {
+	return step.match == nil || step.match(request)
+}
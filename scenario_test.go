@@ -0,0 +1,256 @@
+package smtpmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScenarioDurationUnmarshalJSON(t *testing.T) {
+	t.Run("parses number of seconds", func(t *testing.T) {
+		var duration ScenarioDuration
+
+		assert.NoError(t, json.Unmarshal([]byte("0.25"), &duration))
+		assert.Equal(t, ScenarioDuration(250*time.Millisecond), duration)
+	})
+
+	t.Run("parses duration string", func(t *testing.T) {
+		var duration ScenarioDuration
+
+		assert.NoError(t, json.Unmarshal([]byte(`"2s"`), &duration))
+		assert.Equal(t, ScenarioDuration(2*time.Second), duration)
+	})
+
+	t.Run("returns error when duration string is invalid", func(t *testing.T) {
+		var duration ScenarioDuration
+
+		assert.Error(t, json.Unmarshal([]byte(`"2 seconds"`), &duration))
+	})
+
+	t.Run("returns error when value is neither number nor string", func(t *testing.T) {
+		var duration ScenarioDuration
+
+		assert.EqualError(t, json.Unmarshal([]byte("true"), &duration), scenarioInvalidDurationErrorMsg+": true")
+	})
+
+	t.Run("returns error when JSON is malformed", func(t *testing.T) {
+		assert.Error(t, new(ScenarioDuration).UnmarshalJSON([]byte("{")))
+	})
+}
+
+func TestParseScenario(t *testing.T) {
+	t.Run("returns parsed scenario", func(t *testing.T) {
+		scenario, err := ParseScenario([]byte(`{"states": {"start": [{"pattern": "QUIT", "response": "221 Bye", "delay": 1, "end": true}]}}`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, &Scenario{States: map[string][]ScenarioStep{"start": {{Pattern: "QUIT", Response: "221 Bye", Delay: ScenarioDuration(time.Second), End: true}}}}, scenario)
+	})
+
+	t.Run("returns error when JSON is malformed", func(t *testing.T) {
+		scenario, err := ParseScenario([]byte(`{"states": [`))
+
+		assert.Error(t, err)
+		assert.Nil(t, scenario)
+	})
+
+	t.Run("returns error when scenario is invalid", func(t *testing.T) {
+		scenario, err := ParseScenario([]byte(`{"states": {"start": [{"next": "data"}]}}`))
+
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", scenarioUnknownStateErrorMsg, "data"))
+		assert.Nil(t, scenario)
+	})
+}
+
+func TestLoadScenario(t *testing.T) {
+	t.Run("returns scenario loaded from file", func(t *testing.T) {
+		scenario, err := LoadScenario("testdata/scenario/submission.json")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "start", scenario.InitialState)
+		assert.Len(t, scenario.States, 3)
+		assert.Len(t, scenario.Any, 2)
+	})
+
+	t.Run("returns scenario loaded from YAML file", func(t *testing.T) {
+		yamlScenario, err := LoadScenario("testdata/scenario/submission.yaml")
+		jsonScenario, _ := LoadScenario("testdata/scenario/submission.json")
+
+		assert.NoError(t, err)
+		assert.Equal(t, jsonScenario, yamlScenario)
+	})
+
+	t.Run("returns error when file does not exist", func(t *testing.T) {
+		scenario, err := LoadScenario("testdata/scenario/not_existing.json")
+
+		assert.Error(t, err)
+		assert.Nil(t, scenario)
+	})
+}
+
+func TestScenarioValidate(t *testing.T) {
+	t.Run("when scenario is valid", func(t *testing.T) {
+		assert.NoError(t, (&Scenario{States: map[string][]ScenarioStep{"start": {}}}).validate())
+	})
+
+	t.Run("when scenario has unknown matcher", func(t *testing.T) {
+		scenario := &Scenario{States: map[string][]ScenarioStep{"start": {{Matcher: "exact", Pattern: "QUIT"}}}}
+
+		assert.EqualError(t, scenario.validate(), fmt.Sprintf("%s: %q", ruleUnknownMatcherErrorMsg, "exact"))
+	})
+
+	t.Run("when scenario has unknown fault kind", func(t *testing.T) {
+		scenario := &Scenario{States: map[string][]ScenarioStep{"start": {{Fault: "timeout"}}}}
+
+		assert.EqualError(t, scenario.validate(), fmt.Sprintf("%s: %q", faultUnknownKindErrorMsg, "timeout"))
+	})
+}
+
+func TestNewScenario(t *testing.T) {
+	config := &ConfigurationAttr{SessionTimeout: 42, MsgGreeting: "220 Hi", MsgInvalidCmd: "502 No", ResponseDelayGreetingDuration: time.Second}
+
+	t.Run("returns nil when scenario is not defined", func(t *testing.T) {
+		scenario, err := newScenario(nil, config)
+
+		assert.NoError(t, err)
+		assert.Nil(t, scenario)
+	})
+
+	t.Run("returns compiled scenario with defaults", func(t *testing.T) {
+		scenario, err := newScenario(&Scenario{States: map[string][]ScenarioStep{"start": {{Pattern: "QUIT"}}}}, config)
+
+		assert.NoError(t, err)
+		assert.Equal(t, defaultScenarioInitialState, scenario.initialState)
+		assert.Equal(t, &scenarioStep{response: config.MsgGreeting, delay: config.ResponseDelayGreetingDuration}, scenario.greeting)
+		assert.Equal(t, config.MsgInvalidCmd, scenario.unmatchedResponse)
+		assert.Len(t, scenario.states["start"], 1)
+		assert.Empty(t, scenario.any)
+	})
+
+	t.Run("returns compiled scenario", func(t *testing.T) {
+		scenarioAttr := &Scenario{
+			InitialState: "greeted",
+			Greeting:     ScenarioStep{Response: "220 Ready", Delay: ScenarioDuration(time.Millisecond), Fault: FaultStall},
+			States: map[string][]ScenarioStep{
+				"greeted": {
+					{
+						Matcher:      RegexMatcher,
+						Pattern:      `(?i)^data$`,
+						Response:     "354 Go ahead",
+						Delay:        ScenarioDuration(time.Second),
+						Fault:        FaultByteByByte,
+						ByteDelay:    ScenarioDuration(time.Millisecond),
+						DataResponse: "250 Queued",
+						DataDelay:    ScenarioDuration(2 * time.Second),
+						Next:         "done",
+						End:          true,
+					},
+				},
+				"done": {},
+			},
+			Any:               []ScenarioStep{{Response: "250 Ok"}},
+			UnmatchedResponse: "500 Unexpected",
+		}
+		scenario, err := newScenario(scenarioAttr, config)
+		step := scenario.states["greeted"][0]
+
+		assert.NoError(t, err)
+		assert.Equal(t, "greeted", scenario.initialState)
+		assert.Equal(t, "220 Ready", scenario.greeting.response)
+		assert.Equal(t, time.Millisecond, scenario.greeting.delay)
+		assert.Equal(t, &fault{kind: FaultStall, stallDuration: 42 * time.Second}, scenario.greeting.fault)
+		assert.Equal(t, "500 Unexpected", scenario.unmatchedResponse)
+		assert.True(t, step.isMatched("DATA"))
+		assert.Equal(t, "354 Go ahead", step.response)
+		assert.Equal(t, time.Second, step.delay)
+		assert.Equal(t, &fault{kind: FaultByteByByte, byteDelay: time.Millisecond, stallDuration: 42 * time.Second}, step.fault)
+		assert.Equal(t, "250 Queued", step.dataResponse)
+		assert.Equal(t, 2*time.Second, step.dataDelay)
+		assert.Equal(t, "done", step.next)
+		assert.True(t, step.end)
+		assert.Nil(t, scenario.any[0].match)
+	})
+
+	t.Run("returns error when initial state is unknown", func(t *testing.T) {
+		scenario, err := newScenario(new(Scenario), config)
+
+		assert.Nil(t, scenario)
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", scenarioUnknownStateErrorMsg, defaultScenarioInitialState))
+	})
+
+	t.Run("returns error when next state of any step is unknown", func(t *testing.T) {
+		scenario, err := newScenario(&Scenario{States: map[string][]ScenarioStep{"start": {}}, Any: []ScenarioStep{{Next: "data"}}}, config)
+
+		assert.Nil(t, scenario)
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", scenarioUnknownStateErrorMsg, "data"))
+	})
+
+	t.Run("returns error when next state of state step is unknown", func(t *testing.T) {
+		scenario, err := newScenario(&Scenario{States: map[string][]ScenarioStep{"start": {{Next: "data"}}}}, config)
+
+		assert.Nil(t, scenario)
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", scenarioUnknownStateErrorMsg, "data"))
+	})
+
+	t.Run("returns error when greeting has unknown fault kind", func(t *testing.T) {
+		scenario, err := newScenario(&Scenario{Greeting: ScenarioStep{Fault: "timeout"}}, config)
+
+		assert.Nil(t, scenario)
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", faultUnknownKindErrorMsg, "timeout"))
+	})
+
+	t.Run("returns error when any step has unknown matcher", func(t *testing.T) {
+		scenario, err := newScenario(&Scenario{Any: []ScenarioStep{{Matcher: "exact", Pattern: "QUIT"}}}, config)
+
+		assert.Nil(t, scenario)
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", ruleUnknownMatcherErrorMsg, "exact"))
+	})
+
+	t.Run("returns error when state step has invalid regex pattern", func(t *testing.T) {
+		scenario, err := newScenario(&Scenario{States: map[string][]ScenarioStep{"start": {{Matcher: RegexMatcher, Pattern: "("}}}}, config)
+
+		assert.Nil(t, scenario)
+		assert.Error(t, err)
+	})
+}
+
+func TestScenarioMatch(t *testing.T) {
+	scenario, _ := newScenario(
+		&Scenario{
+			States: map[string][]ScenarioStep{
+				"start": {{Pattern: "EHLO *", Response: "250 Hi"}},
+				"mail":  {{Pattern: "MAIL FROM:*", Response: "250 Sender ok"}},
+			},
+			Any: []ScenarioStep{{Pattern: "NOOP", Response: "250 Ok"}},
+		},
+		new(ConfigurationAttr),
+	)
+
+	t.Run("returns the first matched step of the given state", func(t *testing.T) {
+		assert.Equal(t, scenario.states["start"][0], scenario.match("start", "ehlo example.com"))
+	})
+
+	t.Run("returns the first matched step of any state", func(t *testing.T) {
+		assert.Equal(t, scenario.any[0], scenario.match("mail", "NOOP"))
+	})
+
+	t.Run("returns nil when no step matched", func(t *testing.T) {
+		assert.Nil(t, scenario.match("mail", "EHLO example.com"))
+	})
+}
+
+func TestScenarioStepIsMatched(t *testing.T) {
+	t.Run("when step pattern is not specified", func(t *testing.T) {
+		assert.True(t, new(scenarioStep).isMatched("RSET"))
+	})
+
+	t.Run("when step pattern is specified", func(t *testing.T) {
+		step, err := newScenarioStep(ScenarioStep{Pattern: "rcpt to:<*@example.com>"}, 42)
+
+		assert.NoError(t, err)
+		assert.True(t, step.isMatched("RCPT TO:<user@example.com>"))
+		assert.False(t, step.isMatched("RCPT TO:<user@olo.com>"))
+	})
+}
@@ -0,0 +1,262 @@
+package smtpmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseScenarioYAML parses and validates YAML scenario with the same structure as JSON one.
+// Block style subset of YAML is supported: mappings, sequences, plain and quoted scalars and
+// comments. Flow collections, block scalars, anchors and tags are not supported. Returns
+// error for case when YAML is malformed or scenario is invalid
+func ParseScenarioYAML(data []byte) (*Scenario, error) {
+	document, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, _ := json.Marshal(document)
+	return ParseScenario(jsonData)
+}
+
+// Meaningful line of YAML document without comment and indentation
+type yamlLine struct {
+	number  int
+	indent  int
+	content string
+}
+
+// Parser of block style YAML subset
+type yamlParser struct {
+	lines    []yamlLine
+	position int
+}
+
+// Parses YAML document into maps, slices and scalars which can be marshaled to JSON. Returns
+// nil for case when document is empty. Returns error for case when YAML is malformed
+func parseYAML(data []byte) (interface{}, error) {
+	parser := new(yamlParser)
+	for index, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		content := strings.TrimRight(stripYAMLComment(line), " \t")
+		trimmedContent := strings.TrimLeft(content, " ")
+		if trimmedContent == emptyString || content == "---" {
+			continue
+		}
+
+		meaningfulLine := yamlLine{number: index + 1, indent: len(content) - len(trimmedContent), content: trimmedContent}
+		if strings.HasPrefix(trimmedContent, "\t") {
+			return nil, meaningfulLine.error()
+		}
+
+		parser.lines = append(parser.lines, meaningfulLine)
+	}
+
+	if len(parser.lines) == 0 {
+		return nil, nil
+	}
+
+	document, err := parser.parseNode(parser.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.position < len(parser.lines) {
+		return nil, parser.lines[parser.position].error()
+	}
+
+	return document, nil
+}
+
+// yamlParser methods
+
+// Parses sequence, mapping or scalar which starts from current line with the given indent
+func (parser *yamlParser) parseNode(indent int) (interface{}, error) {
+	line := parser.lines[parser.position]
+	if isYAMLSequenceItem(line.content) {
+		return parser.parseSequence(indent)
+	}
+
+	if _, _, found := splitYAMLKeyValue(line.content); found {
+		return parser.parseMapping(indent)
+	}
+
+	parser.position++
+	return line.scalar(line.content)
+}
+
+// Parses block sequence items with the given indent. Mapping item can start on the same
+// line with item indicator, e.g. "- pattern: QUIT"
+func (parser *yamlParser) parseSequence(indent int) (interface{}, error) {
+	sequence := []interface{}{}
+	for parser.position < len(parser.lines) {
+		line := parser.lines[parser.position]
+		if line.indent > indent {
+			return nil, line.error()
+		}
+
+		if line.indent < indent || !isYAMLSequenceItem(line.content) {
+			break
+		}
+
+		var item interface{}
+		var err error
+		if content := strings.TrimLeft(strings.TrimPrefix(line.content, "-"), " "); content == emptyString {
+			parser.position++
+			item, err = parser.parseNested(indent, false)
+		} else {
+			itemIndent := indent + len(line.content) - len(content)
+			parser.lines[parser.position] = yamlLine{number: line.number, indent: itemIndent, content: content}
+			item, err = parser.parseNode(itemIndent)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sequence = append(sequence, item)
+	}
+
+	return sequence, nil
+}
+
+// Parses block mapping entries with the given indent. Sequence value can have the same
+// indent as its key
+func (parser *yamlParser) parseMapping(indent int) (interface{}, error) {
+	mapping := make(map[string]interface{})
+	for parser.position < len(parser.lines) {
+		line := parser.lines[parser.position]
+		if line.indent > indent {
+			return nil, line.error()
+		}
+
+		if line.indent < indent || isYAMLSequenceItem(line.content) {
+			break
+		}
+
+		key, value, found := splitYAMLKeyValue(line.content)
+		if !found {
+			return nil, line.error()
+		}
+
+		parser.position++
+		var err error
+		if value == emptyString {
+			mapping[key], err = parser.parseNested(indent, true)
+		} else {
+			mapping[key], err = line.scalar(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mapping, nil
+}
+
+// Parses node nested into mapping entry or sequence item with the given indent. Returns nil
+// for case when there is no nested node
+func (parser *yamlParser) parseNested(indent int, isSequenceAllowed bool) (interface{}, error) {
+	if parser.position == len(parser.lines) {
+		return nil, nil
+	}
+
+	line := parser.lines[parser.position]
+	if line.indent > indent || (isSequenceAllowed && line.indent == indent && isYAMLSequenceItem(line.content)) {
+		return parser.parseNode(line.indent)
+	}
+
+	return nil, nil
+}
+
+// yamlLine methods
+
+// Returns value of the given scalar of line. Quoted scalar is string, plain scalar is
+// boolean, null, number or string. Returns error for case when scalar is malformed or
+// unsupported
+func (line yamlLine) scalar(scalar string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(scalar, `"`):
+		value, err := strconv.Unquote(scalar)
+		if err != nil {
+			return nil, line.error()
+		}
+
+		return value, nil
+	case strings.HasPrefix(scalar, "'"):
+		if len(scalar) < 2 || !strings.HasSuffix(scalar, "'") {
+			return nil, line.error()
+		}
+
+		return strings.ReplaceAll(scalar[1:len(scalar)-1], "''", "'"), nil
+	case strings.ContainsAny(scalar[:1], yamlUnsupportedIndicators):
+		return nil, line.error()
+	}
+
+	switch strings.ToLower(scalar) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null", "~":
+		return nil, nil
+	}
+
+	if regexp.MustCompile(yamlNumberRegexPattern).MatchString(scalar) {
+		return strconv.ParseFloat(scalar, 64)
+	}
+
+	return scalar, nil
+}
+
+// Returns error with line number and content
+func (line yamlLine) error() error {
+	return fmt.Errorf("%s: line %d: %q", scenarioInvalidYAMLErrorMsg, line.number, line.content)
+}
+
+// Returns true for case when line content is block sequence item, otherwise returns false
+func isYAMLSequenceItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// Splits mapping entry line content into key and value. Key can be quoted, value is empty
+// for case when entry has nested node. Returns false for case when content isn't mapping entry
+func splitYAMLKeyValue(content string) (string, string, bool) {
+	separator := strings.Index(content, ": ")
+	if separator == -1 && strings.HasSuffix(content, ":") {
+		separator = len(content) - 1
+	}
+	if separator < 1 {
+		return emptyString, emptyString, false
+	}
+
+	key := content[:separator]
+	if unquotedKey, err := strconv.Unquote(key); err == nil {
+		key = unquotedKey
+	}
+
+	return key, strings.TrimLeft(content[separator+1:], " "), true
+}
+
+// Returns line without comment. Comment starts with # at the beginning of line or after
+// whitespace outside of quoted scalar. Quoted scalar starts with quote after whitespace,
+// escaped single quote, i.e. two single quotes, closes and reopens single quoted scalar
+func stripYAMLComment(line string) string {
+	var quote rune
+	for index, char := range line {
+		isAfterSpace := index == 0 || line[index-1] == ' ' || line[index-1] == '\t'
+		switch {
+		case quote != 0:
+			if char == quote && (quote == '\'' || line[index-1] != '\\') {
+				quote = 0
+			}
+		case char == '#' && isAfterSpace:
+			return line[:index]
+		case (char == '"' || char == '\'') && isAfterSpace, char == '\'' && line[index-1] == '\'':
+			quote = char
+		}
+	}
+
+	return line
+}
@@ -0,0 +1,158 @@
+package smtpmock
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScenarioYAML(t *testing.T) {
+	t.Run("returns parsed scenario", func(t *testing.T) {
+		scenario, err := ParseScenarioYAML([]byte("states:\n  start:\n    - pattern: QUIT\n      response: 221 Bye\n      delay: 1\n      end: true\n"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, &Scenario{States: map[string][]ScenarioStep{"start": {{Pattern: "QUIT", Response: "221 Bye", Delay: ScenarioDuration(time.Second), End: true}}}}, scenario)
+	})
+
+	t.Run("returns error when YAML is malformed", func(t *testing.T) {
+		scenario, err := ParseScenarioYAML([]byte("states: {start: []}"))
+
+		assert.EqualError(t, err, fmt.Sprintf("%s: line 1: %q", scenarioInvalidYAMLErrorMsg, "states: {start: []}"))
+		assert.Nil(t, scenario)
+	})
+
+	t.Run("returns error when scenario is invalid", func(t *testing.T) {
+		scenario, err := ParseScenarioYAML([]byte("states:\n  start:\n    - next: data\n"))
+
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", scenarioUnknownStateErrorMsg, "data"))
+		assert.Nil(t, scenario)
+	})
+}
+
+func TestParseYAML(t *testing.T) {
+	t.Run("returns parsed document", func(t *testing.T) {
+		for data, document := range map[string]interface{}{
+			"":                                 nil,
+			"---\n# comment\n\n":               nil,
+			"key: value":                       map[string]interface{}{"key": "value"},
+			"\"quoted key\": 'it''s' # note\r": map[string]interface{}{"quoted key": "it's"},
+			"a:\n  b: 1\n  c:\nd: true":        map[string]interface{}{"a": map[string]interface{}{"b": 1.0, "c": nil}, "d": true},
+			"a:\n- 1\n- x\nb: ~":               map[string]interface{}{"a": []interface{}{1.0, "x"}, "b": nil},
+			"- a: 1\n  b: 2\n-\n  - c\n-":      []interface{}{map[string]interface{}{"a": 1.0, "b": 2.0}, []interface{}{"c"}, nil},
+			"- - a\n  - b":                     []interface{}{[]interface{}{"a", "b"}},
+			"  scalar":                         "scalar",
+		} {
+			parsedDocument, err := parseYAML([]byte(data))
+
+			assert.NoError(t, err)
+			assert.Equal(t, document, parsedDocument)
+		}
+	})
+
+	t.Run("returns error when YAML is malformed", func(t *testing.T) {
+		for data, line := range map[string]yamlLine{
+			"a:\n\tb: 1":        {number: 2, content: "\tb: 1"},
+			"a: 1\n  b: 2":      {number: 2, content: "b: 2"},
+			"- a\n  - b":        {number: 2, content: "- b"},
+			"a: 1\nb":           {number: 2, content: "b"},
+			"a: 1\n- b":         {number: 2, content: "- b"},
+			"scalar\nnext":      {number: 2, content: "next"},
+			"a: \"unterminated": {number: 1, content: "a: \"unterminated"},
+			"- a: [1]":          {number: 1, content: "a: [1]"},
+			"- - 'a":            {number: 1, content: "'a"},
+		} {
+			document, err := parseYAML([]byte(data))
+
+			assert.Nil(t, document)
+			assert.EqualError(t, err, line.error().Error())
+		}
+	})
+}
+
+func TestYAMLLineScalar(t *testing.T) {
+	line := yamlLine{number: 1, content: "key: value"}
+
+	t.Run("returns scalar value", func(t *testing.T) {
+		for scalar, value := range map[string]interface{}{
+			`"250 Ok\t"`: "250 Ok\t",
+			"'250 Ok'":   "250 Ok",
+			"True":       true,
+			"false":      false,
+			"null":       nil,
+			"-0.25":      -0.25,
+			"1e3":        1000.0,
+			"250 Ok":     "250 Ok",
+			"*@example":  "*@example",
+			"10ms":       "10ms",
+		} {
+			parsedValue, err := line.scalar(scalar)
+
+			assert.NoError(t, err)
+			assert.Equal(t, value, parsedValue)
+		}
+	})
+
+	t.Run("returns error when scalar is malformed or unsupported", func(t *testing.T) {
+		for _, scalar := range []string{`"250 Ok`, "'", "'250 Ok", "{a: 1}", "[1]", "|", "&anchor value", "!tag value"} {
+			value, err := line.scalar(scalar)
+
+			assert.Nil(t, value)
+			assert.EqualError(t, err, fmt.Sprintf("%s: line 1: %q", scenarioInvalidYAMLErrorMsg, "key: value"))
+		}
+	})
+}
+
+func TestIsYAMLSequenceItem(t *testing.T) {
+	t.Run("when content is sequence item", func(t *testing.T) {
+		assert.True(t, isYAMLSequenceItem("-"))
+		assert.True(t, isYAMLSequenceItem("- a"))
+	})
+
+	t.Run("when content is not sequence item", func(t *testing.T) {
+		assert.False(t, isYAMLSequenceItem("-a"))
+		assert.False(t, isYAMLSequenceItem("a"))
+	})
+}
+
+func TestSplitYAMLKeyValue(t *testing.T) {
+	t.Run("returns key and value of mapping entry", func(t *testing.T) {
+		for content, keyValue := range map[string][]string{
+			"pattern: MAIL FROM: *": {"pattern", "MAIL FROM: *"},
+			`"pattern":   QUIT`:     {"pattern", "QUIT"},
+			"states:":               {"states", emptyString},
+		} {
+			key, value, found := splitYAMLKeyValue(content)
+
+			assert.True(t, found)
+			assert.Equal(t, keyValue, []string{key, value})
+		}
+	})
+
+	t.Run("when content is not mapping entry", func(t *testing.T) {
+		for _, content := range []string{"MAIL FROM:*", ": value", "value"} {
+			key, value, found := splitYAMLKeyValue(content)
+
+			assert.False(t, found)
+			assert.Empty(t, key)
+			assert.Empty(t, value)
+		}
+	})
+}
+
+func TestStripYAMLComment(t *testing.T) {
+	t.Run("returns line without comment", func(t *testing.T) {
+		for line, strippedLine := range map[string]string{
+			"# comment":                        emptyString,
+			"key: value # comment":             "key: value ",
+			"key: value#not comment":           "key: value#not comment",
+			`key: "value # not comment" # yes`: `key: "value # not comment" `,
+			`key: "\" # not comment"`:          `key: "\" # not comment"`,
+			"key: 'it''s # not comment'":       "key: 'it''s # not comment'",
+			"key: it's # comment":              "key: it's ",
+		} {
+			assert.Equal(t, strippedLine, stripYAMLComment(line))
+		}
+	})
+}
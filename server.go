@@ -1,6 +1,7 @@
 package smtpmock
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -18,25 +19,40 @@ type waitGroup interface {
 
 // Server structure which implements SMTP mock server
 type Server struct {
-	configuration *configuration
-	messages      *messages
-	logger        Logger
-	listener      net.Listener
-	wg            waitGroup
-	quit          chan interface{}
-	started       bool
-	portNumber    int
-	quitTimeout   chan interface{}
+	configuration     *configuration
+	messages          *messages
+	transcripts       *transcripts
+	responseSequences *responseSequences
+	greylist          *greylist
+	limiter           *limiter
+	faultInjector     *faultInjector
+	jitter            *jitter
+	commandHandlers   map[string]CommandHandler
+	middlewares       []Middleware
+	logger            Logger
+	listener          net.Listener
+	wg                waitGroup
+	quit              chan interface{}
+	started           bool
+	portNumber        int
+	quitTimeout       chan interface{}
 	sync.Mutex
 }
 
 // SMTP mock server builder, creates new server
 func newServer(configuration *configuration) *Server {
 	return &Server{
-		configuration: configuration,
-		messages:      new(messages),
-		logger:        newLogger(configuration.logToStdout, configuration.logServerActivity),
-		wg:            new(sync.WaitGroup),
+		configuration:     configuration,
+		messages:          new(messages),
+		transcripts:       new(transcripts),
+		responseSequences: newResponseSequences(configuration.responseSequences),
+		greylist:          newGreylist(configuration.greylistingDelay),
+		limiter:           newLimiter(configuration),
+		faultInjector:     newFaultInjector(configuration),
+		jitter:            newJitter(configuration),
+		commandHandlers:   make(map[string]CommandHandler),
+		logger:            newLogger(configuration.logToStdout, configuration.logServerActivity),
+		wg:                new(sync.WaitGroup),
 	}
 }
 
@@ -47,6 +63,48 @@ func (server *Server) WithLogger(logger Logger) *Server {
 	return server
 }
 
+// Update atomically replaces server configuration with new configuration based on passed
+// configuration attributes. Each new session uses the latest configuration, active sessions
+// are finished with configuration of their start. Counters of sessions and attempts and
+// greylisted triplets are kept. Host address and port number are applied by the next Start,
+// logging options are applied by New only. Returns error and keeps current configuration
+// for case when configuration is invalid
+func (server *Server) Update(config ConfigurationAttr) error {
+	configuration, err := buildConfiguration(config)
+	if err != nil {
+		return err
+	}
+	faultInjector, jitter := newFaultInjector(configuration), newJitter(configuration)
+
+	server.Lock()
+	defer server.Unlock()
+	server.configuration = configuration
+	server.responseSequences.reconfigure(configuration.responseSequences)
+	server.greylist.reconfigure(configuration.greylistingDelay)
+	server.limiter.reconfigure(configuration)
+	server.faultInjector.reconfigure(faultInjector)
+	server.jitter.reconfigure(jitter)
+	return nil
+}
+
+// RegisterCommand registers custom handler of the given command verb, e.g. ETRN. Registered
+// handler adds new command or replaces the built-in handler of the same verb
+func (server *Server) RegisterCommand(verb string, commandHandler CommandHandler) *Server {
+	server.Lock()
+	defer server.Unlock()
+	server.commandHandlers[strings.ToUpper(verb)] = commandHandler
+	return server
+}
+
+// Use appends middlewares to chain which wraps each command handler run, the first middleware
+// is the outermost one
+func (server *Server) Use(middlewares ...Middleware) *Server {
+	server.Lock()
+	defer server.Unlock()
+	server.middlewares = append(server.middlewares, middlewares...)
+	return server
+}
+
 // server methods
 
 // Start binds and runs SMTP mock server on specified port or random free port. Returns error for
@@ -56,7 +114,7 @@ func (server *Server) Start() (err error) {
 		return errors.New(serverStartErrorMsg)
 	}
 
-	configuration, logger := server.configuration, server.logger
+	configuration, logger := server.currentConfiguration(), server.logger
 	portNumber := configuration.portNumber
 
 	listener, err := net.Listen(networkProtocol, serverWithPortNumber(configuration.hostAddress, portNumber))
@@ -85,9 +143,17 @@ func (server *Server) Start() (err error) {
 				return
 			}
 
+			isSessionAcquired := server.limiter.acquireSession(remoteHost(connection.RemoteAddr().String()))
+			session := newSession(connection, logger)
+			session.jitter = server.jitter
 			server.addToWaitGroup()
 			go func() {
-				server.handleSession(newSession(connection, logger))
+				if isSessionAcquired {
+					server.handleSession(session)
+					server.limiter.releaseSession()
+				} else {
+					server.refuseSession(session)
+				}
 				server.removeFromWaitGroup()
 			}()
 
@@ -114,7 +180,7 @@ func (server *Server) Stop() (err error) {
 
 		select {
 		case <-server.quitTimeout:
-		case <-time.After(time.Duration(server.configuration.shutdownTimeout) * time.Second):
+		case <-time.After(time.Duration(server.currentConfiguration().shutdownTimeout) * time.Second):
 			server.stop()
 			server.logger.InfoActivity(serverForceStopMsg)
 		}
@@ -151,6 +217,68 @@ func (server *Server) WaitForMessagesAndPurge(count int, timeout time.Duration)
 	return server.fetchMessages(count, timeout, true)
 }
 
+// FilterMessages returns slice with copy of server messages which match the given filter
+func (server *Server) FilterMessages(filter MessageFilter) []Message {
+	return server.messages.filter(filter)
+}
+
+// FilterMessagesAndPurge returns slice with copy of server messages which match the given
+// filter and at the same time removes them. Other messages are kept on the server
+func (server *Server) FilterMessagesAndPurge(filter MessageFilter) []Message {
+	return server.messages.purgeMatched(filter)
+}
+
+// Subscribe calls the given callback with copy of each message as soon as server stores it.
+// Callback is called from SMTP session goroutine, so it should not block for long.
+// Returns subscription, use Unsubscribe() to stop deliveries and wait for pending ones
+func (server *Server) Subscribe(callback func(Message)) *Subscription {
+	return server.messages.subscribe(newSubscription(server.messages, callback))
+}
+
+// SubscribeChannel sends copy of each message to the returned channel with the given buffer
+// size as soon as server stores it. Sending blocks SMTP session when buffer is full until message
+// is received or subscription is cancelled. Channel is not closed by Unsubscribe()
+func (server *Server) SubscribeChannel(bufferSize int) (<-chan Message, *Subscription) {
+	channel, subscription := make(chan Message, bufferSize), newSubscription(server.messages, nil)
+	subscription.callback = subscription.sendTo(channel)
+
+	return channel, server.messages.subscribe(subscription)
+}
+
+// Transcripts returns slice with copy of finished SMTP session transcripts. Transcripts are
+// kept independently of messages, purging of messages doesn't remove them
+func (server *Server) Transcripts() []Transcript {
+	return server.transcripts.copy()
+}
+
+// TranscriptsAndPurge returns slice with copy of finished SMTP session transcripts and at the
+// same time removes them. Session identifiers of new sessions keep increasing
+func (server *Server) TranscriptsAndPurge() []Transcript {
+	return server.transcripts.purge()
+}
+
+// Transcript returns finished SMTP session transcript by session identifier and true, see
+// Message.SessionID(). Returns false for case when transcript not found
+func (server *Server) Transcript(sessionID int) (Transcript, bool) {
+	return server.transcripts.find(sessionID)
+}
+
+// ResetResponseSequences erases counters of attempts, so all response sequences start over
+func (server *Server) ResetResponseSequences() {
+	server.responseSequences.reset()
+}
+
+// Greylist returns copy of greylisted (IP, sender, recipient) triplets in order of their
+// first attempt. Triplets are recorded for case when greylisting is enabled
+func (server *Server) Greylist() []GreylistEntry {
+	return server.greylist.copy()
+}
+
+// ResetGreylist erases all greylisted triplets, so each triplet is tempfailed again
+func (server *Server) ResetGreylist() {
+	server.greylist.reset()
+}
+
 // Thread-safe getter of server port.
 // Returns server.portNumber
 func (server *Server) PortNumber() int {
@@ -160,9 +288,15 @@ func (server *Server) PortNumber() int {
 }
 
 // fetchMessages fetches messages with timeout from the server with or without purging.
+// Messages are rechecked only when server stores new message.
 // Returns messages and an error if timeout occurs before receiving expected number of messages.
 func (server *Server) fetchMessages(count int, timeout time.Duration, withPurge bool) ([]Message, error) {
-	deadline := time.Now().Add(timeout)
+	stored, subscription := server.storeNotifications()
+	defer subscription.Unsubscribe()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
 	for {
 		messages := server.Messages()
 		messageCount := len(messages)
@@ -174,14 +308,77 @@ func (server *Server) fetchMessages(count int, timeout time.Duration, withPurge
 			return messages, nil
 		}
 
-		if time.Now().After(deadline) {
+		select {
+		case <-stored:
+		case <-deadline.C:
 			return messages, fmt.Errorf("timeout waiting for %d messages, got %d", count, messageCount)
 		}
+	}
+}
 
-		time.Sleep(1 * time.Millisecond)
+// WaitForSessions waits until all active sessions are finished, so messages of sessions
+// which client has already ended are stored. Returns an error for case when timeout is
+// reached before active sessions are finished
+func (server *Server) WaitForSessions(timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	select {
+	case <-server.limiter.idle():
+		return nil
+	case <-deadline.C:
+		return errors.New(serverWaitForSessionsErrorMsg)
 	}
 }
 
+// WaitFor waits for the first message which matches the given predicate, already stored
+// messages are checked too. Returns matched message or an error if context is done before
+// receiving matched message. MessageFilter.Match can be used as predicate
+func (server *Server) WaitFor(ctx context.Context, predicate func(Message) bool) (Message, error) {
+	return server.waitFor(ctx, predicate, false)
+}
+
+// WaitForAndPurge waits for the first message which matches the given predicate, already
+// stored messages are checked too. Returns matched message or an error if context is done
+// before receiving matched message. At the same time removes matched message from the server
+func (server *Server) WaitForAndPurge(ctx context.Context, predicate func(Message) bool) (Message, error) {
+	return server.waitFor(ctx, predicate, true)
+}
+
+// waitFor waits for message which matches predicate with or without purging. Messages are
+// rechecked only when server stores new message. Returns matched message or an error if
+// context is done before receiving matched message
+func (server *Server) waitFor(ctx context.Context, predicate func(Message) bool, withPurge bool) (Message, error) {
+	stored, subscription := server.storeNotifications()
+	defer subscription.Unsubscribe()
+
+	for {
+		if message, found := server.messages.find(predicate, withPurge); found {
+			return message, nil
+		}
+
+		select {
+		case <-stored:
+		case <-ctx.Done():
+			return Message{}, fmt.Errorf("%s: %w", serverWaitForMessageErrorMsg, ctx.Err())
+		}
+	}
+}
+
+// Subscribes to stored messages. Returns channel which receives signal when server stores
+// new message, signals which were not received yet are coalesced into one
+func (server *Server) storeNotifications() (<-chan interface{}, *Subscription) {
+	stored := make(chan interface{}, 1)
+	subscription := server.Subscribe(func(Message) {
+		select {
+		case stored <- true:
+		default:
+		}
+	})
+
+	return stored, subscription
+}
+
 // Thread-safe getter to check if server has been started.
 // Returns server.started
 func (server *Server) isStarted() bool {
@@ -224,13 +421,37 @@ func (server *Server) newMessageWithHeloContext(otherMessage *Message) *Message
 	newMessage.heloRequest = otherMessage.heloRequest
 	newMessage.heloResponse = otherMessage.heloResponse
 	newMessage.helo = otherMessage.helo
+	newMessage.sessionID = otherMessage.sessionID
 	server.messages.append(otherMessage)
 	return newMessage
 }
 
-// Invalid SMTP command predicate. Returns true when command is invalid, otherwise returns false
+// Invalid SMTP command predicate. Returns true when command is neither implemented nor
+// registered, otherwise returns false
 func (server *Server) isInvalidCmd(request string) bool {
-	return !matchRegex(request, availableCmdsRegexPattern)
+	return server.commandHandler(server.recognizeCommand(request)) == nil && !matchRegex(request, availableCmdsRegexPattern)
+}
+
+// Thread-safe getter of registered command handler. Returns nil for case when handler of the
+// given command is not registered
+func (server *Server) commandHandler(command string) CommandHandler {
+	server.Lock()
+	defer server.Unlock()
+	return server.commandHandlers[command]
+}
+
+// Thread-safe getter of the latest server configuration
+func (server *Server) currentConfiguration() *configuration {
+	server.Lock()
+	defer server.Unlock()
+	return server.configuration
+}
+
+// Thread-safe getter of middleware chain
+func (server *Server) middlewareChain() []Middleware {
+	server.Lock()
+	defer server.Unlock()
+	return server.middlewares
 }
 
 // Recognizes command implemented commands. Captures the first word divided by spaces,
@@ -250,23 +471,59 @@ func (server *Server) removeFromWaitGroup() {
 	server.wg.Done()
 }
 
-// Checks ability to end current session
-func (server *Server) isAbleToEndSession(message *Message, session sessionInterface) bool {
-	return message.quitSent || (session.isErrorFound() && server.configuration.isCmdFailFast)
+// Checks ability to end current session. Failed command ends session for case when fail fast
+// scenario is enabled or failed response requires end of session, e.g. rule with fail fast
+// flag or 421 rate limit response
+func (server *Server) isAbleToEndSession(message *Message, session sessionInterface, configuration *configuration) bool {
+	return message.quitSent || (session.isErrorFound() && (configuration.isCmdFailFast || message.failFast))
+}
+
+// Picks fault triggered by the given command and request, injects it into session. Returns
+// injected fault or nil for case when no fault was triggered
+func (server *Server) injectFault(session sessionInterface, command FaultCommand, request string) *fault {
+	fault := server.faultInjector.pick(command, request)
+	if fault != nil {
+		session.injectFault(fault)
+	}
+
+	return fault
+}
+
+// Writes sessions limit response instead of greeting and ends session
+func (server *Server) refuseSession(session sessionInterface) {
+	defer session.finish()
+	sessionID := server.transcripts.nextSessionID()
+	session.writeResponse(server.currentConfiguration().msgSessionLimit, defaultSessionResponseDelay)
+	server.transcripts.append(session.transcript(sessionID, SessionClosedByLimit))
 }
 
 //nolint:gocyclo // SMTP client-server session handler
 func (server *Server) handleSession(session sessionInterface) {
+	configuration := server.currentConfiguration()
+	if configuration.scenario != nil {
+		server.handleScenarioSession(session, configuration)
+		return
+	}
+
 	defer session.finish()
-	message, configuration := new(Message), server.configuration
+	sessionID := server.transcripts.nextSessionID()
+	message, closeReason := &Message{sessionID: sessionID}, SessionClosedByReadError
 	defer func() {
+		server.transcripts.append(session.transcript(sessionID, closeReason))
 		server.messages.append(message)
 	}()
-	session.writeResponse(configuration.msgGreeting, defaultSessionResponseDelay)
+
+	fault := server.injectFault(session, FaultGreeting, emptyString)
+	session.writeResponse(configuration.msgGreeting, configuration.responseDelayGreeting)
+	if fault.isTerminating() {
+		closeReason = SessionClosedByFault
+		return
+	}
 
 	for {
 		select {
 		case <-server.quit:
+			closeReason = SessionClosedByShutdown
 			return
 		default:
 			session.setTimeout(configuration.sessionTimeout)
@@ -280,30 +537,176 @@ func (server *Server) handleSession(session sessionInterface) {
 				continue
 			}
 
-			switch server.recognizeCommand(request) {
-			case "HELO", "EHLO":
-				newHandlerHelo(session, message, configuration).run(request)
-			case "MAIL":
-				if configuration.multipleMessageReceiving && message.rset && message.IsConsistent() {
-					message = server.newMessageWithHeloContext(message)
+			command := server.recognizeCommand(request)
+			fault := server.injectFault(session, faultCommand(command), request)
+
+			var isEnded bool
+			message, isEnded = server.runHandler(session, message, configuration, command, request)
+			if fault.isTerminating() {
+				closeReason = SessionClosedByFault
+				return
+			}
+
+			if isEnded {
+				closeReason = SessionClosedByHandler
+				return
+			}
+
+			if server.isAbleToEndSession(message, session, configuration) {
+				closeReason = SessionClosedByFailFast
+				if message.quitSent {
+					closeReason = SessionClosedByQuit
 				}
 
-				newHandlerMailfrom(session, message, configuration).run(request)
-			case "RCPT":
-				newHandlerRcptto(session, message, configuration).run(request)
-			case "DATA":
-				newHandlerData(session, message, configuration).run(request)
-			case "RSET":
-				newHandlerRset(session, message, configuration).run(request)
-			case "NOOP":
-				newHandlerNoop(session, message, configuration).run(request)
-			case "QUIT":
-				newHandlerQuit(session, message, configuration).run(request)
+				return
+			}
+		}
+	}
+}
+
+// Runs registered command handler or built-in handler of the given command wrapped with
+// middleware chain. Returns current session message and true for case when command handler
+// or middleware ended session, otherwise false
+func (server *Server) runHandler(session sessionInterface, message *Message, configuration *configuration, command, request string) (*Message, bool) {
+	commandHandler, middlewares := server.commandHandler(command), server.middlewareChain()
+	if commandHandler == nil && len(middlewares) == 0 {
+		return server.runBuiltinHandler(session, message, configuration, command, request), false
+	}
+
+	context := newCommandContext(session, message, configuration, command, request)
+	middlewareSession := newMiddlewareSession(session, context)
+	context.session = middlewareSession
+	run := func() {
+		if commandHandler == nil {
+			context.Message = server.runBuiltinHandler(middlewareSession, context.Message, configuration, command, request)
+			return
+		}
+
+		commandHandler.Handle(context)
+	}
+	for index := len(middlewares) - 1; index >= 0; index-- {
+		middleware, next := middlewares[index], run
+		run = func() { middleware(context, next) }
+	}
+
+	run()
+	middlewareSession.flush()
+	return context.Message, context.isEnded
+}
+
+// Runs built-in handler of the given command. Returns current session message
+func (server *Server) runBuiltinHandler(session sessionInterface, message *Message, configuration *configuration, command, request string) *Message {
+	switch command {
+	case "HELO", "EHLO":
+		handler := newHandlerHelo(session, message, configuration)
+		handler.responseSequences = server.responseSequences
+		handler.run(request)
+	case "MAIL":
+		if configuration.multipleMessageReceiving && message.rset && message.IsConsistent() {
+			message = server.newMessageWithHeloContext(message)
+		}
+
+		handler := newHandlerMailfrom(session, message, configuration)
+		handler.responseSequences, handler.limiter = server.responseSequences, server.limiter
+		handler.run(request)
+	case "RCPT":
+		handler := newHandlerRcptto(session, message, configuration)
+		handler.responseSequences, handler.greylist = server.responseSequences, server.greylist
+		handler.limiter = server.limiter
+		handler.run(request)
+	case "DATA":
+		newHandlerData(session, message, configuration).run(request)
+	case "RSET":
+		newHandlerRset(session, message, configuration).run(request)
+	case "NOOP":
+		newHandlerNoop(session, message, configuration).run(request)
+	case "QUIT":
+		newHandlerQuit(session, message, configuration).run(request)
+	}
+
+	return message
+}
+
+// Scripted SMTP client-server session handler. Follows configured scenario state machine
+// instead of the built-in session flow
+func (server *Server) handleScenarioSession(session sessionInterface, configuration *configuration) {
+	defer session.finish()
+	sessionID := server.transcripts.nextSessionID()
+	message, closeReason, scenario := &Message{sessionID: sessionID}, SessionClosedByReadError, configuration.scenario
+	defer func() {
+		server.transcripts.append(session.transcript(sessionID, closeReason))
+		server.messages.append(message)
+	}()
+
+	if server.writeScenarioStep(session, scenario.greeting) {
+		closeReason = SessionClosedByFault
+		return
+	}
+
+	for state := scenario.initialState; ; {
+		select {
+		case <-server.quit:
+			closeReason = SessionClosedByShutdown
+			return
+		default:
+			session.setTimeout(configuration.sessionTimeout)
+			request, err := session.readRequest()
+			if err != nil {
+				return
+			}
+
+			step := scenario.match(state, request)
+			if step == nil {
+				session.writeResponse(scenario.unmatchedResponse, defaultSessionResponseDelay)
+				continue
+			}
+
+			message = server.runScenarioStep(session, message, configuration, step, request)
+			if step.fault.isTerminating() {
+				closeReason = SessionClosedByFault
+				return
 			}
 
-			if server.isAbleToEndSession(message, session) {
+			if step.end {
+				closeReason = SessionClosedByScenario
+				if message.quitSent {
+					closeReason = SessionClosedByQuit
+				}
+
 				return
 			}
+
+			if step.next != emptyString {
+				state = step.next
+			}
 		}
 	}
 }
+
+// Runs scenario step for the given request: saves request and response into message, writes
+// step response and reads message body for case when step has data response. Returns current
+// session message
+func (server *Server) runScenarioStep(session sessionInterface, message *Message, configuration *configuration, step *scenarioStep, request string) *Message {
+	command := server.recognizeCommand(request)
+	if command == "MAIL" && configuration.multipleMessageReceiving && message.rset && message.IsConsistent() {
+		message = server.newMessageWithHeloContext(message)
+	}
+
+	message.record(command, request, step.response)
+	if !server.writeScenarioStep(session, step) && step.dataResponse != emptyString {
+		receiveMessage(session, message, configuration, step.dataResponse, step.dataDelay)
+	}
+
+	return message
+}
+
+// Writes scenario step response with step fault. Returns true for case when step fault ends
+// session, otherwise returns false
+func (server *Server) writeScenarioStep(session sessionInterface, step *scenarioStep) bool {
+	if step.fault != nil {
+		session.injectFault(step.fault)
+	}
+
+	session.writeResponse(step.response, step.delay)
+	return step.fault.isTerminating()
+}
@@ -1,6 +1,7 @@
 package smtpmock
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -18,6 +19,13 @@ func TestNewServer(t *testing.T) {
 
 		assert.Same(t, configuration, server.configuration)
 		assert.Equal(t, new(messages), server.messages)
+		assert.Equal(t, new(transcripts), server.transcripts)
+		assert.Equal(t, newResponseSequences(configuration.responseSequences), server.responseSequences)
+		assert.Equal(t, newGreylist(configuration.greylistingDelay), server.greylist)
+		assert.Equal(t, newLimiter(configuration), server.limiter)
+		assert.Equal(t, configuration.faults, server.faultInjector.faults)
+		assert.NotNil(t, server.faultInjector.random)
+		assert.Equal(t, configuration.responseDelayJitter, server.jitter.amount)
 		assert.Equal(t, newLogger(configuration.logToStdout, configuration.logServerActivity), server.logger)
 		assert.Nil(t, server.listener)
 		assert.NotNil(t, server.wg)
@@ -202,6 +210,29 @@ func TestServerWaitForMessages(t *testing.T) {
 	})
 }
 
+func TestServerWaitForSessions(t *testing.T) {
+	timeout := 1 * time.Millisecond
+
+	t.Run("when there are no active sessions", func(t *testing.T) {
+		assert.NoError(t, newServer(createConfiguration()).WaitForSessions(timeout))
+	})
+
+	t.Run("when active sessions are finished before timeout", func(t *testing.T) {
+		server := newServer(createConfiguration())
+		server.limiter.acquireSession("127.0.0.1")
+		go server.limiter.releaseSession()
+
+		assert.NoError(t, server.WaitForSessions(time.Second))
+	})
+
+	t.Run("when timeout occurs before active sessions are finished", func(t *testing.T) {
+		server := newServer(createConfiguration())
+		server.limiter.acquireSession("127.0.0.1")
+
+		assert.EqualError(t, server.WaitForSessions(timeout), serverWaitForSessionsErrorMsg)
+	})
+}
+
 func TestServerMessagesAndPurge(t *testing.T) {
 	t.Run("returns empty messages after purge", func(t *testing.T) {
 		server, message := newServer(createConfiguration()), new(Message)
@@ -235,6 +266,242 @@ func TestServerWaitForMessagesAndPurge(t *testing.T) {
 	})
 }
 
+func TestServerFilterMessages(t *testing.T) {
+	t.Run("returns matched messages without purging", func(t *testing.T) {
+		server, message := newServer(createConfiguration()), &Message{mailfrom: true, rcptto: true, data: true, msg: true}
+		server.messages.append(message)
+		server.messages.append(new(Message))
+
+		assert.Equal(t, []Message{*message}, server.FilterMessages(MessageFilter{Consistency: ConsistentMessages}))
+		assert.Len(t, server.Messages(), 2)
+	})
+}
+
+func TestServerFilterMessagesAndPurge(t *testing.T) {
+	t.Run("returns matched messages and removes them from the server", func(t *testing.T) {
+		server, message, otherMessage := newServer(createConfiguration()), &Message{mailfrom: true, rcptto: true, data: true, msg: true}, new(Message)
+		server.messages.append(message)
+		server.messages.append(otherMessage)
+
+		assert.Equal(t, []Message{*message}, server.FilterMessagesAndPurge(MessageFilter{Consistency: ConsistentMessages}))
+		assert.Equal(t, []Message{*otherMessage}, server.Messages())
+	})
+}
+
+func TestServerSubscribe(t *testing.T) {
+	t.Run("calls callback with each stored message until unsubscribed", func(t *testing.T) {
+		var deliveredMessages []Message
+		server, message := newServer(createConfiguration()), &Message{heloRequest: "some context"}
+		subscription := server.Subscribe(func(message Message) {
+			deliveredMessages = append(deliveredMessages, message)
+		})
+		server.messages.append(message)
+		subscription.Unsubscribe()
+		server.messages.append(new(Message))
+
+		assert.Equal(t, []Message{*message}, deliveredMessages)
+	})
+}
+
+func TestServerSubscribeChannel(t *testing.T) {
+	t.Run("sends each stored message to channel until unsubscribed", func(t *testing.T) {
+		server, message := newServer(createConfiguration()), &Message{heloRequest: "some context"}
+		channel, subscription := server.SubscribeChannel(1)
+		server.messages.append(message)
+		subscription.Unsubscribe()
+		server.messages.append(new(Message))
+
+		assert.Equal(t, *message, <-channel)
+		assert.Empty(t, channel)
+	})
+
+	t.Run("unblocks session when subscription is cancelled", func(t *testing.T) {
+		server, done := newServer(createConfiguration()), make(chan interface{})
+		_, subscription := server.SubscribeChannel(0)
+		go func() {
+			defer close(done)
+			server.messages.append(new(Message))
+		}()
+		subscription.Unsubscribe()
+		<-done
+
+		assert.Len(t, server.Messages(), 1)
+	})
+}
+
+func TestServerWaitFor(t *testing.T) {
+	predicate := func(message Message) bool { return message.heloRequest == "matched" }
+
+	t.Run("when matched message is already stored", func(t *testing.T) {
+		server, message := newServer(createConfiguration()), &Message{heloRequest: "matched"}
+		server.messages.append(message)
+		foundMessage, err := server.WaitFor(context.Background(), predicate)
+
+		assert.Equal(t, *message, foundMessage)
+		assert.NoError(t, err)
+		assert.Len(t, server.Messages(), 1)
+	})
+
+	t.Run("when matched message is received after waiting", func(t *testing.T) {
+		server, message := newServer(createConfiguration()), &Message{heloRequest: "matched"}
+		go func() {
+			server.messages.append(new(Message))
+			server.messages.append(message)
+		}()
+		foundMessage, err := server.WaitFor(context.Background(), predicate)
+
+		assert.Equal(t, *message, foundMessage)
+		assert.NoError(t, err)
+		assert.Empty(t, server.messages.subscriptions)
+	})
+
+	t.Run("when context is done before receiving matched message", func(t *testing.T) {
+		server := newServer(createConfiguration())
+		server.messages.append(new(Message))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		foundMessage, err := server.WaitFor(ctx, predicate)
+
+		assert.Equal(t, Message{}, foundMessage)
+		assert.EqualError(t, err, serverWaitForMessageErrorMsg+": "+context.Canceled.Error())
+		assert.True(t, errors.Is(err, context.Canceled))
+	})
+}
+
+func TestServerWaitForAndPurge(t *testing.T) {
+	predicate := func(message Message) bool { return message.heloRequest == "matched" }
+
+	t.Run("when matched message is received", func(t *testing.T) {
+		server, message, otherMessage := newServer(createConfiguration()), &Message{heloRequest: "matched"}, new(Message)
+		server.messages.append(otherMessage)
+		go server.messages.append(message)
+		foundMessage, err := server.WaitForAndPurge(context.Background(), predicate)
+
+		assert.Equal(t, *message, foundMessage)
+		assert.NoError(t, err)
+		assert.Equal(t, []Message{*otherMessage}, server.Messages())
+	})
+
+	t.Run("when predicate accesses server messages", func(t *testing.T) {
+		server, message := newServer(createConfiguration()), &Message{heloRequest: "matched"}
+		server.messages.append(message)
+		foundMessage, err := server.WaitForAndPurge(
+			context.Background(),
+			func(message Message) bool { return len(server.Messages()) == 1 && predicate(message) },
+		)
+
+		assert.Equal(t, *message, foundMessage)
+		assert.NoError(t, err)
+		assert.Empty(t, server.Messages())
+	})
+
+	t.Run("when context is done before receiving matched message", func(t *testing.T) {
+		server := newServer(createConfiguration())
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		_, err := server.WaitForAndPurge(ctx, predicate)
+
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+}
+
+func TestServerStoreNotifications(t *testing.T) {
+	t.Run("coalesces signals about stored messages", func(t *testing.T) {
+		server := newServer(createConfiguration())
+		stored, subscription := server.storeNotifications()
+		server.messages.append(new(Message))
+		server.messages.append(new(Message))
+		subscription.Unsubscribe()
+
+		assert.Len(t, stored, 1)
+	})
+}
+
+func TestServerTranscripts(t *testing.T) {
+	t.Run("returns copy of finished session transcripts", func(t *testing.T) {
+		server, transcript := newServer(createConfiguration()), Transcript{SessionID: 1}
+		server.transcripts.append(transcript)
+
+		assert.Equal(t, []Transcript{transcript}, server.Transcripts())
+	})
+
+	t.Run("records transcript of each finished session linked to its messages", func(t *testing.T) {
+		server := newServer(createConfiguration())
+		assert.NoError(t, server.Start())
+		defer server.Stop()
+
+		assert.NoError(t, runSuccessfulSMTPSession("127.0.0.1", server.PortNumber(), false, 0))
+		message, err := server.WaitFor(context.Background(), func(Message) bool { return true })
+		assert.NoError(t, err)
+		transcript, found := server.Transcript(message.SessionID())
+
+		assert.True(t, found)
+		assert.Equal(t, SessionClosedByQuit, transcript.CloseReason)
+		assert.NotEmpty(t, transcript.RemoteAddress)
+		assert.Equal(
+			t,
+			"S: 220 Welcome\nC: EHLO olo.com\nS: 250 Received\nC: QUIT\nS: 221 Closing connection",
+			transcript.String(),
+		)
+	})
+}
+
+func TestServerTranscriptsAndPurge(t *testing.T) {
+	t.Run("returns copy of finished session transcripts and removes them, keeps messages", func(t *testing.T) {
+		server, transcript := newServer(createConfiguration()), Transcript{SessionID: 1}
+		server.transcripts.append(transcript)
+		server.messages.append(&Message{sessionID: 1})
+
+		assert.Equal(t, []Transcript{transcript}, server.TranscriptsAndPurge())
+		assert.Empty(t, server.Transcripts())
+		assert.NotEmpty(t, server.Messages())
+	})
+}
+
+func TestServerTranscript(t *testing.T) {
+	t.Run("returns session transcript by session identifier", func(t *testing.T) {
+		server, transcript := newServer(createConfiguration()), Transcript{SessionID: 1}
+		server.transcripts.append(transcript)
+		foundTranscript, found := server.Transcript(1)
+
+		assert.True(t, found)
+		assert.Equal(t, transcript, foundTranscript)
+	})
+}
+
+func TestServerResetResponseSequences(t *testing.T) {
+	t.Run("erases counters of attempts", func(t *testing.T) {
+		server := newServer(newConfiguration(ConfigurationAttr{ResponseSequences: []ResponseSequence{{Responses: []string{"451 Try again later"}}}}))
+		_, _ = server.responseSequences.next(RuleRcptto, "user@example.com")
+		server.ResetResponseSequences()
+		response, found := server.responseSequences.next(RuleRcptto, "user@example.com")
+
+		assert.True(t, found)
+		assert.Equal(t, "451 Try again later", response)
+	})
+}
+
+func TestServerGreylist(t *testing.T) {
+	t.Run("returns copy of greylisted triplets", func(t *testing.T) {
+		server := newServer(createConfiguration())
+		server.greylist.isPassed("127.0.0.1", "sender@example.com", "user@example.com")
+		entries := server.Greylist()
+
+		assert.Len(t, entries, 1)
+		assert.Equal(t, "user@example.com", entries[0].Recipient)
+	})
+}
+
+func TestServerResetGreylist(t *testing.T) {
+	t.Run("erases greylisted triplets", func(t *testing.T) {
+		server := newServer(createConfiguration())
+		server.greylist.isPassed("127.0.0.1", "sender@example.com", "user@example.com")
+		server.ResetGreylist()
+
+		assert.Empty(t, server.Greylist())
+	})
+}
+
 func TestServerPortNumber(t *testing.T) {
 	t.Run("returns server port number", func(t *testing.T) {
 		portNumber := 2525
@@ -267,6 +534,28 @@ func TestServerFetchMessages(t *testing.T) {
 		assert.Empty(t, server.Messages())
 	})
 
+	t.Run("when expected number of messages is received after waiting", func(t *testing.T) {
+		server, message := newServer(createConfiguration()), new(Message)
+		go func() {
+			time.Sleep(timeout)
+			server.messages.append(message)
+		}()
+		messages, err := server.fetchMessages(1, time.Second, false)
+
+		assert.Equal(t, []Message{*message}, messages)
+		assert.NoError(t, err)
+		assert.Empty(t, server.messages.subscriptions)
+	})
+
+	t.Run("when not enough messages are received before timeout", func(t *testing.T) {
+		server := newServer(createConfiguration())
+		go server.messages.append(new(Message))
+		messages, err := server.fetchMessages(2, 100*timeout, false)
+
+		assert.EqualError(t, err, fmt.Sprintf("timeout waiting for %d messages, got %d", 2, 1))
+		assert.Len(t, messages, 1)
+	})
+
 	t.Run("when timeout occurs before receiving expected number of messages", func(t *testing.T) {
 		server := newServer(createConfiguration())
 		messages, err := server.fetchMessages(1, timeout, false)
@@ -325,7 +614,7 @@ func TestServerNewMessageWithHeloContext(t *testing.T) {
 	t.Run("pushes new message into server.messages with helo context from other message, returns this message", func(t *testing.T) {
 		server := &Server{messages: new(messages)}
 		message, heloRequest, heloResponse, helo := new(Message), "heloRequest", "heloResponse", true
-		message.heloRequest, message.heloResponse, message.helo = heloRequest, heloResponse, helo
+		message.heloRequest, message.heloResponse, message.helo, message.sessionID = heloRequest, heloResponse, helo, 42
 		newMessage := server.newMessageWithHeloContext(message)
 
 		server.messages.RLock()
@@ -333,7 +622,8 @@ func TestServerNewMessageWithHeloContext(t *testing.T) {
 		assert.Equal(t, heloRequest, newMessage.heloRequest)
 		assert.Equal(t, heloResponse, newMessage.heloResponse)
 		assert.Equal(t, helo, newMessage.helo)
-		assert.Equal(t, newMessage, messages[0])
+		assert.Equal(t, message.sessionID, newMessage.sessionID)
+		assert.Same(t, message, messages[0])
 		assert.Equal(t, 1, len(messages))
 		server.messages.RUnlock()
 	})
@@ -351,6 +641,81 @@ func TestServerIsInvalidCmd(t *testing.T) {
 	t.Run("when invalid command", func(t *testing.T) {
 		assert.True(t, server.isInvalidCmd("some invalid command"))
 	})
+
+	t.Run("when registered command", func(t *testing.T) {
+		server := newServer(createConfiguration()).RegisterCommand("etrn", CommandHandlerFunc(func(*CommandContext) {}))
+
+		assert.False(t, server.isInvalidCmd("ETRN example.com"))
+	})
+}
+
+func TestServerUpdate(t *testing.T) {
+	t.Run("replaces configuration and reconfigures shared state", func(t *testing.T) {
+		server := newServer(createConfiguration())
+		server.limiter.acquireSession("127.0.0.1")
+		config := ConfigurationAttr{
+			BlacklistedHeloDomains:      []string{"example.com"},
+			ResponseSequences:           []ResponseSequence{{Responses: []string{"451 Try again later"}}},
+			GreylistingDelay:            42,
+			MaxSessions:                 1,
+			Faults:                      []Fault{{Kind: FaultReset}},
+			ResponseDelayJitterDuration: time.Second,
+		}
+
+		assert.NoError(t, server.Update(config))
+		assert.Equal(t, newConfiguration(config).blacklistedHeloDomains, server.configuration.blacklistedHeloDomains)
+		assert.Equal(t, config.ResponseSequences, server.responseSequences.sequences)
+		assert.Equal(t, 42*time.Second, server.greylist.delay)
+		assert.Equal(t, 1, server.limiter.maxSessions)
+		assert.Equal(t, 1, server.limiter.activeSessions)
+		assert.Len(t, server.faultInjector.faults, 1)
+		assert.Equal(t, time.Second, server.jitter.amount)
+	})
+
+	t.Run("returns error when configuration is invalid, keeps current configuration", func(t *testing.T) {
+		configuration := createConfiguration()
+		server := newServer(configuration)
+		faults, random := server.faultInjector.faults, server.jitter.random
+
+		assert.EqualError(
+			t,
+			server.Update(ConfigurationAttr{Faults: []Fault{{Kind: FaultReset}}, JitterDistribution: "poisson"}),
+			fmt.Sprintf("%s: %q", jitterUnknownDistributionErrorMsg, "poisson"),
+		)
+		assert.Same(t, configuration, server.configuration)
+		assert.Equal(t, faults, server.faultInjector.faults)
+		assert.Same(t, random, server.jitter.random)
+	})
+}
+
+func TestServerCurrentConfiguration(t *testing.T) {
+	t.Run("returns the latest server configuration", func(t *testing.T) {
+		server := newServer(createConfiguration())
+		assert.NoError(t, server.Update(ConfigurationAttr{MsgGreeting: "220 Updated"}))
+
+		assert.Equal(t, "220 Updated", server.currentConfiguration().msgGreeting)
+	})
+}
+
+func TestServerRegisterCommand(t *testing.T) {
+	t.Run("registers command handler of upper cased verb, returns server", func(t *testing.T) {
+		server, commandHandler := newServer(createConfiguration()), CommandHandlerFunc(func(*CommandContext) {})
+
+		assert.Same(t, server, server.RegisterCommand("etrn", commandHandler))
+		assert.NotNil(t, server.commandHandlers["ETRN"])
+	})
+}
+
+func TestServerCommandHandler(t *testing.T) {
+	server := newServer(createConfiguration()).RegisterCommand("XCLIENT", CommandHandlerFunc(func(*CommandContext) {}))
+
+	t.Run("returns registered command handler", func(t *testing.T) {
+		assert.NotNil(t, server.commandHandler("XCLIENT"))
+	})
+
+	t.Run("returns nil when command handler is not registered", func(t *testing.T) {
+		assert.Nil(t, server.commandHandler("ETRN"))
+	})
 }
 
 func TestServerRecognizeCommand(t *testing.T) {
@@ -382,12 +747,47 @@ func TestServerRemoveFromWaitGroup(t *testing.T) {
 	})
 }
 
+func TestServerInjectFault(t *testing.T) {
+	t.Run("injects triggered fault into session", func(t *testing.T) {
+		session := new(sessionMock)
+		server := newServer(newConfiguration(ConfigurationAttr{Faults: []Fault{{Commands: []FaultCommand{FaultQuit}, Kind: FaultReset}}}))
+		fault := server.faultInjector.faults[0]
+		session.On("injectFault", fault).Once().Return(nil)
+
+		assert.Same(t, fault, server.injectFault(session, FaultQuit, "QUIT"))
+		assert.True(t, session.AssertExpectations(t))
+	})
+
+	t.Run("does not inject fault when no fault was triggered", func(t *testing.T) {
+		session := new(sessionMock)
+
+		assert.Nil(t, newServer(createConfiguration()).injectFault(session, FaultQuit, "QUIT"))
+		session.AssertNotCalled(t, "injectFault")
+	})
+}
+
+func TestServerRefuseSession(t *testing.T) {
+	t.Run("writes sessions limit response instead of greeting, records transcript and ends session", func(t *testing.T) {
+		session, configuration := new(sessionMock), createConfiguration()
+		server := newServer(configuration)
+		transcript := Transcript{SessionID: 1, CloseReason: SessionClosedByLimit}
+		session.On("writeResponse", configuration.msgSessionLimit, defaultSessionResponseDelay).Once().Return(nil)
+		session.On("transcript", 1, SessionClosedByLimit).Once().Return(transcript)
+		session.On("finish").Once().Return(nil)
+		server.refuseSession(session)
+
+		assert.True(t, session.AssertExpectations(t))
+		assert.Equal(t, []Transcript{transcript}, server.Transcripts())
+		assert.Empty(t, server.Messages())
+	})
+}
+
 func TestServerIsAbleToEndSession(t *testing.T) {
 	t.Run("when quit command has been sent", func(t *testing.T) {
 		server, message, session := newServer(createConfiguration()), &Message{quitSent: true}, new(session)
 		server.messages.append(message)
 
-		assert.True(t, server.isAbleToEndSession(message, session))
+		assert.True(t, server.isAbleToEndSession(message, session, server.configuration))
 	})
 
 	t.Run("when quit command has not been sent, error has been found, fail fast scenario has been enabled", func(t *testing.T) {
@@ -396,14 +796,22 @@ func TestServerIsAbleToEndSession(t *testing.T) {
 		session.err = errors.New("some error")
 		server.configuration.isCmdFailFast = true
 
-		assert.True(t, server.isAbleToEndSession(message, session))
+		assert.True(t, server.isAbleToEndSession(message, session, server.configuration))
+	})
+
+	t.Run("when quit command has not been sent, error has been found, rule fail fast has been requested", func(t *testing.T) {
+		server, message, session := newServer(createConfiguration()), &Message{failFast: true}, new(session)
+		server.messages.append(message)
+		session.err = errors.New("some error")
+
+		assert.True(t, server.isAbleToEndSession(message, session, server.configuration))
 	})
 
 	t.Run("when quit command has not been sent, no errors", func(t *testing.T) {
 		server, message, session := newServer(createConfiguration()), new(Message), new(session)
 		server.messages.append(message)
 
-		assert.False(t, server.isAbleToEndSession(message, session))
+		assert.False(t, server.isAbleToEndSession(message, session, server.configuration))
 	})
 
 	t.Run("when quit command has not been sent, error has been found, fail fast scenario has not been enabled", func(t *testing.T) {
@@ -411,7 +819,7 @@ func TestServerIsAbleToEndSession(t *testing.T) {
 		server.messages.append(message)
 		session.err = errors.New("some error")
 
-		assert.False(t, server.isAbleToEndSession(message, session))
+		assert.False(t, server.isAbleToEndSession(message, session, server.configuration))
 	})
 }
 
@@ -473,10 +881,13 @@ func TestServerHandleSession(t *testing.T) {
 		session.On("writeResponse", configuration.msgQuitCmd, configuration.responseDelayQuit).Once().Return(nil)
 		session.On("isErrorFound").Once().Return(false)
 
+		session.On("transcript", 1, SessionClosedByQuit).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByQuit})
 		session.On("finish").Once().Return(nil)
 
 		server.handleSession(session)
 		assert.Equal(t, 1, len(server.Messages()))
+		assert.Equal(t, 1, server.Messages()[0].SessionID())
+		assert.Equal(t, []Transcript{{SessionID: 1, CloseReason: SessionClosedByQuit}}, server.Transcripts())
 	})
 
 	t.Run("when complex successful session, multiple message receiving scenario enabled", func(t *testing.T) {
@@ -559,10 +970,13 @@ func TestServerHandleSession(t *testing.T) {
 		session.On("writeResponse", configuration.msgQuitCmd, configuration.responseDelayQuit).Once().Return(nil)
 		session.On("isErrorFound").Once().Return(false)
 
+		session.On("transcript", 1, SessionClosedByQuit).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByQuit})
 		session.On("finish").Once().Return(nil)
 
 		server.handleSession(session)
 		assert.Equal(t, 2, len(server.Messages()))
+		assert.Equal(t, 1, server.Messages()[0].SessionID())
+		assert.Equal(t, 1, server.Messages()[1].SessionID())
 	})
 
 	t.Run("when invalid command, fail fast scenario disabled", func(*testing.T) {
@@ -579,6 +993,7 @@ func TestServerHandleSession(t *testing.T) {
 		session.On("readRequest").Once().Return("quit", nil)
 		session.On("writeResponse", configuration.msgQuitCmd, configuration.responseDelayQuit).Once().Return(nil)
 
+		session.On("transcript", 1, SessionClosedByQuit).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByQuit})
 		session.On("finish").Once().Return(nil)
 
 		server.handleSession(session)
@@ -601,6 +1016,7 @@ func TestServerHandleSession(t *testing.T) {
 		session.On("writeResponse", errorMessage, defaultSessionResponseDelay).Once().Return(nil)
 
 		session.On("isErrorFound").Once().Return(true)
+		session.On("transcript", 1, SessionClosedByFailFast).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByFailFast})
 		session.On("finish").Once().Return(nil)
 
 		server.handleSession(session)
@@ -613,6 +1029,7 @@ func TestServerHandleSession(t *testing.T) {
 		close(server.quit)
 
 		session.On("writeResponse", configuration.msgGreeting, defaultSessionResponseDelay).Once().Return(nil)
+		session.On("transcript", 1, SessionClosedByShutdown).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByShutdown})
 		session.On("finish").Once().Return(nil)
 
 		server.handleSession(session)
@@ -625,8 +1042,359 @@ func TestServerHandleSession(t *testing.T) {
 		session.On("writeResponse", configuration.msgGreeting, defaultSessionResponseDelay).Once().Return(nil)
 		session.On("setTimeout", defaultSessionTimeout).Once().Return(nil)
 		session.On("readRequest").Once().Return(emptyString, errors.New("some read request error"))
+		session.On("transcript", 1, SessionClosedByReadError).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByReadError})
 		session.On("finish").Once().Return(nil)
 
 		server.handleSession(session)
 	})
+	t.Run("when greeting fault ends session", func(t *testing.T) {
+		session := &sessionMock{}
+		configuration := newConfiguration(ConfigurationAttr{Faults: []Fault{{Commands: []FaultCommand{FaultGreeting}, Kind: FaultStall}}})
+		server := newServer(configuration)
+
+		session.On("injectFault", configuration.faults[0]).Once().Return(nil)
+		session.On("writeResponse", configuration.msgGreeting, defaultSessionResponseDelay).Once().Return(nil)
+		session.On("transcript", 1, SessionClosedByFault).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByFault})
+		session.On("finish").Once().Return(nil)
+
+		server.handleSession(session)
+		assert.True(t, session.AssertExpectations(t))
+		assert.Equal(t, SessionClosedByFault, server.Transcripts()[0].CloseReason)
+	})
+
+	t.Run("when command fault ends session", func(t *testing.T) {
+		session := &sessionMock{}
+		configuration := newConfiguration(
+			ConfigurationAttr{
+				Faults: []Fault{
+					{Commands: []FaultCommand{FaultHelo}, Kind: FaultByteByByte},
+					{Commands: []FaultCommand{FaultNoop}, Kind: FaultDropConnection},
+				},
+			},
+		)
+		server := newServer(configuration)
+
+		session.On("writeResponse", configuration.msgGreeting, defaultSessionResponseDelay).Once().Return(nil)
+
+		session.On("setTimeout", defaultSessionTimeout).Once().Return(nil)
+		session.On("readRequest").Once().Return("ehlo example.com", nil)
+		session.On("injectFault", configuration.faults[0]).Once().Return(nil)
+		session.On("clearError").Once().Return(nil)
+		session.On("writeResponse", configuration.msgHeloReceived, configuration.responseDelayHelo).Once().Return(nil)
+		session.On("isErrorFound").Once().Return(false)
+
+		session.On("setTimeout", defaultSessionTimeout).Once().Return(nil)
+		session.On("readRequest").Once().Return("noop", nil)
+		session.On("injectFault", configuration.faults[1]).Once().Return(nil)
+		session.On("writeResponse", configuration.msgNoopReceived, configuration.responseDelayNoop).Once().Return(nil)
+
+		session.On("transcript", 1, SessionClosedByFault).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByFault})
+		session.On("finish").Once().Return(nil)
+
+		server.handleSession(session)
+		assert.True(t, session.AssertExpectations(t))
+		assert.Equal(t, 1, len(server.Messages()))
+	})
+
+	t.Run("when command handler ends session", func(t *testing.T) {
+		session, configuration := &sessionMock{}, createConfiguration()
+		server := newServer(configuration).RegisterCommand("XQUIT", CommandHandlerFunc(func(context *CommandContext) {
+			context.WriteResponse("221 Custom bye", defaultSessionResponseDelay)
+			context.EndSession()
+		}))
+
+		session.On("writeResponse", configuration.msgGreeting, defaultSessionResponseDelay).Once().Return(nil)
+		session.On("setTimeout", configuration.sessionTimeout).Once().Return(nil)
+		session.On("readRequest").Once().Return("xquit", nil)
+		session.On("clearError").Once().Return(nil)
+		session.On("remoteAddress").Once().Return("127.0.0.1:2525")
+		session.On("writeResponse", "221 Custom bye", defaultSessionResponseDelay).Once().Return(nil)
+		session.On("transcript", 1, SessionClosedByHandler).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByHandler})
+		session.On("finish").Once().Return(nil)
+
+		server.handleSession(session)
+		assert.True(t, session.AssertExpectations(t))
+		assert.Equal(t, SessionClosedByHandler, server.Transcripts()[0].CloseReason)
+	})
+}
+
+func TestServerUse(t *testing.T) {
+	t.Run("appends middlewares to chain, returns server", func(t *testing.T) {
+		server, middleware := newServer(createConfiguration()), Middleware(func(_ *CommandContext, next func()) { next() })
+
+		assert.Same(t, server, server.Use(middleware))
+		assert.Same(t, server, server.Use(middleware, middleware))
+		assert.Len(t, server.middlewares, 3)
+	})
+}
+
+func TestServerMiddlewareChain(t *testing.T) {
+	t.Run("returns middleware chain", func(t *testing.T) {
+		server := newServer(createConfiguration())
+		assert.Empty(t, server.middlewareChain())
+
+		server.Use(func(_ *CommandContext, next func()) { next() })
+		assert.Len(t, server.middlewareChain(), 1)
+	})
+}
+
+func TestServerRunHandler(t *testing.T) {
+	t.Run("runs registered command handler", func(t *testing.T) {
+		session, message, configuration := &sessionMock{}, &Message{sessionID: 42}, createConfiguration()
+		server := newServer(configuration)
+		var commandContext *CommandContext
+		server.RegisterCommand("ETRN", CommandHandlerFunc(func(context *CommandContext) {
+			commandContext = context
+			context.WriteResponse("250 Queuing started", defaultSessionResponseDelay)
+			context.EndSession()
+		}))
+
+		session.On("clearError").Once().Return(nil)
+		session.On("remoteAddress").Once().Return("127.0.0.1:2525")
+		session.On("writeResponse", "250 Queuing started", defaultSessionResponseDelay).Once().Return(nil)
+
+		currentMessage, isEnded := server.runHandler(session, message, server.configuration, "ETRN", "ETRN example.com")
+		assert.True(t, session.AssertExpectations(t))
+		assert.Same(t, message, currentMessage)
+		assert.True(t, isEnded)
+		assert.Equal(t, "ETRN example.com", commandContext.Request)
+		assert.Equal(t, 42, commandContext.SessionID)
+		assert.Equal(t, [][]string{{"ETRN example.com", "250 Queuing started"}}, message.CustomRequestResponse())
+	})
+
+	t.Run("runs registered command handler instead of built-in handler", func(t *testing.T) {
+		session, message, configuration := &sessionMock{}, new(Message), createConfiguration()
+		server := newServer(configuration).RegisterCommand("NOOP", CommandHandlerFunc(func(context *CommandContext) {
+			context.WriteResponse("250 Custom noop", defaultSessionResponseDelay)
+		}))
+
+		session.On("clearError").Once().Return(nil)
+		session.On("remoteAddress").Once().Return("127.0.0.1:2525")
+		session.On("writeResponse", "250 Custom noop", defaultSessionResponseDelay).Once().Return(nil)
+
+		_, isEnded := server.runHandler(session, message, server.configuration, "NOOP", "NOOP")
+		assert.True(t, session.AssertExpectations(t))
+		assert.False(t, isEnded)
+		assert.True(t, message.Noop())
+	})
+
+	t.Run("runs middleware chain around built-in handler, writes changed response", func(t *testing.T) {
+		session, message, configuration := &sessionMock{}, new(Message), createConfiguration()
+		var calls []string
+		server := newServer(configuration).Use(
+			func(context *CommandContext, next func()) {
+				calls = append(calls, "outer "+context.Request)
+				next()
+				calls = append(calls, "outer "+context.Response)
+				context.Response = "554 Changed"
+			},
+			func(context *CommandContext, next func()) {
+				calls = append(calls, "inner "+context.Command)
+				next()
+				calls = append(calls, "inner "+context.Response)
+			},
+		)
+
+		session.On("remoteAddress").Once().Return("127.0.0.1:2525")
+		session.On("clearError").Once().Return(nil)
+		session.On("addError", errors.New("554 Changed")).Once().Return(nil)
+		session.On("writeResponse", "554 Changed", configuration.responseDelayNoop).Once().Return(nil)
+
+		currentMessage, isEnded := server.runHandler(session, message, server.configuration, "NOOP", "noop")
+		assert.True(t, session.AssertExpectations(t))
+		assert.Same(t, message, currentMessage)
+		assert.False(t, isEnded)
+		assert.True(t, message.Noop())
+		assert.Equal(t, []string{"outer noop", "inner NOOP", "inner " + configuration.msgNoopReceived, "outer " + configuration.msgNoopReceived}, calls)
+	})
+
+	t.Run("returns new message created by built-in handler within middleware chain", func(t *testing.T) {
+		session, configuration := &sessionMock{}, createConfiguration()
+		configuration.multipleMessageReceiving = true
+		message := &Message{heloRequest: "HELO example.com", helo: true, mailfrom: true, rcptto: true, data: true, msg: true, rset: true}
+		server := newServer(configuration).Use(func(_ *CommandContext, next func()) { next() })
+
+		session.On("remoteAddress").Once().Return("127.0.0.1:2525")
+		session.On("clearError").Twice().Return(nil)
+		session.On("writeResponse", configuration.msgMailfromReceived, configuration.responseDelayMailfrom).Once().Return(nil)
+
+		currentMessage, _ := server.runHandler(session, message, server.configuration, "MAIL", "MAIL FROM:<user@example.com>")
+		assert.True(t, session.AssertExpectations(t))
+		assert.NotSame(t, message, currentMessage)
+		assert.Equal(t, "HELO example.com", currentMessage.HeloRequest())
+		assert.Equal(t, "MAIL FROM:<user@example.com>", currentMessage.MailfromRequest())
+	})
+
+	t.Run("when middleware skips handler and ends session", func(t *testing.T) {
+		session, message, configuration := &sessionMock{}, new(Message), createConfiguration()
+		server := newServer(configuration).Use(func(context *CommandContext, _ func()) {
+			context.WriteResponse("421 Aborted", defaultSessionResponseDelay)
+			context.EndSession()
+		})
+
+		session.On("remoteAddress").Once().Return("127.0.0.1:2525")
+		session.On("clearError").Once().Return(nil)
+		session.On("addError", errors.New("421 Aborted")).Twice().Return(nil)
+		session.On("writeResponse", "421 Aborted", defaultSessionResponseDelay).Once().Return(nil)
+
+		_, isEnded := server.runHandler(session, message, server.configuration, "RSET", "rset")
+		assert.True(t, session.AssertExpectations(t))
+		assert.True(t, isEnded)
+		assert.Equal(t, "421 Aborted", message.RsetResponse())
+		assert.False(t, message.Rset())
+	})
+
+	t.Run("runs built-in handler", func(t *testing.T) {
+		session, message, configuration := &sessionMock{}, new(Message), createConfiguration()
+		server := newServer(configuration)
+
+		session.On("writeResponse", configuration.msgNoopReceived, configuration.responseDelayNoop).Once().Return(nil)
+
+		_, isEnded := server.runHandler(session, message, server.configuration, "NOOP", "NOOP")
+		assert.True(t, session.AssertExpectations(t))
+		assert.False(t, isEnded)
+		assert.True(t, message.Noop())
+	})
+}
+
+func TestServerHandleScenarioSession(t *testing.T) {
+	scenario := &Scenario{
+		Greeting:          ScenarioStep{Response: "220 Ready"},
+		UnmatchedResponse: "500 Unexpected",
+		States: map[string][]ScenarioStep{
+			"start": {{Pattern: "EHLO *", Response: "250 Hi", Next: "mail"}},
+			"mail":  {{Pattern: "MAIL FROM:*", Response: "250 Sender ok", Next: "rcpt"}},
+			"rcpt": {
+				{Pattern: "RCPT TO:*", Response: "250 Recipient ok"},
+				{Pattern: "DATA", Response: "354 Go ahead", DataResponse: "250 Queued", DataDelay: ScenarioDuration(time.Second), Next: "sent"},
+			},
+			"sent": {{Pattern: "RSET", Response: "250 Reset", Next: "mail"}},
+		},
+		Any: []ScenarioStep{{Pattern: "QUIT", Response: "221 Bye", End: true}},
+	}
+
+	t.Run("when scripted session with multiple messages, follows scenario states", func(t *testing.T) {
+		session := &sessionMock{}
+		configuration := newConfiguration(ConfigurationAttr{Scenario: scenario, MultipleMessageReceiving: true})
+		server := newServer(configuration)
+
+		session.On("writeResponse", "220 Ready", defaultSessionResponseDelay).Once().Return(nil)
+		for _, requestResponse := range [][]string{
+			{"MAIL FROM:<user@example.com>", "500 Unexpected"},
+			{"EHLO example.com", "250 Hi"},
+			{"MAIL FROM:<user@example.com>", "250 Sender ok"},
+			{"RCPT TO:<user@olo.com>", "250 Recipient ok"},
+			{"DATA", "354 Go ahead"},
+			{"RSET", "250 Reset"},
+			{"MAIL FROM:<user@example.com>", "250 Sender ok"},
+			{"QUIT", "221 Bye"},
+		} {
+			session.On("setTimeout", defaultSessionTimeout).Once().Return(nil)
+			session.On("readRequest").Once().Return(requestResponse[0], nil)
+			session.On("writeResponse", requestResponse[1], defaultSessionResponseDelay).Once().Return(nil)
+		}
+		session.On("readBytes").Once().Return([]uint8("Message body\r\n"), nil)
+		session.On("readBytes").Once().Return([]uint8(".\r\n"), nil)
+		session.On("writeResponse", "250 Queued", time.Second).Once().Return(nil)
+		session.On("transcript", 1, SessionClosedByQuit).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByQuit})
+		session.On("finish").Once().Return(nil)
+
+		server.handleSession(session)
+		assert.True(t, session.AssertExpectations(t))
+		messages := server.Messages()
+		assert.Equal(t, 2, len(messages))
+		assert.True(t, messages[0].IsConsistent())
+		assert.Equal(t, "Message body\r\n", messages[0].MsgRequest())
+		assert.Equal(t, "250 Queued", messages[0].MsgResponse())
+		assert.Equal(t, "EHLO example.com", messages[1].HeloRequest())
+		assert.True(t, messages[1].Mailfrom())
+		assert.True(t, messages[1].QuitSent())
+	})
+
+	t.Run("when scenario step ends session", func(t *testing.T) {
+		session := &sessionMock{}
+		configuration := newConfiguration(
+			ConfigurationAttr{Scenario: &Scenario{States: map[string][]ScenarioStep{"start": {{Response: "421 Bye", End: true}}}}},
+		)
+		server := newServer(configuration)
+
+		session.On("writeResponse", configuration.msgGreeting, defaultSessionResponseDelay).Once().Return(nil)
+		session.On("setTimeout", defaultSessionTimeout).Once().Return(nil)
+		session.On("readRequest").Once().Return("EHLO example.com", nil)
+		session.On("writeResponse", "421 Bye", defaultSessionResponseDelay).Once().Return(nil)
+		session.On("transcript", 1, SessionClosedByScenario).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByScenario})
+		session.On("finish").Once().Return(nil)
+
+		server.handleScenarioSession(session, server.configuration)
+		assert.True(t, session.AssertExpectations(t))
+	})
+
+	t.Run("when server quit channel was closed", func(t *testing.T) {
+		session, configuration := &sessionMock{}, newConfiguration(ConfigurationAttr{Scenario: scenario})
+		server := newServer(configuration)
+		server.quit = make(chan interface{})
+		close(server.quit)
+
+		session.On("writeResponse", "220 Ready", defaultSessionResponseDelay).Once().Return(nil)
+		session.On("transcript", 1, SessionClosedByShutdown).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByShutdown})
+		session.On("finish").Once().Return(nil)
+
+		server.handleScenarioSession(session, server.configuration)
+		assert.True(t, session.AssertExpectations(t))
+	})
+
+	t.Run("when read request session error", func(t *testing.T) {
+		session, configuration := &sessionMock{}, newConfiguration(ConfigurationAttr{Scenario: scenario})
+		server := newServer(configuration)
+
+		session.On("writeResponse", "220 Ready", defaultSessionResponseDelay).Once().Return(nil)
+		session.On("setTimeout", defaultSessionTimeout).Once().Return(nil)
+		session.On("readRequest").Once().Return(emptyString, errors.New("some read request error"))
+		session.On("transcript", 1, SessionClosedByReadError).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByReadError})
+		session.On("finish").Once().Return(nil)
+
+		server.handleScenarioSession(session, server.configuration)
+		assert.True(t, session.AssertExpectations(t))
+	})
+
+	t.Run("when greeting fault ends session", func(t *testing.T) {
+		session := &sessionMock{}
+		configuration := newConfiguration(
+			ConfigurationAttr{Scenario: &Scenario{Greeting: ScenarioStep{Fault: FaultReset}, States: map[string][]ScenarioStep{"start": {}}}},
+		)
+		server := newServer(configuration)
+
+		session.On("injectFault", configuration.scenario.greeting.fault).Once().Return(nil)
+		session.On("writeResponse", configuration.msgGreeting, defaultSessionResponseDelay).Once().Return(nil)
+		session.On("transcript", 1, SessionClosedByFault).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByFault})
+		session.On("finish").Once().Return(nil)
+
+		server.handleScenarioSession(session, server.configuration)
+		assert.True(t, session.AssertExpectations(t))
+	})
+
+	t.Run("when step fault ends session, skips message body", func(t *testing.T) {
+		session := &sessionMock{}
+		configuration := newConfiguration(
+			ConfigurationAttr{
+				Scenario: &Scenario{
+					States: map[string][]ScenarioStep{"start": {{Response: "354 Go ahead", Fault: FaultDropConnection, DataResponse: "250 Queued"}}},
+				},
+			},
+		)
+		server := newServer(configuration)
+		step := configuration.scenario.states["start"][0]
+
+		session.On("writeResponse", configuration.msgGreeting, defaultSessionResponseDelay).Once().Return(nil)
+		session.On("setTimeout", defaultSessionTimeout).Once().Return(nil)
+		session.On("readRequest").Once().Return("DATA", nil)
+		session.On("injectFault", step.fault).Once().Return(nil)
+		session.On("writeResponse", "354 Go ahead", defaultSessionResponseDelay).Once().Return(nil)
+		session.On("transcript", 1, SessionClosedByFault).Once().Return(Transcript{SessionID: 1, CloseReason: SessionClosedByFault})
+		session.On("finish").Once().Return(nil)
+
+		server.handleScenarioSession(session, server.configuration)
+		assert.True(t, session.AssertExpectations(t))
+		assert.Equal(t, "DATA", server.Messages()[0].DataRequest())
+	})
 }
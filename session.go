@@ -12,21 +12,25 @@ import (
 var timeNow = func() time.Time { return time.Now() }
 
 // Allows to stub time.Sleep()
-var timeSleep = func(delay int) int {
-	time.Sleep(time.Duration(delay) * time.Second)
-	return int(delay)
+var timeSleep = func(delay time.Duration) time.Duration {
+	time.Sleep(delay)
+	return delay
 }
 
 // SMTP client-server session interface
 type sessionInterface interface {
 	setTimeout(int)
 	readRequest() (string, error)
-	writeResponse(string, int)
+	writeResponse(string, time.Duration)
 	addError(error)
 	clearError()
 	discardBufin()
 	readBytes() ([]byte, error)
 	isErrorFound() bool
+	remoteAddress() string
+	logWarning(string)
+	transcript(int, SessionCloseReason) Transcript
+	injectFault(*fault)
 	finish()
 }
 
@@ -44,6 +48,10 @@ type bufout interface {
 	Flush() error
 }
 
+type lingerer interface {
+	SetLinger(int) error
+}
+
 // SMTP client-server session
 type session struct {
 	connection net.Conn
@@ -52,6 +60,11 @@ type session struct {
 	bufout     bufout
 	err        error
 	logger     Logger
+	startedAt  time.Time
+	entries    []TranscriptEntry
+	jitter     *jitter
+	fault      *fault
+	aborted    bool
 }
 
 // SMTP session builder. Creates new session
@@ -62,6 +75,7 @@ func newSession(connection net.Conn, logger Logger) *session {
 		bufin:      bufio.NewReader(connection),
 		bufout:     bufio.NewWriter(connection),
 		logger:     logger,
+		startedAt:  timeNow(),
 	}
 }
 
@@ -82,6 +96,16 @@ func (session *session) clearError() {
 	session.err = nil
 }
 
+// Returns session remote address
+func (session *session) remoteAddress() string {
+	return session.address
+}
+
+// Triggers logger with warning level
+func (session *session) logWarning(message string) {
+	session.logger.Warning(message)
+}
+
 // Sets session timeout from now to the specified duration in seconds
 func (session *session) setTimeout(timeout int) {
 	err := session.connection.SetDeadline(
@@ -111,6 +135,7 @@ func (session *session) readRequest() (string, error) {
 	request, err := session.bufin.ReadString('\n')
 	if err == nil {
 		trimmedRequest := strings.TrimSpace(request)
+		session.record(ClientRequest, trimmedRequest)
 		session.logger.InfoActivity(sessionRequestMsg + trimmedRequest)
 		return trimmedRequest, err
 	}
@@ -126,6 +151,7 @@ func (session *session) readBytes() ([]byte, error) {
 	var request []byte
 	request, err := session.bufin.ReadBytes('\n')
 	if err == nil {
+		session.record(ClientRequest, strings.TrimRight(string(request), "\r\n"))
 		session.logger.InfoActivity(sessionRequestMsg + sessionBinaryDataMsg)
 		return request, err
 	}
@@ -135,34 +161,115 @@ func (session *session) readBytes() ([]byte, error) {
 	return request, err
 }
 
-// Activates session response delay for case when delay > 0.
+// Activates session response delay with session jitter for case when delay > 0.
 // Otherwise skipes this feature
-func (session *session) responseDelay(delay int) int {
-	if delay == defaultSessionResponseDelay {
+func (session *session) responseDelay(delay time.Duration) time.Duration {
+	if delay = session.jitter.apply(delay); delay == defaultSessionResponseDelay {
 		return delay
 	}
 
-	session.logger.InfoActivity(fmt.Sprintf("%s: %d sec", sessionResponseDelayMsg, delay))
+	session.logger.InfoActivity(fmt.Sprintf("%s: %s", sessionResponseDelayMsg, delay))
 	return timeSleep(delay)
 }
 
-// Writes server response to the client session. When error case happened triggers
-// logger with warning level
-func (session *session) writeResponse(response string, responseDelay int) {
+// Writes server response to the client session. Injected fault is applied to the response
+// and erased. When error case happened triggers logger with warning level
+func (session *session) writeResponse(response string, responseDelay time.Duration) {
 	session.responseDelay(responseDelay)
+	fault := session.fault
+	session.fault = nil
+
+	switch {
+	case fault != nil && fault.kind == FaultHalfReply:
+		response = response[:len(response)/2]
+		session.write(response)
+	case fault != nil && fault.kind == FaultByteByByte:
+		for _, char := range []byte(response + "\r\n") {
+			session.write(string(char))
+			timeSleep(fault.byteDelay)
+		}
+	default:
+		session.write(response + "\r\n")
+	}
+
+	session.record(ServerResponse, response)
+	session.logger.InfoActivity(sessionResponseMsg + response)
+	if fault != nil {
+		session.logger.InfoActivity(fmt.Sprintf("%s: %s", sessionFaultMsg, fault.kind))
+	}
+	if fault.isTerminating() {
+		session.abort(fault)
+	}
+}
+
+// Writes and flushes data to the client session. When error case happened triggers
+// logger with warning level
+func (session *session) write(data string) {
 	bufout := session.bufout
-	if _, err := bufout.WriteString(response + "\r\n"); err != nil {
+	if _, err := bufout.WriteString(data); err != nil {
 		session.logger.Warning(err.Error())
 	}
 	bufout.Flush()
-	session.logger.InfoActivity(sessionResponseMsg + response)
 }
 
-// Finishes SMTP session. When error case happened triggers logger with warning level
-func (session *session) finish() {
+// Injects fault which is applied to the next server response
+func (session *session) injectFault(fault *fault) {
+	session.fault = fault
+}
+
+// Closes session connection after terminating fault. Stall fault holds connection during
+// stall duration before, reset fault sends TCP RST instead of clean close. When error case
+// happened triggers logger with warning level
+func (session *session) abort(fault *fault) {
+	switch fault.kind {
+	case FaultStall:
+		timeSleep(fault.stallDuration)
+	case FaultReset:
+		if connection, ok := session.connection.(lingerer); ok {
+			if err := connection.SetLinger(0); err != nil {
+				session.logger.Warning(err.Error())
+			}
+		}
+	}
+
+	session.aborted = true
 	if err := session.connection.Close(); err != nil {
 		session.logger.Warning(err.Error())
 	}
+}
+
+// Adds line to session transcript
+func (session *session) record(direction TranscriptDirection, line string) {
+	session.entries = append(session.entries, TranscriptEntry{Direction: direction, Line: line, Time: timeNow()})
+}
+
+// Returns session transcript with the given session identifier and close reason. Session error
+// is included for fail fast and read error close reasons only
+func (session *session) transcript(sessionID int, closeReason SessionCloseReason) Transcript {
+	transcript := Transcript{
+		SessionID:     sessionID,
+		RemoteAddress: session.address,
+		StartedAt:     session.startedAt,
+		FinishedAt:    timeNow(),
+		CloseReason:   closeReason,
+		Entries:       session.entries,
+	}
+
+	if closeReason == SessionClosedByFailFast || closeReason == SessionClosedByReadError {
+		transcript.CloseError = session.err
+	}
+
+	return transcript
+}
+
+// Finishes SMTP session, connection is closed for case when it was not aborted by fault.
+// When error case happened triggers logger with warning level
+func (session *session) finish() {
+	if !session.aborted {
+		if err := session.connection.Close(); err != nil {
+			session.logger.Warning(err.Error())
+		}
+	}
 
 	session.logger.InfoActivity(sessionEndMsg)
 }
@@ -20,7 +20,7 @@ func TestTimeNow(t *testing.T) {
 
 func TestTimeSleep(t *testing.T) {
 	t.Run("wrappes time.Sleep() in function, returns delay", func(t *testing.T) {
-		delay := 0
+		delay := time.Duration(0)
 
 		assert.Equal(t, delay, timeSleep(delay))
 	})
@@ -56,6 +56,26 @@ func TestSessionClearError(t *testing.T) {
 	})
 }
 
+func TestSessionRemoteAddress(t *testing.T) {
+	t.Run("returns session remote address", func(t *testing.T) {
+		address := "127.0.0.1:25"
+		session := &session{address: address}
+
+		assert.Equal(t, address, session.remoteAddress())
+	})
+}
+
+func TestSessionLogWarning(t *testing.T) {
+	t.Run("triggers logger with warning level", func(t *testing.T) {
+		logger, message := new(loggerMock), "some warning"
+		session := &session{logger: logger}
+		logger.On("Warning", message).Once().Return(nil)
+		session.logWarning(message)
+
+		logger.AssertExpectations(t)
+	})
+}
+
 func TestSessionSetTimeout(t *testing.T) {
 	timeStub, timeout := time.Now(), 42
 	timeNow = func() time.Time { return timeStub }
@@ -115,6 +135,7 @@ func TestNewSession(t *testing.T) {
 		assert.Equal(t, bufio.NewReader(connection), session.bufin)
 		assert.Equal(t, bufio.NewWriter(connection), session.bufout)
 		assert.Equal(t, logger, session.logger)
+		assert.Equal(t, timeNow(), session.startedAt)
 	})
 }
 
@@ -131,6 +152,7 @@ func TestSessionReadRequest(t *testing.T) {
 		assert.Equal(t, capturedStringContext, request)
 		assert.NoError(t, err)
 		assert.NoError(t, session.err)
+		assert.Equal(t, []TranscriptEntry{{Direction: ClientRequest, Line: capturedStringContext, Time: timeNow()}}, session.entries)
 	})
 
 	t.Run("extracts string from bufin with error", func(t *testing.T) {
@@ -159,6 +181,7 @@ func TestSessionReadBytes(t *testing.T) {
 		assert.Equal(t, []uint8(str), request)
 		assert.NoError(t, err)
 		assert.NoError(t, session.err)
+		assert.Equal(t, []TranscriptEntry{{Direction: ClientRequest, Line: "stringContext", Time: timeNow()}}, session.entries)
 	})
 
 	t.Run("extracts line in bytes from bufin with error", func(t *testing.T) {
@@ -182,13 +205,25 @@ func TestSessionResponseDelay(t *testing.T) {
 	})
 
 	t.Run("when custom session response delay", func(t *testing.T) {
-		timeSleep = func(delay int) int { return delay }
-		delay, logger := 42, new(loggerMock)
-		logger.On("InfoActivity", fmt.Sprintf("%s: %d sec", sessionResponseDelayMsg, delay)).Once().Return(nil)
+		timeSleep = func(delay time.Duration) time.Duration { return delay }
+		delay, logger := 1500*time.Millisecond, new(loggerMock)
+		logger.On("InfoActivity", fmt.Sprintf("%s: %s", sessionResponseDelayMsg, delay)).Once().Return(nil)
 		session := &session{logger: logger}
 
 		assert.Equal(t, delay, session.responseDelay(delay))
 	})
+
+	t.Run("when custom session response delay with jitter", func(t *testing.T) {
+		timeSleep = func(delay time.Duration) time.Duration { return delay }
+		delay, logger := 1500*time.Millisecond, new(loggerMock)
+		jitter := newJitter(newConfiguration(ConfigurationAttr{ResponseDelayJitterDuration: time.Second, RandomSeed: 42}))
+		jitteredDelay := newJitter(newConfiguration(ConfigurationAttr{ResponseDelayJitterDuration: time.Second, RandomSeed: 42})).apply(delay)
+		logger.On("InfoActivity", fmt.Sprintf("%s: %s", sessionResponseDelayMsg, jitteredDelay)).Once().Return(nil)
+		session := &session{logger: logger, jitter: jitter}
+
+		assert.Equal(t, jitteredDelay, session.responseDelay(delay))
+		assert.NotEqual(t, delay, jitteredDelay)
+	})
 }
 
 func TestSessionWriteResponse(t *testing.T) {
@@ -202,15 +237,16 @@ func TestSessionWriteResponse(t *testing.T) {
 
 		assert.Equal(t, response+"\r\n", binaryData.String())
 		assert.NoError(t, session.err)
+		assert.Equal(t, []TranscriptEntry{{Direction: ServerResponse, Line: response, Time: timeNow()}}, session.entries)
 	})
 
 	t.Run("writes server response to bufout with response delay and without error", func(t *testing.T) {
-		timeSleep = func(delay int) int { return delay }
-		response, delay := "some response", 42
+		timeSleep = func(delay time.Duration) time.Duration { return delay }
+		response, delay := "some response", 1500*time.Millisecond
 		binaryData := bytes.NewBufferString("")
 		bufout, logger := bufio.NewWriter(binaryData), new(loggerMock)
 		logger.On("InfoActivity", sessionResponseMsg+response).Once().Return(nil)
-		logger.On("InfoActivity", fmt.Sprintf("%s: %d sec", sessionResponseDelayMsg, delay)).Once().Return(nil)
+		logger.On("InfoActivity", fmt.Sprintf("%s: %s", sessionResponseDelayMsg, delay)).Once().Return(nil)
 		session := &session{bufout: bufout, logger: logger}
 		session.writeResponse(response, delay)
 
@@ -232,6 +268,202 @@ func TestSessionWriteResponse(t *testing.T) {
 	})
 }
 
+func TestSessionWriteResponseWithFault(t *testing.T) {
+	response := "250 Received"
+
+	t.Run("writes full response, closes connection after drop fault", func(t *testing.T) {
+		binaryData := bytes.NewBufferString("")
+		connection, logger := new(netConnectionMock), new(loggerMock)
+		connection.On("Close").Once().Return(nil)
+		logger.On("InfoActivity", sessionResponseMsg+response).Once().Return(nil)
+		logger.On("InfoActivity", fmt.Sprintf("%s: %s", sessionFaultMsg, FaultDropConnection)).Once().Return(nil)
+		session := &session{connection: connection, bufout: bufio.NewWriter(binaryData), logger: logger}
+		session.injectFault(&fault{kind: FaultDropConnection})
+		session.writeResponse(response, defaultSessionResponseDelay)
+
+		assert.Equal(t, response+"\r\n", binaryData.String())
+		assert.True(t, session.aborted)
+		assert.Nil(t, session.fault)
+	})
+
+	t.Run("writes half of response line, closes connection after half reply fault", func(t *testing.T) {
+		binaryData := bytes.NewBufferString("")
+		connection, logger := new(netConnectionMock), new(loggerMock)
+		connection.On("Close").Once().Return(nil)
+		logger.On("InfoActivity", sessionResponseMsg+"250 Re").Once().Return(nil)
+		logger.On("InfoActivity", fmt.Sprintf("%s: %s", sessionFaultMsg, FaultHalfReply)).Once().Return(nil)
+		session := &session{connection: connection, bufout: bufio.NewWriter(binaryData), logger: logger}
+		session.injectFault(&fault{kind: FaultHalfReply})
+		session.writeResponse(response, defaultSessionResponseDelay)
+
+		assert.Equal(t, "250 Re", binaryData.String())
+		assert.Equal(t, "250 Re", session.entries[0].Line)
+		assert.True(t, session.aborted)
+	})
+
+	t.Run("writes response one byte at a time, keeps connection after byte by byte fault", func(t *testing.T) {
+		bufout, logger := new(bufioWriterMock), new(loggerMock)
+		for _, char := range response + "\r\n" {
+			bufout.On("WriteString", string(char)).Once().Return(1, nil)
+		}
+		bufout.On("Flush").Times(len(response) + 2).Return(nil)
+		logger.On("InfoActivity", sessionResponseMsg+response).Once().Return(nil)
+		logger.On("InfoActivity", fmt.Sprintf("%s: %s", sessionFaultMsg, FaultByteByByte)).Once().Return(nil)
+		var byteDelays []time.Duration
+		timeSleep = func(delay time.Duration) time.Duration {
+			byteDelays = append(byteDelays, delay)
+			return delay
+		}
+		session := &session{bufout: bufout, logger: logger}
+		session.injectFault(&fault{kind: FaultByteByByte, byteDelay: time.Millisecond})
+		session.writeResponse(response, defaultSessionResponseDelay)
+
+		bufout.AssertExpectations(t)
+		assert.False(t, session.aborted)
+		assert.Len(t, byteDelays, len(response)+2)
+		assert.Equal(t, time.Millisecond, byteDelays[0])
+	})
+
+	t.Run("injected fault is applied to the next response only", func(t *testing.T) {
+		binaryData := bytes.NewBufferString("")
+		logger := new(loggerMock)
+		logger.On("InfoActivity", sessionResponseMsg+response).Twice().Return(nil)
+		logger.On("InfoActivity", fmt.Sprintf("%s: %s", sessionFaultMsg, FaultByteByByte)).Once().Return(nil)
+		session := &session{bufout: bufio.NewWriter(binaryData), logger: logger}
+		session.injectFault(&fault{kind: FaultByteByByte})
+		session.writeResponse(response, defaultSessionResponseDelay)
+		session.writeResponse(response, defaultSessionResponseDelay)
+
+		assert.Equal(t, response+"\r\n"+response+"\r\n", binaryData.String())
+		logger.AssertExpectations(t)
+	})
+}
+
+func TestSessionWrite(t *testing.T) {
+	t.Run("writes and flushes data without error", func(t *testing.T) {
+		binaryData := bytes.NewBufferString("")
+		session := &session{bufout: bufio.NewWriter(binaryData)}
+		session.write("2")
+
+		assert.Equal(t, "2", binaryData.String())
+	})
+
+	t.Run("writes and flushes data with error", func(t *testing.T) {
+		errorMessage, bufout, logger := "write error", new(bufioWriterMock), new(loggerMock)
+		err := errors.New(errorMessage)
+		bufout.On("WriteString", "2").Once().Return(0, err)
+		bufout.On("Flush").Once().Return(err)
+		logger.On("Warning", errorMessage).Once().Return(nil)
+		session := &session{bufout: bufout, logger: logger}
+		session.write("2")
+
+		bufout.AssertExpectations(t)
+		logger.AssertExpectations(t)
+	})
+}
+
+func TestSessionInjectFault(t *testing.T) {
+	t.Run("injects fault into session", func(t *testing.T) {
+		session, fault := new(session), &fault{kind: FaultReset}
+		session.injectFault(fault)
+
+		assert.Same(t, fault, session.fault)
+	})
+}
+
+func TestSessionAbort(t *testing.T) {
+	t.Run("closes connection after drop fault", func(t *testing.T) {
+		connection := new(netConnectionMock)
+		connection.On("Close").Once().Return(nil)
+		session := &session{connection: connection}
+		session.abort(&fault{kind: FaultDropConnection})
+
+		assert.True(t, session.aborted)
+	})
+
+	t.Run("holds connection during stall duration before close after stall fault", func(t *testing.T) {
+		var stallDuration time.Duration
+		timeSleep = func(delay time.Duration) time.Duration {
+			stallDuration = delay
+			return delay
+		}
+		connection := new(netConnectionMock)
+		connection.On("Close").Once().Return(nil)
+		session := &session{connection: connection}
+		session.abort(&fault{kind: FaultStall, stallDuration: 42 * time.Second})
+
+		assert.Equal(t, 42*time.Second, stallDuration)
+		assert.True(t, session.aborted)
+	})
+
+	t.Run("sends TCP RST after reset fault", func(t *testing.T) {
+		connection := new(tcpConnectionMock)
+		connection.On("SetLinger", 0).Once().Return(nil)
+		connection.On("Close").Once().Return(nil)
+		session := &session{connection: connection}
+		session.abort(&fault{kind: FaultReset})
+
+		connection.AssertExpectations(t)
+	})
+
+	t.Run("closes connection with errors", func(t *testing.T) {
+		lingerErrorMessage, closeErrorMessage := "linger error", "close error"
+		connection, logger := new(tcpConnectionMock), new(loggerMock)
+		connection.On("SetLinger", 0).Once().Return(errors.New(lingerErrorMessage))
+		connection.On("Close").Once().Return(errors.New(closeErrorMessage))
+		logger.On("Warning", lingerErrorMessage).Once().Return(nil)
+		logger.On("Warning", closeErrorMessage).Once().Return(nil)
+		session := &session{connection: connection, logger: logger}
+		session.abort(&fault{kind: FaultReset})
+
+		logger.AssertExpectations(t)
+		assert.True(t, session.aborted)
+	})
+}
+
+func TestSessionRecord(t *testing.T) {
+	t.Run("adds line to session transcript", func(t *testing.T) {
+		session := new(session)
+		session.record(ClientRequest, "NOOP")
+		session.record(ServerResponse, defaultOkMsg)
+
+		assert.Equal(
+			t,
+			[]TranscriptEntry{
+				{Direction: ClientRequest, Line: "NOOP", Time: timeNow()},
+				{Direction: ServerResponse, Line: defaultOkMsg, Time: timeNow()},
+			},
+			session.entries,
+		)
+	})
+}
+
+func TestSessionTranscript(t *testing.T) {
+	startedAt, entries, err := time.Now().Add(-time.Second), []TranscriptEntry{{Direction: ClientRequest, Line: "NOOP"}}, errors.New("some error")
+	session := &session{address: "127.0.0.1:25", startedAt: startedAt, entries: entries, err: err}
+
+	t.Run("returns session transcript", func(t *testing.T) {
+		assert.Equal(
+			t,
+			Transcript{
+				SessionID:     42,
+				RemoteAddress: "127.0.0.1:25",
+				StartedAt:     startedAt,
+				FinishedAt:    timeNow(),
+				CloseReason:   SessionClosedByQuit,
+				Entries:       entries,
+			},
+			session.transcript(42, SessionClosedByQuit),
+		)
+	})
+
+	t.Run("includes session error for fail fast and read error close reasons", func(t *testing.T) {
+		assert.Same(t, err, session.transcript(42, SessionClosedByFailFast).CloseError)
+		assert.Same(t, err, session.transcript(42, SessionClosedByReadError).CloseError)
+		assert.Nil(t, session.transcript(42, SessionClosedByShutdown).CloseError)
+	})
+}
+
 func TestSessionFinish(t *testing.T) {
 	t.Run("closes session connection without error", func(t *testing.T) {
 		connection, logger := netConnectionMock{}, new(loggerMock)
@@ -254,4 +486,14 @@ func TestSessionFinish(t *testing.T) {
 
 		assert.NoError(t, session.err)
 	})
+
+	t.Run("does not close session connection aborted by fault", func(t *testing.T) {
+		connection, logger := new(netConnectionMock), new(loggerMock)
+		logger.On("InfoActivity", sessionEndMsg).Once().Return(nil)
+		session := &session{connection: connection, logger: logger, aborted: true}
+		session.finish()
+
+		connection.AssertNotCalled(t, "Close")
+		logger.AssertExpectations(t)
+	})
 }
@@ -0,0 +1,400 @@
+package smtpmock
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// PKCS #7 (CMS) object identifiers
+var (
+	oidPKCS7SignedData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidPKCS7EnvelopedData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidPKCS7AttributeMsgDigest  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidPKCS7RSAEncryption       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidPKCS7EncryptionAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidPKCS7EncryptionAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidPKCS7EncryptionAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidPKCS7EncryptionDESEDE3   = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidPKCS7DigestSHA1          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidPKCS7DigestSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidPKCS7DigestSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidPKCS7DigestSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// Supported content encryption algorithms
+var pkcs7ContentCiphers = []struct {
+	oid       asn1.ObjectIdentifier
+	keySize   int
+	newCipher func([]byte) (cipher.Block, error)
+}{
+	{oidPKCS7EncryptionAES128CBC, 16, aes.NewCipher},
+	{oidPKCS7EncryptionAES192CBC, 24, aes.NewCipher},
+	{oidPKCS7EncryptionAES256CBC, 32, aes.NewCipher},
+	{oidPKCS7EncryptionDESEDE3, 24, des.NewTripleDESCipher},
+}
+
+// Supported digest algorithms
+var pkcs7DigestAlgorithms = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{oidPKCS7DigestSHA1, crypto.SHA1},
+	{oidPKCS7DigestSHA256, crypto.SHA256},
+	{oidPKCS7DigestSHA384, crypto.SHA384},
+	{oidPKCS7DigestSHA512, crypto.SHA512},
+}
+
+// Certificate signature algorithms by public key algorithm and digest algorithm
+var pkcs7SignatureAlgorithms = map[x509.PublicKeyAlgorithm]map[crypto.Hash]x509.SignatureAlgorithm{
+	x509.RSA: {
+		crypto.SHA1:   x509.SHA1WithRSA,
+		crypto.SHA256: x509.SHA256WithRSA,
+		crypto.SHA384: x509.SHA384WithRSA,
+		crypto.SHA512: x509.SHA512WithRSA,
+	},
+	x509.ECDSA: {
+		crypto.SHA1:   x509.ECDSAWithSHA1,
+		crypto.SHA256: x509.ECDSAWithSHA256,
+		crypto.SHA384: x509.ECDSAWithSHA384,
+		crypto.SHA512: x509.ECDSAWithSHA512,
+	},
+}
+
+// PKCS #7 ContentInfo
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// PKCS #7 EnvelopedData
+type pkcs7EnvelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo pkcs7EncryptedContentInfo
+}
+
+// PKCS #7 KeyTransRecipientInfo
+type pkcs7KeyTransRecipientInfo struct {
+	Version                int
+	RecipientIdentifier    asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+// PKCS #7 EncryptedContentInfo
+type pkcs7EncryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// PKCS #7 SignedData
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue     `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue     `asn1:"optional,tag:1"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+// PKCS #7 SignerInfo
+type pkcs7SignerInfo struct {
+	Version            int
+	SignerIdentifier   asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// PKCS #7 IssuerAndSerialNumber
+type pkcs7IssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// PKCS #7 Attribute
+type pkcs7Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// Parses DER encoded PKCS #7 ContentInfo
+func parsePKCS7ContentInfo(data []byte) (*pkcs7ContentInfo, error) {
+	contentInfo := new(pkcs7ContentInfo)
+	if _, err := asn1.Unmarshal(data, contentInfo); err != nil {
+		return nil, err
+	}
+
+	if !contentInfo.ContentType.Equal(oidPKCS7EnvelopedData) && !contentInfo.ContentType.Equal(oidPKCS7SignedData) {
+		return nil, fmt.Errorf("%s: %s", unsupportedAlgorithmMsg, contentInfo.ContentType)
+	}
+
+	return contentInfo, nil
+}
+
+// Returns OCTET STRING context. Supports both primitive and constructed encodings
+func pkcs7OctetString(value asn1.RawValue) []byte {
+	if !value.IsCompound {
+		return value.Bytes
+	}
+
+	var octets []byte
+	for rest := value.Bytes; len(rest) > 0; {
+		var segment asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &segment); err != nil {
+			break
+		}
+
+		octets = append(octets, pkcs7OctetString(segment)...)
+	}
+
+	return octets
+}
+
+// Decrypts PKCS #7 EnvelopedData with the given RSA private keys. Only key transport
+// recipients are supported
+func decryptPKCS7EnvelopedData(data []byte, privateKeys []*rsa.PrivateKey) ([]byte, error) {
+	var envelopedData pkcs7EnvelopedData
+	if _, err := asn1.Unmarshal(data, &envelopedData); err != nil {
+		return nil, err
+	}
+
+	for _, rawRecipientInfo := range envelopedData.RecipientInfos {
+		var recipientInfo pkcs7KeyTransRecipientInfo
+		if _, err := asn1.Unmarshal(rawRecipientInfo.FullBytes, &recipientInfo); err != nil ||
+			!recipientInfo.KeyEncryptionAlgorithm.Algorithm.Equal(oidPKCS7RSAEncryption) {
+			continue
+		}
+
+		for _, privateKey := range privateKeys {
+			contentKey, err := rsa.DecryptPKCS1v15(nil, privateKey, recipientInfo.EncryptedKey)
+			if err != nil {
+				continue
+			}
+
+			if content, err := decryptPKCS7Content(envelopedData.EncryptedContentInfo, contentKey); err == nil {
+				return content, nil
+			}
+		}
+	}
+
+	return nil, errors.New(noDecryptionKeyMsg)
+}
+
+// Decrypts PKCS #7 EncryptedContentInfo with the given content encryption key
+func decryptPKCS7Content(contentInfo pkcs7EncryptedContentInfo, contentKey []byte) ([]byte, error) {
+	algorithm := contentInfo.ContentEncryptionAlgorithm
+
+	for _, contentCipher := range pkcs7ContentCiphers {
+		if !algorithm.Algorithm.Equal(contentCipher.oid) {
+			continue
+		}
+
+		if len(contentKey) != contentCipher.keySize {
+			return nil, errors.New(noDecryptionKeyMsg)
+		}
+
+		var iv []byte
+		if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &iv); err != nil {
+			return nil, err
+		}
+
+		block, _ := contentCipher.newCipher(contentKey)
+		encryptedContent := pkcs7OctetString(contentInfo.EncryptedContent)
+		if len(iv) != block.BlockSize() || len(encryptedContent) == 0 || len(encryptedContent)%block.BlockSize() != 0 {
+			return nil, errors.New(malformedSecurityDataMsg)
+		}
+
+		content := make([]byte, len(encryptedContent))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(content, encryptedContent)
+		return pkcs7Unpad(content, block.BlockSize())
+	}
+
+	return nil, fmt.Errorf("%s: %s", unsupportedAlgorithmMsg, algorithm.Algorithm)
+}
+
+// Removes PKCS #7 padding
+func pkcs7Unpad(data []byte, blockSize int) ([]byte, error) {
+	paddingSize := int(data[len(data)-1])
+	if paddingSize == 0 || paddingSize > blockSize ||
+		!bytes.Equal(data[len(data)-paddingSize:], bytes.Repeat([]byte{byte(paddingSize)}, paddingSize)) {
+		return nil, errors.New(noDecryptionKeyMsg)
+	}
+
+	return data[:len(data)-paddingSize], nil
+}
+
+// Verifies the first signer of PKCS #7 SignedData. Uses detached content for case when
+// it's not nil, otherwise uses encapsulated content. Signer certificate should be one of
+// trusted certificates or should be issued by one of them. Returns signed content and
+// signer identity. Signed content is returned even for case when verification failed
+func verifyPKCS7SignedData(
+	contentInfo *pkcs7ContentInfo,
+	detachedContent []byte,
+	trustedCertificates []*x509.Certificate,
+) ([]byte, string, error) {
+	var signedData pkcs7SignedData
+	if !contentInfo.ContentType.Equal(oidPKCS7SignedData) {
+		return nil, emptyString, errors.New(malformedSecurityDataMsg)
+	}
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		return nil, emptyString, err
+	}
+
+	content := detachedContent
+	if content == nil {
+		var encapsulatedContent asn1.RawValue
+		if _, err := asn1.Unmarshal(signedData.ContentInfo.Content.Bytes, &encapsulatedContent); err != nil {
+			return nil, emptyString, errors.New(malformedSecurityDataMsg)
+		}
+
+		content = pkcs7OctetString(encapsulatedContent)
+	}
+
+	certificates, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+	if err != nil {
+		return content, emptyString, err
+	}
+	if len(signedData.SignerInfos) == 0 {
+		return content, emptyString, errors.New(malformedSecurityDataMsg)
+	}
+
+	signerInfo := signedData.SignerInfos[0]
+	certificate := pkcs7SignerCertificate(signerInfo, append(certificates, trustedCertificates...))
+	if certificate == nil {
+		return content, emptyString, errors.New(signerNotFoundMsg)
+	}
+
+	signer := certificateIdentity(certificate)
+	if err := verifyPKCS7Signature(signerInfo, certificate, content); err != nil {
+		return content, signer, err
+	}
+
+	if !isTrustedCertificate(certificate, certificates, trustedCertificates) {
+		return content, signer, errors.New(untrustedSignerMsg)
+	}
+
+	return content, signer, nil
+}
+
+// Verifies PKCS #7 SignerInfo signature with the given certificate. Checks message digest
+// attribute for case when signer info has signed attributes
+func verifyPKCS7Signature(signerInfo pkcs7SignerInfo, certificate *x509.Certificate, content []byte) error {
+	hash := pkcs7DigestAlgorithm(signerInfo.DigestAlgorithm.Algorithm)
+	signatureAlgorithm, ok := pkcs7SignatureAlgorithms[certificate.PublicKeyAlgorithm][hash]
+	if !ok {
+		return fmt.Errorf("%s: %s", unsupportedAlgorithmMsg, signerInfo.DigestAlgorithm.Algorithm)
+	}
+
+	signedData := content
+	if len(signerInfo.SignedAttributes.FullBytes) > 0 {
+		digest := hash.New()
+		digest.Write(content)
+		if !bytes.Equal(pkcs7MessageDigest(signerInfo.SignedAttributes.Bytes), digest.Sum(nil)) {
+			return errors.New(digestMismatchMsg)
+		}
+
+		// Signed attributes are signed with SET OF tag instead of implicit [0] tag
+		signedData = append([]byte{0x31}, signerInfo.SignedAttributes.FullBytes[1:]...)
+	}
+
+	return certificate.CheckSignature(signatureAlgorithm, signedData, signerInfo.Signature)
+}
+
+// Returns hash function by PKCS #7 digest algorithm identifier. Returns zero value for
+// case when algorithm is not supported
+func pkcs7DigestAlgorithm(oid asn1.ObjectIdentifier) crypto.Hash {
+	for _, digestAlgorithm := range pkcs7DigestAlgorithms {
+		if oid.Equal(digestAlgorithm.oid) {
+			return digestAlgorithm.hash
+		}
+	}
+
+	return 0
+}
+
+// Returns message digest attribute value from DER encoded signed attributes
+func pkcs7MessageDigest(attributes []byte) []byte {
+	for rest := attributes; len(rest) > 0; {
+		var attribute pkcs7Attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attribute); err != nil {
+			return nil
+		}
+
+		if attribute.Type.Equal(oidPKCS7AttributeMsgDigest) {
+			var digest []byte
+			_, _ = asn1.Unmarshal(attribute.Values.Bytes, &digest)
+			return digest
+		}
+	}
+
+	return nil
+}
+
+// Returns signer certificate by signer identifier. Supports issuer and serial number
+// and subject key identifier. Returns nil for case when certificate not found
+func pkcs7SignerCertificate(signerInfo pkcs7SignerInfo, certificates []*x509.Certificate) *x509.Certificate {
+	var issuerAndSerialNumber pkcs7IssuerAndSerialNumber
+	_, err := asn1.Unmarshal(signerInfo.SignerIdentifier.FullBytes, &issuerAndSerialNumber)
+
+	for _, certificate := range certificates {
+		if err == nil && bytes.Equal(certificate.RawIssuer, issuerAndSerialNumber.Issuer.FullBytes) &&
+			certificate.SerialNumber.Cmp(issuerAndSerialNumber.SerialNumber) == 0 {
+			return certificate
+		}
+
+		if err != nil && signerInfo.SignerIdentifier.Tag == 0 && len(certificate.SubjectKeyId) > 0 &&
+			bytes.Equal(certificate.SubjectKeyId, signerInfo.SignerIdentifier.Bytes) {
+			return certificate
+		}
+	}
+
+	return nil
+}
+
+// Returns true for case when certificate is one of trusted certificates or it's issued
+// by one of them, otherwise returns false
+func isTrustedCertificate(certificate *x509.Certificate, intermediates, trustedCertificates []*x509.Certificate) bool {
+	roots, intermediatesPool := x509.NewCertPool(), x509.NewCertPool()
+	for _, trustedCertificate := range trustedCertificates {
+		if trustedCertificate.Equal(certificate) {
+			return true
+		}
+
+		roots.AddCert(trustedCertificate)
+	}
+
+	for _, intermediate := range intermediates {
+		intermediatesPool.AddCert(intermediate)
+	}
+
+	_, err := certificate.Verify(
+		x509.VerifyOptions{Roots: roots, Intermediates: intermediatesPool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}},
+	)
+	return err == nil
+}
+
+// Returns certificate owner identity: the first e-mail address or subject common name
+func certificateIdentity(certificate *x509.Certificate) string {
+	if len(certificate.EmailAddresses) > 0 {
+		return certificate.EmailAddresses[0]
+	}
+
+	return certificate.Subject.CommonName
+}
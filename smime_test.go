@@ -0,0 +1,361 @@
+package smtpmock
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePKCS7ContentInfo(t *testing.T) {
+	t.Run("returns parsed content info", func(t *testing.T) {
+		_, data := smimeFixturePKCS7("smime_encrypted.eml")
+		contentInfo, err := parsePKCS7ContentInfo(data)
+
+		assert.True(t, contentInfo.ContentType.Equal(oidPKCS7EnvelopedData))
+		assert.NoError(t, err)
+	})
+
+	t.Run("when data is malformed", func(t *testing.T) {
+		contentInfo, err := parsePKCS7ContentInfo([]byte("data"))
+
+		assert.Nil(t, contentInfo)
+		assert.Error(t, err)
+	})
+
+	t.Run("when content type is not supported", func(t *testing.T) {
+		data, _ := asn1.Marshal(pkcs7ContentInfo{ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}})
+		contentInfo, err := parsePKCS7ContentInfo(data)
+
+		assert.Nil(t, contentInfo)
+		assert.EqualError(t, err, unsupportedAlgorithmMsg+": 1.2.840.113549.1.7.1")
+	})
+}
+
+func TestPKCS7OctetString(t *testing.T) {
+	t.Run("when primitive encoding", func(t *testing.T) {
+		assert.Equal(t, []byte("ab"), pkcs7OctetString(asn1.RawValue{Bytes: []byte("ab")}))
+	})
+
+	t.Run("when constructed encoding", func(t *testing.T) {
+		firstSegment, _ := asn1.Marshal([]byte("ab"))
+		secondSegment, _ := asn1.Marshal([]byte("cd"))
+
+		assert.Equal(t, []byte("abcd"), pkcs7OctetString(asn1.RawValue{IsCompound: true, Bytes: append(firstSegment, secondSegment...)}))
+	})
+
+	t.Run("when constructed encoding is malformed", func(t *testing.T) {
+		segment, _ := asn1.Marshal([]byte("ab"))
+
+		assert.Equal(t, []byte("ab"), pkcs7OctetString(asn1.RawValue{IsCompound: true, Bytes: append(segment, 0x04)}))
+	})
+}
+
+func TestDecryptPKCS7EnvelopedData(t *testing.T) {
+	privateKeys := createSecurityKeyRing().smimePrivateKeys
+	_, data := smimeFixturePKCS7("smime_encrypted.eml")
+	contentInfo, _ := parsePKCS7ContentInfo(data)
+	envelopedData := contentInfo.Content.Bytes
+
+	t.Run("returns decrypted content", func(t *testing.T) {
+		content, err := decryptPKCS7EnvelopedData(envelopedData, privateKeys)
+
+		assert.Equal(t, "Content-Type: text/plain; charset=utf-8\r\n\r\nSecret text\r\n", string(content))
+		assert.NoError(t, err)
+	})
+
+	t.Run("when enveloped data is malformed", func(t *testing.T) {
+		content, err := decryptPKCS7EnvelopedData([]byte("data"), privateKeys)
+
+		assert.Nil(t, content)
+		assert.Error(t, err)
+	})
+
+	t.Run("when private key doesn't match", func(t *testing.T) {
+		privateKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+		content, err := decryptPKCS7EnvelopedData(envelopedData, []*rsa.PrivateKey{privateKey})
+
+		assert.Nil(t, content)
+		assert.EqualError(t, err, noDecryptionKeyMsg)
+	})
+
+	t.Run("when recipient info is not supported", func(t *testing.T) {
+		var parsedEnvelopedData pkcs7EnvelopedData
+		_, _ = asn1.Unmarshal(envelopedData, &parsedEnvelopedData)
+		recipientInfo, _ := asn1.Marshal(1)
+		parsedEnvelopedData.RecipientInfos = []asn1.RawValue{{FullBytes: recipientInfo}}
+		data, _ := asn1.Marshal(parsedEnvelopedData)
+		content, err := decryptPKCS7EnvelopedData(data, privateKeys)
+
+		assert.Nil(t, content)
+		assert.EqualError(t, err, noDecryptionKeyMsg)
+	})
+
+	t.Run("when content can't be decrypted", func(t *testing.T) {
+		var parsedEnvelopedData pkcs7EnvelopedData
+		_, _ = asn1.Unmarshal(envelopedData, &parsedEnvelopedData)
+		parsedEnvelopedData.EncryptedContentInfo.ContentEncryptionAlgorithm.Algorithm = oidPKCS7DigestSHA256
+		data, _ := asn1.Marshal(parsedEnvelopedData)
+		content, err := decryptPKCS7EnvelopedData(data, privateKeys)
+
+		assert.Nil(t, content)
+		assert.EqualError(t, err, noDecryptionKeyMsg)
+	})
+}
+
+func TestDecryptPKCS7Content(t *testing.T) {
+	contentKey := make([]byte, 16)
+	iv, _ := asn1.Marshal(make([]byte, 16))
+	newContentInfo := func(algorithm asn1.ObjectIdentifier, iv, encryptedContent []byte) pkcs7EncryptedContentInfo {
+		contentInfo := pkcs7EncryptedContentInfo{EncryptedContent: asn1.RawValue{Bytes: encryptedContent}}
+		contentInfo.ContentEncryptionAlgorithm.Algorithm = algorithm
+		contentInfo.ContentEncryptionAlgorithm.Parameters = asn1.RawValue{FullBytes: iv}
+		return contentInfo
+	}
+
+	t.Run("when content key size doesn't match", func(t *testing.T) {
+		content, err := decryptPKCS7Content(newContentInfo(oidPKCS7EncryptionAES256CBC, iv, make([]byte, 16)), contentKey)
+
+		assert.Nil(t, content)
+		assert.EqualError(t, err, noDecryptionKeyMsg)
+	})
+
+	t.Run("when initialization vector is malformed", func(t *testing.T) {
+		content, err := decryptPKCS7Content(newContentInfo(oidPKCS7EncryptionAES128CBC, nil, make([]byte, 16)), contentKey)
+
+		assert.Nil(t, content)
+		assert.Error(t, err)
+	})
+
+	t.Run("when encrypted content size is invalid", func(t *testing.T) {
+		content, err := decryptPKCS7Content(newContentInfo(oidPKCS7EncryptionAES128CBC, iv, make([]byte, 15)), contentKey)
+
+		assert.Nil(t, content)
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+
+	t.Run("when algorithm is not supported", func(t *testing.T) {
+		content, err := decryptPKCS7Content(newContentInfo(oidPKCS7DigestSHA1, iv, make([]byte, 16)), contentKey)
+
+		assert.Nil(t, content)
+		assert.EqualError(t, err, unsupportedAlgorithmMsg+": "+oidPKCS7DigestSHA1.String())
+	})
+}
+
+func TestPKCS7Unpad(t *testing.T) {
+	t.Run("returns unpadded data", func(t *testing.T) {
+		data, err := pkcs7Unpad([]byte{'a', 3, 3, 3}, 4)
+
+		assert.Equal(t, []byte{'a'}, data)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when padding is invalid", func(t *testing.T) {
+		for _, data := range [][]byte{{'a', 'b', 'c', 0}, {'a', 'b', 'c', 5}, {'a', 'b', 2, 3}} {
+			unpaddedData, err := pkcs7Unpad(data, 4)
+
+			assert.Nil(t, unpaddedData)
+			assert.EqualError(t, err, noDecryptionKeyMsg)
+		}
+	})
+}
+
+func TestVerifyPKCS7SignedData(t *testing.T) {
+	trustedCertificates := createSecurityKeyRing().smimeCertificates
+	detachedContent, data := smimeFixturePKCS7("smime_signed.eml")
+	contentInfo, _ := parsePKCS7ContentInfo(data)
+	newContentInfo := func(modify func(*pkcs7SignedData)) *pkcs7ContentInfo {
+		var signedData pkcs7SignedData
+		_, _ = asn1.Unmarshal(contentInfo.Content.Bytes, &signedData)
+		modify(&signedData)
+		data, _ := asn1.Marshal(signedData)
+		return &pkcs7ContentInfo{ContentType: oidPKCS7SignedData, Content: asn1.RawValue{Bytes: data}}
+	}
+
+	t.Run("returns signed content and signer identity", func(t *testing.T) {
+		content, signer, err := verifyPKCS7SignedData(contentInfo, detachedContent, trustedCertificates)
+
+		assert.Equal(t, detachedContent, content)
+		assert.Equal(t, "user@example.com", signer)
+		assert.NoError(t, err)
+	})
+
+	t.Run("when content type is not signed data", func(t *testing.T) {
+		content, signer, err := verifyPKCS7SignedData(&pkcs7ContentInfo{ContentType: oidPKCS7EnvelopedData}, detachedContent, trustedCertificates)
+
+		assert.Nil(t, content)
+		assert.Empty(t, signer)
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+
+	t.Run("when signed data is malformed", func(t *testing.T) {
+		content, signer, err := verifyPKCS7SignedData(&pkcs7ContentInfo{ContentType: oidPKCS7SignedData}, detachedContent, trustedCertificates)
+
+		assert.Nil(t, content)
+		assert.Empty(t, signer)
+		assert.Error(t, err)
+	})
+
+	t.Run("when encapsulated content not found", func(t *testing.T) {
+		content, signer, err := verifyPKCS7SignedData(contentInfo, nil, trustedCertificates)
+
+		assert.Nil(t, content)
+		assert.Empty(t, signer)
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+
+	t.Run("when certificates are malformed", func(t *testing.T) {
+		signedContentInfo := newContentInfo(func(signedData *pkcs7SignedData) {
+			signedData.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, IsCompound: true, Bytes: []byte{0x30, 0x01, 0x00}}
+		})
+		content, signer, err := verifyPKCS7SignedData(signedContentInfo, detachedContent, trustedCertificates)
+
+		assert.Equal(t, detachedContent, content)
+		assert.Empty(t, signer)
+		assert.Error(t, err)
+	})
+
+	t.Run("when signer info not found", func(t *testing.T) {
+		signedContentInfo := newContentInfo(func(signedData *pkcs7SignedData) { signedData.SignerInfos = nil })
+		content, signer, err := verifyPKCS7SignedData(signedContentInfo, detachedContent, trustedCertificates)
+
+		assert.Equal(t, detachedContent, content)
+		assert.Empty(t, signer)
+		assert.EqualError(t, err, malformedSecurityDataMsg)
+	})
+
+	t.Run("when signer certificate not found", func(t *testing.T) {
+		signedContentInfo := newContentInfo(func(signedData *pkcs7SignedData) { signedData.Certificates = asn1.RawValue{} })
+		content, signer, err := verifyPKCS7SignedData(signedContentInfo, detachedContent, nil)
+
+		assert.Equal(t, detachedContent, content)
+		assert.Empty(t, signer)
+		assert.EqualError(t, err, signerNotFoundMsg)
+	})
+}
+
+func TestVerifyPKCS7Signature(t *testing.T) {
+	detachedContent, data := smimeFixturePKCS7("smime_signed.eml")
+	contentInfo, _ := parsePKCS7ContentInfo(data)
+	var signedData pkcs7SignedData
+	_, _ = asn1.Unmarshal(contentInfo.Content.Bytes, &signedData)
+	certificates, _ := x509.ParseCertificates(signedData.Certificates.Bytes)
+	signerInfo, certificate := signedData.SignerInfos[0], certificates[0]
+
+	t.Run("when signature is valid", func(t *testing.T) {
+		assert.NoError(t, verifyPKCS7Signature(signerInfo, certificate, detachedContent))
+	})
+
+	t.Run("when digest algorithm is not supported", func(t *testing.T) {
+		unsupportedSignerInfo := signerInfo
+		unsupportedSignerInfo.DigestAlgorithm.Algorithm = oidPKCS7RSAEncryption
+
+		assert.EqualError(
+			t,
+			verifyPKCS7Signature(unsupportedSignerInfo, certificate, detachedContent),
+			unsupportedAlgorithmMsg+": "+oidPKCS7RSAEncryption.String(),
+		)
+	})
+
+	t.Run("when message digest doesn't match", func(t *testing.T) {
+		assert.EqualError(t, verifyPKCS7Signature(signerInfo, certificate, []byte("content")), digestMismatchMsg)
+	})
+
+	t.Run("when signer info has no signed attributes", func(t *testing.T) {
+		privateKey := createSecurityKeyRing().smimePrivateKeys[0]
+		digest := crypto.SHA256.New()
+		digest.Write(detachedContent)
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest.Sum(nil))
+		unsignedAttributesSignerInfo := signerInfo
+		unsignedAttributesSignerInfo.SignedAttributes, unsignedAttributesSignerInfo.Signature = asn1.RawValue{}, signature
+
+		assert.NoError(t, verifyPKCS7Signature(unsignedAttributesSignerInfo, certificate, detachedContent))
+	})
+}
+
+func TestPKCS7DigestAlgorithm(t *testing.T) {
+	t.Run("returns hash function", func(t *testing.T) {
+		assert.Equal(t, crypto.SHA512, pkcs7DigestAlgorithm(oidPKCS7DigestSHA512))
+	})
+
+	t.Run("when digest algorithm is not supported", func(t *testing.T) {
+		assert.Equal(t, crypto.Hash(0), pkcs7DigestAlgorithm(oidPKCS7RSAEncryption))
+	})
+}
+
+func TestPKCS7MessageDigest(t *testing.T) {
+	digestValue, _ := asn1.Marshal([]byte("digest"))
+	attribute, _ := asn1.Marshal(pkcs7Attribute{Type: oidPKCS7AttributeMsgDigest, Values: asn1.RawValue{Bytes: digestValue}})
+
+	t.Run("returns message digest", func(t *testing.T) {
+		assert.Equal(t, []byte("digest"), pkcs7MessageDigest(attribute))
+	})
+
+	t.Run("when message digest attribute not found", func(t *testing.T) {
+		otherAttribute, _ := asn1.Marshal(pkcs7Attribute{Type: oidPKCS7DigestSHA1, Values: asn1.RawValue{Bytes: digestValue}})
+
+		assert.Nil(t, pkcs7MessageDigest(otherAttribute))
+	})
+
+	t.Run("when attributes are malformed", func(t *testing.T) {
+		assert.Nil(t, pkcs7MessageDigest([]byte("attributes")))
+	})
+}
+
+func TestPKCS7SignerCertificate(t *testing.T) {
+	certificates := createSecurityKeyRing().smimeCertificates
+	userCertificate, _ := x509.ParseCertificate(pemBlocks(securityFixture("smime_user.crt"))[0].Bytes)
+	certificates = append(certificates, userCertificate)
+
+	t.Run("when signer identifier is issuer and serial number", func(t *testing.T) {
+		signerIdentifier, _ := asn1.Marshal(
+			pkcs7IssuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: userCertificate.RawIssuer}, SerialNumber: userCertificate.SerialNumber},
+		)
+
+		assert.Equal(t, userCertificate, pkcs7SignerCertificate(pkcs7SignerInfo{SignerIdentifier: asn1.RawValue{FullBytes: signerIdentifier}}, certificates))
+	})
+
+	t.Run("when signer identifier is subject key identifier", func(t *testing.T) {
+		signerIdentifier := asn1.RawValue{Class: asn1.ClassContextSpecific, Bytes: userCertificate.SubjectKeyId}
+		signerIdentifier.FullBytes, _ = asn1.Marshal(signerIdentifier)
+
+		assert.Equal(t, userCertificate, pkcs7SignerCertificate(pkcs7SignerInfo{SignerIdentifier: signerIdentifier}, certificates))
+	})
+
+	t.Run("when signer certificate not found", func(t *testing.T) {
+		assert.Nil(t, pkcs7SignerCertificate(pkcs7SignerInfo{}, certificates))
+	})
+}
+
+func TestIsTrustedCertificate(t *testing.T) {
+	caCertificate := createSecurityKeyRing().smimeCertificates[0]
+	userCertificate, _ := x509.ParseCertificate(pemBlocks(securityFixture("smime_user.crt"))[0].Bytes)
+
+	t.Run("when certificate is trusted certificate", func(t *testing.T) {
+		assert.True(t, isTrustedCertificate(userCertificate, nil, []*x509.Certificate{userCertificate}))
+	})
+
+	t.Run("when certificate is issued by trusted certificate", func(t *testing.T) {
+		assert.True(t, isTrustedCertificate(userCertificate, []*x509.Certificate{userCertificate}, []*x509.Certificate{caCertificate}))
+	})
+
+	t.Run("when certificate is not trusted", func(t *testing.T) {
+		assert.False(t, isTrustedCertificate(caCertificate, nil, []*x509.Certificate{userCertificate}))
+	})
+}
+
+func TestCertificateIdentity(t *testing.T) {
+	t.Run("returns e-mail address", func(t *testing.T) {
+		certificate, _ := x509.ParseCertificate(pemBlocks(securityFixture("smime_user.crt"))[0].Bytes)
+
+		assert.Equal(t, "user@example.com", certificateIdentity(certificate))
+	})
+
+	t.Run("returns subject common name", func(t *testing.T) {
+		assert.Equal(t, "smtpmock test CA", certificateIdentity(createSecurityKeyRing().smimeCertificates[0]))
+	})
+}
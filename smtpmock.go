@@ -1,6 +1,24 @@
 package smtpmock
 
-// New builds new SMTP mock server based on passed configuration attributes
+// Build builds new SMTP mock server based on passed configuration attributes. Returns error
+// for case when configuration attributes are invalid
+func Build(config ConfigurationAttr) (*Server, error) {
+	configuration, err := buildConfiguration(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newServer(configuration), nil
+}
+
+// New builds new SMTP mock server based on passed configuration attributes. It's thin wrapper
+// of Build for configuration which is known to be valid. Panics for case when configuration
+// attributes are invalid, use Build to get error instead
 func New(config ConfigurationAttr) *Server {
-	return newServer(newConfiguration(config))
+	server, err := Build(config)
+	if err != nil {
+		panic(err)
+	}
+
+	return server
 }
@@ -2,7 +2,11 @@ package smtpmock
 
 import (
 	"fmt"
+	"net/smtp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -183,6 +187,7 @@ func TestNew(t *testing.T) {
 		assert.Equal(t, configuration.msgDataReceived, firstMessage.dataResponse)
 		assert.True(t, firstMessage.msg)
 		assert.Equal(t, string(messageBody("user@molo.com", "user1@olo.com"))+"\r\n", firstMessage.msgRequest)
+		assert.Equal(t, string(messageBody("user@molo.com", "user1@olo.com"))+"\r\n.\r\n", firstMessage.msgRawRequest)
 		assert.Equal(t, configuration.msgMsgReceived, firstMessage.msgResponse)
 		assert.True(t, firstMessage.IsConsistent())
 		assert.True(t, firstMessage.rset)
@@ -207,6 +212,29 @@ func TestNew(t *testing.T) {
 		assert.True(t, secondMessage.IsConsistent())
 		assert.True(t, secondMessage.quitSent)
 	})
+
+	t.Run("panics when configuration attributes are invalid", func(t *testing.T) {
+		assert.PanicsWithError(t, fmt.Sprintf("%s: %q", jitterUnknownDistributionErrorMsg, "poisson"), func() {
+			New(ConfigurationAttr{JitterDistribution: "poisson"})
+		})
+	})
+}
+
+func TestBuild(t *testing.T) {
+	t.Run("builds new server when configuration attributes are valid", func(t *testing.T) {
+		server, err := Build(ConfigurationAttr{MsgGreeting: "220 Hi"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "220 Hi", server.configuration.msgGreeting)
+		assert.False(t, server.isStarted())
+	})
+
+	t.Run("returns error when configuration attributes are invalid", func(t *testing.T) {
+		server, err := Build(ConfigurationAttr{JitterDistribution: "poisson"})
+
+		assert.Nil(t, server)
+		assert.EqualError(t, err, fmt.Sprintf("%s: %q", jitterUnknownDistributionErrorMsg, "poisson"))
+	})
 }
 
 func TestServerMessagesRaceCondition(t *testing.T) {
@@ -236,3 +264,644 @@ func TestServerMessagesRaceCondition(t *testing.T) {
 		}
 	})
 }
+
+func TestServerPrependReceivedHeader(t *testing.T) {
+	t.Run("prepends Received header to stored message body", func(t *testing.T) {
+		server := New(ConfigurationAttr{PrependReceivedHeader: true})
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		_ = runSuccessfulSMTPSession(server.configuration.hostAddress, server.PortNumber(), true, 0)
+		messages, err := server.WaitForMessages(1, 1*time.Second)
+		_ = server.Stop()
+
+		assert.NoError(t, err)
+		message := messages[0]
+		body := string(messageBody("user@molo.com", "user2@olo.com")) + "\r\n"
+		assert.Regexp(t, `\AReceived: from olo\.com \(\[127\.0\.0\.1\]\)\r\n\tby localhost with ESMTP id `+message.QueueID()+`\r\n\tfor <user3@olo\.com>;\r\n\t.+\r\n`, message.MsgRequest())
+		assert.True(t, strings.HasSuffix(message.MsgRequest(), body))
+		assert.Equal(t, body+".\r\n", message.MsgRawRequest())
+	})
+
+	t.Run("adds recipient accepted with custom response to Received header", func(t *testing.T) {
+		server := New(
+			ConfigurationAttr{
+				PrependReceivedHeader: true,
+				Rules:                 []Rule{{Commands: []RuleCommand{RuleRcptto}, Pattern: "user@olo.com", Response: "250 Accepted"}},
+			},
+		)
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		address, body := serverWithPortNumber("127.0.0.1", server.PortNumber()), messageBody("user@example.com", "user@olo.com")
+		assert.NoError(t, smtp.SendMail(address, nil, "user@example.com", []string{"user@olo.com"}, body))
+		messages, err := server.WaitForMessages(1, 1*time.Second)
+
+		assert.NoError(t, err)
+		assert.Contains(t, messages[0].MsgRequest(), "\tfor <user@olo.com>;\r\n")
+	})
+}
+
+func TestServerRules(t *testing.T) {
+	t.Run("responds with matched rule response and ends session for rule with fail fast flag", func(t *testing.T) {
+		server := New(
+			ConfigurationAttr{
+				Rules: []Rule{
+					{Commands: []RuleCommand{RuleRcptto}, Pattern: "postmaster@*", Response: "250 Accepted"},
+					{Matcher: DomainSuffixMatcher, Pattern: "invalid.test", Response: "550 Mailbox unavailable", FailFast: true},
+				},
+			},
+		)
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer client.Close()
+
+		assert.NoError(t, client.Hello("example.com"))
+		assert.NoError(t, client.Mail("user@example.com"))
+		assert.NoError(t, client.Rcpt("postmaster@mx.invalid.test"))
+		err = client.Rcpt("user@mx.invalid.test")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Mailbox unavailable")
+
+		messages, err := server.WaitForMessages(1, 1*time.Second)
+		assert.NoError(t, err)
+		transcript, _ := server.Transcript(messages[0].SessionID())
+		assert.Equal(t, SessionClosedByFailFast, transcript.CloseReason)
+	})
+}
+
+func TestServerRulesWithMultipleRcptto(t *testing.T) {
+	t.Run("keeps recipient accepted by rule after failed recipient", func(t *testing.T) {
+		server := New(
+			ConfigurationAttr{
+				MultipleRcptto:      true,
+				NotRegisteredEmails: []string{"b@olo.com"},
+				Rules:               []Rule{{Commands: []RuleCommand{RuleRcptto}, Pattern: "a@*", Response: "250 Accepted"}},
+			},
+		)
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer client.Close()
+
+		assert.NoError(t, client.Hello("example.com"))
+		assert.NoError(t, client.Mail("user@example.com"))
+		assert.NoError(t, client.Rcpt("a@olo.com"))
+		assert.Error(t, client.Rcpt("b@olo.com"))
+		writer, err := client.Data()
+		assert.NoError(t, err)
+		_, _ = writer.Write(messageBody("user@example.com", "a@olo.com"))
+		assert.NoError(t, writer.Close())
+		assert.NoError(t, client.Quit())
+
+		messages, err := server.WaitForMessages(1, 1*time.Second)
+		assert.NoError(t, err)
+		assert.True(t, messages[0].IsConsistent())
+	})
+}
+
+func TestServerResponseSequences(t *testing.T) {
+	t.Run("fails the first attempts of recipient across sessions, then accepts it", func(t *testing.T) {
+		server := New(
+			ConfigurationAttr{
+				ResponseSequences: []ResponseSequence{
+					{Command: RuleRcptto, PerAddress: true, Responses: []string{"451 Try again later", "451 Try again later"}},
+				},
+			},
+		)
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		address, body := serverWithPortNumber("127.0.0.1", server.PortNumber()), messageBody("user@example.com", "user@olo.com")
+		for attempt := 1; attempt <= 2; attempt++ {
+			err := smtp.SendMail(address, nil, "user@example.com", []string{"user@olo.com"}, body)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), "Try again later")
+		}
+		assert.NoError(t, smtp.SendMail(address, nil, "user@example.com", []string{"user@olo.com"}, body))
+
+		server.ResetResponseSequences()
+		assert.Error(t, smtp.SendMail(address, nil, "user@example.com", []string{"user@olo.com"}, body))
+	})
+
+	t.Run("keeps recipient accepted by sequenced response after failed recipient", func(t *testing.T) {
+		server := New(
+			ConfigurationAttr{
+				MultipleRcptto:      true,
+				NotRegisteredEmails: []string{"b@olo.com"},
+				ResponseSequences:   []ResponseSequence{{Command: RuleRcptto, Address: "a@olo.com", Responses: []string{"250 OK later"}}},
+			},
+		)
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer client.Close()
+
+		assert.NoError(t, client.Hello("example.com"))
+		assert.NoError(t, client.Mail("user@example.com"))
+		assert.NoError(t, client.Rcpt("a@olo.com"))
+		assert.Error(t, client.Rcpt("b@olo.com"))
+		writer, err := client.Data()
+		assert.NoError(t, err)
+		_, _ = writer.Write(messageBody("user@example.com", "a@olo.com"))
+		assert.NoError(t, writer.Close())
+		assert.NoError(t, client.Quit())
+
+		messages, err := server.WaitForMessages(1, 1*time.Second)
+		assert.NoError(t, err)
+		assert.True(t, messages[0].IsConsistent())
+		assert.Equal(t, "250 OK later", messages[0].RcpttoRequestResponse()[0][1])
+	})
+}
+
+func TestServerGreylisting(t *testing.T) {
+	t.Run("tempfails unknown triplet, accepts its retry after minimum delay", func(t *testing.T) {
+		server := New(ConfigurationAttr{Greylisting: true})
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		address, body := serverWithPortNumber("127.0.0.1", server.PortNumber()), messageBody("user@example.com", "user@olo.com")
+		err := smtp.SendMail(address, nil, "user@example.com", []string{"user@olo.com"}, body)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Greylisted")
+		assert.NoError(t, smtp.SendMail(address, nil, "user@example.com", []string{"user@olo.com"}, body))
+
+		entries := server.Greylist()
+		assert.Len(t, entries, 1)
+		assert.Equal(t, "127.0.0.1", entries[0].IP)
+		assert.Equal(t, 2, entries[0].Attempts)
+		assert.False(t, entries[0].PassedAt.IsZero())
+	})
+}
+
+func TestServerLimits(t *testing.T) {
+	t.Run("refuses session over total sessions per IP limit with 421 greeting", func(t *testing.T) {
+		server := New(ConfigurationAttr{MaxSessionsPerIP: 1})
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		address := serverWithPortNumber("127.0.0.1", server.PortNumber())
+		client, err := smtp.Dial(address)
+		assert.NoError(t, err)
+		assert.NoError(t, client.Quit())
+
+		_, err = smtp.Dial(address)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Too many sessions")
+	})
+
+	t.Run("rejects recipients over recipients per window limit, ends session for 421 response", func(t *testing.T) {
+		server := New(ConfigurationAttr{MultipleRcptto: true, MaxRcpttosPerWindow: 1, MsgRcpttoRateLimit: "421 Too many recipients"})
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer client.Close()
+
+		assert.NoError(t, client.Hello("example.com"))
+		assert.NoError(t, client.Mail("user@example.com"))
+		assert.NoError(t, client.Rcpt("user1@olo.com"))
+		err = client.Rcpt("user2@olo.com")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Too many recipients")
+
+		messages, err := server.WaitForMessages(1, 1*time.Second)
+		assert.NoError(t, err)
+		transcript, _ := server.Transcript(messages[0].SessionID())
+		assert.Equal(t, SessionClosedByFailFast, transcript.CloseReason)
+	})
+}
+
+func TestServerFaults(t *testing.T) {
+	t.Run("writes HELO response byte by byte, drops connection mid-DATA", func(t *testing.T) {
+		server := New(
+			ConfigurationAttr{
+				Faults: []Fault{
+					{Commands: []FaultCommand{FaultHelo}, Kind: FaultByteByByte, ByteDelay: time.Millisecond},
+					{Commands: []FaultCommand{FaultData}, Kind: FaultDropConnection},
+				},
+			},
+		)
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer client.Close()
+
+		assert.NoError(t, client.Hello("example.com"))
+		assert.NoError(t, client.Mail("user@example.com"))
+		assert.NoError(t, client.Rcpt("user@olo.com"))
+		writer, err := client.Data()
+		assert.NoError(t, err)
+		_, _ = writer.Write([]byte("Subject: Test\r\n\r\nMessage body"))
+		assert.Error(t, writer.Close())
+
+		messages, err := server.WaitForMessages(1, 1*time.Second)
+		assert.NoError(t, err)
+		assert.False(t, messages[0].IsConsistent())
+		transcript, _ := server.Transcript(messages[0].SessionID())
+		assert.Equal(t, SessionClosedByFault, transcript.CloseReason)
+	})
+
+	t.Run("writes half of RCPT TO response for matched request and closes connection", func(t *testing.T) {
+		server := New(ConfigurationAttr{Faults: []Fault{{Kind: FaultHalfReply, Pattern: "RCPT TO:<*@flaky.test>"}}})
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer client.Close()
+
+		assert.NoError(t, client.Hello("example.com"))
+		assert.NoError(t, client.Mail("user@example.com"))
+		_ = client.Rcpt("user@flaky.test")
+		_, err = client.Data()
+		assert.Error(t, err)
+
+		messages, err := server.WaitForMessages(1, 1*time.Second)
+		assert.NoError(t, err)
+		transcript, _ := server.Transcript(messages[0].SessionID())
+		assert.Equal(t, SessionClosedByFault, transcript.CloseReason)
+		assert.Equal(t, "250 Re", transcript.Entries[len(transcript.Entries)-1].Line)
+	})
+
+	t.Run("stalls after greeting until session timeout", func(t *testing.T) {
+		server := New(ConfigurationAttr{SessionTimeout: 1, Faults: []Fault{{Commands: []FaultCommand{FaultGreeting}, Kind: FaultStall}}})
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer client.Close()
+
+		assert.Error(t, client.Hello("example.com"))
+	})
+
+	t.Run("sends TCP RST instead of clean close after QUIT", func(t *testing.T) {
+		server := New(ConfigurationAttr{Faults: []Fault{{Commands: []FaultCommand{FaultQuit}, Kind: FaultReset}}})
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		assert.NoError(t, client.Hello("example.com"))
+		_ = client.Quit()
+
+		messages, err := server.WaitForMessages(1, 1*time.Second)
+		assert.NoError(t, err)
+		transcript, _ := server.Transcript(messages[0].SessionID())
+		assert.Equal(t, SessionClosedByFault, transcript.CloseReason)
+	})
+}
+
+func TestServerScenario(t *testing.T) {
+	t.Run("follows scenario loaded from file", func(t *testing.T) {
+		scenario, err := LoadScenario("testdata/scenario/submission.json")
+		assert.NoError(t, err)
+		server := New(ConfigurationAttr{Scenario: scenario})
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer client.Close()
+
+		assert.NoError(t, client.Hello("example.com"))
+		assert.Contains(t, fmt.Sprint(client.Rcpt("user@olo.com")), "Unexpected command")
+		assert.NoError(t, client.Mail("user@example.com"))
+		assert.Contains(t, fmt.Sprint(client.Rcpt("user@blocked.test")), "Mailbox unavailable")
+		assert.NoError(t, client.Rcpt("user@olo.com"))
+		writer, err := client.Data()
+		assert.NoError(t, err)
+		_, _ = writer.Write([]byte("Subject: Test\r\n\r\nMessage body"))
+		assert.NoError(t, writer.Close())
+		assert.NoError(t, client.Noop())
+		assert.NoError(t, client.Quit())
+
+		messages, err := server.WaitForMessages(1, 1*time.Second)
+		assert.NoError(t, err)
+		assert.True(t, messages[0].IsConsistent())
+		assert.Equal(t, "250 Queued as 42", messages[0].MsgResponse())
+		assert.Equal(t, "Subject: Test\r\n\r\nMessage body\r\n", messages[0].MsgRequest())
+		transcript, _ := server.Transcript(messages[0].SessionID())
+		assert.Equal(t, SessionClosedByQuit, transcript.CloseReason)
+		assert.Equal(t, "220 mx.example.com ESMTP", transcript.Entries[0].Line)
+	})
+}
+
+func TestServerCustomCommands(t *testing.T) {
+	t.Run("handles registered custom command and replaced built-in command", func(t *testing.T) {
+		server := New(ConfigurationAttr{}).
+			RegisterCommand("ETRN", CommandHandlerFunc(func(context *CommandContext) {
+				context.WriteResponse("250 Queuing for "+strings.TrimPrefix(context.Request, "ETRN "), defaultSessionResponseDelay)
+			})).
+			RegisterCommand("DATA", CommandHandlerFunc(func(context *CommandContext) {
+				context.WriteResponse("354 Go ahead", defaultSessionResponseDelay)
+				context.ReceiveMessage("250 Custom queued", defaultSessionResponseDelay)
+			}))
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer client.Close()
+
+		assert.NoError(t, client.Hello("example.com"))
+		id, err := client.Text.Cmd("ETRN example.com")
+		assert.NoError(t, err)
+		client.Text.StartResponse(id)
+		_, response, err := client.Text.ReadResponse(250)
+		client.Text.EndResponse(id)
+		assert.NoError(t, err)
+		assert.Equal(t, "Queuing for example.com", response)
+		assert.NoError(t, client.Mail("user@example.com"))
+		assert.NoError(t, client.Rcpt("user@olo.com"))
+		writer, err := client.Data()
+		assert.NoError(t, err)
+		_, _ = writer.Write([]byte("Subject: Test\r\n\r\nMessage body"))
+		assert.NoError(t, writer.Close())
+		assert.NoError(t, client.Quit())
+
+		messages, err := server.WaitForMessages(1, 1*time.Second)
+		assert.NoError(t, err)
+		assert.True(t, messages[0].IsConsistent())
+		assert.Equal(t, "250 Custom queued", messages[0].MsgResponse())
+		assert.Equal(t, [][]string{{"ETRN example.com", "250 Queuing for example.com"}}, messages[0].CustomRequestResponse())
+	})
+}
+
+func TestServerMiddlewares(t *testing.T) {
+	t.Run("wraps each command handler run, changes responses and aborts session", func(t *testing.T) {
+		var mutex sync.Mutex
+		var commands []string
+		server := New(ConfigurationAttr{}).Use(
+			func(context *CommandContext, next func()) {
+				next()
+				mutex.Lock()
+				defer mutex.Unlock()
+				commands = append(commands, context.Command+" "+context.Response)
+			},
+			func(context *CommandContext, next func()) {
+				if context.Command == "RSET" {
+					context.WriteResponse("421 Aborted", defaultSessionResponseDelay)
+					context.EndSession()
+					return
+				}
+
+				next()
+				if strings.HasSuffix(context.Request, "@blocked.test>") {
+					context.Response = "550 Blocked by middleware"
+				}
+			},
+		)
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer client.Close()
+
+		assert.NoError(t, client.Hello("example.com"))
+		assert.NoError(t, client.Mail("user@example.com"))
+		assert.Contains(t, fmt.Sprint(client.Rcpt("user@blocked.test")), "Blocked by middleware")
+		assert.NoError(t, client.Rcpt("user@olo.com"))
+		writer, err := client.Data()
+		assert.NoError(t, err)
+		_, _ = writer.Write([]byte("Subject: Test\r\n\r\nMessage body"))
+		assert.NoError(t, writer.Close())
+		assert.Contains(t, fmt.Sprint(client.Reset()), "Aborted")
+
+		messages, err := server.WaitForMessages(1, 1*time.Second)
+		assert.NoError(t, err)
+		assert.True(t, messages[0].IsConsistent())
+		transcript, _ := server.Transcript(messages[0].SessionID())
+		assert.Equal(t, SessionClosedByHandler, transcript.CloseReason)
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Equal(t, "RCPT 550 Blocked by middleware", commands[2])
+		assert.Equal(t, "DATA "+defaultReceivedMsg, commands[4])
+		assert.Equal(t, "RSET 421 Aborted", commands[5])
+	})
+
+	t.Run("ends session by response changed by middleware with fail fast scenario", func(t *testing.T) {
+		server := New(ConfigurationAttr{IsCmdFailFast: true, NotRegisteredEmails: []string{"user@rejected.test"}}).Use(
+			func(context *CommandContext, next func()) {
+				next()
+				switch {
+				case strings.HasSuffix(context.Request, "@rejected.test>"):
+					context.Response = "250 Accepted by middleware"
+				case strings.HasSuffix(context.Request, "@blocked.test>"):
+					context.Response = "550 Blocked by middleware"
+				}
+			},
+		)
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer client.Close()
+
+		assert.NoError(t, client.Hello("example.com"))
+		assert.NoError(t, client.Mail("user@example.com"))
+		assert.NoError(t, client.Rcpt("user@rejected.test"))
+		assert.Contains(t, fmt.Sprint(client.Rcpt("user@blocked.test")), "Blocked by middleware")
+
+		messages, err := server.WaitForMessages(1, 1*time.Second)
+		assert.NoError(t, err)
+		transcript, _ := server.Transcript(messages[0].SessionID())
+		assert.Equal(t, SessionClosedByFailFast, transcript.CloseReason)
+		assert.EqualError(t, transcript.CloseError, "550 Blocked by middleware")
+	})
+}
+
+func TestServerRuntimeUpdate(t *testing.T) {
+	t.Run("applies updated configuration to new sessions, active sessions keep configuration of their start", func(t *testing.T) {
+		server := New(ConfigurationAttr{})
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		activeClient, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer activeClient.Close()
+		assert.NoError(t, activeClient.Hello("example.com"))
+
+		assert.NoError(t, server.Update(ConfigurationAttr{BlacklistedMailfromEmails: []string{"user@blocked.test"}, MsgMailfromBlacklistedEmail: "550 Sender blocked"}))
+
+		newClient, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer newClient.Close()
+
+		assert.NoError(t, activeClient.Mail("user@blocked.test"))
+		assert.Contains(t, fmt.Sprint(newClient.Mail("user@blocked.test")), "Sender blocked")
+	})
+
+	t.Run("updates configuration concurrently with running sessions", func(t *testing.T) {
+		server := New(ConfigurationAttr{})
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		var waitGroup sync.WaitGroup
+		for index := 0; index < 5; index++ {
+			waitGroup.Add(2)
+			go func() {
+				defer waitGroup.Done()
+				_ = server.Update(ConfigurationAttr{ResponseDelayJitterDuration: time.Millisecond, Faults: []Fault{{Kind: FaultReset, Probability: 0.01}}})
+			}()
+			go func() {
+				defer waitGroup.Done()
+				client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+				if err != nil {
+					return
+				}
+				defer client.Close()
+				_ = client.Hello("example.com")
+				_ = client.Quit()
+			}()
+		}
+		waitGroup.Wait()
+
+		assert.Equal(t, time.Millisecond, server.currentConfiguration().responseDelayJitter)
+	})
+
+	t.Run("keeps serving with previous configuration when updated configuration is invalid", func(t *testing.T) {
+		server := New(ConfigurationAttr{BlacklistedMailfromEmails: []string{"user@blocked.test"}, MsgMailfromBlacklistedEmail: "550 Sender blocked"})
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		assert.Error(t, server.Update(ConfigurationAttr{Rules: []Rule{{Matcher: RegexMatcher, Pattern: "("}}}))
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer client.Close()
+		assert.NoError(t, client.Hello("example.com"))
+		assert.Contains(t, fmt.Sprint(client.Mail("user@blocked.test")), "Sender blocked")
+		assert.NoError(t, client.Mail("user@example.com"))
+	})
+}
+
+func TestServerResponseDelays(t *testing.T) {
+	t.Run("delays greeting and commands with sub-second delays and jitter", func(t *testing.T) {
+		var delays []time.Duration
+		var mutex sync.Mutex
+		defer func(originalTimeSleep func(time.Duration) time.Duration) { timeSleep = originalTimeSleep }(timeSleep)
+		timeSleep = func(delay time.Duration) time.Duration {
+			mutex.Lock()
+			defer mutex.Unlock()
+			delays = append(delays, delay)
+			return delay
+		}
+		server := New(
+			ConfigurationAttr{
+				ResponseDelayGreetingDuration: 100 * time.Millisecond,
+				ResponseDelayHeloDuration:     300 * time.Millisecond,
+				ResponseDelayJitterDuration:   50 * time.Millisecond,
+				RandomSeed:                    42,
+			},
+		)
+
+		if err := server.Start(); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer func() { _ = server.Stop() }()
+
+		client, err := smtp.Dial(serverWithPortNumber("127.0.0.1", server.PortNumber()))
+		assert.NoError(t, err)
+		defer client.Close()
+		assert.NoError(t, client.Hello("example.com"))
+		assert.NoError(t, client.Quit())
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		jitter := newJitter(server.configuration)
+		assert.Equal(t, []time.Duration{jitter.apply(100 * time.Millisecond), jitter.apply(300 * time.Millisecond)}, delays)
+		assert.InDelta(t, int64(100*time.Millisecond), int64(delays[0]), float64(50*time.Millisecond))
+		assert.InDelta(t, int64(300*time.Millisecond), int64(delays[1]), float64(50*time.Millisecond))
+	})
+}
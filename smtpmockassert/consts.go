@@ -0,0 +1,9 @@
+package smtpmockassert
+
+const (
+	// Failure output
+	maxTextLength = 80 // in characters
+
+	// Helpers
+	emptyString = ""
+)
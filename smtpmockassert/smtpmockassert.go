@@ -0,0 +1,284 @@
+// Package smtpmockassert provides fluent assertions for messages captured by SMTP mock server
+package smtpmockassert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	smtpmock "github.com/mocktools/go-smtp-mock/v2"
+)
+
+// MessagesAssertion is the chainable set of criteria for captured messages. Every criteria
+// method narrows the set of matched messages, terminal methods (Exactly, AtLeast, None)
+// assert the number of matched messages and report failure to testing.TB
+type MessagesAssertion struct {
+	tb       testing.TB
+	messages []smtpmock.Message
+	criteria []criterion
+}
+
+// Message criterion. Mismatch returns description of message context which doesn't
+// satisfy criterion, it returns empty string for case when message matches criterion
+type criterion struct {
+	description string
+	mismatch    func(smtpmock.Message) string
+}
+
+// Messages builds new assertion for the given captured messages, usually server.Messages()
+func Messages(tb testing.TB, messages []smtpmock.Message) *MessagesAssertion {
+	return &MessagesAssertion{tb: tb, messages: messages}
+}
+
+// From narrows matched messages to messages with the given MAIL FROM address.
+// Addresses are compared case-insensitively
+func (assertion *MessagesAssertion) From(address string) *MessagesAssertion {
+	return assertion.with("from <"+address+">", func(message smtpmock.Message) string {
+		if sender := message.Sender(); !strings.EqualFold(sender, address) {
+			return fmt.Sprintf("sender is <%s>", sender)
+		}
+
+		return emptyString
+	})
+}
+
+// To narrows matched messages to messages with the given accepted RCPT TO address.
+// Addresses are compared case-insensitively
+func (assertion *MessagesAssertion) To(address string) *MessagesAssertion {
+	return assertion.with("to <"+address+">", func(message smtpmock.Message) string {
+		recipients := message.Recipients()
+		for _, recipient := range recipients {
+			if strings.EqualFold(recipient, address) {
+				return emptyString
+			}
+		}
+
+		return fmt.Sprintf("recipients are %s", formatAddresses(recipients))
+	})
+}
+
+// WithSubject narrows matched messages to messages with decoded subject matching
+// the given regex pattern
+func (assertion *MessagesAssertion) WithSubject(regexPattern string) *MessagesAssertion {
+	return assertion.WithHeader("Subject", regexPattern)
+}
+
+// WithHeader narrows matched messages to messages with decoded header value matching
+// the given regex pattern
+func (assertion *MessagesAssertion) WithHeader(name, regexPattern string) *MessagesAssertion {
+	regex := assertion.compile(regexPattern)
+	description := fmt.Sprintf("with %s matching /%s/", strings.ToLower(name), regexPattern)
+
+	return assertion.with(description, func(message smtpmock.Message) string {
+		value, err := decodedHeader(message, name)
+		if err != nil {
+			return fmt.Sprintf("%s can't be decoded: %s", strings.ToLower(name), err)
+		}
+		if !regex.MatchString(value) {
+			return fmt.Sprintf("%s is %q", strings.ToLower(name), value)
+		}
+
+		return emptyString
+	})
+}
+
+// WithText narrows matched messages to messages with plain text or HTML body matching
+// the given regex pattern
+func (assertion *MessagesAssertion) WithText(regexPattern string) *MessagesAssertion {
+	regex := assertion.compile(regexPattern)
+
+	return assertion.with(fmt.Sprintf("with text matching /%s/", regexPattern), func(message smtpmock.Message) string {
+		text, _ := message.TextBody()
+		html, _ := message.HTMLBody()
+		if !regex.MatchString(text) && !regex.MatchString(html) {
+			return fmt.Sprintf("text is %q", truncate(text+html))
+		}
+
+		return emptyString
+	})
+}
+
+// WithLink narrows matched messages to messages containing link with URL matching
+// the given regex pattern
+func (assertion *MessagesAssertion) WithLink(regexPattern string) *MessagesAssertion {
+	regex := assertion.compile(regexPattern)
+
+	return assertion.with(fmt.Sprintf("with link matching /%s/", regexPattern), func(message smtpmock.Message) string {
+		var links []smtpmock.Link
+		var err error
+		if message.MsgRequest() != emptyString {
+			if links, err = message.Links(); err != nil {
+				return fmt.Sprintf("links can't be extracted: %s", err)
+			}
+		}
+
+		var urls []string
+		for _, link := range links {
+			if regex.MatchString(link.URL) {
+				return emptyString
+			}
+
+			urls = append(urls, link.URL)
+		}
+
+		return fmt.Sprintf("links are [%s]", strings.Join(urls, ", "))
+	})
+}
+
+// Consistent narrows matched messages to consistent messages, see Message.IsConsistent()
+func (assertion *MessagesAssertion) Consistent() *MessagesAssertion {
+	return assertion.with("consistent", func(message smtpmock.Message) string {
+		if !message.IsConsistent() {
+			return "message is not consistent"
+		}
+
+		return emptyString
+	})
+}
+
+// Matches returns messages which match all criteria
+func (assertion *MessagesAssertion) Matches() []smtpmock.Message {
+	var matches []smtpmock.Message
+	for _, message := range assertion.messages {
+		if len(assertion.mismatches(message)) == 0 {
+			matches = append(matches, message)
+		}
+	}
+
+	return matches
+}
+
+// Exactly asserts that exactly the given number of messages match all criteria.
+// Returns true for case when assertion passed, otherwise reports failure and returns false
+func (assertion *MessagesAssertion) Exactly(count int) bool {
+	assertion.tb.Helper()
+
+	if matchesCount := len(assertion.Matches()); matchesCount != count {
+		assertion.fail(fmt.Sprintf("exactly %d", count), matchesCount)
+		return false
+	}
+
+	return true
+}
+
+// AtLeast asserts that at least the given number of messages match all criteria.
+// Returns true for case when assertion passed, otherwise reports failure and returns false
+func (assertion *MessagesAssertion) AtLeast(count int) bool {
+	assertion.tb.Helper()
+
+	if matchesCount := len(assertion.Matches()); matchesCount < count {
+		assertion.fail(fmt.Sprintf("at least %d", count), matchesCount)
+		return false
+	}
+
+	return true
+}
+
+// None asserts that no messages match all criteria. Works the same way as Exactly(0)
+func (assertion *MessagesAssertion) None() bool {
+	assertion.tb.Helper()
+	return assertion.Exactly(0)
+}
+
+// Returns new assertion with the given criterion added
+func (assertion *MessagesAssertion) with(description string, mismatch func(smtpmock.Message) string) *MessagesAssertion {
+	criteria := append(append([]criterion{}, assertion.criteria...), criterion{description: description, mismatch: mismatch})
+	return &MessagesAssertion{tb: assertion.tb, messages: assertion.messages, criteria: criteria}
+}
+
+// Compiles criterion regex pattern. Fails test immediately for case when pattern is invalid
+func (assertion *MessagesAssertion) compile(regexPattern string) *regexp.Regexp {
+	assertion.tb.Helper()
+
+	regex, err := regexp.Compile(regexPattern)
+	if err != nil {
+		assertion.tb.Fatalf("invalid regex pattern /%s/: %s", regexPattern, err)
+	}
+
+	return regex
+}
+
+// Returns mismatches of message with all criteria
+func (assertion *MessagesAssertion) mismatches(message smtpmock.Message) []string {
+	var mismatches []string
+	for _, criterion := range assertion.criteria {
+		if mismatch := criterion.mismatch(message); mismatch != emptyString {
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+
+	return mismatches
+}
+
+// Reports assertion failure with compact summary of every captured message and its mismatches
+func (assertion *MessagesAssertion) fail(expectation string, matchesCount int) {
+	assertion.tb.Helper()
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "expected %s message(s)%s, found %d\n", expectation, assertion.describe(), matchesCount)
+	fmt.Fprintf(&report, "captured messages (%d):", len(assertion.messages))
+
+	for index, message := range assertion.messages {
+		fmt.Fprintf(&report, "\n  #%d %s", index+1, Summary(message))
+		for _, mismatch := range assertion.mismatches(message) {
+			fmt.Fprintf(&report, "\n     - %s", mismatch)
+		}
+	}
+
+	assertion.tb.Errorf("%s", report.String())
+}
+
+// Returns description of all criteria
+func (assertion *MessagesAssertion) describe() string {
+	var descriptions []string
+	for _, criterion := range assertion.criteria {
+		descriptions = append(descriptions, criterion.description)
+	}
+
+	if len(descriptions) == 0 {
+		return emptyString
+	}
+
+	return " " + strings.Join(descriptions, ", ")
+}
+
+// Summary returns compact one line description of captured message: sender, accepted
+// recipients, subject and consistency status
+func Summary(message smtpmock.Message) string {
+	subject, _ := decodedHeader(message, "Subject")
+	consistency := "consistent"
+	if !message.IsConsistent() {
+		consistency = "not consistent"
+	}
+
+	return fmt.Sprintf("from <%s> to %s, subject %q, %s", message.Sender(), formatAddresses(message.Recipients()), subject, consistency)
+}
+
+// Returns decoded header value of captured message. Returns empty string for case when
+// message has no body
+func decodedHeader(message smtpmock.Message, name string) (string, error) {
+	if message.MsgRequest() == emptyString {
+		return emptyString, nil
+	}
+
+	return message.DecodedHeader(name)
+}
+
+// Formats addresses as comma separated list of angle bracketed addresses
+func formatAddresses(addresses []string) string {
+	if len(addresses) == 0 {
+		return "<>"
+	}
+
+	return "<" + strings.Join(addresses, ">, <") + ">"
+}
+
+// Truncates long text to make failure output compact
+func truncate(text string) string {
+	if runes := []rune(text); len(runes) > maxTextLength {
+		return string(runes[:maxTextLength]) + "..."
+	}
+
+	return text
+}
@@ -0,0 +1,232 @@
+package smtpmockassert
+
+import (
+	"net"
+	"net/smtp"
+	"strconv"
+	"testing"
+	"time"
+
+	smtpmock "github.com/mocktools/go-smtp-mock/v2"
+	"github.com/mocktools/go-smtp-mock/v2/smtpmocktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Returns messages captured by SMTP mock server: reset password message, welcome message
+// and not consistent message with rejected recipient
+func capturedMessages(t *testing.T) []smtpmock.Message {
+	server := smtpmocktest.NewServer(t, smtpmock.ConfigurationAttr{NotRegisteredEmails: []string{"rejected@example.com"}})
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(server.PortNumber()))
+
+	assert.NoError(t, smtp.SendMail(address, nil, "a@example.com", []string{"x@example.com"}, []byte(
+		"Subject: Reset password\r\n"+
+			"Content-Type: text/html\r\n"+
+			"\r\n"+
+			`<a href="https://example.com/reset?token=abc">Reset</a> Code: 123456`+"\r\n",
+	)))
+	assert.NoError(t, smtp.SendMail(address, nil, "b@example.com", []string{"y@example.com"}, []byte(
+		"Subject: Welcome\r\n\r\nHello\r\n",
+	)))
+
+	client, _ := smtp.Dial(address)
+	assert.NoError(t, client.Mail("c@example.com"))
+	assert.Error(t, client.Rcpt("rejected@example.com"))
+	assert.NoError(t, client.Quit())
+
+	messages, err := server.WaitForMessages(3, time.Second)
+	assert.NoError(t, err)
+
+	return messages
+}
+
+// Returns message with malformed body captured by SMTP mock server
+func malformedMessage(t *testing.T) smtpmock.Message {
+	server := smtpmocktest.NewServer(t, smtpmock.ConfigurationAttr{})
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(server.PortNumber()))
+
+	assert.NoError(t, smtp.SendMail(address, nil, "a@example.com", []string{"x@example.com"}, []byte("Malformed header\r\n")))
+	messages, err := server.WaitForMessages(1, time.Second)
+	assert.NoError(t, err)
+
+	return messages[0]
+}
+
+func TestMessages(t *testing.T) {
+	t.Run("returns new assertion", func(t *testing.T) {
+		messages := []smtpmock.Message{{}}
+
+		assert.Equal(t, &MessagesAssertion{tb: t, messages: messages}, Messages(t, messages))
+	})
+}
+
+func TestMessagesAssertionCriteria(t *testing.T) {
+	messages := capturedMessages(t)
+
+	t.Run("narrows matched messages", func(t *testing.T) {
+		for _, testCase := range []struct {
+			assertion *MessagesAssertion
+			senders   []string
+		}{
+			{Messages(t, messages), []string{"a@example.com", "b@example.com", "c@example.com"}},
+			{Messages(t, messages).From("B@example.com"), []string{"b@example.com"}},
+			{Messages(t, messages).To("X@example.com"), []string{"a@example.com"}},
+			{Messages(t, messages).To("rejected@example.com"), nil},
+			{Messages(t, messages).WithSubject(`(?i)reset`), []string{"a@example.com"}},
+			{Messages(t, messages).WithHeader("Subject", `\AWelcome\z`), []string{"b@example.com"}},
+			{Messages(t, messages).WithText(`Code: \d{6}`), []string{"a@example.com"}},
+			{Messages(t, messages).WithText(`Hello`), []string{"b@example.com"}},
+			{Messages(t, messages).WithLink(`/reset\?token=`), []string{"a@example.com"}},
+			{Messages(t, messages).Consistent(), []string{"a@example.com", "b@example.com"}},
+			{Messages(t, messages).Consistent().To("y@example.com").WithSubject("Reset"), nil},
+		} {
+			var senders []string
+			for _, message := range testCase.assertion.Matches() {
+				senders = append(senders, message.Sender())
+			}
+
+			assert.Equal(t, testCase.senders, senders)
+		}
+	})
+
+	t.Run("doesn't change original assertion", func(t *testing.T) {
+		assertion := Messages(t, messages).Consistent()
+		assertion.From("a@example.com")
+
+		assert.Len(t, assertion.Matches(), 2)
+	})
+
+	t.Run("when message has no body", func(t *testing.T) {
+		assertion := Messages(t, messages).WithSubject("Reset").WithLink("reset")
+
+		assert.Equal(t, `subject is ""`, assertion.criteria[0].mismatch(smtpmock.Message{}))
+		assert.Equal(t, "links are []", assertion.criteria[1].mismatch(smtpmock.Message{}))
+	})
+
+	t.Run("when message doesn't match criteria", func(t *testing.T) {
+		assertion := Messages(t, messages).WithLink("unsubscribe").WithText("Goodbye")
+
+		assert.Equal(t, "links are [https://example.com/reset?token=abc]", assertion.criteria[0].mismatch(messages[0]))
+		assert.Equal(t, `text is "Hello\r\n"`, assertion.criteria[1].mismatch(messages[1]))
+	})
+
+	t.Run("when header can't be decoded", func(t *testing.T) {
+		assertion, message := Messages(t, messages).WithHeader("Subject", "Reset"), malformedMessage(t)
+		_, err := message.DecodedHeader("Subject")
+
+		assert.Equal(t, "subject can't be decoded: "+err.Error(), assertion.criteria[0].mismatch(message))
+	})
+
+	t.Run("when links can't be extracted", func(t *testing.T) {
+		assertion, message := Messages(t, messages).WithLink("reset"), malformedMessage(t)
+		_, err := message.Links()
+
+		assert.Equal(t, "links can't be extracted: "+err.Error(), assertion.criteria[0].mismatch(message))
+	})
+
+	t.Run("when regex pattern is invalid", func(t *testing.T) {
+		tb, done := new(testingTBMock), make(chan interface{})
+		tb.On("Fatalf", "invalid regex pattern /%s/: %s", mock.Anything).Once().Return()
+		go func() {
+			defer close(done)
+			Messages(tb, messages).WithText(`\K`)
+		}()
+		<-done
+
+		tb.AssertExpectations(t)
+	})
+}
+
+func TestMessagesAssertionExactly(t *testing.T) {
+	messages := capturedMessages(t)
+
+	t.Run("when assertion passed", func(t *testing.T) {
+		tb := new(testingTBMock)
+
+		assert.True(t, Messages(tb, messages).To("x@example.com").WithSubject("Reset").WithLink(`/reset\?token=`).Exactly(1))
+		tb.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+	})
+
+	t.Run("when assertion failed", func(t *testing.T) {
+		tb := new(testingTBMock)
+		report := "expected exactly 1 message(s) to <y@example.com>, with subject matching /Reset/, found 0\n" +
+			"captured messages (3):\n" +
+			"  #1 from <a@example.com> to <x@example.com>, subject \"Reset password\", consistent\n" +
+			"     - recipients are <x@example.com>\n" +
+			"  #2 from <b@example.com> to <y@example.com>, subject \"Welcome\", consistent\n" +
+			"     - subject is \"Welcome\"\n" +
+			"  #3 from <c@example.com> to <>, subject \"\", not consistent\n" +
+			"     - recipients are <>\n" +
+			"     - subject is \"\""
+		tb.On("Errorf", "%s", []interface{}{report}).Once().Return()
+
+		assert.False(t, Messages(tb, messages).To("y@example.com").WithSubject("Reset").Exactly(1))
+		tb.AssertExpectations(t)
+	})
+}
+
+func TestMessagesAssertionAtLeast(t *testing.T) {
+	messages := capturedMessages(t)
+
+	t.Run("when assertion passed", func(t *testing.T) {
+		tb := new(testingTBMock)
+
+		assert.True(t, Messages(tb, messages).Consistent().AtLeast(2))
+		tb.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+	})
+
+	t.Run("when assertion failed", func(t *testing.T) {
+		tb := new(testingTBMock)
+		tb.On("Errorf", "%s", mock.Anything).Once().Return()
+
+		assert.False(t, Messages(tb, messages).Consistent().AtLeast(3))
+		assert.Contains(t, tb.Calls[0].Arguments[1].([]interface{})[0], "expected at least 3 message(s) consistent, found 2\n")
+	})
+}
+
+func TestMessagesAssertionNone(t *testing.T) {
+	messages := capturedMessages(t)
+
+	t.Run("when assertion passed", func(t *testing.T) {
+		tb := new(testingTBMock)
+
+		assert.True(t, Messages(tb, messages).WithText("Goodbye").None())
+		tb.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+	})
+
+	t.Run("when assertion failed", func(t *testing.T) {
+		tb := new(testingTBMock)
+		tb.On("Errorf", "%s", mock.Anything).Once().Return()
+
+		assert.False(t, Messages(tb, messages).None())
+		assert.Contains(t, tb.Calls[0].Arguments[1].([]interface{})[0], "expected exactly 0 message(s), found 3\n")
+	})
+}
+
+func TestSummary(t *testing.T) {
+	t.Run("returns message summary", func(t *testing.T) {
+		assert.Equal(t, `from <> to <>, subject "", not consistent`, Summary(smtpmock.Message{}))
+	})
+}
+
+func TestFormatAddresses(t *testing.T) {
+	t.Run("returns formatted addresses", func(t *testing.T) {
+		assert.Equal(t, "<a@example.com>, <b@example.com>", formatAddresses([]string{"a@example.com", "b@example.com"}))
+	})
+
+	t.Run("when addresses are empty", func(t *testing.T) {
+		assert.Equal(t, "<>", formatAddresses(nil))
+	})
+}
+
+func TestTruncate(t *testing.T) {
+	t.Run("returns short text as is", func(t *testing.T) {
+		assert.Equal(t, "text", truncate("text"))
+	})
+
+	t.Run("returns truncated long text", func(t *testing.T) {
+		text := string(make([]rune, maxTextLength+1))
+
+		assert.Equal(t, string(make([]rune, maxTextLength))+"...", truncate(text))
+	})
+}
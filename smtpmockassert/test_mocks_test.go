@@ -0,0 +1,28 @@
+package smtpmockassert
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Testing mocks
+
+// testing.TB mock
+type testingTBMock struct {
+	testing.TB
+	mock.Mock
+}
+
+func (tb *testingTBMock) Helper() {}
+
+func (tb *testingTBMock) Errorf(format string, args ...interface{}) {
+	tb.Called(format, args)
+}
+
+// Stops calling goroutine the same way as testing.T does
+func (tb *testingTBMock) Fatalf(format string, args ...interface{}) {
+	tb.Called(format, args)
+	runtime.Goexit()
+}
@@ -0,0 +1,14 @@
+package smtpmockexpect
+
+import "time"
+
+const (
+	// Expectation times
+	unlimitedTimes = -1
+
+	// Verification
+	defaultVerifyTimeout = time.Second
+
+	// Helpers
+	emptyString = ""
+)
@@ -0,0 +1,276 @@
+// Package smtpmockexpect provides mock framework style expectations for messages captured by
+// SMTP mock server. Expectations are declared up front, traffic is checked as it arrives and
+// all unmet or violated expectations are reported by Verify at the end of test
+package smtpmockexpect
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	smtpmock "github.com/mocktools/go-smtp-mock/v2"
+	"github.com/mocktools/go-smtp-mock/v2/smtpmockassert"
+)
+
+// Controller records messages stored by server after controller creation and checks them
+// against declared expectations
+type Controller struct {
+	server                   *smtpmock.Server
+	subscription             *smtpmock.Subscription
+	createdAt                time.Time
+	expectations             []*Expectation
+	forbiddenResponseClasses []int
+	violations               []string
+	sync.Mutex
+}
+
+// Expectation is the expected number of messages which match message filter
+type Expectation struct {
+	filter             smtpmock.MessageFilter
+	minTimes, maxTimes int
+	count              int
+	controller         *Controller
+}
+
+// NewController builds new controller subscribed to messages of the given server. Should be
+// created before SMTP traffic, already stored messages and sessions started before controller
+// creation are not checked
+func NewController(server *smtpmock.Server) *Controller {
+	controller := &Controller{server: server, createdAt: time.Now()}
+	controller.subscription = server.Subscribe(controller.record)
+
+	return controller
+}
+
+// Expect declares expectation of messages which match the given filter. Expects exactly one
+// message by default, use Times, AtLeast, AtMost, Never or AnyTimes to change it.
+// Messages which don't match any expectation are reported as unexpected
+func (controller *Controller) Expect(filter smtpmock.MessageFilter) *Expectation {
+	controller.Lock()
+	defer controller.Unlock()
+
+	expectation := &Expectation{filter: filter, minTimes: 1, maxTimes: 1, controller: controller}
+	controller.expectations = append(controller.expectations, expectation)
+
+	return expectation
+}
+
+// ForbidResponseClass declares that server should not send responses of the given class,
+// e.g. 5 for 5xx responses. Every response line of session transcripts is checked including
+// greeting, NOOP, QUIT and invalid command responses
+func (controller *Controller) ForbidResponseClass(responseClass int) {
+	controller.Lock()
+	defer controller.Unlock()
+	controller.forbiddenResponseClasses = append(controller.forbiddenResponseClasses, responseClass)
+}
+
+// Verify waits up to 1 second for active sessions, then stops recording of messages and reports
+// to tb every violated expectation in order of message arrival, every forbidden response in
+// order of session end and then every unmet expectation. Timeout of waiting for active sessions
+// is reported too. Returns true for case when all expectations are met, otherwise returns false
+func (controller *Controller) Verify(tb testing.TB) bool {
+	tb.Helper()
+	return controller.VerifyWithin(tb, defaultVerifyTimeout)
+}
+
+// VerifyWithin works the same way as Verify, but waits for active sessions up to the given
+// timeout. Server stores message after session end, so message of client which has already
+// sent QUIT can be stored a bit later. Messages of sessions which are still active after
+// timeout are not checked
+func (controller *Controller) VerifyWithin(tb testing.TB, timeout time.Duration) bool {
+	tb.Helper()
+	var failures []string
+	if err := controller.server.WaitForSessions(timeout); err != nil {
+		failures = append(failures, fmt.Sprintf("%s within %s", err, timeout))
+	}
+	controller.subscription.Unsubscribe()
+
+	controller.Lock()
+	defer controller.Unlock()
+
+	failures = append(failures, controller.violations...)
+	failures = append(failures, controller.forbiddenResponses()...)
+	for _, expectation := range controller.expectations {
+		if expectation.count < expectation.minTimes {
+			failures = append(failures, fmt.Sprintf("missing message(s): %s", expectation.report()))
+		}
+	}
+
+	for _, failure := range failures {
+		tb.Errorf("%s", failure)
+	}
+
+	return len(failures) == 0
+}
+
+// Checks stored message against expectations, records violations
+func (controller *Controller) record(message smtpmock.Message) {
+	controller.Lock()
+	defer controller.Unlock()
+
+	if message.MailfromRequest() == emptyString {
+		return
+	}
+
+	var exhausted *Expectation
+	for _, expectation := range controller.expectations {
+		if !expectation.filter.Match(message) {
+			continue
+		}
+
+		if expectation.maxTimes == unlimitedTimes || expectation.count < expectation.maxTimes {
+			expectation.count++
+			return
+		}
+
+		if exhausted == nil {
+			exhausted = expectation
+		}
+	}
+
+	if exhausted != nil {
+		exhausted.count++
+		controller.violate("unexpected message %s: %s", smtpmockassert.Summary(message), exhausted.report())
+		return
+	}
+
+	controller.violate("unexpected message %s: no matching expectation", smtpmockassert.Summary(message))
+}
+
+// Returns forbidden response lines of sessions started after controller creation. Transcript
+// has every response line exactly once, so response shared by several messages of the same
+// session is reported once
+func (controller *Controller) forbiddenResponses() []string {
+	var forbidden []string
+	for _, transcript := range controller.server.Transcripts() {
+		if transcript.StartedAt.Before(controller.createdAt) {
+			continue
+		}
+
+		for _, entry := range transcript.Entries {
+			if entry.Direction != smtpmock.ServerResponse || entry.Line == emptyString {
+				continue
+			}
+
+			for _, responseClass := range controller.forbiddenResponseClasses {
+				if int(entry.Line[0]-'0') == responseClass {
+					forbidden = append(forbidden, fmt.Sprintf("forbidden %dxx response %q in session %d", responseClass, entry.Line, transcript.SessionID))
+				}
+			}
+		}
+	}
+
+	return forbidden
+}
+
+// Records violation
+func (controller *Controller) violate(format string, args ...interface{}) {
+	controller.violations = append(controller.violations, fmt.Sprintf(format, args...))
+}
+
+// Times sets expected exactly the given number of messages
+func (expectation *Expectation) Times(count int) *Expectation {
+	return expectation.setTimes(count, count)
+}
+
+// AtLeast sets expected at least the given number of messages
+func (expectation *Expectation) AtLeast(count int) *Expectation {
+	return expectation.setTimes(count, unlimitedTimes)
+}
+
+// AtMost sets expected at most the given number of messages
+func (expectation *Expectation) AtMost(count int) *Expectation {
+	return expectation.setTimes(0, count)
+}
+
+// Never sets expected no messages. Works the same way as Times(0)
+func (expectation *Expectation) Never() *Expectation {
+	return expectation.setTimes(0, 0)
+}
+
+// AnyTimes allows any number of messages including zero
+func (expectation *Expectation) AnyTimes() *Expectation {
+	return expectation.setTimes(0, unlimitedTimes)
+}
+
+// Thread-safe setter of expected number of messages range
+func (expectation *Expectation) setTimes(minTimes, maxTimes int) *Expectation {
+	expectation.controller.Lock()
+	defer expectation.controller.Unlock()
+	expectation.minTimes, expectation.maxTimes = minTimes, maxTimes
+
+	return expectation
+}
+
+// Returns report of expected and actual number of messages
+func (expectation *Expectation) report() string {
+	return fmt.Sprintf("expected %s message(s) %s, got %d", expectation.times(), describeFilter(expectation.filter), expectation.count)
+}
+
+// Returns description of expected number of messages
+func (expectation *Expectation) times() string {
+	switch {
+	case expectation.maxTimes == 0:
+		return "no"
+	case expectation.minTimes == expectation.maxTimes:
+		return fmt.Sprintf("exactly %d", expectation.minTimes)
+	case expectation.maxTimes == unlimitedTimes && expectation.minTimes == 0:
+		return "any number of"
+	case expectation.maxTimes == unlimitedTimes:
+		return fmt.Sprintf("at least %d", expectation.minTimes)
+	default:
+		return fmt.Sprintf("at most %d", expectation.maxTimes)
+	}
+}
+
+// Returns description of message filter criteria
+func describeFilter(filter smtpmock.MessageFilter) string {
+	var criteria []string
+	if filter.From != emptyString {
+		criteria = append(criteria, fmt.Sprintf("from <%s>", filter.From))
+	}
+	if filter.To != emptyString {
+		criteria = append(criteria, fmt.Sprintf("to <%s>", filter.To))
+	}
+	if filter.Subject != nil {
+		criteria = append(criteria, fmt.Sprintf("with subject matching /%s/", filter.Subject))
+	}
+	for _, name := range sortedHeaderNames(filter) {
+		criteria = append(criteria, fmt.Sprintf("with %s matching /%s/", strings.ToLower(name), filter.Headers[name]))
+	}
+	if !filter.ReceivedAfter.IsZero() {
+		criteria = append(criteria, fmt.Sprintf("received after %s", filter.ReceivedAfter))
+	}
+	if !filter.ReceivedBefore.IsZero() {
+		criteria = append(criteria, fmt.Sprintf("received before %s", filter.ReceivedBefore))
+	}
+	switch filter.Consistency {
+	case smtpmock.ConsistentMessages:
+		criteria = append(criteria, "consistent")
+	case smtpmock.InconsistentMessages:
+		criteria = append(criteria, "not consistent")
+	}
+	if filter.ResponseClass != 0 {
+		criteria = append(criteria, fmt.Sprintf("with %dxx response", filter.ResponseClass))
+	}
+
+	if len(criteria) == 0 {
+		return "of any kind"
+	}
+
+	return strings.Join(criteria, ", ")
+}
+
+// Returns message filter header names in stable order
+func sortedHeaderNames(filter smtpmock.MessageFilter) []string {
+	names := make([]string, 0, len(filter.Headers))
+	for name := range filter.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,252 @@
+package smtpmockexpect
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	smtpmock "github.com/mocktools/go-smtp-mock/v2"
+	"github.com/mocktools/go-smtp-mock/v2/smtpmocktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Returns SMTP mock server which rejects rejected@example.com recipient
+func newServer(t *testing.T) *smtpmock.Server {
+	return smtpmocktest.NewServer(t, smtpmock.ConfigurationAttr{NotRegisteredEmails: []string{"rejected@example.com"}})
+}
+
+// Sends messages to server one by one, waits until each of them is stored to keep order of
+// message arrival
+func sendMessages(t *testing.T, server *smtpmock.Server, recipients ...string) {
+	address, count := net.JoinHostPort("127.0.0.1", strconv.Itoa(server.PortNumber())), len(server.Messages())
+	for index, recipient := range recipients {
+		_ = smtp.SendMail(address, nil, "sender@example.com", []string{recipient}, []byte("Subject: Invoice\r\n\r\nHello\r\n"))
+		_, err := server.WaitForMessages(count+index+1, time.Second)
+		assert.NoError(t, err)
+	}
+}
+
+func TestNewController(t *testing.T) {
+	t.Run("subscribes to messages stored after controller creation", func(t *testing.T) {
+		server, tb := newServer(t), new(testingTBMock)
+		sendMessages(t, server, "before@example.com")
+		controller := NewController(server)
+		controller.ForbidResponseClass(2)
+
+		assert.NotNil(t, controller.subscription)
+		assert.True(t, controller.Verify(tb))
+	})
+}
+
+func TestControllerVerify(t *testing.T) {
+	t.Run("when all expectations are met", func(t *testing.T) {
+		server, tb := newServer(t), new(testingTBMock)
+		controller := NewController(server)
+		controller.Expect(smtpmock.MessageFilter{To: "billing@example.com"}).Times(2)
+		controller.Expect(smtpmock.MessageFilter{To: "admin@example.com"}).Never()
+		controller.Expect(smtpmock.MessageFilter{Subject: regexp.MustCompile("Invoice")}).AnyTimes()
+		controller.ForbidResponseClass(5)
+		sendMessages(t, server, "billing@example.com", "billing@example.com", "user@example.com")
+
+		assert.True(t, controller.Verify(tb))
+		tb.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+	})
+
+	t.Run("when expectations are violated or unmet", func(t *testing.T) {
+		server, tb := newServer(t), new(testingTBMock)
+		tb.On("Errorf", "%s", mock.Anything).Return()
+		controller := NewController(server)
+		controller.Expect(smtpmock.MessageFilter{To: "billing@example.com"}).Times(2)
+		controller.Expect(smtpmock.MessageFilter{To: "admin@example.com"}).Never()
+		controller.Expect(smtpmock.MessageFilter{From: "sender@example.com", Subject: regexp.MustCompile("Receipt")}).AtLeast(1)
+		controller.ForbidResponseClass(5)
+		sendMessages(t, server, "billing@example.com", "admin@example.com", "rejected@example.com")
+
+		assert.False(t, controller.Verify(tb))
+		assert.Equal(
+			t,
+			[]string{
+				`unexpected message from <sender@example.com> to <admin@example.com>, subject "Invoice", consistent: expected no message(s) to <admin@example.com>, got 1`,
+				`unexpected message from <sender@example.com> to <>, subject "", not consistent: no matching expectation`,
+				`forbidden 5xx response "550 User not found" in session 3`,
+				`missing message(s): expected exactly 2 message(s) to <billing@example.com>, got 1`,
+				`missing message(s): expected at least 1 message(s) from <sender@example.com>, with subject matching /Receipt/, got 0`,
+			},
+			tb.failures(),
+		)
+	})
+
+	t.Run("when message exceeds expected number of messages", func(t *testing.T) {
+		server, tb := newServer(t), new(testingTBMock)
+		tb.On("Errorf", "%s", mock.Anything).Return()
+		controller := NewController(server)
+		controller.Expect(smtpmock.MessageFilter{To: "billing@example.com"}).AtMost(1)
+		sendMessages(t, server, "billing@example.com", "billing@example.com")
+
+		assert.False(t, controller.Verify(tb))
+		assert.Equal(
+			t,
+			[]string{`unexpected message from <sender@example.com> to <billing@example.com>, subject "Invoice", consistent: expected at most 1 message(s) to <billing@example.com>, got 2`},
+			tb.failures(),
+		)
+	})
+
+	t.Run("when forbidden responses are sent outside of message context", func(t *testing.T) {
+		server, tb := newServer(t), new(testingTBMock)
+		tb.On("Errorf", "%s", mock.Anything).Return()
+		controller := NewController(server)
+		controller.ForbidResponseClass(5)
+		conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(server.PortNumber())))
+		assert.NoError(t, err)
+		_, _ = conn.Write([]byte("PING\r\nQUIT\r\n"))
+		_, _ = ioutil.ReadAll(conn)
+		conn.Close()
+
+		assert.False(t, controller.Verify(tb))
+		assert.Equal(
+			t,
+			[]string{`forbidden 5xx response "502 Command unrecognized. Available commands: HELO, EHLO, MAIL FROM:, RCPT TO:, DATA, RSET, NOOP, QUIT" in session 1`},
+			tb.failures(),
+		)
+	})
+
+	t.Run("reports response shared by several messages of session once", func(t *testing.T) {
+		server := smtpmocktest.NewServer(t, smtpmock.ConfigurationAttr{MultipleMessageReceiving: true})
+		tb := new(testingTBMock)
+		tb.On("Errorf", "%s", mock.Anything).Return()
+		controller := NewController(server)
+		controller.Expect(smtpmock.MessageFilter{}).AnyTimes()
+		controller.ForbidResponseClass(2)
+		client, err := smtp.Dial(net.JoinHostPort("127.0.0.1", strconv.Itoa(server.PortNumber())))
+		assert.NoError(t, err)
+		for index := 0; index < 2; index++ {
+			assert.NoError(t, client.Mail("sender@example.com"))
+			assert.NoError(t, client.Rcpt("user@example.com"))
+			writer, err := client.Data()
+			assert.NoError(t, err)
+			_, _ = writer.Write([]byte("Subject: Invoice\r\n\r\nHello\r\n"))
+			assert.NoError(t, writer.Close())
+		}
+		assert.NoError(t, client.Quit())
+
+		assert.False(t, controller.Verify(tb))
+		var expected []string
+		for _, entry := range server.Transcripts()[0].Entries {
+			if entry.Direction == smtpmock.ServerResponse && entry.Line[0] == '2' {
+				expected = append(expected, fmt.Sprintf("forbidden 2xx response %q in session 1", entry.Line))
+			}
+		}
+		assert.Equal(t, expected, tb.failures())
+		assert.Len(t, expected, 9)
+	})
+
+	t.Run("stops recording of messages", func(t *testing.T) {
+		server, tb := newServer(t), new(testingTBMock)
+		controller := NewController(server)
+		controller.Verify(tb)
+		sendMessages(t, server, "user@example.com")
+
+		assert.Empty(t, controller.violations)
+	})
+}
+
+func TestControllerVerifyWithin(t *testing.T) {
+	// Returns SMTP mock server which stores message the given delay after QUIT response
+	newDelayedServer := func(t *testing.T, delay time.Duration) *smtpmock.Server {
+		server := smtpmock.New(smtpmock.ConfigurationAttr{}).WithLogger(&delayedQuitLogger{delay: delay})
+		assert.NoError(t, server.Start())
+		t.Cleanup(func() { _ = server.Stop() })
+
+		return server
+	}
+
+	t.Run("waits for message of session which client has already ended", func(t *testing.T) {
+		server, tb := newDelayedServer(t, 100*time.Millisecond), new(testingTBMock)
+		controller := NewController(server)
+		controller.Expect(smtpmock.MessageFilter{To: "billing@example.com"})
+		address := net.JoinHostPort("127.0.0.1", strconv.Itoa(server.PortNumber()))
+		assert.NoError(t, smtp.SendMail(address, nil, "sender@example.com", []string{"billing@example.com"}, []byte("Subject: Invoice\r\n\r\nHello\r\n")))
+
+		assert.True(t, controller.VerifyWithin(tb, time.Second))
+		tb.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+	})
+
+	t.Run("doesn't check message of session which is active after timeout", func(t *testing.T) {
+		server, tb := newDelayedServer(t, 200*time.Millisecond), new(testingTBMock)
+		tb.On("Errorf", "%s", mock.Anything).Return()
+		controller := NewController(server)
+		controller.Expect(smtpmock.MessageFilter{To: "billing@example.com"})
+		address := net.JoinHostPort("127.0.0.1", strconv.Itoa(server.PortNumber()))
+		assert.NoError(t, smtp.SendMail(address, nil, "sender@example.com", []string{"billing@example.com"}, []byte("Subject: Invoice\r\n\r\nHello\r\n")))
+
+		assert.False(t, controller.VerifyWithin(tb, time.Millisecond))
+		assert.Equal(
+			t,
+			[]string{
+				"Active sessions were not finished within 1ms",
+				"missing message(s): expected exactly 1 message(s) to <billing@example.com>, got 0",
+			},
+			tb.failures(),
+		)
+	})
+}
+
+func TestControllerRecord(t *testing.T) {
+	t.Run("skips messages without MAIL FROM command", func(t *testing.T) {
+		controller := new(Controller)
+		controller.record(smtpmock.Message{})
+
+		assert.Empty(t, controller.violations)
+	})
+}
+
+func TestExpectationTimes(t *testing.T) {
+	t.Run("sets expected number of messages range", func(t *testing.T) {
+		controller := new(Controller)
+		expectation := controller.Expect(smtpmock.MessageFilter{})
+
+		assert.Equal(t, "exactly 1", expectation.times())
+		assert.Equal(t, "exactly 3", expectation.Times(3).times())
+		assert.Equal(t, "at least 2", expectation.AtLeast(2).times())
+		assert.Equal(t, "at most 2", expectation.AtMost(2).times())
+		assert.Equal(t, "no", expectation.Never().times())
+		assert.Equal(t, "any number of", expectation.AnyTimes().times())
+	})
+}
+
+func TestDescribeFilter(t *testing.T) {
+	t.Run("returns description of message filter criteria", func(t *testing.T) {
+		receivedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		filter := smtpmock.MessageFilter{
+			From:           "sender@example.com",
+			To:             "user@example.com",
+			Subject:        regexp.MustCompile("Invoice"),
+			Headers:        map[string]*regexp.Regexp{"X-B": regexp.MustCompile("b"), "X-A": regexp.MustCompile("a")},
+			ReceivedAfter:  receivedAt,
+			ReceivedBefore: receivedAt,
+			Consistency:    smtpmock.ConsistentMessages,
+			ResponseClass:  2,
+		}
+
+		assert.Equal(
+			t,
+			"from <sender@example.com>, to <user@example.com>, with subject matching /Invoice/, with x-a matching /a/, with x-b matching /b/, "+
+				"received after 2024-01-01 12:00:00 +0000 UTC, received before 2024-01-01 12:00:00 +0000 UTC, consistent, with 2xx response",
+			describeFilter(filter),
+		)
+	})
+
+	t.Run("when filter is not consistent", func(t *testing.T) {
+		assert.Equal(t, "not consistent", describeFilter(smtpmock.MessageFilter{Consistency: smtpmock.InconsistentMessages}))
+	})
+
+	t.Run("when filter is empty", func(t *testing.T) {
+		assert.Equal(t, "of any kind", describeFilter(smtpmock.MessageFilter{}))
+	})
+}
@@ -0,0 +1,51 @@
+package smtpmockexpect
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Testing mocks
+
+// testing.TB mock
+type testingTBMock struct {
+	testing.TB
+	mock.Mock
+}
+
+func (tb *testingTBMock) Helper() {}
+
+func (tb *testingTBMock) Errorf(format string, args ...interface{}) {
+	tb.Called(format, args)
+}
+
+// Logger mock which delays logging of QUIT response, so server stores message after client
+// has received QUIT response
+type delayedQuitLogger struct {
+	delay time.Duration
+}
+
+func (logger *delayedQuitLogger) InfoActivity(message string) {
+	if strings.HasPrefix(message, "SMTP response: 221") {
+		time.Sleep(logger.delay)
+	}
+}
+
+func (logger *delayedQuitLogger) Info(string) {}
+
+func (logger *delayedQuitLogger) Warning(string) {}
+
+func (logger *delayedQuitLogger) Error(string) {}
+
+// Returns reported failures
+func (tb *testingTBMock) failures() []string {
+	var failures []string
+	for _, call := range tb.Calls {
+		failures = append(failures, call.Arguments[1].([]interface{})[0].(string))
+	}
+
+	return failures
+}
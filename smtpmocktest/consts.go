@@ -0,0 +1,22 @@
+package smtpmocktest
+
+const (
+	// Logger
+	infoLogLevel    = "INFO"
+	warningLogLevel = "WARNING"
+	errorLogLevel   = "ERROR"
+
+	// Golden files
+	updateGoldenFlagName  = "smtpmock.update"
+	updateGoldenFlagUsage = "rewrite SMTP mock golden files with actual message snapshots"
+	snapshotName          = "snapshot"
+	maskedValue           = "<masked>"
+	boundaryPlaceholder   = "boundary-%d"
+	boundaryRegexPattern  = `(?i)\bboundary="?([^";\s]+)"?`
+	goldenDirPermissions  = 0o755
+	goldenFilePermissions = 0o644
+	diffContextLines      = 3
+
+	// Helpers
+	emptyString = ""
+)
@@ -0,0 +1,140 @@
+package smtpmocktest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Line based edit operation
+type diffOperation struct {
+	kind byte // ' ' for equal line, '-' for deleted line, '+' for inserted line
+	line string
+}
+
+// Returns unified diff between expected and actual texts with diffContextLines lines of
+// context. Returns empty string for case when texts are equal
+func unifiedDiff(expectedName, actualName, expected, actual string) string {
+	if expected == actual {
+		return emptyString
+	}
+
+	operations := diffOperations(strings.Split(expected, "\n"), strings.Split(actual, "\n"))
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- %s\n+++ %s\n", expectedName, actualName)
+
+	for start := 0; start < len(operations); {
+		if operations[start].kind == ' ' {
+			start++
+			continue
+		}
+
+		hunkStart, hunkEnd := hunkBounds(operations, start)
+		writeHunk(&diff, operations, hunkStart, hunkEnd)
+		start = hunkEnd
+	}
+
+	return diff.String()
+}
+
+// Returns edit operations which transform expected lines into actual lines, based on the
+// longest common subsequence of lines
+func diffOperations(expected, actual []string) []diffOperation {
+	expectedCount, actualCount := len(expected), len(actual)
+	lcs := make([][]int, expectedCount+1)
+	for index := range lcs {
+		lcs[index] = make([]int, actualCount+1)
+	}
+
+	for i := expectedCount - 1; i >= 0; i-- {
+		for j := actualCount - 1; j >= 0; j-- {
+			switch {
+			case expected[i] == actual[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var operations []diffOperation
+	i, j := 0, 0
+	for i < expectedCount || j < actualCount {
+		switch {
+		case i < expectedCount && j < actualCount && expected[i] == actual[j]:
+			operations = append(operations, diffOperation{' ', expected[i]})
+			i, j = i+1, j+1
+		case j == actualCount || (i < expectedCount && lcs[i+1][j] >= lcs[i][j+1]):
+			operations = append(operations, diffOperation{'-', expected[i]})
+			i++
+		default:
+			operations = append(operations, diffOperation{'+', actual[j]})
+			j++
+		}
+	}
+
+	return operations
+}
+
+// Returns bounds of hunk which starts with changed operation. Changes separated by not more
+// than two contexts of equal lines are merged into one hunk
+func hunkBounds(operations []diffOperation, changeIndex int) (int, int) {
+	lastChangeIndex := changeIndex
+	for index := changeIndex; index < len(operations) && index-lastChangeIndex <= 2*diffContextLines+1; index++ {
+		if operations[index].kind != ' ' {
+			lastChangeIndex = index
+		}
+	}
+
+	start, end := changeIndex-diffContextLines, lastChangeIndex+1+diffContextLines
+	if start < 0 {
+		start = 0
+	}
+	if end > len(operations) {
+		end = len(operations)
+	}
+
+	return start, end
+}
+
+// Writes hunk header and hunk lines
+func writeHunk(diff *strings.Builder, operations []diffOperation, start, end int) {
+	expectedStart, actualStart := 1, 1
+	for _, operation := range operations[:start] {
+		if operation.kind != '+' {
+			expectedStart++
+		}
+		if operation.kind != '-' {
+			actualStart++
+		}
+	}
+
+	expectedCount, actualCount := 0, 0
+	for _, operation := range operations[start:end] {
+		if operation.kind != '+' {
+			expectedCount++
+		}
+		if operation.kind != '-' {
+			actualCount++
+		}
+	}
+
+	fmt.Fprintf(diff, "@@ -%s +%s @@\n", hunkRange(expectedStart, expectedCount), hunkRange(actualStart, actualCount))
+	for _, operation := range operations[start:end] {
+		fmt.Fprintf(diff, "%c%s\n", operation.kind, operation.line)
+	}
+}
+
+// Returns hunk range in unified diff format. Empty range points to the line before,
+// count of single line range is omitted
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprint(start)
+	}
+
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,73 @@
+package smtpmocktest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Run("when texts are equal", func(t *testing.T) {
+		assert.Empty(t, unifiedDiff("expected", "actual", "a\nb\n", "a\nb\n"))
+	})
+
+	t.Run("returns hunks with context lines", func(t *testing.T) {
+		expected := strings.Join([]string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}, "\n")
+		actual := strings.Join([]string{"1", "two", "3", "4", "5", "6", "7", "8", "9", "10", "12", "13"}, "\n")
+
+		assert.Equal(
+			t,
+			"--- expected\n+++ actual\n"+
+				"@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n"+
+				"@@ -8,5 +8,5 @@\n 8\n 9\n 10\n-11\n 12\n+13\n",
+			unifiedDiff("expected", "actual", expected, actual),
+		)
+	})
+
+	t.Run("merges close changes into one hunk", func(t *testing.T) {
+		assert.Equal(
+			t,
+			"--- expected\n+++ actual\n@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+			unifiedDiff("expected", "actual", "1\n2\n3\n4\n5\n6\n7\n8", "one\n2\n3\n4\n5\n6\n7\neight"),
+		)
+	})
+
+	t.Run("when expected text is empty", func(t *testing.T) {
+		assert.Equal(t, "--- expected\n+++ actual\n@@ -1 +1,2 @@\n-\n+a\n+b\n", unifiedDiff("expected", "actual", "", "a\nb"))
+	})
+}
+
+func TestDiffOperations(t *testing.T) {
+	t.Run("returns edit operations based on the longest common subsequence", func(t *testing.T) {
+		assert.Equal(
+			t,
+			[]diffOperation{{'-', "a"}, {' ', "b"}, {'+', "x"}, {' ', "c"}, {'-', "d"}},
+			diffOperations([]string{"a", "b", "c", "d"}, []string{"b", "x", "c"}),
+		)
+	})
+}
+
+func TestHunkBounds(t *testing.T) {
+	t.Run("returns bounds with context lines", func(t *testing.T) {
+		operations := []diffOperation{{' ', "1"}, {' ', "2"}, {' ', "3"}, {' ', "4"}, {'-', "5"}, {' ', "6"}}
+		start, end := hunkBounds(operations, 4)
+
+		assert.Equal(t, 1, start)
+		assert.Equal(t, 6, end)
+	})
+}
+
+func TestHunkRange(t *testing.T) {
+	t.Run("returns hunk range", func(t *testing.T) {
+		assert.Equal(t, "3,2", hunkRange(3, 2))
+	})
+
+	t.Run("when range has single line", func(t *testing.T) {
+		assert.Equal(t, "3", hunkRange(3, 1))
+	})
+
+	t.Run("when range is empty", func(t *testing.T) {
+		assert.Equal(t, "2,0", hunkRange(3, 0))
+	})
+}
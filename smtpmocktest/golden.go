@@ -0,0 +1,131 @@
+package smtpmocktest
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	smtpmock "github.com/mocktools/go-smtp-mock/v2"
+)
+
+// Rewrites golden files instead of comparing when test binary runs with -smtpmock.update flag
+var updateGoldenFiles = flag.Bool(updateGoldenFlagName, false, updateGoldenFlagUsage)
+
+// MaskRule replaces volatile parts of message snapshot, such as dates or generated tokens,
+// with stable placeholders
+type MaskRule func(string) string
+
+// MaskRegex builds mask rule which replaces all regex pattern matches with the given
+// replacement. Replacement supports regexp.Regexp.ReplaceAllString expansion syntax
+func MaskRegex(regexPattern, replacement string) MaskRule {
+	regex := regexp.MustCompile(regexPattern)
+
+	return func(snapshot string) string {
+		return regex.ReplaceAllString(snapshot, replacement)
+	}
+}
+
+// MaskHeader builds mask rule which replaces value of all header fields with the given name,
+// including folded lines, with placeholder. Header name is case-insensitive
+func MaskHeader(name string) MaskRule {
+	return MaskRegex(`(?im)^(`+regexp.QuoteMeta(name)+`:)[^\n]*(?:\n[ \t][^\n]*)*`, "${1} "+maskedValue)
+}
+
+// MaskBoundaries builds mask rule which replaces MIME boundaries with numbered placeholders
+// in order of appearance, so nested multiparts stay distinguishable
+func MaskBoundaries() MaskRule {
+	regex := regexp.MustCompile(boundaryRegexPattern)
+
+	return func(snapshot string) string {
+		var boundaries []string
+		placeholders := make(map[string]string)
+		for _, match := range regex.FindAllStringSubmatch(snapshot, -1) {
+			if _, ok := placeholders[match[1]]; !ok {
+				placeholders[match[1]] = fmt.Sprintf(boundaryPlaceholder, len(boundaries)+1)
+				boundaries = append(boundaries, match[1])
+			}
+		}
+
+		// Longer boundaries go first, because boundary can be substring of other one
+		sort.SliceStable(boundaries, func(i, j int) bool { return len(boundaries[i]) > len(boundaries[j]) })
+		for _, boundary := range boundaries {
+			snapshot = strings.ReplaceAll(snapshot, boundary, placeholders[boundary])
+		}
+
+		return snapshot
+	}
+}
+
+// DefaultMaskRules returns mask rules which are used for case when no rules are passed:
+// Date, Message-ID and Received headers and MIME boundaries
+func DefaultMaskRules() []MaskRule {
+	return []MaskRule{MaskHeader("Date"), MaskHeader("Message-ID"), MaskHeader("Received"), MaskBoundaries()}
+}
+
+// Snapshot returns message body with LF line endings, masked by the given rules.
+// Uses DefaultMaskRules for case when no rules are passed
+func Snapshot(message smtpmock.Message, rules ...MaskRule) string {
+	if len(rules) == 0 {
+		rules = DefaultMaskRules()
+	}
+
+	snapshot := strings.ReplaceAll(message.MsgRequest(), "\r\n", "\n")
+	for _, rule := range rules {
+		snapshot = rule(snapshot)
+	}
+
+	return snapshot
+}
+
+// AssertGolden compares message snapshot with golden file content. Reports unified diff to
+// tb for case when they are different. Rewrites golden file with snapshot instead of comparing
+// for case when test binary runs with -smtpmock.update flag. Uses DefaultMaskRules for case
+// when no rules are passed, use append(DefaultMaskRules(), rules...) to extend defaults.
+// Returns true for case when assertion passed, otherwise returns false
+func AssertGolden(tb testing.TB, message smtpmock.Message, goldenPath string, rules ...MaskRule) bool {
+	tb.Helper()
+
+	return assertGolden(tb, Snapshot(message, rules...), goldenPath, *updateGoldenFiles)
+}
+
+// Compares or rewrites golden file
+func assertGolden(tb testing.TB, snapshot, goldenPath string, update bool) bool {
+	tb.Helper()
+
+	if update {
+		if err := writeGoldenFile(goldenPath, snapshot); err != nil {
+			tb.Errorf("unable to update golden file %s: %s", goldenPath, err)
+			return false
+		}
+
+		return true
+	}
+
+	golden, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		tb.Errorf("unable to read golden file %s, run test with -%s flag to create it: %s", goldenPath, updateGoldenFlagName, err)
+		return false
+	}
+
+	if diff := unifiedDiff(goldenPath, snapshotName, string(golden), snapshot); diff != emptyString {
+		tb.Errorf("message doesn't match golden file %s, run test with -%s flag to update it:\n%s", goldenPath, updateGoldenFlagName, diff)
+		return false
+	}
+
+	return true
+}
+
+// Writes golden file, creates missing directories
+func writeGoldenFile(goldenPath, snapshot string) error {
+	if err := os.MkdirAll(filepath.Dir(goldenPath), goldenDirPermissions); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(goldenPath, []byte(snapshot), goldenFilePermissions)
+}
@@ -0,0 +1,173 @@
+package smtpmocktest
+
+import (
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	smtpmock "github.com/mocktools/go-smtp-mock/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Multipart message with volatile Date, Message-ID and MIME boundaries
+const goldenMessageBody = "Date: Mon, 1 Jan 2024 12:00:00 +0000\r\n" +
+	"Message-ID: <1704110400.42@example.com>\r\n" +
+	"Subject: Reset password\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"b1_abc\"\r\n" +
+	"\r\n" +
+	"--b1_abc\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"https://example.com/reset?token=a1b2c3\r\n" +
+	"--b1_abc--\r\n"
+
+// Returns message captured by SMTP mock server
+func capturedMessage(t *testing.T, body string) smtpmock.Message {
+	server := NewServer(t, smtpmock.ConfigurationAttr{})
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(server.PortNumber()))
+
+	assert.NoError(t, smtp.SendMail(address, nil, "sender@example.com", []string{"user@example.com"}, []byte(body)))
+	messages, err := server.WaitForMessages(1, time.Second)
+	assert.NoError(t, err)
+
+	return messages[0]
+}
+
+func TestMaskRegex(t *testing.T) {
+	t.Run("replaces all regex pattern matches", func(t *testing.T) {
+		assert.Equal(t, "token=<token> token=<token>", MaskRegex(`token=\w+`, "token=<token>")("token=a1 token=b2"))
+	})
+
+	t.Run("supports replacement expansion", func(t *testing.T) {
+		assert.Equal(t, "code: ***", MaskRegex(`(code:) \d+`, "${1} ***")("code: 123456"))
+	})
+}
+
+func TestMaskHeader(t *testing.T) {
+	t.Run("replaces header value including folded lines", func(t *testing.T) {
+		snapshot := "received: from a\n\tby b;\n\tdate\nSubject: Hello\n"
+
+		assert.Equal(t, "received: <masked>\nSubject: Hello\n", MaskHeader("Received")(snapshot))
+	})
+
+	t.Run("quotes header name", func(t *testing.T) {
+		assert.Equal(t, "X.Y: a\n", MaskHeader("X+Y")("X.Y: a\n"))
+	})
+}
+
+func TestMaskBoundaries(t *testing.T) {
+	t.Run("replaces boundaries with numbered placeholders in order of appearance", func(t *testing.T) {
+		snapshot := "Content-Type: multipart/mixed; boundary=\"outer\"\n\n" +
+			"--outer\nContent-Type: multipart/alternative; BOUNDARY=outer2\n\n--outer2\n--outer2--\n--outer--\n"
+
+		assert.Equal(
+			t,
+			"Content-Type: multipart/mixed; boundary=\"boundary-1\"\n\n"+
+				"--boundary-1\nContent-Type: multipart/alternative; BOUNDARY=boundary-2\n\n--boundary-2\n--boundary-2--\n--boundary-1--\n",
+			MaskBoundaries()(snapshot),
+		)
+	})
+
+	t.Run("when there are no boundaries", func(t *testing.T) {
+		assert.Equal(t, "Subject: Hello\n", MaskBoundaries()("Subject: Hello\n"))
+	})
+}
+
+func TestDefaultMaskRules(t *testing.T) {
+	t.Run("returns default mask rules", func(t *testing.T) {
+		assert.Len(t, DefaultMaskRules(), 4)
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	message := capturedMessage(t, goldenMessageBody)
+
+	t.Run("when no rules are passed", func(t *testing.T) {
+		assert.Equal(
+			t,
+			"Date: <masked>\n"+
+				"Message-ID: <masked>\n"+
+				"Subject: Reset password\n"+
+				"Content-Type: multipart/alternative; boundary=\"boundary-1\"\n"+
+				"\n"+
+				"--boundary-1\n"+
+				"Content-Type: text/plain\n"+
+				"\n"+
+				"https://example.com/reset?token=a1b2c3\n"+
+				"--boundary-1--\n",
+			Snapshot(message),
+		)
+	})
+
+	t.Run("when rules are passed", func(t *testing.T) {
+		assert.Equal(
+			t,
+			"Subject: Reset password\n",
+			Snapshot(capturedMessage(t, "Date: today\r\nSubject: Reset password\r\n"), MaskRegex(`Date: \w+\n`, "")),
+		)
+	})
+}
+
+func TestAssertGolden(t *testing.T) {
+	t.Run("when message matches golden file", func(t *testing.T) {
+		tb := new(testingTBMock)
+		message := capturedMessage(t, goldenMessageBody)
+
+		assert.True(t, AssertGolden(tb, message, filepath.Join("testdata", "message.golden"), append(DefaultMaskRules(), MaskRegex(`token=\w+`, "token=<token>"))...))
+		tb.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAssertGoldenWithUpdate(t *testing.T) {
+	t.Run("when golden file is updated", func(t *testing.T) {
+		tb, goldenPath := new(testingTBMock), filepath.Join(t.TempDir(), "golden", "message.golden")
+
+		assert.True(t, assertGolden(tb, "snapshot\n", goldenPath, true))
+		golden, err := ioutil.ReadFile(goldenPath)
+		assert.NoError(t, err)
+		assert.Equal(t, "snapshot\n", string(golden))
+		tb.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+	})
+
+	t.Run("when golden file can't be updated", func(t *testing.T) {
+		tb, goldenPath := new(testingTBMock), filepath.Join(t.TempDir(), "file")
+		assert.NoError(t, ioutil.WriteFile(goldenPath, nil, goldenFilePermissions))
+		tb.On("Errorf", "unable to update golden file %s: %s", mock.Anything).Once().Return()
+
+		assert.False(t, assertGolden(tb, "snapshot\n", filepath.Join(goldenPath, "message.golden"), true))
+		tb.AssertExpectations(t)
+	})
+
+	t.Run("when golden file can't be written", func(t *testing.T) {
+		tb, goldenPath := new(testingTBMock), t.TempDir()
+		tb.On("Errorf", "unable to update golden file %s: %s", mock.Anything).Once().Return()
+
+		assert.False(t, assertGolden(tb, "snapshot\n", goldenPath, true))
+		tb.AssertExpectations(t)
+	})
+}
+
+func TestAssertGoldenWithoutUpdate(t *testing.T) {
+	t.Run("when golden file doesn't exist", func(t *testing.T) {
+		tb, goldenPath := new(testingTBMock), filepath.Join(t.TempDir(), "message.golden")
+		tb.On("Errorf", "unable to read golden file %s, run test with -%s flag to create it: %s", mock.Anything).Once().Return()
+
+		assert.False(t, assertGolden(tb, "snapshot\n", goldenPath, false))
+		tb.AssertExpectations(t)
+	})
+
+	t.Run("when snapshot doesn't match golden file", func(t *testing.T) {
+		tb, goldenPath := new(testingTBMock), filepath.Join(t.TempDir(), "message.golden")
+		assert.NoError(t, ioutil.WriteFile(goldenPath, []byte("Subject: Hello\n"), goldenFilePermissions))
+		diff := "--- " + goldenPath + "\n+++ snapshot\n@@ -1,2 +1,2 @@\n-Subject: Hello\n+Subject: Goodbye\n \n"
+		tb.On("Errorf", "message doesn't match golden file %s, run test with -%s flag to update it:\n%s", []interface{}{goldenPath, updateGoldenFlagName, diff}).Once().Return()
+
+		assert.False(t, assertGolden(tb, "Subject: Goodbye\n", goldenPath, false))
+		tb.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,87 @@
+// Package smtpmocktest provides helpers for using SMTP mock server inside of Go tests
+package smtpmocktest
+
+import (
+	"sync"
+	"testing"
+
+	smtpmock "github.com/mocktools/go-smtp-mock/v2"
+)
+
+// NewServer builds and starts SMTP mock server based on passed configuration attributes.
+// Server runs on random free port unless PortNumber is specified. Server log is routed
+// to tb.Log, server is stopped automatically when test and all its subtests complete,
+// unless test has stopped it itself. Fails the test for case when configuration attributes
+// are invalid or server can't be started
+func NewServer(tb testing.TB, config smtpmock.ConfigurationAttr) *smtpmock.Server {
+	tb.Helper()
+
+	server, err := smtpmock.Build(config)
+	if err != nil {
+		tb.Fatalf("unable to build SMTP mock server: %s", err)
+	}
+
+	logger := NewLogger(tb)
+	server.WithLogger(logger)
+	if err := server.Start(); err != nil {
+		tb.Fatalf("unable to start SMTP mock server: %s", err)
+	}
+
+	tb.Cleanup(func() {
+		// Stop returns error only for case when server is already stopped by test
+		_ = server.Stop()
+		logger.Disable()
+	})
+
+	return server
+}
+
+// Logger is the smtpmock.Logger implementation which writes server log to test log
+type Logger struct {
+	tb       testing.TB
+	disabled bool
+	sync.Mutex
+}
+
+// NewLogger builds new logger which writes to the given test log
+func NewLogger(tb testing.TB) *Logger {
+	return &Logger{tb: tb}
+}
+
+// InfoActivity writes server activity message with INFO log level
+func (logger *Logger) InfoActivity(message string) {
+	logger.log(infoLogLevel, message)
+}
+
+// Info writes message with INFO log level
+func (logger *Logger) Info(message string) {
+	logger.log(infoLogLevel, message)
+}
+
+// Warning writes message with WARNING log level
+func (logger *Logger) Warning(message string) {
+	logger.log(warningLogLevel, message)
+}
+
+// Error writes message with ERROR log level
+func (logger *Logger) Error(message string) {
+	logger.log(errorLogLevel, message)
+}
+
+// Disable suppresses all further messages. Should be called before test completion,
+// because writing to test log after test completion leads to panic
+func (logger *Logger) Disable() {
+	logger.Lock()
+	defer logger.Unlock()
+	logger.disabled = true
+}
+
+// Thread-safe writer of message to test log. Skips message for case when logger is disabled
+func (logger *Logger) log(logLevel, message string) {
+	logger.Lock()
+	defer logger.Unlock()
+
+	if !logger.disabled {
+		logger.tb.Logf("%s: %s", logLevel, message)
+	}
+}
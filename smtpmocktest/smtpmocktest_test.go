@@ -0,0 +1,122 @@
+package smtpmocktest
+
+import (
+	"errors"
+	"net"
+	"net/smtp"
+	"strconv"
+	"testing"
+
+	smtpmock "github.com/mocktools/go-smtp-mock/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNewServer(t *testing.T) {
+	t.Run("returns started server which is stopped on test cleanup", func(t *testing.T) {
+		var server *smtpmock.Server
+
+		t.Run("runs server", func(t *testing.T) {
+			server = NewServer(t, smtpmock.ConfigurationAttr{LogToStdout: true, LogServerActivity: true})
+			client, err := smtp.Dial(net.JoinHostPort("127.0.0.1", strconv.Itoa(server.PortNumber())))
+
+			assert.NoError(t, err)
+			assert.NoError(t, client.Hello("example.com"))
+			assert.NoError(t, client.Quit())
+		})
+
+		assert.Len(t, server.Messages(), 1)
+		assert.Error(t, server.Stop())
+	})
+
+	t.Run("routes server log to test log", func(t *testing.T) {
+		tb := new(testingTBMock)
+		tb.On("Logf", "%s: %s", mock.Anything).Return()
+		server := NewServer(tb, smtpmock.ConfigurationAttr{})
+		tb.runCleanups()
+
+		tb.AssertCalled(t, "Logf", "%s: %s", []interface{}{infoLogLevel, "SMTP mock server started on port: " + strconv.Itoa(server.PortNumber())})
+	})
+
+	t.Run("when configuration attributes are invalid", func(t *testing.T) {
+		tb, done := new(testingTBMock), make(chan interface{})
+		tb.On("Fatalf", "unable to build SMTP mock server: %s", []interface{}{errors.New(`Unknown jitter distribution: "poisson"`)}).Once().Return()
+		go func() {
+			defer close(done)
+			NewServer(tb, smtpmock.ConfigurationAttr{JitterDistribution: "poisson"})
+		}()
+		<-done
+
+		tb.AssertExpectations(t)
+		assert.Empty(t, tb.cleanups)
+	})
+
+	t.Run("when server can't be started", func(t *testing.T) {
+		tb, done := new(testingTBMock), make(chan interface{})
+		tb.On("Logf", "%s: %s", mock.Anything).Return()
+		tb.On("Fatalf", "unable to start SMTP mock server: %s", []interface{}{errors.New("Failed to start SMTP mock server on port: 0")}).Once().Return()
+		go func() {
+			defer close(done)
+			NewServer(tb, smtpmock.ConfigurationAttr{HostAddress: "a"})
+		}()
+		<-done
+
+		tb.AssertExpectations(t)
+		assert.Empty(t, tb.cleanups)
+	})
+
+	t.Run("when server is stopped by test", func(t *testing.T) {
+		tb := new(testingTBMock)
+		tb.On("Logf", "%s: %s", mock.Anything).Return()
+		assert.NoError(t, NewServer(tb, smtpmock.ConfigurationAttr{}).Stop())
+		tb.runCleanups()
+
+		tb.AssertExpectations(t)
+		tb.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+	})
+
+	t.Run("when server is stopped by test, real test passes", func(t *testing.T) {
+		var server *smtpmock.Server
+
+		t.Run("stops server", func(t *testing.T) {
+			server = NewServer(t, smtpmock.ConfigurationAttr{})
+
+			assert.NoError(t, server.Stop())
+		})
+
+		assert.Error(t, server.Stop())
+	})
+}
+
+func TestNewLogger(t *testing.T) {
+	t.Run("returns new logger", func(t *testing.T) {
+		assert.Equal(t, &Logger{tb: t}, NewLogger(t))
+	})
+}
+
+func TestLogger(t *testing.T) {
+	t.Run("writes messages with log levels to test log", func(t *testing.T) {
+		tb := new(testingTBMock)
+		logger := NewLogger(tb)
+		for _, logLevel := range []string{infoLogLevel, warningLogLevel, errorLogLevel} {
+			tb.On("Logf", "%s: %s", []interface{}{logLevel, "message"}).Return()
+		}
+		tb.On("Logf", "%s: %s", []interface{}{infoLogLevel, "activity"}).Return()
+		logger.InfoActivity("activity")
+		logger.Info("message")
+		logger.Warning("message")
+		logger.Error("message")
+
+		tb.AssertNumberOfCalls(t, "Logf", 4)
+	})
+
+	t.Run("when logger is disabled", func(t *testing.T) {
+		tb := new(testingTBMock)
+		logger := NewLogger(tb)
+		logger.Disable()
+		logger.Info("message")
+
+		assert.True(t, logger.disabled)
+		tb.AssertNotCalled(t, "Logf", mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,44 @@
+package smtpmocktest
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Testing mocks
+
+// testing.TB mock
+type testingTBMock struct {
+	testing.TB
+	mock.Mock
+	cleanups []func()
+}
+
+func (tb *testingTBMock) Helper() {}
+
+func (tb *testingTBMock) Logf(format string, args ...interface{}) {
+	tb.Called(format, args)
+}
+
+func (tb *testingTBMock) Errorf(format string, args ...interface{}) {
+	tb.Called(format, args)
+}
+
+// Stops calling goroutine the same way as testing.T does
+func (tb *testingTBMock) Fatalf(format string, args ...interface{}) {
+	tb.Called(format, args)
+	runtime.Goexit()
+}
+
+func (tb *testingTBMock) Cleanup(cleanup func()) {
+	tb.cleanups = append(tb.cleanups, cleanup)
+}
+
+// Runs registered cleanup functions in last added, first called order
+func (tb *testingTBMock) runCleanups() {
+	for index := len(tb.cleanups) - 1; index >= 0; index-- {
+		tb.cleanups[index]()
+	}
+}
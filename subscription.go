@@ -0,0 +1,51 @@
+package smtpmock
+
+import "sync"
+
+// Subscription is the push subscription to messages stored by server. Each stored message
+// is delivered to subscription until it is unsubscribed
+type Subscription struct {
+	messages *messages
+	callback func(Message)
+	done     chan interface{}
+	pending  sync.WaitGroup
+	once     sync.Once
+}
+
+// Subscription builder. Returns pointer to new active subscription
+func newSubscription(messages *messages, callback func(Message)) *Subscription {
+	return &Subscription{messages: messages, callback: callback, done: make(chan interface{})}
+}
+
+// subscription methods
+
+// Unsubscribe cancels subscription, messages stored after that are not delivered. Waits until
+// delivery of messages stored before is completed, so all of them are seen by subscriber when
+// Unsubscribe returns. Pending channel delivery is dropped instead of waiting for receiver.
+// Should not be called from subscription callback. It is safe to call Unsubscribe multiple times
+func (subscription *Subscription) Unsubscribe() {
+	subscription.once.Do(func() {
+		close(subscription.done)
+		subscription.messages.unsubscribe(subscription)
+	})
+
+	subscription.pending.Wait()
+}
+
+// Delivers message to subscriber, completes pending delivery which was added when message
+// was stored
+func (subscription *Subscription) deliver(message Message) {
+	defer subscription.pending.Done()
+	subscription.callback(message)
+}
+
+// Returns callback which sends message to the given channel. Sending blocks until message
+// is received or subscription is cancelled
+func (subscription *Subscription) sendTo(channel chan<- Message) func(Message) {
+	return func(message Message) {
+		select {
+		case channel <- message:
+		case <-subscription.done:
+		}
+	}
+}
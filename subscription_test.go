@@ -0,0 +1,93 @@
+package smtpmock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSubscription(t *testing.T) {
+	t.Run("creates new active subscription", func(t *testing.T) {
+		messages := new(messages)
+		subscription := newSubscription(messages, func(Message) {})
+
+		assert.Same(t, messages, subscription.messages)
+		assert.NotNil(t, subscription.callback)
+		assert.NotNil(t, subscription.done)
+	})
+}
+
+func TestSubscriptionUnsubscribe(t *testing.T) {
+	t.Run("cancels subscription and removes it from messages", func(t *testing.T) {
+		messages := new(messages)
+		subscription := messages.subscribe(newSubscription(messages, func(Message) {}))
+		subscription.Unsubscribe()
+
+		assert.Empty(t, messages.subscriptions)
+		_, active := <-subscription.done
+		assert.False(t, active)
+	})
+
+	t.Run("waits for delivery of messages stored before", func(t *testing.T) {
+		messages, delivering, delivered := new(messages), make(chan interface{}), false
+		subscription := messages.subscribe(newSubscription(messages, func(Message) {
+			close(delivering)
+			time.Sleep(time.Millisecond)
+			delivered = true
+		}))
+		go messages.append(new(Message))
+		<-delivering
+		subscription.Unsubscribe()
+
+		assert.True(t, delivered)
+	})
+
+	t.Run("when subscription is cancelled multiple times", func(t *testing.T) {
+		messages := new(messages)
+		subscription := messages.subscribe(newSubscription(messages, func(Message) {}))
+
+		assert.NotPanics(t, func() {
+			subscription.Unsubscribe()
+			subscription.Unsubscribe()
+		})
+	})
+}
+
+func TestSubscriptionDeliver(t *testing.T) {
+	t.Run("delivers message to subscriber, completes pending delivery", func(t *testing.T) {
+		var deliveredMessages []Message
+		message := Message{heloRequest: "some context"}
+		subscription := newSubscription(new(messages), func(message Message) {
+			deliveredMessages = append(deliveredMessages, message)
+		})
+		subscription.pending.Add(1)
+		subscription.deliver(message)
+		subscription.pending.Wait()
+
+		assert.Equal(t, []Message{message}, deliveredMessages)
+	})
+}
+
+func TestSubscriptionSendTo(t *testing.T) {
+	message := Message{heloRequest: "some context"}
+
+	t.Run("sends message to channel", func(t *testing.T) {
+		channel, subscription := make(chan Message, 1), newSubscription(new(messages), nil)
+		subscription.sendTo(channel)(message)
+
+		assert.Equal(t, message, <-channel)
+	})
+
+	t.Run("when subscription is cancelled during blocked sending", func(t *testing.T) {
+		channel, subscription, done := make(chan Message), newSubscription(new(messages), nil), make(chan interface{})
+		go func() {
+			defer close(done)
+			subscription.sendTo(channel)(message)
+		}()
+		subscription.Unsubscribe()
+		<-done
+
+		assert.Empty(t, channel)
+	})
+}
@@ -1,7 +1,10 @@
 package smtpmock
 
 import (
+	"bytes"
 	"io"
+	"io/ioutil"
+	"mime"
 	"net"
 	"net/smtp"
 	"regexp"
@@ -20,6 +23,37 @@ func createConfiguration() *configuration {
 	return newConfiguration(ConfigurationAttr{})
 }
 
+// Returns context of S/MIME or OpenPGP test fixture
+func securityFixture(name string) string {
+	data, _ := ioutil.ReadFile("testdata/security/" + name)
+	return string(data)
+}
+
+// Creates security key ring with test CA certificate, S/MIME private key and OpenPGP secret keys
+func createSecurityKeyRing() *securityKeyRing {
+	keyRing, _ := newSecurityKeyRing(securityFixture("smime_ca.crt"), securityFixture("smime_user.key"), securityFixture("pgp_secret.asc"))
+	return keyRing
+}
+
+// Creates security key ring without certificates and keys
+func createEmptySecurityKeyRing() *securityKeyRing {
+	keyRing, _ := newSecurityKeyRing(emptyString, emptyString, emptyString)
+	return keyRing
+}
+
+// Returns S/MIME fixture signed content and DER encoded PKCS #7 data. Signed content is nil
+// for case when fixture is not multipart/signed message
+func smimeFixturePKCS7(name string) ([]byte, []byte) {
+	header, body, _ := splitEntity([]byte(securityFixture(name)))
+	if _, params, _ := mime.ParseMediaType(header.Get("Content-Type")); params["boundary"] != emptyString {
+		content, signature, _ := splitMultipartSigned(body, params["boundary"])
+		return content, signature
+	}
+
+	data, _ := ioutil.ReadAll(transferDecoder(header.Get("Content-Transfer-Encoding"), bytes.NewReader(body)))
+	return nil, data
+}
+
 // Creates not empty message
 func createNotEmptyMessage() *Message {
 	return &Message{
@@ -31,6 +65,7 @@ func createNotEmptyMessage() *Message {
 		dataRequest:           "c",
 		dataResponse:          "d",
 		msgRequest:            "a",
+		msgRawRequest:         "a",
 		msgResponse:           "b",
 		rsetRequest:           "a",
 		rsetResponse:          "b",
@@ -69,6 +69,16 @@ func (connection netConnectionMock) Close() error {
 	return args.Error(0)
 }
 
+// net.TCPConn mock
+type tcpConnectionMock struct {
+	netConnectionMock
+}
+
+func (connection *tcpConnectionMock) SetLinger(sec int) error {
+	args := connection.Called(sec)
+	return args.Error(0)
+}
+
 // bufio.Reader mock
 type bufioReaderMock struct {
 	mock.Mock
@@ -144,7 +154,7 @@ func (session *sessionMock) readRequest() (string, error) {
 	return args.String(0), args.Error(1)
 }
 
-func (session *sessionMock) writeResponse(response string, responseDelay int) {
+func (session *sessionMock) writeResponse(response string, responseDelay time.Duration) {
 	session.Called(response, responseDelay)
 }
 
@@ -170,6 +180,24 @@ func (session *sessionMock) isErrorFound() bool {
 	return args.Bool(0)
 }
 
+func (session *sessionMock) remoteAddress() string {
+	args := session.Called()
+	return args.String(0)
+}
+
+func (session *sessionMock) logWarning(message string) {
+	session.Called(message)
+}
+
+func (session *sessionMock) transcript(sessionID int, closeReason SessionCloseReason) Transcript {
+	args := session.Called(sessionID, closeReason)
+	return args.Get(0).(Transcript)
+}
+
+func (session *sessionMock) injectFault(fault *fault) {
+	session.Called(fault)
+}
+
 func (session *sessionMock) finish() {
 	session.Called()
 }
@@ -0,0 +1,127 @@
+package smtpmock
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TranscriptDirection is the direction of SMTP session transcript line
+type TranscriptDirection string
+
+// Available SMTP session transcript line directions
+const (
+	ClientRequest  TranscriptDirection = "C" // line received from client
+	ServerResponse TranscriptDirection = "S" // line sent by server
+)
+
+// SessionCloseReason describes why SMTP session was finished
+type SessionCloseReason string
+
+// Available SMTP session close reasons
+const (
+	SessionClosedByQuit      SessionCloseReason = "quit"       // client sent QUIT command
+	SessionClosedByShutdown  SessionCloseReason = "shutdown"   // server was stopped
+	SessionClosedByFailFast  SessionCloseReason = "fail fast"  // command failed with enabled IsCmdFailFast
+	SessionClosedByReadError SessionCloseReason = "read error" // client disconnected, session timeout, etc.
+	SessionClosedByLimit     SessionCloseReason = "limit"      // session was refused by sessions limit
+	SessionClosedByFault     SessionCloseReason = "fault"      // connection was closed by injected fault
+	SessionClosedByScenario  SessionCloseReason = "scenario"   // scenario step ended session
+	SessionClosedByHandler   SessionCloseReason = "handler"    // custom command handler or middleware ended session
+)
+
+// TranscriptEntry is the single line of SMTP session transcript
+type TranscriptEntry struct {
+	Direction TranscriptDirection
+	Line      string
+	Time      time.Time
+}
+
+// Transcript is the full record of SMTP client-server session: every request and response
+// line including greeting, NOOPs and invalid commands. Messages received during session
+// have the same SessionID, see Message.SessionID()
+type Transcript struct {
+	SessionID     int
+	RemoteAddress string
+	StartedAt     time.Time
+	FinishedAt    time.Time
+	CloseReason   SessionCloseReason
+	CloseError    error // session error for fail fast and read error close reasons
+	Entries       []TranscriptEntry
+}
+
+// String returns transcript lines prefixed with direction, e.g. "C: EHLO example.com"
+func (transcript Transcript) String() string {
+	lines := make([]string, 0, len(transcript.Entries))
+	for _, entry := range transcript.Entries {
+		lines = append(lines, fmt.Sprintf("%s: %s", entry.Direction, entry.Line))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Concurrent type that can be safely shared between goroutines. Index keeps position of
+// transcript in items by session identifier
+type transcripts struct {
+	sync.RWMutex
+	items         []Transcript
+	index         map[int]int
+	lastSessionID int
+}
+
+// transcripts methods
+
+// Returns new unique session identifier
+func (transcripts *transcripts) nextSessionID() int {
+	transcripts.Lock()
+	defer transcripts.Unlock()
+	transcripts.lastSessionID++
+
+	return transcripts.lastSessionID
+}
+
+// Adds new transcript into concurrent transcripts slice
+func (transcripts *transcripts) append(transcript Transcript) {
+	transcripts.Lock()
+	defer transcripts.Unlock()
+	if transcripts.index == nil {
+		transcripts.index = make(map[int]int)
+	}
+
+	transcripts.index[transcript.SessionID] = len(transcripts.items)
+	transcripts.items = append(transcripts.items, transcript)
+}
+
+// Returns a copy of all transcripts
+func (transcripts *transcripts) copy() []Transcript {
+	transcripts.RLock()
+	defer transcripts.RUnlock()
+
+	return append([]Transcript{}, transcripts.items...)
+}
+
+// Returns a copy of all transcripts and removes them. Session identifiers are not reset
+func (transcripts *transcripts) purge() []Transcript {
+	transcripts.Lock()
+	defer transcripts.Unlock()
+
+	copiedTranscripts := append([]Transcript{}, transcripts.items...)
+	transcripts.items, transcripts.index = nil, nil
+
+	return copiedTranscripts
+}
+
+// Returns transcript with the given session identifier and true. Returns zero transcript and
+// false for case when transcript not found
+func (transcripts *transcripts) find(sessionID int) (Transcript, bool) {
+	transcripts.RLock()
+	defer transcripts.RUnlock()
+
+	position, found := transcripts.index[sessionID]
+	if !found {
+		return Transcript{}, false
+	}
+
+	return transcripts.items[position], true
+}
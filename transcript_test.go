@@ -0,0 +1,103 @@
+package smtpmock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscriptString(t *testing.T) {
+	t.Run("returns transcript lines prefixed with direction", func(t *testing.T) {
+		transcript := Transcript{
+			Entries: []TranscriptEntry{
+				{Direction: ServerResponse, Line: defaultGreetingMsg},
+				{Direction: ClientRequest, Line: "EHLO example.com"},
+			},
+		}
+
+		assert.Equal(t, "S: 220 Welcome\nC: EHLO example.com", transcript.String())
+	})
+
+	t.Run("when transcript has no entries", func(t *testing.T) {
+		assert.Empty(t, Transcript{}.String())
+	})
+}
+
+func TestTranscriptsNextSessionID(t *testing.T) {
+	t.Run("returns new unique session identifier", func(t *testing.T) {
+		transcripts := new(transcripts)
+
+		assert.Equal(t, 1, transcripts.nextSessionID())
+		assert.Equal(t, 2, transcripts.nextSessionID())
+	})
+}
+
+func TestTranscriptsAppend(t *testing.T) {
+	t.Run("adds transcript into items slice", func(t *testing.T) {
+		transcripts, transcript := new(transcripts), Transcript{SessionID: 1}
+		transcripts.append(transcript)
+
+		assert.Equal(t, []Transcript{transcript}, transcripts.items)
+		assert.Equal(t, map[int]int{1: 0}, transcripts.index)
+	})
+}
+
+func TestTranscriptsCopy(t *testing.T) {
+	t.Run("copies transcripts", func(t *testing.T) {
+		transcripts := new(transcripts)
+		transcripts.append(Transcript{SessionID: 1})
+		copiedTranscripts := transcripts.copy()
+		copiedTranscripts[0].SessionID = 2
+
+		assert.Equal(t, 1, transcripts.items[0].SessionID)
+	})
+
+	t.Run("when there are no transcripts", func(t *testing.T) {
+		assert.Equal(t, []Transcript{}, new(transcripts).copy())
+	})
+}
+
+func TestTranscriptsPurge(t *testing.T) {
+	t.Run("returns copy of transcripts and removes them", func(t *testing.T) {
+		transcripts, transcript := new(transcripts), Transcript{SessionID: 1}
+		transcripts.append(transcript)
+		_ = transcripts.nextSessionID()
+
+		assert.Equal(t, []Transcript{transcript}, transcripts.purge())
+		assert.Empty(t, transcripts.items)
+		assert.Empty(t, transcripts.index)
+		assert.Equal(t, 2, transcripts.nextSessionID())
+	})
+
+	t.Run("when there are no transcripts", func(t *testing.T) {
+		assert.Equal(t, []Transcript{}, new(transcripts).purge())
+	})
+}
+
+func TestTranscriptsFind(t *testing.T) {
+	transcripts, transcript := new(transcripts), Transcript{SessionID: 2}
+	transcripts.append(Transcript{SessionID: 1})
+	transcripts.append(transcript)
+
+	t.Run("when transcript found", func(t *testing.T) {
+		foundTranscript, found := transcripts.find(2)
+
+		assert.True(t, found)
+		assert.Equal(t, transcript, foundTranscript)
+	})
+
+	t.Run("when transcript not found", func(t *testing.T) {
+		foundTranscript, found := transcripts.find(3)
+
+		assert.False(t, found)
+		assert.Equal(t, Transcript{}, foundTranscript)
+	})
+
+	t.Run("when transcripts are purged", func(t *testing.T) {
+		transcripts.purge()
+		foundTranscript, found := transcripts.find(2)
+
+		assert.False(t, found)
+		assert.Equal(t, Transcript{}, foundTranscript)
+	})
+}